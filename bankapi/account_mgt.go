@@ -1,104 +1,267 @@
 package main
 
 import (
-	"database/sql"
+	"errors"
 	"fmt"
-	"strconv"
-	"time"
 
 	"github.com/themobileprof/bank"
 	"github.com/themobileprof/db"
-	"golang.org/x/exp/rand"
 )
 
-// createAccount creates a new bank account and inserts it into the database.
-// It generates a random 10-digit account number that starts with 001.
-// The account details such as customer name, email, phone, address, gender, and date of birth are set to default values.
-// The created account is then inserted into the database using the insertAccount function.
-// If the insertion is successful, the created account is returned along with nil error.
-// If there is an error during the insertion, an empty account and the corresponding error message are returned.
-func createAccount(accounts *bank.Account) (*bank.Account, error) {
-
-	// Generate a random 10 digits account number that starts with 001
-	rand.Seed(uint64(time.Now().UnixNano()))
-	accountNumber := "001" + strconv.Itoa(rand.Intn(9000000)+1000000)
-
-	*accounts = bank.Account{
-		Customer: bank.Customer{
-			Name:    "John Doe",
-			Email:   "john@gmail.com",
-			Phone:   "(213) 555 0147",
-			Address: "Los Angeles, California",
-			Gender:  "Male",
-			DoB:     "1983-10-10",
-		},
-		Number: accountNumber,
-	}
+// allocationAttempts is how many allocated numbers are tried before giving up
+// when the number turns out to be taken by the time the account is stored.
+const allocationAttempts = 3
 
-	_, err := insertAccount(accounts)
-	if err != nil {
-		return &bank.Account{}, fmt.Errorf("insertAccountError: %v", err)
+// storeRegistry tells an account number allocator which numbers are in use in a store.
+type storeRegistry struct {
+	store db.Store
+}
+
+// Exists reports whether an account in the store has the number.
+func (r storeRegistry) Exists(number string) (bool, error) {
+	_, err := r.store.Accounts().GetAccountByNumber(number)
+	if err == db.ErrAccountNotFound {
+		return false, nil
 	}
+	return err == nil, err
+}
 
-	return accounts, nil
+// Last returns the highest account number with the prefix in the store.
+func (r storeRegistry) Last(prefix string) (string, error) {
+	return r.store.Accounts().LastAccountNumber(prefix)
 }
 
-// insertAccount inserts the given account into the database.
-// It checks if the account is nil and returns an error if it is.
-// It also checks if the database connection is nil and returns an error if it is.
-// The account details such as name, email, phone number, address, gender, and date of birth are inserted into the "users" table.
-// The account number and balance are inserted into the "accounts" table.
-// If the insertion is successful, the ID of the inserted account is returned along with nil error.
-// If there is an error during the insertion, the corresponding error message is returned.
-func insertAccount(accounts *bank.Account) (int64, error) {
-	if accounts == nil {
-		return 0, fmt.Errorf("account is nil")
+// createAccount onboards a new customer and opens their first bank account, of the given type and currency.
+// The customer's details are validated first, and a *bank.FieldError is returned if any is invalid.
+// The account gets a zero balance in its currency and a new account number from the server's allocator:
+// the branch prefix, a serial and a check digit.
+// The customer and the account are inserted in the same database transaction,
+// so a customer is never stored without an account.
+// If the email address is already taken, the returned error wraps db.ErrDuplicate.
+func (s *server) createAccount(customer bank.Customer, accountType bank.AccountType, currency string) (*bank.Account, error) {
+	if err := customer.Validate(); err != nil {
+		return nil, err
 	}
 
-	// Assuming db is a global variable or passed as a parameter
-	if db.DB == nil {
-		return 0, fmt.Errorf("database connection is nil")
-	}
+	var account *bank.Account
+	err := s.store.Atomic(func(tx db.Store) error {
+		if _, err := tx.Customers().InsertCustomer(&customer); err != nil {
+			return err
+		}
 
-	result, err := db.DB.Exec("INSERT INTO users (name, email, phone_number, address, gender, date_of_birth) VALUES (?, ?, ?, ?, ?, ?)", accounts.Name, accounts.Email, accounts.Phone, accounts.Address, accounts.Gender, accounts.DoB)
+		var err error
+		account, err = s.allocateAccount(tx, customer, accountType, currency)
+		return err
+	})
 	if err != nil {
-		return 0, fmt.Errorf("AddUser: %v", err)
+		return nil, fmt.Errorf("insertAccountError: %w", err)
 	}
-	user_id, err := result.LastInsertId()
+
+	return account, nil
+}
+
+// openAccount opens an additional bank account of the given type and currency for an existing customer.
+// The account is numbered and funded like the one createAccount opens.
+// If no customer has the ID, the returned error wraps db.ErrCustomerNotFound.
+func (s *server) openAccount(customerID int64, accountType bank.AccountType, currency string) (*bank.Account, error) {
+	var account *bank.Account
+	err := s.store.Atomic(func(tx db.Store) error {
+		customer, err := tx.Customers().GetCustomer(customerID)
+		if err != nil {
+			return err
+		}
+
+		account, err = s.allocateAccount(tx, *customer, accountType, currency)
+		return err
+	})
 	if err != nil {
-		return 0, fmt.Errorf("addUser: %v", err)
+		return nil, fmt.Errorf("openAccountError: %w", err)
 	}
 
-	result, err = db.DB.Exec("INSERT INTO accounts (user_id, account_number, balance) VALUES (?, ?, ?)", user_id, accounts.Number, accounts.Balance)
-	if err != nil {
-		return 0, fmt.Errorf("addAccount: %v", err)
+	return account, nil
+}
+
+// allocateAccount inserts a new account for the stored customer, with a zero balance in the currency
+// and an account number that no other account has.
+// If another account took the allocated number before this one was stored, another number is allocated.
+func (s *server) allocateAccount(tx db.Store, customer bank.Customer, accountType bank.AccountType, currency string) (*bank.Account, error) {
+	account := &bank.Account{
+		Customer: customer,
+		Type:     accountType,
+		Balance:  bank.NewMoney(0, currency),
 	}
 
-	account_id, err := result.LastInsertId()
-	if err != nil {
-		return 0, fmt.Errorf("addAccount: %v", err)
+	for attempt := 1; ; attempt++ {
+		number, err := s.numbers.Allocate(storeRegistry{tx})
+		if err != nil {
+			return nil, err
+		}
+		account.Number = number
+
+		_, err = tx.Accounts().InsertAccount(customer.ID, account)
+		if errors.Is(err, db.ErrDuplicate) && attempt < allocationAttempts {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		return account, nil
 	}
-	return account_id, nil
 }
 
-// getAccountByNumber retrieves the account with the given account number from the database.
-// It checks if the database connection is nil and returns an error if it is.
-// It queries the "users" and "accounts" tables to retrieve the account details.
-// If the account is found, its details are assigned to the account variable and returned along with nil error.
-// If the account is not found, an error message is returned.
-func getAccountByNumber(number string) (*bank.Account, error) {
-	account := &bank.Account{}
+// getAccountByNumber retrieves the account with the given account number from the account repository.
+// If the account is found, it is returned along with nil error.
+// If the account is not found, db.ErrAccountNotFound is returned.
+func (s *server) getAccountByNumber(number string) (*bank.Account, error) {
+	return s.store.Accounts().GetAccountByNumber(number)
+}
 
-	if db.DB == nil {
-		return nil, fmt.Errorf("database connection is nil")
-	}
+// changeAccountStatus moves the account with the given number to the status, for the given reason.
+// It locks the account inside a store transaction, checks the change is allowed with bank.Account.ChangeStatus,
+// and stores the new status along with the change.
+// A missing account is reported with an error wrapping db.ErrAccountNotFound.
+func (s *server) changeAccountStatus(number string, to bank.AccountStatus, reason string) (*bank.Account, *bank.StatusChange, error) {
+	var account *bank.Account
+	var change *bank.StatusChange
+	err := s.store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return fmt.Errorf("Error getting account: %v", err)
+		}
+		if account = accounts[number]; account == nil {
+			return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+		}
 
-	row := db.DB.QueryRow("SELECT u.name, u.email, u.phone_number, u.address, u.gender, u.date_of_birth, a.account_number, a.balance FROM users u JOIN accounts a ON u.id = a.user_id WHERE a.account_number = ?", number)
-	if err := row.Scan(&account.Name, &account.Email, &account.Phone, &account.Address, &account.Gender, &account.DoB, &account.Number, &account.Balance); err != nil {
-		if err == sql.ErrNoRows {
-			return nil, fmt.Errorf("account not found")
+		if change, err = account.ChangeStatus(to, reason); err != nil {
+			return err
 		}
-		return nil, fmt.Errorf("getAccountByNumber %v: %v", number, err)
-	}
-	return account, nil
+		return tx.Accounts().UpdateStatus(account, change)
+	})
+	return account, change, err
+}
+
+// setOverdraft arranges an overdraft of up to limit on the account with the given number,
+// or removes it with a zero limit. It locks the account inside a store transaction and stores the new limit.
+// The limit can't be lowered below what the account already uses; see bank.Account.SetOverdraft.
+// A missing account is reported with an error wrapping db.ErrAccountNotFound.
+func (s *server) setOverdraft(number string, limit bank.Money) (*bank.Account, error) {
+	var account *bank.Account
+	err := s.store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return fmt.Errorf("Error getting account: %v", err)
+		}
+		if account = accounts[number]; account == nil {
+			return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+		}
+
+		if err := account.SetOverdraft(limit); err != nil {
+			return err
+		}
+		return tx.Accounts().UpdateOverdraft(account)
+	})
+	return account, err
+}
+
+// closeAccount settles and closes the account with the given number for good, for the given reason.
+// It locks the account, and the settlement account if one is given, inside a store transaction.
+// The account's balance is swept to the settlement account with a transfer, or must already be zero,
+// and the account must have no pending holds; see bank.Ledger.Close.
+// The new balances, the status change and the closing statement are stored in the same transaction.
+// The account's history stays queryable, but its number can't be used for new transactions.
+// A missing account is reported with an error wrapping db.ErrAccountNotFound.
+func (s *server) closeAccount(number, settlementAccount, reason string) (*bank.Account, *bank.ClosingStatement, error) {
+	var account *bank.Account
+	var statement *bank.ClosingStatement
+	err := s.store.Atomic(func(tx db.Store) error {
+		numbers := []string{number}
+		if settlementAccount != "" {
+			numbers = append(numbers, settlementAccount)
+		}
+		accounts, err := tx.Accounts().LockAccounts(numbers...)
+		if err != nil {
+			return fmt.Errorf("Error getting accounts: %v", err)
+		}
+		if account = accounts[number]; account == nil {
+			return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+		}
+		settlement := accounts[settlementAccount]
+		if settlementAccount != "" && settlement == nil {
+			return fmt.Errorf("Error getting settlement account: %w", db.ErrAccountNotFound)
+		}
+
+		var change *bank.StatusChange
+		if statement, change, err = s.ledger(tx).Close(account, settlement, reason); err != nil {
+			return err
+		}
+
+		// Synchronize with database
+		if statement.SettlementID != 0 {
+			if err := tx.Accounts().UpdateBalance(account); err != nil {
+				return err
+			}
+			if err := tx.Accounts().UpdateBalance(settlement); err != nil {
+				return err
+			}
+		}
+		if err := tx.Accounts().UpdateStatus(account, change); err != nil {
+			return err
+		}
+		return tx.Accounts().InsertClosure(statement)
+	})
+	return account, statement, err
+}
+
+// placeHold reserves the amount of the balance of the account with the given number, for the given reason.
+// It locks the account inside a store transaction and checks the hold with bank.Account.PlaceHold:
+// only an account that can send money can have money held, and only out of its available balance.
+// A missing account is reported with an error wrapping db.ErrAccountNotFound.
+func (s *server) placeHold(number string, amount bank.Money, reason string) (*bank.Account, *bank.Hold, error) {
+	var account *bank.Account
+	var hold *bank.Hold
+	err := s.store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return fmt.Errorf("Error getting account: %v", err)
+		}
+		if account = accounts[number]; account == nil {
+			return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+		}
+
+		if hold, err = account.PlaceHold(amount, reason); err != nil {
+			return err
+		}
+		return tx.Holds().InsertHold(hold)
+	})
+	return account, hold, err
+}
+
+// releaseHold releases the pending hold with the given ID on the account with the given number,
+// making the held money available again.
+// A hold that is on another account, or already released, is reported with an error wrapping db.ErrHoldNotFound.
+func (s *server) releaseHold(number string, id int64) (*bank.Account, *bank.Hold, error) {
+	var account *bank.Account
+	var hold *bank.Hold
+	err := s.store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return fmt.Errorf("Error getting account: %v", err)
+		}
+		if account = accounts[number]; account == nil {
+			return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+		}
+
+		if hold, err = tx.Holds().PendingHold(id); err != nil {
+			return err
+		}
+		if hold.Account != number {
+			return fmt.Errorf("hold %d of account %s: %w", id, number, db.ErrHoldNotFound)
+		}
+
+		if err := account.ReleaseHold(hold); err != nil {
+			return err
+		}
+		return tx.Holds().ReleaseHold(hold)
+	})
+	return account, hold, err
 }
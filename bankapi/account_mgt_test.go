@@ -1,22 +1,29 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/themobileprof/bank"
+	"github.com/themobileprof/bank/accountnumber"
 	"github.com/themobileprof/db"
 )
 
 func TestCreateAccount(t *testing.T) {
-	// Connect DB
-	db.ConnectTesting()
+	s := newServer(db.NewMemoryStore())
 
 	// Create a new account
-	accounts := &bank.Account{}
-
-	_, err := createAccount(accounts)
+	accounts, err := s.createAccount(bank.Customer{
+		Name:    "John Doe",
+		Email:   "john@gmail.com",
+		Phone:   "(213) 555 0147",
+		Address: "Los Angeles, California",
+		Gender:  "Male",
+		DoB:     "1983-10-10",
+	}, bank.CurrentAccount, bank.DefaultCurrency)
 	if err != nil {
-		t.Errorf("account not created. %s", err)
+		t.Fatalf("account not created. %s", err)
 	}
 
 	// Check if the account is created
@@ -24,60 +31,92 @@ func TestCreateAccount(t *testing.T) {
 		t.Error("account name is incorrect")
 	}
 
-	// Check if the account number starts with 001
-	if accounts.Number[:3] != "001" {
-		t.Error("account number should start with 001")
+	// Check if the account number starts with 001 and has a valid check digit
+	if accounts.Number[:3] != "001" || !accountnumber.Valid(accounts.Number) {
+		t.Errorf("account number %s should start with 001 and end with a check digit", accounts.Number)
 	}
 
 	// Check if the account has a balance of zero
-	if accounts.Balance != 0.00 {
+	if !accounts.Balance.IsZero() {
 		t.Error("account balance is not zero")
 	}
+
+	// Check if the account is stored
+	if _, err := s.getAccountByNumber(accounts.Number); err != nil {
+		t.Errorf("account not stored. %s", err)
+	}
 }
 
-func TestInsertAccount(t *testing.T) {
-	// Connect DB
-	db.ConnectTesting()
+func TestCreateAccountInvalidCustomer(t *testing.T) {
+	s := newServer(db.NewMemoryStore())
 
-	// Create a new account
-	accounts := &bank.Account{
-		Customer: bank.Customer{
-			Name:    "Jane Doe",
-			Email:   "jane@gmail.com",
-			Phone:   "(213) 555 0147",
-			Address: "Los Angeles, California",
-			Gender:  "Female",
-			DoB:     "2003-01-01",
-		},
-		Number:  "0017286376",
-		Balance: 0.00,
+	_, err := s.createAccount(bank.Customer{Name: "John Doe", Email: "not an email"}, bank.CurrentAccount, bank.DefaultCurrency)
+	if !errors.Is(err, bank.ErrInvalidCustomer) {
+		t.Errorf("expected an invalid customer error, got %v", err)
 	}
+}
+
+func TestCreateAccountDuplicateEmail(t *testing.T) {
+	s := newServer(db.NewMemoryStore())
+
+	customer := bank.Customer{Name: "John Doe", Email: "john@gmail.com"}
+	if _, err := s.createAccount(customer, bank.CurrentAccount, bank.DefaultCurrency); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second customer is rolled back with its account
+	if _, err := s.createAccount(customer, bank.CurrentAccount, bank.DefaultCurrency); !errors.Is(err, db.ErrDuplicate) {
+		t.Errorf("expected a duplicate error, got %v", err)
+	}
+}
 
-	// Insert the account
-	_, err := insertAccount(accounts)
+func TestOpenAccount(t *testing.T) {
+	s := newServer(db.NewMemoryStore())
+
+	current, err := s.createAccount(bank.Customer{Name: "John Doe", Email: "john@gmail.com"}, bank.CurrentAccount, bank.DefaultCurrency)
 	if err != nil {
-		t.Errorf("account not inserted. %s", err)
+		t.Fatal(err)
 	}
 
-	// Check if the account is created
-	if accounts.Name != "Jane Doe" {
-		t.Error("account not created")
+	// A second account for the same customer
+	savings, err := s.openAccount(current.ID, bank.SavingsAccount, bank.DefaultCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if savings.ID != current.ID || savings.Number == current.Number || savings.Type != bank.SavingsAccount {
+		t.Errorf("unexpected savings account: %+v", savings)
 	}
 
-	// Check if the account number starts with 001
-	if accounts.Number[:3] != "001" {
-		t.Error("account number should start with 001")
+	accounts, err := s.store.Accounts().AccountsByCustomer(current.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Number != current.Number || accounts[1].Number != savings.Number {
+		t.Errorf("expected both accounts for the customer, got %+v", accounts)
 	}
 
-	// Check if the account has a balance of zero
-	if accounts.Balance != 0.00 {
-		t.Error("account balance is not zero")
+	if _, err := s.openAccount(99, bank.SavingsAccount, bank.DefaultCurrency); !errors.Is(err, db.ErrCustomerNotFound) {
+		t.Errorf("expected a customer not found error, got %v", err)
+	}
+}
+
+func TestCreateAccountSequentialNumbers(t *testing.T) {
+	s := newServer(db.NewMemoryStore())
+	s.numbers, _ = accountnumber.NewAllocator("042", accountnumber.Sequential)
+
+	for i, want := range []string{"0420000002", "0420000010"} {
+		account, err := s.createAccount(bank.Customer{Name: "John Doe", Email: fmt.Sprintf("john%d@gmail.com", i)}, bank.CurrentAccount, bank.DefaultCurrency)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if account.Number != want {
+			t.Errorf("expected account number %s, got %s", want, account.Number)
+		}
 	}
 }
 
 func TestGetAccountByNumber(t *testing.T) {
-	// Connect DB
-	db.ConnectTesting()
+	s := newServer(db.NewMemoryStore())
 
 	// Create a new account
 	accounts := &bank.Account{
@@ -89,18 +128,14 @@ func TestGetAccountByNumber(t *testing.T) {
 			Gender:  "Male",
 			DoB:     "1983-10-10",
 		},
-		Number:  "0018989351",
-		Balance: 0.00,
+		Number:  "0018989350",
+		Balance: bank.NewMoney(0, bank.DefaultCurrency),
 	}
 
-	// Insert the account
-	_, err := insertAccount(accounts)
-	if err != nil {
-		t.Errorf("account not inserted. %s", err)
-	}
+	seedAccount(t, s.store, accounts)
 
 	// Get the account by number
-	account, err := getAccountByNumber(accounts.Number)
+	account, err := s.getAccountByNumber(accounts.Number)
 	if err != nil {
 		t.Errorf("failed to get account. %s", err)
 	}
@@ -0,0 +1,389 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+// statusChangeRequest is the body of an admin status change: why the account's status changes.
+type statusChangeRequest struct {
+	Reason string `json:"reason"`
+}
+
+// closeRequest is the body of an account closure: why the account is closed,
+// and the account its remaining balance is swept to, if it has one.
+type closeRequest struct {
+	Reason            string `json:"reason"`
+	SettlementAccount string `json:"settlement_account"`
+}
+
+// holdRequest is the body of a hold: the amount to hold and why.
+type holdRequest struct {
+	Amount *bank.Money `json:"amount"`
+	Reason string      `json:"reason"`
+}
+
+// overdraftRequest is the body of an overdraft arrangement: the limit, zero to remove the overdraft.
+type overdraftRequest struct {
+	Limit *bank.Money `json:"limit"`
+}
+
+// apiHold is a pending hold as returned by the /v1 API.
+type apiHold struct {
+	ID        int64      `json:"id"`
+	Account   string     `json:"account"`
+	Amount    bank.Money `json:"amount"`
+	Reason    string     `json:"reason"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// newAPIHold is a function that converts a hold to its /v1 representation.
+func newAPIHold(h *bank.Hold) apiHold {
+	return apiHold{
+		ID:        h.ID,
+		Account:   h.Account,
+		Amount:    h.Amount,
+		Reason:    h.Reason,
+		CreatedAt: h.CreatedAt,
+	}
+}
+
+// holdResponse is the response to a hold being placed or released: the hold and the account's new available balance.
+type holdResponse struct {
+	Hold    apiHold    `json:"hold"`
+	Account apiAccount `json:"account"`
+}
+
+// closeResponse is the response to an account closure: the closed account and its closing statement.
+type closeResponse struct {
+	Account apiAccount `json:"account"`
+	Closure apiClosure `json:"closure"`
+}
+
+// apiStatusChange is a change of account status as returned by the /v1 API.
+type apiStatusChange struct {
+	From      bank.AccountStatus `json:"from"`
+	To        bank.AccountStatus `json:"to"`
+	Reason    string             `json:"reason"`
+	CreatedAt time.Time          `json:"created_at"`
+}
+
+// newAPIStatusChange is a function that converts a status change to its /v1 representation.
+func newAPIStatusChange(c *bank.StatusChange) apiStatusChange {
+	return apiStatusChange{
+		From:      c.From,
+		To:        c.To,
+		Reason:    c.Reason,
+		CreatedAt: c.CreatedAt,
+	}
+}
+
+// statusChangeResponse is the response to an admin status change: the account with its new status and the change.
+type statusChangeResponse struct {
+	Account apiAccount      `json:"account"`
+	Change  apiStatusChange `json:"change"`
+}
+
+// adminRoutes is a function that registers the /v1/admin endpoints on the mux.
+// They change the status of accounts: freezing one stops money leaving it, blacklisting one stops all movements,
+// unfreezing one makes it active again, and closing one is final.
+// They also place and release holds on account balances. Only the back office uses them,
+// with the accounts:manage permission for changes and accounts:read for reads,
+// and the money:adjust permission to correct balances with manual adjustments.
+func (s *server) adminRoutes(mux *http.ServeMux) {
+	mux.Handle("/v1/admin/accounts/{number}/freeze", backOfficeOnly(methods{http.MethodPost: allow(bank.PermManageAccounts, s.v1ChangeStatus(bank.StatusInactive))}))
+	mux.Handle("/v1/admin/accounts/{number}/unfreeze", backOfficeOnly(methods{http.MethodPost: allow(bank.PermManageAccounts, s.v1ChangeStatus(bank.StatusActive))}))
+	mux.Handle("/v1/admin/accounts/{number}/blacklist", backOfficeOnly(methods{http.MethodPost: allow(bank.PermManageAccounts, s.v1ChangeStatus(bank.StatusBlacklisted))}))
+	mux.Handle("/v1/admin/accounts/{number}/close", backOfficeOnly(methods{http.MethodPost: allow(bank.PermManageAccounts, s.v1CloseAccount)}))
+	mux.Handle("/v1/admin/accounts/{number}/status-changes", backOfficeOnly(methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1StatusChanges)}))
+	mux.Handle("/v1/admin/accounts/{number}/holds", backOfficeOnly(methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1Holds), http.MethodPost: allow(bank.PermManageAccounts, s.v1PlaceHold)}))
+	mux.Handle("/v1/admin/accounts/{number}/holds/{id}", backOfficeOnly(methods{http.MethodDelete: allow(bank.PermManageAccounts, s.v1ReleaseHold)}))
+	mux.Handle("/v1/admin/accounts/{number}/overdraft", backOfficeOnly(methods{http.MethodPut: allow(bank.PermManageAccounts, s.v1SetOverdraft)}))
+	mux.Handle("/v1/admin/accounts/{number}/adjustments", backOfficeOnly(methods{http.MethodPost: allow(bank.PermAdjustBalances, s.v1AdjustBalance)}))
+}
+
+// v1ChangeStatus is a function that returns the handler of POST /v1/admin/accounts/{number}/{action}
+// with a statusChangeRequest body, which moves the account to the given status.
+// The reason is required. It responds 200 OK with the account and the change,
+// and 409 if the account can't move to the status from its current one.
+func (s *server) v1ChangeStatus(to bank.AccountStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		number, err := pathAccountNumber(req)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		var body statusChangeRequest
+		if err := decodeJSON(w, req, &body); err != nil {
+			writeError(w, err)
+			return
+		}
+		reason, err := requireReason(body.Reason)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		account, change, err := s.changeAccountStatus(number, to, reason)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, statusChangeResponse{newAPIAccount(account), newAPIStatusChange(change)})
+	}
+}
+
+// v1StatusChanges is a function that handles GET /v1/admin/accounts/{number}/status-changes.
+// It returns every status change of the account with its reason, oldest first.
+func (s *server) v1StatusChanges(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := s.getAccountByNumber(number); err != nil {
+		writeError(w, err)
+		return
+	}
+	changes, err := s.store.Accounts().StatusChanges(number)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	list := make([]apiStatusChange, 0, len(changes))
+	for i := range changes {
+		list = append(list, newAPIStatusChange(&changes[i]))
+	}
+	writeJSON(w, http.StatusOK, map[string][]apiStatusChange{"status_changes": list})
+}
+
+// requireReason is a function that returns the trimmed reason of an admin request body,
+// or an error if it is missing or too long to store.
+func requireReason(reason string) (string, error) {
+	reason = strings.TrimSpace(reason)
+	if reason == "" || len(reason) > 255 {
+		return "", &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidationFailed, Message: "reason: is required and at most 255 characters", Field: "reason"}
+	}
+	return reason, nil
+}
+
+// v1CloseAccount is a function that handles POST /v1/admin/accounts/{number}/close with a closeRequest body.
+// It settles and closes the account with closeAccount: its balance is swept to the settlement account,
+// or must be zero if there is none, and it must have no pending holds.
+// It responds 200 OK with the closed account and its closing statement,
+// or 202 Accepted with the operation awaiting approval if the balance swept is over the approval limit,
+// and 409 if the balance isn't zero, there are pending holds or the account is already closed.
+func (s *server) v1CloseAccount(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body closeRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	reason, err := requireReason(body.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if body.SettlementAccount != "" {
+		if err := validateAccountNumber(body.SettlementAccount, "settlement_account"); err != nil {
+			writeError(w, err)
+			return
+		}
+	}
+	if body.SettlementAccount == number {
+		writeError(w, &apiError{Status: http.StatusUnprocessableEntity, Code: codeSameAccount, Message: "cannot settle an account into itself", Field: "settlement_account"})
+		return
+	}
+
+	// The balance to sweep is checked against the approval limits with the account locked, until it is swept or held
+	var account *bank.Account
+	var closure *bank.ClosingStatement
+	var pending bool
+	o := &bank.PendingOperation{Type: bank.ClosureOperation, Account: number, To: body.SettlementAccount, Note: reason}
+	err = s.store.Atomic(func(tx db.Store) error {
+		if body.SettlementAccount != "" {
+			accounts, err := tx.Accounts().LockAccounts(number)
+			if err != nil {
+				return fmt.Errorf("Error getting account: %v", err)
+			}
+			if accounts[number] == nil {
+				return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+			}
+			if err := accounts[number].CanClose(); err != nil {
+				return err
+			}
+			if o.Amount = accounts[number].Balance; o.Amount.IsPositive() {
+				if pending, err = s.using(tx).submitForApproval(req, o); err != nil || pending {
+					return err
+				}
+			}
+		}
+		var err error
+		account, closure, err = s.using(tx).closeAccount(number, body.SettlementAccount, reason)
+		return err
+	})
+	if err != nil || pending {
+		v1Submitted(w, o, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, closeResponse{newAPIAccount(account), newAPIClosure(closure)})
+}
+
+// v1Holds is a function that handles GET /v1/admin/accounts/{number}/holds.
+// It returns the account's pending holds, oldest first.
+func (s *server) v1Holds(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := s.getAccountByNumber(number); err != nil {
+		writeError(w, err)
+		return
+	}
+	holds, err := s.store.Holds().PendingHolds(number)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	list := make([]apiHold, 0, len(holds))
+	for i := range holds {
+		list = append(list, newAPIHold(&holds[i]))
+	}
+	writeJSON(w, http.StatusOK, map[string][]apiHold{"holds": list})
+}
+
+// v1PlaceHold is a function that handles POST /v1/admin/accounts/{number}/holds with a holdRequest body.
+// It responds 201 Created with the hold and the account's new available balance,
+// and 422 if the available balance is too low.
+func (s *server) v1PlaceHold(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body holdRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	amount, err := requireAmount(body.Amount, "")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	reason, err := requireReason(body.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	account, hold, err := s.placeHold(number, amount, reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/admin/accounts/%s/holds/%d", number, hold.ID))
+	writeJSON(w, http.StatusCreated, holdResponse{newAPIHold(hold), newAPIAccount(account)})
+}
+
+// v1ReleaseHold is a function that handles DELETE /v1/admin/accounts/{number}/holds/{id}.
+// It responds 200 OK with the released hold and the account's new available balance.
+func (s *server) v1ReleaseHold(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: fmt.Sprintf("Invalid hold ID %q", req.PathValue("id"))})
+		return
+	}
+
+	account, hold, err := s.releaseHold(number, id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, holdResponse{newAPIHold(hold), newAPIAccount(account)})
+}
+
+// v1SetOverdraft is a function that handles PUT /v1/admin/accounts/{number}/overdraft with an overdraftRequest body.
+// It arranges an overdraft of up to the limit, in the account's currency, or removes it with a zero limit.
+// It responds 200 OK with the account, and 422 if the account already uses more than the limit.
+func (s *server) v1SetOverdraft(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body overdraftRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	if body.Limit == nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: "limit is required", Field: "limit"})
+		return
+	}
+
+	account, err := s.setOverdraft(number, *body.Limit)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIAccount(account))
+}
+
+// v1AdjustBalance is a function that handles POST /v1/admin/accounts/{number}/adjustments with an amountRequest body.
+// It submits the correction of the account's balance by the amount, which is taken from the balance if negative,
+// for approval: adjustments are only posted, see bank.Ledger.Adjust, once a second person approves them.
+// It responds 202 Accepted with the operation awaiting approval, and 422 if the amount is zero.
+func (s *server) v1AdjustBalance(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body amountRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	amount, err := requireAmount(body.Amount, body.Currency)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if amount.IsZero() {
+		writeError(w, &apiError{Status: http.StatusUnprocessableEntity, Code: codeInvalidAmount, Message: "amount: an adjustment should not be zero", Field: "amount"})
+		return
+	}
+
+	o := &bank.PendingOperation{Type: bank.AdjustmentTransaction, Account: number, Amount: amount}
+	_, err = s.submitForApproval(req, o)
+	v1Submitted(w, o, err)
+}
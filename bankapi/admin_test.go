@@ -0,0 +1,358 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/themobileprof/bank"
+)
+
+func TestAdminAccountStatus(t *testing.T) {
+	s := newTestServer(t)
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`)
+
+	rr := serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/freeze", `{"reason": "Suspected fraud"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var response statusChangeResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if response.Account.Status != bank.StatusInactive || response.Change.From != bank.StatusActive || response.Change.Reason != "Suspected fraud" {
+		t.Errorf("unexpected status change: %s", rr.Body.String())
+	}
+
+	// A frozen account can receive money but not send it, through the /v1 API and the original endpoints
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/v1/accounts/0017286378/deposits", `{"amount": 5}`, http.StatusCreated},
+		{"POST", "/v1/accounts/0018989350/deposits", `{"amount": 50}`, http.StatusCreated},
+		{"POST", "/v1/accounts/0018989350/transfers", `{"to": "0017286378", "amount": 5}`, http.StatusCreated},
+		{"POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 5}`, http.StatusUnprocessableEntity},
+		{"POST", "/v1/accounts/0017286378/transfers", `{"to": "0018989350", "amount": 5}`, http.StatusUnprocessableEntity},
+		{"GET", "/v1/accounts/0017286378/transactions", "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := serveAPI(t, s, tt.method, tt.path, tt.body)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %d but got %d: %s", tt.method, tt.path, tt.status, rr.Code, rr.Body.String())
+		}
+		if tt.status == http.StatusUnprocessableEntity && errorCode(t, rr) != codeAccountRestricted {
+			t.Errorf("%s %s: expected code %q: %s", tt.method, tt.path, codeAccountRestricted, rr.Body.String())
+		}
+	}
+	rr = serveAPI(t, s, "POST", "/withdraw?number=0017286378&amount=5", "")
+	if !strings.Contains(rr.Body.String(), "cannot send money") {
+		t.Errorf("expected the legacy withdrawal to be refused, got %s", rr.Body.String())
+	}
+
+	// A blacklisted account can't receive money either
+	serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/blacklist", `{"reason": "Confirmed fraud"}`)
+	rr = serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 5}`)
+	if rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeAccountRestricted {
+		t.Errorf("expected the deposit to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/unfreeze", `{"reason": "Cleared"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr = serveAPI(t, s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 5}`)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected the withdrawal to go through once unfrozen, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// An account with money in it can't be closed, and a closed account stays closed
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Customer request"}`)
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codeBalanceNotZero {
+		t.Errorf("expected a non-zero balance error, got %d %s", rr.Code, rr.Body.String())
+	}
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 105}`)
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Customer request"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/unfreeze", `{"reason": "Reopen"}`)
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codeInvalidStatus {
+		t.Errorf("expected an invalid status change, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/admin/accounts/0017286378/status-changes", "")
+	var list struct {
+		StatusChanges []apiStatusChange `json:"status_changes"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.StatusChanges) != 4 || list.StatusChanges[3].To != bank.StatusClosed {
+		t.Errorf("unexpected status changes: %s", rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0018989350/freeze", `{}`)
+	if rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeValidationFailed {
+		t.Errorf("expected a missing reason to be rejected, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0000000000/freeze", `{"reason": "Test"}`)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected an unknown account to be reported, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminCloseAccount(t *testing.T) {
+	s := newTestServer(t)
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`)
+
+	rr := serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/holds", `{"amount": 30, "reason": "Card payment"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var held holdResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &held); err != nil {
+		t.Fatal(err)
+	}
+	if held.Hold.ID == 0 || held.Account.Available.String() != "70.00" || held.Account.Balance.String() != "100.00" {
+		t.Errorf("unexpected hold: %s", rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 80}`)
+	if rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeInsufficientFunds {
+		t.Errorf("expected held money to stay in the account, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Pending holds block the closure
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Customer request", "settlement_account": "0018989350"}`)
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codePendingHolds {
+		t.Errorf("expected pending holds to block the closure, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "DELETE", "/v1/admin/accounts/0017286378/holds/"+strconv.FormatInt(held.Hold.ID, 10), "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"available":100.00`) {
+		t.Errorf("unexpected release: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveAPI(t, s, "DELETE", "/v1/admin/accounts/0017286378/holds/"+strconv.FormatInt(held.Hold.ID, 10), "")
+	if rr.Code != http.StatusNotFound || errorCode(t, rr) != codeHoldNotFound {
+		t.Errorf("expected a released hold to be gone, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Without a settlement account the balance must be zero
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Customer request"}`)
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codeBalanceNotZero {
+		t.Errorf("expected the balance to block the closure, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378/closure", "")
+	if rr.Code != http.StatusNotFound || errorCode(t, rr) != codeClosureNotFound {
+		t.Errorf("expected no closure for an open account, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Customer request", "settlement_account": "0018989350"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var closed closeResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &closed); err != nil {
+		t.Fatal(err)
+	}
+	if closed.Account.Status != bank.StatusClosed || !closed.Account.Balance.IsZero() || closed.Closure.FinalBalance.String() != "100.00" ||
+		closed.Closure.SettlementAccount != "0018989350" || closed.Closure.SettlementID == 0 || closed.Closure.TotalDebits.String() != "100.00" {
+		t.Errorf("unexpected closure: %s", rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0018989350", "")
+	if !strings.Contains(rr.Body.String(), `"balance":100.00`) {
+		t.Errorf("expected the balance to be swept, got %s", rr.Body.String())
+	}
+
+	// The closing statement and the history stay available, but the number takes no new transactions
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378/closure", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"reason":"Customer request"`) {
+		t.Errorf("unexpected closing statement: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378/transactions", "")
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), `"Direction"`) != 2 {
+		t.Errorf("expected the history to stay queryable, got %d %s", rr.Code, rr.Body.String())
+	}
+	for _, post := range []struct{ path, body string }{
+		{"/v1/accounts/0017286378/deposits", `{"amount": 5}`},
+		{"/v1/accounts/0018989350/transfers", `{"to": "0017286378", "amount": 5}`},
+	} {
+		rr = serveAPI(t, s, "POST", post.path, post.body)
+		if rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeAccountRestricted {
+			t.Errorf("%s: expected a closed account to be refused, got %d %s", post.path, rr.Code, rr.Body.String())
+		}
+	}
+	rr = serveAPI(t, s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Again"}`)
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codeInvalidStatus {
+		t.Errorf("expected a closed account to stay closed, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminCloseAccountApproval(t *testing.T) {
+	s, admin := newAuthServer(t)
+	s.approvalLimits, _ = bank.ParseApprovalLimits("NGN 1000")
+	approver := staffKey(t, s, "supervisor", bank.RoleApprover)
+	rr := serveWith(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 5000}`, admin)
+	serveWith(s, "POST", rr.Header().Get("Location")+"/approve", `{}`, approver)
+
+	// A balance up to the limit is swept at once
+	rr = serveWith(s, "POST", "/v1/customers/1/accounts", `{"type": "savings"}`, admin)
+	number := strings.TrimPrefix(rr.Header().Get("Location"), "/v1/accounts/")
+	serveWith(s, "POST", "/v1/accounts/"+number+"/deposits", `{"amount": 10}`, admin)
+	if rr := serveWith(s, "POST", "/v1/admin/accounts/"+number+"/close", `{"reason": "Duplicate account", "settlement_account": "0017286378"}`, admin); rr.Code != http.StatusOK {
+		t.Errorf("expected the closure to be made at once, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// A larger one waits for approval, and the account stays open until then
+	rr = serveWith(s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Moving abroad", "settlement_account": "0018989350"}`, admin)
+	o := decodeOperation(t, rr)
+	if rr.Code != http.StatusAccepted || o.Type != bank.ClosureOperation || o.To != "0018989350" || o.Amount.String() != "5010.00" || o.Note != "Moving abroad" {
+		t.Fatalf("expected the closure to await approval, got %d %s", rr.Code, rr.Body.String())
+	}
+	closure := rr.Header().Get("Location")
+	if account, _ := s.store.Accounts().GetAccountByNumber("0017286378"); account.Status != bank.StatusActive || account.Balance.Amount != 501000 {
+		t.Errorf("expected the pending closure to leave the account as it was, got %+v", account)
+	}
+
+	// The balance approved is the one swept
+	serveWith(s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 10}`, admin)
+	if rr := serveWith(s, "POST", closure+"/approve", `{}`, approver); rr.Code != http.StatusConflict || errorCode(t, rr) != codeConflict {
+		t.Errorf("expected the changed balance to block the closure, got %d %s", rr.Code, rr.Body.String())
+	}
+	serveWith(s, "POST", closure+"/reject", `{"reason": "Balance changed"}`, approver)
+	rr = serveWith(s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Moving abroad", "settlement_account": "0018989350"}`, admin)
+	if rr := serveWith(s, "POST", rr.Header().Get("Location")+"/approve", `{}`, approver); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"status":"closed"`) {
+		t.Errorf("expected the closure to be approved, got %d %s", rr.Code, rr.Body.String())
+	}
+	if got := balance(t, s, "0018989350"); got != 500000 {
+		t.Errorf("expected the balance to be swept, got %d", got)
+	}
+
+	if rr := serveWith(s, "POST", "/v1/admin/accounts/0017286378/close", `{"reason": "Again", "settlement_account": "0018989350"}`, admin); rr.Code != http.StatusConflict {
+		t.Errorf("expected a closed account not to be closed again, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminOverdraft(t *testing.T) {
+	s := newTestServer(t)
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`)
+
+	rr := serveAPI(t, s, "PUT", "/v1/admin/accounts/0017286378/overdraft", `{"limit": 500}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+	var account apiAccount
+	if err := json.Unmarshal(rr.Body.Bytes(), &account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Overdraft == nil || account.Overdraft.String() != "500.00" || account.Available.String() != "600.00" {
+		t.Errorf("unexpected account: %s", rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 350}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"balance":-250.00`) {
+		t.Fatalf("expected the withdrawal to use the overdraft: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378/statement", "")
+	if !strings.Contains(rr.Body.String(), `"Overdraft":{"Limit":500.00,"Used":250.00}`) {
+		t.Errorf("expected the statement to show the overdraft used: %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 250.01}`, http.StatusUnprocessableEntity, codeOverdraftExceeded},
+		{"POST", "/v1/accounts/0017286378/transfers", `{"to": "0018989350", "amount": 300}`, http.StatusUnprocessableEntity, codeOverdraftExceeded},
+		{"POST", "/v1/accounts/0018989350/withdrawals", `{"amount": 1}`, http.StatusUnprocessableEntity, codeInsufficientFunds},
+		{"PUT", "/v1/admin/accounts/0017286378/overdraft", `{"limit": 200}`, http.StatusUnprocessableEntity, codeOverdraftExceeded},
+		{"PUT", "/v1/admin/accounts/0017286378/overdraft", `{"limit": -1}`, http.StatusUnprocessableEntity, codeInvalidAmount},
+		{"PUT", "/v1/admin/accounts/0017286378/overdraft", `{}`, http.StatusBadRequest, codeInvalidRequest},
+		{"PUT", "/v1/admin/accounts/0000000000/overdraft", `{"limit": 10}`, http.StatusNotFound, codeAccountNotFound},
+	}
+	for _, tt := range tests {
+		rr := serveAPI(t, s, tt.method, tt.path, tt.body)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d but got %d: %s", tt.method, tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if code := errorCode(t, rr); code != tt.code {
+			t.Errorf("%s %s %s: expected code %q but got %q", tt.method, tt.path, tt.body, tt.code, code)
+		}
+	}
+
+	// Repaid, the overdraft can be removed
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 250}`)
+	rr = serveAPI(t, s, "PUT", "/v1/admin/accounts/0017286378/overdraft", `{"limit": 0}`)
+	if rr.Code != http.StatusOK || strings.Contains(rr.Body.String(), "overdraft_limit") {
+		t.Errorf("expected the overdraft to be removed: %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAdminAdjustBalance(t *testing.T) {
+	s, admin := newAuthServer(t)
+	approver := staffKey(t, s, "supervisor", bank.RoleApprover)
+	serveWith(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, admin)
+
+	// Adjustments wait for a second person's approval, whatever their amount, and are then posted to the ledger
+	for _, body := range []string{`{"amount": 12.50}`, `{"amount": -20}`} {
+		before := balance(t, s, "0017286378")
+		rr := serveWith(s, "POST", "/v1/admin/accounts/0017286378/adjustments", body, admin)
+		o := decodeOperation(t, rr)
+		if rr.Code != http.StatusAccepted || o.Type != bank.AdjustmentTransaction || o.Status != bank.OperationPending {
+			t.Fatalf("expected the adjustment to await approval, got %d %s", rr.Code, rr.Body.String())
+		}
+		if got := balance(t, s, "0017286378"); got != before {
+			t.Errorf("expected the pending adjustment not to change the balance of %d, got %d", before, got)
+		}
+		if rr := serveWith(s, "POST", rr.Header().Get("Location")+"/approve", `{}`, admin); rr.Code != http.StatusForbidden {
+			t.Errorf("expected the requester not to approve the adjustment, got %d %s", rr.Code, rr.Body.String())
+		}
+		if rr := serveWith(s, "POST", rr.Header().Get("Location")+"/approve", `{}`, approver); rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"type":"adjustment"`) {
+			t.Errorf("expected the adjustment to be approved, got %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	if got := balance(t, s, "0017286378"); got != 9250 {
+		t.Errorf("expected both adjustments, got a balance of %d", got)
+	}
+	rr := serveWith(s, "GET", "/v1/accounts/0017286378/transactions?type=adjustment", "", admin)
+	if rr.Code != http.StatusOK || strings.Count(rr.Body.String(), `"Type":"adjustment"`) != 2 || !strings.Contains(rr.Body.String(), `"Direction":"debit","Amount":20.00`) {
+		t.Errorf("expected both adjustments in the history, got %d %s", rr.Code, rr.Body.String())
+	}
+	account, _ := s.store.Accounts().GetAccountByNumber("0017286378")
+	if err := s.ledger(s.store).Verify(account); err != nil {
+		t.Error(err)
+	}
+
+	// An adjustment taking more than the available balance stays pending
+	rr = serveWith(s, "POST", "/v1/admin/accounts/0017286378/adjustments", `{"amount": -92.51}`, admin)
+	if rr = serveWith(s, "POST", rr.Header().Get("Location")+"/approve", `{}`, approver); rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeInsufficientFunds {
+		t.Errorf("expected the adjustment to fail, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		body, number string
+		status       int
+		code         string
+	}{
+		{`{"amount": 0}`, "0017286378", http.StatusUnprocessableEntity, codeInvalidAmount},
+		{`{}`, "0017286378", http.StatusBadRequest, codeInvalidRequest},
+		{`{"amount": 1}`, "0000000000", http.StatusNotFound, codeAccountNotFound},
+	}
+	for _, tt := range tests {
+		rr := serveWith(s, "POST", "/v1/admin/accounts/"+tt.number+"/adjustments", tt.body, admin)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %d but got %d: %s", tt.number, tt.body, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if code := errorCode(t, rr); code != tt.code {
+			t.Errorf("%s %s: expected code %q but got %q", tt.number, tt.body, tt.code, code)
+		}
+	}
+}
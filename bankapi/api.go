@@ -0,0 +1,914 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/bank/accountnumber"
+	"github.com/themobileprof/db"
+)
+
+// maxBodySize is the largest JSON request body the API reads.
+const maxBodySize = 1 << 20
+
+// Machine-readable error codes of the /v1 API.
+const (
+	codeInvalidJSON           = "invalid_json"
+	codeInvalidRequest        = "invalid_request"
+	codeInvalidAccount        = "invalid_account_number"
+	codeInvalidIBAN           = "invalid_iban"
+	codeForeignIBAN           = "foreign_iban"
+	codeInvalidAmount         = "invalid_amount"
+	codeInvalidCurrency       = "unsupported_currency"
+	codeRateNotFound          = "rate_not_found"
+	codeAccountNotFound       = "account_not_found"
+	codeInvalidCustomerID     = "invalid_customer_id"
+	codeCustomerNotFound      = "customer_not_found"
+	codeInsufficientFunds     = "insufficient_funds"
+	codeOverdraftExceeded     = "overdraft_limit_exceeded"
+	codeSameAccount           = "same_account"
+	codeCurrencyMismatch      = "currency_mismatch"
+	codeAccountRestricted     = "account_restricted"
+	codeInvalidStatus         = "invalid_status_change"
+	codeBalanceNotZero        = "balance_not_zero"
+	codePendingHolds          = "pending_holds"
+	codeHoldNotFound          = "hold_not_found"
+	codeClosureNotFound       = "closure_not_found"
+	codeOperationNotFound     = "operation_not_found"
+	codeOperationDecided      = "operation_decided"
+	codeValidationFailed      = "validation_failed"
+	codeConflict              = "conflict"
+	codeUnauthenticated       = "unauthenticated"
+	codeInvalidCredentials    = "invalid_credentials"
+	codeForbidden             = "forbidden"
+	codeIdempotencyInProgress = "idempotency_key_in_use"
+	codeIdempotencyMismatch   = "idempotency_key_reused"
+	codeNotFound              = "not_found"
+	codeMethodNotAllowed      = "method_not_allowed"
+	codeNotAcceptable         = "not_acceptable"
+	codeInternal              = "internal_error"
+)
+
+// apiError is an error with the HTTP status and code it is reported with.
+type apiError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	Field   string `json:"field,omitempty"` // The request field at fault, for validation errors.
+}
+
+func (e *apiError) Error() string {
+	return e.Message
+}
+
+// errorEnvelope is the body of every /v1 error response.
+type errorEnvelope struct {
+	Error *apiError `json:"error"`
+}
+
+// apiCustomer is a customer as returned by the /v1 API.
+type apiCustomer struct {
+	ID      int64  `json:"id"`
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone,omitempty"`
+	Address string `json:"address,omitempty"`
+	Gender  string `json:"gender,omitempty"`
+	DoB     string `json:"date_of_birth,omitempty"`
+}
+
+// apiAccount is an account as returned by the /v1 API.
+type apiAccount struct {
+	Number     string             `json:"number"`
+	Type       bank.AccountType   `json:"type"`
+	Status     bank.AccountStatus `json:"status"`
+	CustomerID int64              `json:"customer_id,omitempty"`
+	Name       string             `json:"name"`
+	Email      string             `json:"email,omitempty"`
+	Phone      string             `json:"phone,omitempty"`
+	Address    string             `json:"address,omitempty"`
+	Balance    bank.Money         `json:"balance"`
+	Available  bank.Money         `json:"available"`                 // The balance less the pending holds, plus the overdraft limit.
+	Overdraft  *bank.Money        `json:"overdraft_limit,omitempty"` // Arranged overdraft, if any.
+	Currency   string             `json:"currency"`
+}
+
+// apiTransaction is a posted transaction as returned by the /v1 API.
+// A transfer between currencies also has the amount credited in the other currency and the rate applied,
+// and a withdrawal or transfer that was charged a fee has the fee, which came out of the account on top of the amount.
+type apiTransaction struct {
+	ID                int64                `json:"id"`
+	Type              bank.TransactionType `json:"type"`
+	Amount            bank.Money           `json:"amount"`
+	Currency          string               `json:"currency"`
+	ConvertedAmount   *bank.Money          `json:"converted_amount,omitempty"`
+	ConvertedCurrency string               `json:"converted_currency,omitempty"`
+	Rate              *bank.Rate           `json:"exchange_rate,omitempty"`
+	Fee               *bank.Money          `json:"fee,omitempty"`
+	CreatedAt         time.Time            `json:"created_at"`
+}
+
+// apiClosure is the closing statement of a closed account as returned by the /v1 API.
+type apiClosure struct {
+	Number            string     `json:"number"`
+	Reason            string     `json:"reason"`
+	TotalCredits      bank.Money `json:"total_credits"`
+	TotalDebits       bank.Money `json:"total_debits"`
+	FinalBalance      bank.Money `json:"final_balance"`
+	SettlementAccount string     `json:"settlement_account,omitempty"`
+	SettlementID      int64      `json:"settlement_transaction_id,omitempty"`
+	ClosedAt          time.Time  `json:"closed_at"`
+}
+
+// postingResponse is the response to a deposit, withdrawal or transfer:
+// the transaction and the account it was requested on, with its new balance.
+type postingResponse struct {
+	Transaction apiTransaction `json:"transaction"`
+	Account     apiAccount     `json:"account"`
+}
+
+// amountRequest is the body of a deposit, withdrawal or balance adjustment.
+type amountRequest struct {
+	Amount   *bank.Money `json:"amount"`
+	Currency string      `json:"currency"` // The account's currency if empty.
+}
+
+// customerRequest is the body of a customer creation or update: the customer's details.
+type customerRequest struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Phone   string `json:"phone"`
+	Address string `json:"address"`
+	Gender  string `json:"gender"`
+	DoB     string `json:"date_of_birth"`
+}
+
+// customer is a function that returns the customer with the details of the request.
+func (r customerRequest) customer() bank.Customer {
+	return bank.Customer{
+		Name:    r.Name,
+		Email:   r.Email,
+		Phone:   r.Phone,
+		Address: r.Address,
+		Gender:  r.Gender,
+		DoB:     r.DoB,
+	}
+}
+
+// openAccountRequest is the body of an account opening: the details of the new customer
+// and the type and currency of their first account.
+type openAccountRequest struct {
+	customerRequest
+	Type     string `json:"type"`
+	Currency string `json:"currency"`
+}
+
+// newAccountRequest is the body of an additional account opening for an existing customer.
+type newAccountRequest struct {
+	Type     string `json:"type"`
+	Currency string `json:"currency"`
+}
+
+// transferRequest is the body of a transfer. The amount is in the currency of the debited account.
+type transferRequest struct {
+	To       string      `json:"to"` // Account number or IBAN.
+	Amount   *bank.Money `json:"amount"`
+	Currency string      `json:"currency"` // The debited account's currency if empty.
+}
+
+// newAPIAccount is a function that converts a bank account to its /v1 representation.
+func newAPIAccount(a *bank.Account) apiAccount {
+	currency := a.Balance.Currency
+	if currency == "" {
+		currency = bank.DefaultCurrency
+	}
+
+	accountType := a.Type
+	if accountType == "" {
+		accountType = bank.CurrentAccount
+	}
+
+	status := a.Status
+	if status == "" {
+		status = bank.StatusActive
+	}
+
+	var overdraft *bank.Money
+	if a.Overdraft.IsPositive() {
+		overdraft = &a.Overdraft
+	}
+
+	return apiAccount{
+		Number:     a.Number,
+		Type:       accountType,
+		Status:     status,
+		CustomerID: a.ID,
+		Name:       a.Name,
+		Email:      a.Email,
+		Phone:      a.Phone,
+		Address:    a.Address,
+		Balance:    a.Balance,
+		Available:  a.Available(),
+		Overdraft:  overdraft,
+		Currency:   currency,
+	}
+}
+
+// newAPICustomer is a function that converts a bank customer to its /v1 representation.
+func newAPICustomer(c *bank.Customer) apiCustomer {
+	return apiCustomer{
+		ID:      c.ID,
+		Name:    c.Name,
+		Email:   c.Email,
+		Phone:   c.Phone,
+		Address: c.Address,
+		Gender:  c.Gender,
+		DoB:     c.DoB,
+	}
+}
+
+// newAPITransaction is a function that converts a posted transaction to its /v1 representation.
+func newAPITransaction(t *bank.Transaction) apiTransaction {
+	currency := t.Amount.Currency
+	if currency == "" {
+		currency = bank.DefaultCurrency
+	}
+
+	createdAt := t.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now().UTC()
+	}
+
+	at := apiTransaction{
+		ID:        t.ID,
+		Type:      t.Type,
+		Amount:    t.Amount,
+		Currency:  currency,
+		Fee:       chargedFee(t),
+		CreatedAt: createdAt,
+	}
+	if t.Rate != nil {
+		at.ConvertedAmount, at.ConvertedCurrency, at.Rate = &t.Converted, t.Converted.Currency, t.Rate
+	}
+	return at
+}
+
+// newAPIClosure is a function that converts a closing statement to its /v1 representation.
+func newAPIClosure(c *bank.ClosingStatement) apiClosure {
+	return apiClosure{
+		Number:            c.Number,
+		Reason:            c.Reason,
+		TotalCredits:      c.TotalCredits,
+		TotalDebits:       c.TotalDebits,
+		FinalBalance:      c.FinalBalance,
+		SettlementAccount: c.SettlementAccount,
+		SettlementID:      c.SettlementID,
+		ClosedAt:          c.ClosedAt,
+	}
+}
+
+// writeJSON is a function that writes v as the JSON body of a response with the given status.
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError is a function that writes err in the /v1 error envelope.
+// Errors of the bank and db packages are given their status and code,
+// and any other error is reported as an internal error without its details.
+func writeError(w http.ResponseWriter, err error) {
+	var e *apiError
+	var fe *bank.FieldError
+	switch {
+	case errors.As(err, &e):
+	case errors.As(err, &fe):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidationFailed, Message: fe.Error(), Field: fe.Field}
+	case errors.Is(err, db.ErrAccountNotFound):
+		e = &apiError{Status: http.StatusNotFound, Code: codeAccountNotFound, Message: err.Error()}
+	case errors.Is(err, db.ErrCustomerNotFound):
+		e = &apiError{Status: http.StatusNotFound, Code: codeCustomerNotFound, Message: err.Error()}
+	case errors.Is(err, db.ErrDuplicate):
+		e = &apiError{Status: http.StatusConflict, Code: codeConflict, Message: err.Error()}
+	case errors.Is(err, bank.ErrInsufficientFunds):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeInsufficientFunds, Message: err.Error()}
+	case errors.Is(err, bank.ErrOverdraftLimitExceeded):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeOverdraftExceeded, Message: err.Error()}
+	case errors.Is(err, bank.ErrNonPositiveAmount):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeInvalidAmount, Message: err.Error()}
+	case errors.Is(err, bank.ErrSameAccount):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeSameAccount, Message: err.Error()}
+	case errors.Is(err, bank.ErrAccountRestricted):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeAccountRestricted, Message: err.Error()}
+	case errors.Is(err, bank.ErrInvalidStatusChange):
+		e = &apiError{Status: http.StatusConflict, Code: codeInvalidStatus, Message: err.Error()}
+	case errors.Is(err, bank.ErrBalanceNotZero):
+		e = &apiError{Status: http.StatusConflict, Code: codeBalanceNotZero, Message: err.Error()}
+	case errors.Is(err, bank.ErrPendingHolds):
+		e = &apiError{Status: http.StatusConflict, Code: codePendingHolds, Message: err.Error()}
+	case errors.Is(err, db.ErrHoldNotFound):
+		e = &apiError{Status: http.StatusNotFound, Code: codeHoldNotFound, Message: err.Error()}
+	case errors.Is(err, db.ErrClosureNotFound):
+		e = &apiError{Status: http.StatusNotFound, Code: codeClosureNotFound, Message: err.Error()}
+	case errors.Is(err, db.ErrOperationNotFound):
+		e = &apiError{Status: http.StatusNotFound, Code: codeOperationNotFound, Message: err.Error()}
+	case errors.Is(err, bank.ErrNotPending):
+		e = &apiError{Status: http.StatusConflict, Code: codeOperationDecided, Message: err.Error()}
+	case errors.Is(err, bank.ErrSameApprover):
+		e = &apiError{Status: http.StatusForbidden, Code: codeForbidden, Message: err.Error()}
+	case errors.Is(err, bank.ErrUnsupportedCurrency):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeInvalidCurrency, Message: err.Error()}
+	case errors.Is(err, bank.ErrRateNotFound):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeRateNotFound, Message: err.Error()}
+	case errors.Is(err, bank.ErrCurrencyMismatch):
+		e = &apiError{Status: http.StatusUnprocessableEntity, Code: codeCurrencyMismatch, Message: err.Error()}
+	default:
+		log.Printf("internal error: %v", err)
+		e = &apiError{Status: http.StatusInternalServerError, Code: codeInternal, Message: "Internal server error"}
+	}
+
+	writeJSON(w, e.Status, errorEnvelope{Error: e})
+}
+
+// methods maps the HTTP methods a /v1 endpoint serves to their handlers.
+// Other methods get a 405 error with an Allow header, and GET handlers also serve HEAD.
+type methods map[string]http.HandlerFunc
+
+func (m methods) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	method := req.Method
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+	if h, ok := m[method]; ok {
+		h(w, req)
+		return
+	}
+
+	allowed := make([]string, 0, len(m))
+	for method := range m {
+		allowed = append(allowed, method)
+	}
+	sort.Strings(allowed)
+
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, &apiError{Status: http.StatusMethodNotAllowed, Code: codeMethodNotAllowed, Message: fmt.Sprintf("Method %s is not allowed, use %s", req.Method, strings.Join(allowed, " or "))})
+}
+
+// decodeJSON is a function that reads the JSON body of the request into v.
+// Unknown fields and trailing data are rejected.
+func decodeJSON(w http.ResponseWriter, req *http.Request, v interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, req.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, bank.ErrInvalidAmount) {
+			return &apiError{Status: http.StatusBadRequest, Code: codeInvalidAmount, Message: "Invalid amount: " + err.Error()}
+		}
+		return &apiError{Status: http.StatusBadRequest, Code: codeInvalidJSON, Message: "Invalid JSON body: " + err.Error()}
+	}
+	if dec.More() {
+		return &apiError{Status: http.StatusBadRequest, Code: codeInvalidJSON, Message: "Invalid JSON body: unexpected data after the object"}
+	}
+	return nil
+}
+
+// validateAccountNumber is a function that returns an error unless number is a well-formed account number
+// with a matching check digit. field names the request field the number came from, if any.
+func validateAccountNumber(number, field string) error {
+	if err := accountnumber.Validate(number); err != nil {
+		return &apiError{Status: http.StatusBadRequest, Code: codeInvalidAccount, Message: strings.ToUpper(err.Error()[:1]) + err.Error()[1:], Field: field}
+	}
+	return nil
+}
+
+// pathAccountNumber is a function that returns the {number} path segment of the request,
+// or an error if it isn't a valid account number.
+func pathAccountNumber(req *http.Request) (string, error) {
+	number := req.PathValue("number")
+	if err := validateAccountNumber(number, ""); err != nil {
+		return "", err
+	}
+	return number, nil
+}
+
+// accountIBAN is a function that returns the IBAN of the account number,
+// or an empty string if the bank has no IBANs.
+func (s *server) accountIBAN(number string) string {
+	if s.iban == nil {
+		return ""
+	}
+	iban, err := s.iban.IBAN(number)
+	if err != nil {
+		return ""
+	}
+	return iban
+}
+
+// resolveAccountNumber is a function that returns the account number an account identifier stands for.
+// The identifier is either an account number or, when the bank has IBANs, the IBAN of one of its accounts,
+// with or without spaces. field names the request field the identifier came from, if any.
+func (s *server) resolveAccountNumber(id, field string) (string, error) {
+	iban := bank.NormalizeIBAN(id)
+	if len(iban) < 2 || !unicode.IsLetter(rune(iban[0])) || !unicode.IsLetter(rune(iban[1])) {
+		return id, validateAccountNumber(id, field)
+	}
+
+	if s.iban == nil {
+		return "", &apiError{Status: http.StatusBadRequest, Code: codeInvalidIBAN, Message: "IBANs are not supported, use the account number", Field: field}
+	}
+	number, err := s.iban.AccountNumber(iban)
+	switch {
+	case errors.Is(err, bank.ErrForeignIBAN):
+		return "", &apiError{Status: http.StatusUnprocessableEntity, Code: codeForeignIBAN, Message: "The IBAN belongs to another bank", Field: field}
+	case err != nil:
+		return "", &apiError{Status: http.StatusBadRequest, Code: codeInvalidIBAN, Message: strings.ToUpper(err.Error()[:1]) + err.Error()[1:], Field: field}
+	}
+	return number, validateAccountNumber(number, field)
+}
+
+// pathCustomerID is a function that returns the {id} path segment of the request,
+// or an error if it isn't a customer ID.
+func pathCustomerID(req *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, &apiError{Status: http.StatusBadRequest, Code: codeInvalidCustomerID, Message: fmt.Sprintf("Invalid customer ID %q", req.PathValue("id"))}
+	}
+	return id, nil
+}
+
+// parseAccountType is a function that returns the account type of a request body, current if it is empty.
+func parseAccountType(s string) (bank.AccountType, error) {
+	accountType, err := bank.ParseAccountType(s)
+	if err != nil {
+		return "", &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidationFailed, Message: "type: " + err.Error(), Field: "type"}
+	}
+	return accountType, nil
+}
+
+// parseCurrency is a function that returns the currency of a request body, or an error if it isn't supported.
+// An empty currency is returned as is when the currency is optional, and as bank.DefaultCurrency otherwise.
+func parseCurrency(s string, optional bool) (string, error) {
+	if s == "" && optional {
+		return "", nil
+	}
+	currency, err := bank.ParseCurrency(s)
+	if err != nil {
+		return "", &apiError{Status: http.StatusUnprocessableEntity, Code: codeInvalidCurrency, Message: "currency: " + err.Error(), Field: "currency"}
+	}
+	return currency, nil
+}
+
+// duplicateEmail is the error reported when a customer's email address is already taken.
+var duplicateEmail = &apiError{Status: http.StatusConflict, Code: codeConflict, Message: "A customer with this email address already exists", Field: "email"}
+
+// requireAmount is a function that returns the amount of a request body in its currency,
+// or an error if it is missing. An amount without a currency is in the currency of the account it is posted to.
+func requireAmount(amount *bank.Money, currency string) (bank.Money, error) {
+	if amount == nil {
+		return bank.Money{}, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: "amount is required"}
+	}
+	currency, err := parseCurrency(currency, true)
+	if err != nil {
+		return bank.Money{}, err
+	}
+
+	m := *amount
+	m.Currency = currency
+	return m, nil
+}
+
+// v1Routes is a function that registers the /v1 API on the mux.
+// Every handler is behind the policy check of its permission, see allow, and customers only reach themselves and their own accounts.
+func (s *server) v1Routes(mux *http.ServeMux) {
+	mux.HandleFunc("/v1/", func(w http.ResponseWriter, req *http.Request) {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: fmt.Sprintf("No such endpoint: %s", req.URL.Path)})
+	})
+	mux.Handle("/v1/customers", methods{http.MethodPost: allow(bank.PermCreateCustomers, s.v1CreateCustomer)})
+	mux.Handle("/v1/customers/{id}", ownCustomer(methods{http.MethodGet: allow(bank.PermReadCustomers, s.v1GetCustomer), http.MethodPut: allow(bank.PermUpdateCustomers, s.v1UpdateCustomer)}))
+	mux.Handle("/v1/customers/{id}/accounts", ownCustomer(methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1CustomerAccounts), http.MethodPost: allow(bank.PermOpenAccounts, s.v1NewAccount)}))
+	mux.Handle("/v1/accounts", methods{http.MethodPost: allow(bank.PermCreateCustomers, s.v1OpenAccount)})
+
+	number := pathValue("number")
+	mux.Handle("/v1/accounts/{number}", s.ownAccount(number, methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1GetAccount)}))
+	mux.Handle("/v1/accounts/{number}/deposits", s.ownAccount(number, methods{http.MethodPost: allow(bank.PermDeposit, s.v1Deposit)}))
+	mux.Handle("/v1/accounts/{number}/withdrawals", s.ownAccount(number, methods{http.MethodPost: allow(bank.PermWithdraw, s.v1Withdraw)}))
+	mux.Handle("/v1/accounts/{number}/transfers", s.ownAccount(number, methods{http.MethodPost: allow(bank.PermTransfer, s.v1Transfer)}))
+	mux.Handle("/v1/accounts/{number}/transactions", s.ownAccount(number, methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1Transactions)}))
+	mux.Handle("/v1/accounts/{number}/statement", s.ownAccount(number, methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1Statement)}))
+	mux.Handle("/v1/accounts/{number}/closure", s.ownAccount(number, methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1Closure)}))
+	s.authRoutes(mux)
+	s.adminRoutes(mux)
+	s.approvalRoutes(mux)
+	s.auditRoutes(mux)
+}
+
+// v1CreateCustomer is a function that handles POST /v1/customers with a customerRequest body.
+// It onboards the customer without opening an account; accounts are opened with POST /v1/customers/{id}/accounts.
+// It responds 201 Created with the new customer and its location, 422 if a detail is invalid,
+// and 409 if the email address is already taken.
+func (s *server) v1CreateCustomer(w http.ResponseWriter, req *http.Request) {
+	var body customerRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	customer, err := s.createCustomer(body.customer())
+	if errors.Is(err, db.ErrDuplicate) {
+		writeError(w, duplicateEmail)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/v1/customers/%d", customer.ID))
+	writeJSON(w, http.StatusCreated, newAPICustomer(customer))
+}
+
+// v1GetCustomer is a function that handles GET /v1/customers/{id}.
+// It returns the customer's details.
+func (s *server) v1GetCustomer(w http.ResponseWriter, req *http.Request) {
+	id, err := pathCustomerID(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	customer, err := s.getCustomer(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPICustomer(customer))
+}
+
+// v1UpdateCustomer is a function that handles PUT /v1/customers/{id} with a customerRequest body.
+// The body replaces all of the customer's details, so optional details left out are cleared.
+// It responds 200 OK with the updated customer, 422 if a detail is invalid,
+// and 409 if the email address belongs to another customer.
+func (s *server) v1UpdateCustomer(w http.ResponseWriter, req *http.Request) {
+	id, err := pathCustomerID(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body customerRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	customer := body.customer()
+	customer.ID = id
+	updated, err := s.updateCustomer(customer)
+	if errors.Is(err, db.ErrDuplicate) {
+		writeError(w, duplicateEmail)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPICustomer(updated))
+}
+
+// v1CustomerAccounts is a function that handles GET /v1/customers/{id}/accounts.
+// It returns the customer's accounts with their balances, in the order they were opened.
+func (s *server) v1CustomerAccounts(w http.ResponseWriter, req *http.Request) {
+	id, err := pathCustomerID(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	accounts, err := s.customerAccounts(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	list := make([]apiAccount, 0, len(accounts))
+	for _, account := range accounts {
+		list = append(list, newAPIAccount(account))
+	}
+	writeJSON(w, http.StatusOK, map[string][]apiAccount{"accounts": list})
+}
+
+// v1NewAccount is a function that handles POST /v1/customers/{id}/accounts with a newAccountRequest body.
+// It opens an additional account of the given type and currency, current and in NGN by default, for an existing customer.
+// It responds 201 Created with the new account and its location, and 404 if there is no such customer.
+func (s *server) v1NewAccount(w http.ResponseWriter, req *http.Request) {
+	id, err := pathCustomerID(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body newAccountRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	accountType, err := parseAccountType(body.Type)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	currency, err := parseCurrency(body.Currency, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	account, err := s.openAccount(id, accountType, currency)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/v1/accounts/"+account.Number)
+	writeJSON(w, http.StatusCreated, newAPIAccount(account))
+}
+
+// v1OpenAccount is a function that handles POST /v1/accounts with an openAccountRequest body.
+// It onboards the customer and opens their first account, current and in NGN by default, with createAccount.
+// It responds 201 Created with the new account and its location, 422 if a detail is invalid,
+// and 409 if the email address is already taken.
+func (s *server) v1OpenAccount(w http.ResponseWriter, req *http.Request) {
+	var body openAccountRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	accountType, err := parseAccountType(body.Type)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	currency, err := parseCurrency(body.Currency, false)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	account, err := s.createAccount(body.customer(), accountType, currency)
+	if errors.Is(err, db.ErrDuplicate) {
+		writeError(w, duplicateEmail)
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Location", "/v1/accounts/"+account.Number)
+	writeJSON(w, http.StatusCreated, newAPIAccount(account))
+}
+
+// v1GetAccount is a function that handles GET /v1/accounts/{number}.
+// It returns the account with its owner's details and current balance.
+func (s *server) v1GetAccount(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	account, err := s.getAccountByNumber(number)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIAccount(account))
+}
+
+// v1Deposit is a function that handles POST /v1/accounts/{number}/deposits with an amountRequest body.
+// It responds 201 Created with the deposit and the account's new balance,
+// or 202 Accepted with the operation awaiting approval if the amount is over the approval limit.
+func (s *server) v1Deposit(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body amountRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	amount, err := requireAmount(body.Amount, body.Currency)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	o := &bank.PendingOperation{Type: bank.DepositTransaction, Account: number, Amount: amount}
+	if pending, err := s.submitForApproval(req, o); err != nil || pending {
+		v1Submitted(w, o, err)
+		return
+	}
+
+	account, transaction, err := s.postDeposit(s.store, number, amount)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, postingResponse{newAPITransaction(transaction), newAPIAccount(account)})
+}
+
+// v1Withdraw is a function that handles POST /v1/accounts/{number}/withdrawals with an amountRequest body.
+// It responds 201 Created with the withdrawal and the account's new balance,
+// or 202 Accepted with the operation awaiting approval if the amount is over the approval limit.
+func (s *server) v1Withdraw(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body amountRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	amount, err := requireAmount(body.Amount, body.Currency)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	o := &bank.PendingOperation{Type: bank.WithdrawalTransaction, Account: number, Amount: amount}
+	if pending, err := s.submitForApproval(req, o); err != nil || pending {
+		v1Submitted(w, o, err)
+		return
+	}
+
+	account, transaction, err := s.postWithdrawal(s.store, number, amount)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, postingResponse{newAPITransaction(transaction), newAPIAccount(account)})
+}
+
+// v1Transfer is a function that handles POST /v1/accounts/{number}/transfers with a transferRequest body.
+// The account in the path is debited and the "to" account is credited.
+// Either account may be given by its number or by its IBAN. Between accounts of different currencies,
+// the amount is converted at the server's rates and the response shows the rate and converted amount.
+// It responds 201 Created with the transfer and the debited account's new balance,
+// or 202 Accepted with the operation awaiting approval if the amount is over the approval limit.
+func (s *server) v1Transfer(w http.ResponseWriter, req *http.Request) {
+	number, err := s.resolveAccountNumber(req.PathValue("number"), "")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body transferRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	to, err := s.resolveAccountNumber(body.To, "to")
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	amount, err := requireAmount(body.Amount, body.Currency)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	o := &bank.PendingOperation{Type: bank.TransferTransaction, Account: number, To: to, Amount: amount}
+	if pending, err := s.submitForApproval(req, o); err != nil || pending {
+		v1Submitted(w, o, err)
+		return
+	}
+
+	account, transaction, err := s.postTransfer(s.store, number, to, amount)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusCreated, postingResponse{newAPITransaction(transaction), newAPIAccount(account)})
+}
+
+// v1Transactions is a function that handles GET /v1/accounts/{number}/transactions.
+// It takes the same filters as the transactions handler and returns a page of the history as JSON.
+func (s *server) v1Transactions(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	filter, err := parseHistoryFilter(req)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	account, err := s.getAccountByNumber(number)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	lines, cursor, err := s.getTransactions(account.Number, filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Account      apiAccount           `json:"account"`
+		Transactions []bank.StatementLine `json:"transactions"`
+		NextCursor   string               `json:"next_cursor,omitempty"`
+	}{newAPIAccount(account), lines, cursor})
+}
+
+// v1Statement is a function that handles GET /v1/accounts/{number}/statement.
+// It takes the same "from", "to" and "format" parameters as the statement handler,
+// and always covers a period, the current month by default.
+func (s *server) v1Statement(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	format := statementFormat(req)
+	if format == "" {
+		writeError(w, &apiError{Status: http.StatusNotAcceptable, Code: codeNotAcceptable, Message: "Unsupported statement format"})
+		return
+	}
+
+	from, to, err := parsePeriod(req.URL.Query().Get("from"), req.URL.Query().Get("to"))
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	account, err := s.getAccountByNumber(number)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	statement := accountStatement{
+		Name:      account.Name,
+		Address:   account.Address,
+		Phone:     account.Phone,
+		Number:    account.Number,
+		IBAN:      s.accountIBAN(account.Number),
+		Balance:   account.Balance,
+		Overdraft: newStatementOverdraft(account),
+		Date:      time.Now().UTC(),
+	}
+	if statement.Period, err = s.getPeriodStatement(account, from, to); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	renderer := statementRenderers[format]
+	w.Header().Set("Content-Type", renderer.ContentType())
+	if format != "json" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"statement-%s.%s\"", account.Number, format))
+	}
+	renderer.Render(w, &statement)
+}
+
+// v1Closure is a function that handles GET /v1/accounts/{number}/closure.
+// It returns the closing statement of a closed account, and 404 if the account hasn't been closed.
+func (s *server) v1Closure(w http.ResponseWriter, req *http.Request) {
+	number, err := pathAccountNumber(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	if _, err := s.getAccountByNumber(number); err != nil {
+		writeError(w, err)
+		return
+	}
+	closure, err := s.store.Accounts().GetClosure(number)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIClosure(closure))
+}
@@ -0,0 +1,393 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/bank/accountnumber"
+	"github.com/themobileprof/db"
+)
+
+// serveAPI sends the request through the server's routes and returns the response.
+func serveAPI(t *testing.T, s *server, method, path, body string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest(method, path, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	rr := httptest.NewRecorder()
+	s.routes().ServeHTTP(rr, req)
+	return rr
+}
+
+// errorCode returns the code of the error envelope in the response, failing the test if there is none.
+func errorCode(t *testing.T, rr *httptest.ResponseRecorder) string {
+	var envelope errorEnvelope
+	if err := json.Unmarshal(rr.Body.Bytes(), &envelope); err != nil || envelope.Error == nil {
+		t.Fatalf("response is not an error envelope: %v: %s", err, rr.Body.String())
+	}
+	if envelope.Error.Message == "" {
+		t.Errorf("error %q has no message", envelope.Error.Code)
+	}
+	return envelope.Error.Code
+}
+
+func TestAPIPostings(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100.50}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("unexpected content type %q", ct)
+	}
+
+	var posting postingResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &posting); err != nil {
+		t.Fatal(err)
+	}
+	if posting.Transaction.ID == 0 || posting.Transaction.Type != "deposit" || posting.Account.Balance.String() != "100.50" {
+		t.Errorf("unexpected deposit response: %s", rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": "0.50"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts/0017286378/transfers", `{"to": "0018989350", "amount": 40}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0018989350", "")
+	var account apiAccount
+	if err := json.Unmarshal(rr.Body.Bytes(), &account); err != nil {
+		t.Fatal(err)
+	}
+	if rr.Code != http.StatusOK || account.Balance.String() != "40.00" || account.Currency != "NGN" || account.Name != "Sam Song" {
+		t.Errorf("unexpected account: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378/transactions?limit=2", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"next_cursor"`) {
+		t.Errorf("unexpected transactions page: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378/statement?format=csv", "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv" {
+		t.Errorf("unexpected statement: %d %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+}
+
+func TestAPIErrors(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"GET", "/v1/accounts/0017286378/deposits", "", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"DELETE", "/v1/accounts/0017286378", "", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+		{"GET", "/v1/nowhere", "", http.StatusNotFound, codeNotFound},
+		{"GET", "/v1/accounts/00172x6376", "", http.StatusBadRequest, codeInvalidAccount},
+		{"GET", "/v1/accounts/0000000000", "", http.StatusNotFound, codeAccountNotFound},
+		{"GET", "/v1/accounts/0017286387", "", http.StatusBadRequest, codeInvalidAccount},
+		{"GET", "/v1/accounts/1e5", "", http.StatusBadRequest, codeInvalidAccount},
+		{"GET", "/v1/accounts/-3", "", http.StatusBadRequest, codeInvalidAccount},
+		{"POST", "/v1/accounts/0017286378/deposits", `{"amount": 10`, http.StatusBadRequest, codeInvalidJSON},
+		{"POST", "/v1/accounts/0017286378/deposits", `{"amount": 10, "note": "hi"}`, http.StatusBadRequest, codeInvalidJSON},
+		{"POST", "/v1/accounts/0017286378/deposits", `{}`, http.StatusBadRequest, codeInvalidRequest},
+		{"POST", "/v1/accounts/0017286378/deposits", `{"amount": 10.555}`, http.StatusBadRequest, codeInvalidAmount},
+		{"POST", "/v1/accounts/0017286378/deposits", `{"amount": -5}`, http.StatusUnprocessableEntity, codeInvalidAmount},
+		{"POST", "/v1/accounts/0000000000/deposits", `{"amount": 5}`, http.StatusNotFound, codeAccountNotFound},
+		{"POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 5}`, http.StatusUnprocessableEntity, codeInsufficientFunds},
+		{"POST", "/v1/accounts/0017286378/transfers", `{"to": "0017286378", "amount": 5}`, http.StatusUnprocessableEntity, codeSameAccount},
+		{"POST", "/v1/accounts/0017286378/transfers", `{"to": "", "amount": 5}`, http.StatusBadRequest, codeInvalidAccount},
+		{"POST", "/v1/accounts/0017286378/transfers", `{"to": "0000000000", "amount": 5}`, http.StatusNotFound, codeAccountNotFound},
+		{"GET", "/v1/accounts/0017286378/transactions?type=loan", "", http.StatusBadRequest, codeInvalidRequest},
+		{"GET", "/v1/accounts/0017286378/statement?format=xls", "", http.StatusNotAcceptable, codeNotAcceptable},
+		{"GET", "/v1/accounts/0017286378/statement?from=2024-02-01&to=2024-01-01", "", http.StatusBadRequest, codeInvalidRequest},
+	}
+
+	for _, tt := range tests {
+		rr := serveAPI(t, s, tt.method, tt.path, tt.body)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d but got %d: %s", tt.method, tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if code := errorCode(t, rr); code != tt.code {
+			t.Errorf("%s %s %s: expected code %q but got %q", tt.method, tt.path, tt.body, tt.code, code)
+		}
+	}
+
+	rr := serveAPI(t, s, "PUT", "/v1/accounts/0017286378/transfers", "")
+	if allow := rr.Header().Get("Allow"); allow != http.MethodPost {
+		t.Errorf("expected Allow: POST, got %q", allow)
+	}
+}
+
+func TestAPIOpenAccount(t *testing.T) {
+	s := newServer(db.NewMemoryStore())
+
+	body := `{"name": "Ada Obi", "email": "ada@example.com", "phone": "+234 803 555 0147", "gender": "Female", "date_of_birth": "1990-04-12"}`
+	rr := serveAPI(t, s, "POST", "/v1/accounts", body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var account apiAccount
+	if err := json.Unmarshal(rr.Body.Bytes(), &account); err != nil {
+		t.Fatal(err)
+	}
+	if !accountnumber.Valid(account.Number) || account.Name != "Ada Obi" || !account.Balance.IsZero() {
+		t.Errorf("unexpected account: %s", rr.Body.String())
+	}
+	if location := rr.Header().Get("Location"); location != "/v1/accounts/"+account.Number {
+		t.Errorf("unexpected location %q", location)
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/accounts/"+account.Number, "")
+	if rr.Code != http.StatusOK {
+		t.Errorf("new account not found: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts", body)
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codeConflict {
+		t.Errorf("expected a conflict for a taken email, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts", `{"name": "Ada Obi", "email": "ada@example"}`)
+	var envelope errorEnvelope
+	json.Unmarshal(rr.Body.Bytes(), &envelope)
+	if rr.Code != http.StatusUnprocessableEntity || envelope.Error == nil || envelope.Error.Code != codeValidationFailed || envelope.Error.Field != "email" {
+		t.Errorf("expected a validation error on email, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAPICustomers(t *testing.T) {
+	s := newServer(newTestStore(t))
+
+	rr := serveAPI(t, s, "POST", "/v1/customers", `{"name": "Ada Obi", "email": "ada@example.com"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var customer apiCustomer
+	if err := json.Unmarshal(rr.Body.Bytes(), &customer); err != nil {
+		t.Fatal(err)
+	}
+	location := rr.Header().Get("Location")
+	if customer.ID == 0 || location != fmt.Sprintf("/v1/customers/%d", customer.ID) {
+		t.Fatalf("unexpected customer: %s at %q", rr.Body.String(), location)
+	}
+
+	rr = serveAPI(t, s, "PUT", location, `{"name": "Ada Obi", "email": "ada.obi@example.com", "gender": "female"}`)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"gender":"Female"`) {
+		t.Errorf("unexpected update: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveAPI(t, s, "GET", location, "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "ada.obi@example.com") {
+		t.Errorf("update not stored: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// A customer can hold several accounts
+	for _, body := range []string{`{}`, `{"type": "savings"}`} {
+		rr = serveAPI(t, s, "POST", location+"/accounts", body)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+	}
+	var account apiAccount
+	json.Unmarshal(rr.Body.Bytes(), &account)
+	serveAPI(t, s, "POST", "/v1/accounts/"+account.Number+"/deposits", `{"amount": 25}`)
+
+	rr = serveAPI(t, s, "GET", location+"/accounts", "")
+	var list struct{ Accounts []apiAccount }
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatal(err)
+	}
+	if len(list.Accounts) != 2 || list.Accounts[0].Type != bank.CurrentAccount || list.Accounts[1].Type != bank.SavingsAccount ||
+		list.Accounts[1].Balance.String() != "25.00" || list.Accounts[1].CustomerID != customer.ID {
+		t.Errorf("unexpected accounts: %s", rr.Body.String())
+	}
+
+	// The first account can be chosen when onboarding too
+	rr = serveAPI(t, s, "POST", "/v1/accounts", `{"name": "Sam Song", "email": "sam@example.com", "type": "savings"}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"type":"savings"`) {
+		t.Errorf("unexpected account: %d %s", rr.Code, rr.Body.String())
+	}
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"GET", "/v1/customers/abc", "", http.StatusBadRequest, codeInvalidCustomerID},
+		{"GET", "/v1/customers/0", "", http.StatusBadRequest, codeInvalidCustomerID},
+		{"GET", "/v1/customers/99", "", http.StatusNotFound, codeCustomerNotFound},
+		{"PUT", "/v1/customers/99", `{"name": "Nobody", "email": "nobody@example.com"}`, http.StatusNotFound, codeCustomerNotFound},
+		{"PUT", location, `{"name": "Ada Obi", "email": "sam@example.com"}`, http.StatusConflict, codeConflict},
+		{"PUT", location, `{"name": ""}`, http.StatusUnprocessableEntity, codeValidationFailed},
+		{"POST", "/v1/customers", `{"name": "Ada", "email": "ada.obi@example.com"}`, http.StatusConflict, codeConflict},
+		{"POST", "/v1/customers/99/accounts", `{}`, http.StatusNotFound, codeCustomerNotFound},
+		{"POST", location + "/accounts", `{"type": "loan"}`, http.StatusUnprocessableEntity, codeValidationFailed},
+		{"GET", "/v1/customers/99/accounts", "", http.StatusNotFound, codeCustomerNotFound},
+		{"DELETE", location, "", http.StatusMethodNotAllowed, codeMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		rr := serveAPI(t, s, tt.method, tt.path, tt.body)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d but got %d: %s", tt.method, tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if code := errorCode(t, rr); code != tt.code {
+			t.Errorf("%s %s %s: expected code %q but got %q", tt.method, tt.path, tt.body, tt.code, code)
+		}
+	}
+
+	rr = serveAPI(t, s, "DELETE", location, "")
+	if allow := rr.Header().Get("Allow"); allow != "GET, PUT" {
+		t.Errorf("expected Allow: GET, PUT, got %q", allow)
+	}
+}
+
+func TestAPITransferIBAN(t *testing.T) {
+	s := newTestServer(t)
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`)
+
+	rr := serveAPI(t, s, "POST", "/v1/accounts/0017286378/transfers", `{"to": "DE89370400440532013000", "amount": 5}`)
+	if rr.Code != http.StatusBadRequest || errorCode(t, rr) != codeInvalidIBAN {
+		t.Errorf("expected IBANs to be refused without an IBAN scheme: %d %s", rr.Code, rr.Body.String())
+	}
+
+	var err error
+	if s.iban, err = bank.NewIBANScheme("DE", "37040044", accountnumber.Length); err != nil {
+		t.Fatal(err)
+	}
+	from, _ := s.iban.IBAN("0017286378")
+	to, _ := s.iban.IBAN("0018989350")
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts/"+from+"/transfers", fmt.Sprintf(`{"to": %q, "amount": 40}`, bank.FormatIBAN(to)))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var posting postingResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &posting); err != nil {
+		t.Fatal(err)
+	}
+	if posting.Account.Number != "0017286378" || posting.Account.Balance.String() != "60.00" {
+		t.Errorf("unexpected transfer response: %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		to     string
+		status int
+		code   string
+	}{
+		{"GB82WEST12345698765432", http.StatusUnprocessableEntity, codeForeignIBAN},
+		{to[:2] + "00" + to[4:], http.StatusBadRequest, codeInvalidIBAN},
+		{"DE", http.StatusBadRequest, codeInvalidIBAN},
+	}
+	for _, tt := range tests {
+		rr := serveAPI(t, s, "POST", "/v1/accounts/0017286378/transfers", fmt.Sprintf(`{"to": %q, "amount": 5}`, tt.to))
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d but got %d: %s", tt.to, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if code := errorCode(t, rr); code != tt.code {
+			t.Errorf("%s: expected code %q but got %q", tt.to, tt.code, code)
+		}
+	}
+
+	// The legacy endpoint takes IBANs too, and statements show them
+	rr = serveAPI(t, s, "POST", "/transfer?from="+to+"&to=0017286378&amount=15", "")
+	if !strings.Contains(rr.Body.String(), `"IBAN":"`+to+`"`) || !strings.Contains(rr.Body.String(), `"Balance":25.00`) {
+		t.Errorf("unexpected legacy transfer response: %s", rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378/statement", "")
+	if !strings.Contains(rr.Body.String(), `"IBAN":"`+from+`"`) {
+		t.Errorf("expected the statement to show the IBAN: %s", rr.Body.String())
+	}
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378/statement?format=pdf", "")
+	if !strings.Contains(rr.Body.String(), "IBAN: "+bank.FormatIBAN(from)) {
+		t.Error("expected the PDF statement to show the IBAN")
+	}
+}
+
+func TestAPICurrencies(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := serveAPI(t, s, "POST", "/v1/customers/1/accounts", `{"currency": "usd"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var usd apiAccount
+	if err := json.Unmarshal(rr.Body.Bytes(), &usd); err != nil {
+		t.Fatal(err)
+	}
+	if usd.Currency != "USD" {
+		t.Errorf("expected a USD account, got %s", rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts/"+usd.Number+"/deposits", `{"amount": 100}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"currency":"USD"`) {
+		t.Fatalf("expected the deposit to be in the account's currency: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "POST", "/v1/accounts/"+usd.Number+"/transfers", `{"to": "0017286378", "amount": 10}`)
+	if rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeRateNotFound {
+		t.Errorf("expected a transfer without a rate to be refused: %d %s", rr.Code, rr.Body.String())
+	}
+
+	rate, _ := bank.ParseRate("USD", "NGN", "1500")
+	s.rates = bank.NewStaticRates(rate)
+	rr = serveAPI(t, s, "POST", "/v1/accounts/"+usd.Number+"/transfers", `{"to": "0017286378", "amount": 10}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	var posting postingResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &posting); err != nil {
+		t.Fatal(err)
+	}
+	tx := posting.Transaction
+	if tx.Currency != "USD" || tx.Amount.String() != "10.00" || tx.ConvertedCurrency != "NGN" || tx.ConvertedAmount == nil || tx.ConvertedAmount.String() != "15000.00" ||
+		!strings.Contains(rr.Body.String(), `"rate":1500.000000`) || posting.Account.Balance.String() != "90.00" {
+		t.Errorf("unexpected exchange: %s", rr.Body.String())
+	}
+
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0017286378", "")
+	if !strings.Contains(rr.Body.String(), `"balance":15000.00`) || !strings.Contains(rr.Body.String(), `"currency":"NGN"`) {
+		t.Errorf("expected 15000.00 NGN to be credited: %s", rr.Body.String())
+	}
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"POST", "/v1/customers/1/accounts", `{"currency": "GBP"}`, http.StatusUnprocessableEntity, codeInvalidCurrency},
+		{"POST", "/v1/accounts/" + usd.Number + "/deposits", `{"amount": 5, "currency": "NGN"}`, http.StatusUnprocessableEntity, codeCurrencyMismatch},
+		{"POST", "/v1/accounts/" + usd.Number + "/deposits", `{"amount": 5, "currency": "XYZ"}`, http.StatusUnprocessableEntity, codeInvalidCurrency},
+		{"POST", "/v1/accounts/" + usd.Number + "/transfers", `{"to": "0017286378", "amount": 5, "currency": "NGN"}`, http.StatusUnprocessableEntity, codeCurrencyMismatch},
+	}
+	for _, tt := range tests {
+		rr := serveAPI(t, s, tt.method, tt.path, tt.body)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s %s: expected status %d but got %d: %s", tt.method, tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if code := errorCode(t, rr); code != tt.code {
+			t.Errorf("%s %s %s: expected code %q but got %q", tt.method, tt.path, tt.body, tt.code, code)
+		}
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+// decisionRequest is the body of an approval or rejection: why the operation was approved or rejected.
+type decisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// apiOperation is an operation awaiting approval, or decided, as returned by the /v1 API.
+type apiOperation struct {
+	ID            int64                `json:"id"`
+	Type          bank.TransactionType `json:"type"`
+	Account       string               `json:"account"`
+	To            string               `json:"to,omitempty"`
+	Amount        bank.Money           `json:"amount"`
+	Currency      string               `json:"currency"`
+	Note          string               `json:"note,omitempty"`
+	Status        bank.OperationStatus `json:"status"`
+	RequestedBy   string               `json:"requested_by"`
+	RequestedAt   time.Time            `json:"requested_at"`
+	DecidedBy     string               `json:"decided_by,omitempty"`
+	DecidedAt     *time.Time           `json:"decided_at,omitempty"`
+	Reason        string               `json:"reason,omitempty"`
+	TransactionID int64                `json:"transaction_id,omitempty"`
+}
+
+// newAPIOperation is a function that converts a pending operation to its /v1 representation.
+func newAPIOperation(o *bank.PendingOperation) apiOperation {
+	op := apiOperation{
+		ID:            o.ID,
+		Type:          o.Type,
+		Account:       o.Account,
+		To:            o.To,
+		Amount:        o.Amount,
+		Currency:      o.Amount.Currency,
+		Note:          o.Note,
+		Status:        o.Status,
+		RequestedBy:   o.RequestedBy,
+		RequestedAt:   o.RequestedAt,
+		DecidedBy:     o.DecidedBy,
+		Reason:        o.Reason,
+		TransactionID: o.Transaction,
+	}
+	if !o.DecidedAt.IsZero() {
+		op.DecidedAt = &o.DecidedAt
+	}
+	return op
+}
+
+// approvalResponse is the response to an approval: the operation and what posting it did.
+type approvalResponse struct {
+	Operation   apiOperation   `json:"operation"`
+	Transaction apiTransaction `json:"transaction"`
+	Account     apiAccount     `json:"account"`
+}
+
+// requester is a function that returns who made the request, as recorded on the operations it submits for approval.
+// Requests are made by nobody until the server authenticates them.
+func requester(req *http.Request) string {
+	if p := principalOf(req); p != nil {
+		return p.String()
+	}
+	return ""
+}
+
+// submitForApproval is a function that stores the deposit, withdrawal, transfer or closure as awaiting approval,
+// instead of posting it, if its amount is over the server's approval limit of its currency.
+// Balance adjustments are always stored to await approval, whatever their amount.
+// An amount without a currency is in the currency of the account. It reports whether the operation was stored,
+// and reports a missing account with an error wrapping db.ErrAccountNotFound.
+func (s *server) submitForApproval(req *http.Request, o *bank.PendingOperation) (bool, error) {
+	always := o.Type == bank.AdjustmentTransaction
+	if len(s.approvalLimits) == 0 && !always {
+		return false, nil
+	}
+
+	account, err := s.getAccountByNumber(o.Account)
+	if err != nil {
+		return false, err
+	}
+	if o.Amount.Currency == "" {
+		o.Amount.Currency = account.Currency()
+	}
+	if !always && !s.approvalLimits.NeedsApproval(o.Amount) {
+		return false, nil
+	}
+	if o.To != "" {
+		if _, err := s.getAccountByNumber(o.To); err != nil {
+			return false, err
+		}
+	}
+
+	o.Status, o.RequestedBy = bank.OperationPending, requester(req)
+	return true, s.store.Approvals().InsertOperation(o)
+}
+
+// v1Submitted is a function that responds 202 Accepted with an operation submitForApproval stored,
+// or with the error it returned.
+func v1Submitted(w http.ResponseWriter, o *bank.PendingOperation, err error) {
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	w.Header().Set("Location", fmt.Sprintf("/v1/admin/operations/%d", o.ID))
+	writeJSON(w, http.StatusAccepted, newAPIOperation(o))
+}
+
+// legacySubmitted is a function that tells the caller of a legacy endpoint that the operation awaits approval,
+// or why it couldn't be submitted.
+func legacySubmitted(w http.ResponseWriter, o *bank.PendingOperation, err error) {
+	if err != nil {
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+	fmt.Fprintf(w, "The %s of %s %s awaits approval as operation %d", o.Type, o.Amount, o.Amount.Currency, o.ID)
+}
+
+// postOperation is a function that posts the approved operation in the store, which the approval runs in.
+func (s *server) postOperation(tx db.Store, o *bank.PendingOperation) (*bank.Account, *bank.Transaction, error) {
+	switch o.Type {
+	case bank.DepositTransaction:
+		return s.postDeposit(tx, o.Account, o.Amount)
+	case bank.WithdrawalTransaction:
+		return s.postWithdrawal(tx, o.Account, o.Amount)
+	case bank.TransferTransaction:
+		return s.postTransfer(tx, o.Account, o.To, o.Amount)
+	case bank.AdjustmentTransaction:
+		return s.postAdjustment(tx, o.Account, o.Amount)
+	case bank.ClosureOperation:
+		return s.postClosure(tx, o)
+	}
+	return nil, nil, fmt.Errorf("operation %d: cannot post a %s", o.ID, o.Type)
+}
+
+// postClosure is a function that closes the account of the approved closure in the store, sweeping its balance
+// to the settlement account, and returns the closed account and the sweep. The balance must still be the amount approved;
+// if it changed, nothing is posted and it responds 409, so the closure can be rejected and requested again.
+func (s *server) postClosure(tx db.Store, o *bank.PendingOperation) (*bank.Account, *bank.Transaction, error) {
+	account, statement, err := s.using(tx).closeAccount(o.Account, o.To, o.Note)
+	if err != nil {
+		return nil, nil, err
+	}
+	if statement.Settlement == nil || statement.FinalBalance.Amount != o.Amount.Amount {
+		return nil, nil, &apiError{Status: http.StatusConflict, Code: codeConflict, Message: fmt.Sprintf("The balance of account %s is %s, not the %s approved for its closure", o.Account, statement.FinalBalance, o.Amount)}
+	}
+	return account, statement.Settlement, nil
+}
+
+// approveOperation is a function that records the approver's approval of the operation with the given ID and posts it,
+// inside a single store transaction. If the posting fails, such as for insufficient funds, nothing is recorded
+// and the operation stays pending.
+func (s *server) approveOperation(id int64, approver, reason string) (*bank.PendingOperation, *bank.Account, *bank.Transaction, error) {
+	var o *bank.PendingOperation
+	var account *bank.Account
+	var transaction *bank.Transaction
+	err := s.store.Atomic(func(tx db.Store) error {
+		var err error
+		if o, err = tx.Approvals().GetOperation(id); err != nil {
+			return err
+		}
+		if err := o.Decide(approver, true, reason, time.Now().UTC()); err != nil {
+			return err
+		}
+
+		if account, transaction, err = s.postOperation(tx, o); err != nil {
+			return err
+		}
+		o.Transaction = transaction.ID
+		return tx.Approvals().DecideOperation(o)
+	})
+	return o, account, transaction, err
+}
+
+// rejectOperation is a function that records the approver's rejection of the operation with the given ID.
+func (s *server) rejectOperation(id int64, approver, reason string) (*bank.PendingOperation, error) {
+	var o *bank.PendingOperation
+	err := s.store.Atomic(func(tx db.Store) error {
+		var err error
+		if o, err = tx.Approvals().GetOperation(id); err != nil {
+			return err
+		}
+		if err := o.Decide(approver, false, reason, time.Now().UTC()); err != nil {
+			return err
+		}
+		return tx.Approvals().DecideOperation(o)
+	})
+	return o, err
+}
+
+// approvalRoutes is a function that registers the /v1/admin/operations endpoints on the mux.
+// Deposits, withdrawals, transfers and closure sweeps over the approval limits, and every balance adjustment, wait there
+// until someone other than who requested them, with the operations:approve permission, approves or rejects them. Only the back office uses them.
+func (s *server) approvalRoutes(mux *http.ServeMux) {
+	mux.Handle("/v1/admin/operations", backOfficeOnly(methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1Operations)}))
+	mux.Handle("/v1/admin/operations/{id}", backOfficeOnly(methods{http.MethodGet: allow(bank.PermReadAccounts, s.v1Operation)}))
+	mux.Handle("/v1/admin/operations/{id}/approve", backOfficeOnly(methods{http.MethodPost: allow(bank.PermApprove, s.v1Approve)}))
+	mux.Handle("/v1/admin/operations/{id}/reject", backOfficeOnly(methods{http.MethodPost: allow(bank.PermApprove, s.v1Reject)}))
+}
+
+// pathOperationID is a function that returns the operation ID of the {id} path segment.
+func pathOperationID(req *http.Request) (int64, error) {
+	id, err := strconv.ParseInt(req.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		return 0, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: fmt.Sprintf("Invalid operation ID %q", req.PathValue("id"))}
+	}
+	return id, nil
+}
+
+// v1Operations is a function that handles GET /v1/admin/operations.
+// It returns the operations submitted for approval, oldest first, with the status of the "status" query parameter
+// if it is given, such as "pending" for those awaiting a decision.
+func (s *server) v1Operations(w http.ResponseWriter, req *http.Request) {
+	var status bank.OperationStatus
+	if qs := req.URL.Query().Get("status"); qs != "" {
+		var err error
+		if status, err = bank.ParseOperationStatus(qs); err != nil {
+			writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: err.Error()})
+			return
+		}
+	}
+
+	operations, err := s.store.Approvals().Operations(status)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	list := make([]apiOperation, 0, len(operations))
+	for _, o := range operations {
+		list = append(list, newAPIOperation(o))
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Operations []apiOperation `json:"operations"`
+	}{list})
+}
+
+// v1Operation is a function that handles GET /v1/admin/operations/{id}.
+// It returns the operation with its decision trail.
+func (s *server) v1Operation(w http.ResponseWriter, req *http.Request) {
+	id, err := pathOperationID(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	o, err := s.store.Approvals().GetOperation(id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIOperation(o))
+}
+
+// v1Approve is a function that handles POST /v1/admin/operations/{id}/approve with a decisionRequest body,
+// whose reason is optional.
+// It posts the operation and responds 200 OK with it, the transaction and the account's new balance.
+// It responds 403 to whoever requested the operation, 409 if it was already decided,
+// and with the error of the posting, such as 422 for insufficient funds, which leaves the operation pending.
+func (s *server) v1Approve(w http.ResponseWriter, req *http.Request) {
+	id, err := pathOperationID(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var body decisionRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	o, account, transaction, err := s.approveOperation(id, requester(req), body.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, approvalResponse{newAPIOperation(o), newAPITransaction(transaction), newAPIAccount(account)})
+}
+
+// v1Reject is a function that handles POST /v1/admin/operations/{id}/reject with a decisionRequest body.
+// The reason is required. It responds 200 OK with the rejected operation, 403 to whoever requested it
+// and 409 if it was already decided.
+func (s *server) v1Reject(w http.ResponseWriter, req *http.Request) {
+	id, err := pathOperationID(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	var body decisionRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	reason, err := requireReason(body.Reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	o, err := s.rejectOperation(id, requester(req), reason)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, newAPIOperation(o))
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+// decodeOperation decodes the operation of the response.
+func decodeOperation(t *testing.T, rr *httptest.ResponseRecorder) apiOperation {
+	var o apiOperation
+	if err := json.Unmarshal(rr.Body.Bytes(), &o); err != nil {
+		t.Fatalf("expected an operation, got %s", rr.Body.String())
+	}
+	return o
+}
+
+// balance returns the balance of the account, in minor units.
+func balance(t *testing.T, s *server, number string) int64 {
+	account, err := s.store.Accounts().GetAccountByNumber(number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return account.Balance.Amount
+}
+
+func TestApprovals(t *testing.T) {
+	s, admin := newAuthServer(t)
+	s.approvalLimits, _ = bank.ParseApprovalLimits("NGN 1000")
+	approver := staffKey(t, s, "supervisor", bank.RoleApprover)
+	teller := staffKey(t, s, "counter", bank.RoleTeller)
+	jane := signIn(t, s, admin, "1", "jane")
+
+	// Amounts up to the limit move at once, larger ones wait
+	if rr := serveWith(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 1000}`, admin); rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	rr := serveWith(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 5000}`, admin)
+	deposit := decodeOperation(t, rr)
+	if rr.Code != http.StatusAccepted || deposit.Status != bank.OperationPending || deposit.RequestedBy != "key:back-office" || deposit.Currency != "NGN" || rr.Header().Get("Location") != "/v1/admin/operations/1" {
+		t.Errorf("expected the deposit to await approval, got %d %s", rr.Code, rr.Body.String())
+	}
+	if got := balance(t, s, "0017286378"); got != 100000 {
+		t.Errorf("expected the pending deposit not to move money, got a balance of %d", got)
+	}
+
+	rr = serveWith(s, "POST", "/v1/accounts/0017286378/transfers", `{"to": "0018989350", "amount": 1500}`, jane)
+	transfer := decodeOperation(t, rr)
+	if rr.Code != http.StatusAccepted || transfer.RequestedBy != "customer:1" || transfer.To != "0018989350" {
+		t.Errorf("expected the transfer to await approval, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveWith(s, "POST", "/transfer?from=0017286378&to=0018989350&amount=2000", "", jane)
+	if !strings.Contains(rr.Body.String(), "The transfer of 2000.00 NGN awaits approval as operation 3") {
+		t.Errorf("expected the legacy transfer to await approval, got %s", rr.Body.String())
+	}
+	rr = serveWith(s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 1001}`, teller)
+	if rr.Code != http.StatusAccepted {
+		t.Errorf("expected the withdrawal to await approval, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Someone else, with the approve permission, decides
+	tests := []struct {
+		path, body string
+		headers    map[string]string
+		status     int
+		code       string
+	}{
+		{"/v1/admin/operations/1/approve", `{}`, teller, http.StatusForbidden, codeForbidden},
+		{"/v1/admin/operations/1/approve", `{}`, jane, http.StatusForbidden, codeForbidden},
+		{"/v1/admin/operations/1/approve", `{}`, admin, http.StatusForbidden, codeForbidden},
+		{"/v1/admin/operations/1/approve", `{"reason": "Cash counted"}`, approver, http.StatusOK, ""},
+		{"/v1/admin/operations/1/approve", `{}`, approver, http.StatusConflict, codeOperationDecided},
+		{"/v1/admin/operations/1/reject", `{"reason": "Too late"}`, approver, http.StatusConflict, codeOperationDecided},
+		{"/v1/admin/operations/3/reject", `{}`, approver, http.StatusUnprocessableEntity, codeValidationFailed},
+		{"/v1/admin/operations/3/reject", `{"reason": "Duplicate of operation 2"}`, approver, http.StatusOK, ""},
+		{"/v1/admin/operations/2/approve", `{}`, admin, http.StatusOK, ""},
+		{"/v1/admin/operations/9/approve", `{}`, approver, http.StatusNotFound, codeOperationNotFound},
+		{"/v1/admin/operations/x/approve", `{}`, approver, http.StatusBadRequest, codeInvalidRequest},
+	}
+	for _, tt := range tests {
+		rr := serveWith(s, "POST", tt.path, tt.body, tt.headers)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %d but got %d: %s", tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if tt.code != "" && errorCode(t, rr) != tt.code {
+			t.Errorf("%s %s: expected %q, got %s", tt.path, tt.body, tt.code, rr.Body.String())
+		}
+	}
+
+	// Only approved operations moved money, once
+	if got := balance(t, s, "0017286378"); got != 450000 {
+		t.Errorf("expected the approved deposit and transfer, got a balance of %d", got)
+	}
+	if got := balance(t, s, "0018989350"); got != 150000 {
+		t.Errorf("expected the approved transfer, got a balance of %d", got)
+	}
+
+	// Approving a transfer is recorded for the operation and both accounts
+	entries, err := s.store.Audit().AuditEntries(db.AuditFilter{Target: "account:0018989350"})
+	if err != nil || len(entries) != 4 {
+		t.Fatalf("expected the transfers submitted and decided to be recorded for the account credited, got %v %v", entries, err)
+	}
+	if e := entries[3]; e.Action != "POST /v1/admin/operations/{id}/approve" || !strings.Contains(e.Before, `"balance":0`) || !strings.Contains(e.After, `"balance":1500`) {
+		t.Errorf("unexpected entry of the account credited %+v", e)
+	}
+	if entries, err := s.store.Audit().AuditEntries(db.AuditFilter{Actor: "key:back-office", Account: "0017286378"}); err != nil || len(entries) != 4 || entries[2].Target != "operation:2" || entries[3].Target != "account:0017286378" {
+		t.Errorf("expected the deposits and the approval of the transfer, got %v %v", entries, err)
+	}
+
+	// The decisions are kept
+	rr = serveWith(s, "GET", "/v1/admin/operations/1", "", staffKey(t, s, "audit", bank.RoleAuditor))
+	deposit = decodeOperation(t, rr)
+	if deposit.Status != bank.OperationApproved || deposit.DecidedBy != "key:supervisor" || deposit.DecidedAt == nil || deposit.Reason != "Cash counted" || deposit.TransactionID == 0 {
+		t.Errorf("expected the approval trail, got %s", rr.Body.String())
+	}
+	rr = serveWith(s, "GET", "/v1/admin/operations/3", "", admin)
+	if o := decodeOperation(t, rr); o.Status != bank.OperationRejected || o.TransactionID != 0 || o.Reason != "Duplicate of operation 2" {
+		t.Errorf("expected the rejection trail, got %s", rr.Body.String())
+	}
+
+	// A posting that fails leaves the operation pending
+	serveWith(s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 4600}`, jane)
+	rr = serveWith(s, "POST", "/v1/admin/operations/5/approve", `{}`, approver)
+	if rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeInsufficientFunds {
+		t.Errorf("expected the withdrawal to fail, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveWith(s, "GET", "/v1/admin/operations?status=pending", "", approver)
+	var list struct {
+		Operations []apiOperation `json:"operations"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || len(list.Operations) != 2 || list.Operations[0].ID != 4 || list.Operations[1].ID != 5 {
+		t.Errorf("expected the withdrawals to be pending, got %s", rr.Body.String())
+	}
+	if rr := serveWith(s, "GET", "/v1/admin/operations?status=maybe", "", approver); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected an unknown status to be refused, got %d", rr.Code)
+	}
+	if rr := serveWith(s, "GET", "/v1/admin/operations", "", jane); rr.Code != http.StatusForbidden {
+		t.Errorf("expected customers not to see the operations, got %d", rr.Code)
+	}
+}
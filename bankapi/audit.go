@@ -0,0 +1,412 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+// requestIDHeader is the header that identifies a request in the audit log. Callers may send their own,
+// and every response carries the one the request was recorded under.
+const requestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest request ID the audit log stores. Longer ones are replaced.
+const maxRequestIDLength = 64
+
+// Limits of the audit log entries returned by GET /v1/admin/audit.
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// appendAttempts is how many times an entry is chained to the end of the audit log before giving up,
+// when other entries are appended at the same time.
+const appendAttempts = 3
+
+const auditUsage = "usage: bankapi audit [-testing] verify"
+
+// auditTarget is what a mutating request changes, whose state the audit log records before and after the change.
+type auditTarget struct {
+	Kind string // "account", "customer", "operation" or "api-key", empty if nothing in particular.
+	ID   string // Number of the account, ID of the customer or operation, or name of the API key.
+}
+
+func (t auditTarget) String() string {
+	if t.Kind == "" {
+		return ""
+	}
+	return t.Kind + ":" + t.ID
+}
+
+// apiAuditEntry is an audit log entry as returned by the /v1 API.
+type apiAuditEntry struct {
+	ID        int64           `json:"id"`
+	Actor     string          `json:"actor"`
+	Action    string          `json:"action"`
+	Target    string          `json:"target,omitempty"`
+	Account   string          `json:"account,omitempty"`
+	Before    json.RawMessage `json:"before,omitempty"`
+	After     json.RawMessage `json:"after,omitempty"`
+	RequestID string          `json:"request_id"`
+	Status    int             `json:"status,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+}
+
+// newAPIAuditEntry is a function that converts an audit log entry to its /v1 representation.
+func newAPIAuditEntry(e *db.AuditEntry) apiAuditEntry {
+	entry := apiAuditEntry{
+		ID:        e.ID,
+		Actor:     e.Actor,
+		Action:    e.Action,
+		Target:    e.Target,
+		Account:   e.Account,
+		RequestID: e.RequestID,
+		Status:    e.Status,
+		CreatedAt: e.CreatedAt,
+		PrevHash:  e.PrevHash,
+		Hash:      e.Hash,
+	}
+	if e.Before != "" {
+		entry.Before = json.RawMessage(e.Before)
+	}
+	if e.After != "" {
+		entry.After = json.RawMessage(e.After)
+	}
+	return entry
+}
+
+// newRequestID is a function that returns a random request ID.
+func newRequestID() string {
+	random := make([]byte, 16)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
+
+// requestID is a function that returns the ID the caller sent in the X-Request-ID header,
+// or a new one if it sent none or one too long to store.
+func requestID(req *http.Request) string {
+	if id := req.Header.Get(requestIDHeader); id != "" && len(id) <= maxRequestIDLength {
+		return id
+	}
+	return newRequestID()
+}
+
+// patternValues is a function that returns the values of the wildcards of the mux pattern in the path,
+// such as "number" in "/v1/accounts/{number}/deposits". The audit log reads them before the mux sets them on the request.
+func patternValues(pattern, path string) map[string]string {
+	values := map[string]string{}
+	patterns, segments := strings.Split(pattern, "/"), strings.Split(path, "/")
+	if len(patterns) != len(segments) {
+		return values
+	}
+	for i, p := range patterns {
+		if strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}") {
+			values[strings.Trim(p, "{}")] = segments[i]
+		}
+	}
+	return values
+}
+
+// auditTargetsOf is a function that returns what the request to the mux pattern changes:
+// both accounts of a transfer, the account closed and the one its balance is swept to,
+// the operation of /v1/admin/operations/{id} and the accounts its money moves between,
+// the account of any other {number} path segment or of the legacy endpoints' query string,
+// or the customer of /v1/customers/{id}. Other requests change nothing in particular.
+func (s *server) auditTargetsOf(req *http.Request, pattern string) []auditTarget {
+	values := patternValues(pattern, req.URL.Path)
+	switch {
+	case pattern == "/v1/accounts/{number}/transfers":
+		return s.accountTargets(values["number"], bodyValue(req, "to"))
+	case pattern == "/v1/admin/accounts/{number}/close":
+		return s.accountTargets(values["number"], bodyValue(req, "settlement_account"))
+	case strings.HasPrefix(pattern, "/v1/admin/operations/{id}"):
+		return append([]auditTarget{{"operation", values["id"]}}, s.operationAccounts(values["id"])...)
+	case values["number"] != "":
+		return s.accountTargets(values["number"])
+	case strings.HasPrefix(pattern, "/v1/customers/{id}"):
+		return []auditTarget{{"customer", values["id"]}}
+	case pattern == "/transfer":
+		return s.accountTargets(req.URL.Query().Get("from"), req.URL.Query().Get("to"))
+	case pattern == "/deposit", pattern == "/withdraw":
+		return s.accountTargets(req.URL.Query().Get("number"))
+	}
+	return nil
+}
+
+// bodyValue is a function that returns the string field of the request's JSON body with the given name,
+// or "" if the body has none. The body is left for the handler to read.
+func bodyValue(req *http.Request, name string) string {
+	body, _ := io.ReadAll(io.LimitReader(req.Body, maxBodySize+1))
+	req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), req.Body))
+
+	var fields map[string]json.RawMessage
+	var value string
+	if json.Unmarshal(body, &fields) == nil {
+		json.Unmarshal(fields[name], &value)
+	}
+	return value
+}
+
+// accountTargets is a function that returns the accounts of the numbers or IBANs as audit targets,
+// leaving out those not given.
+func (s *server) accountTargets(ids ...string) []auditTarget {
+	var targets []auditTarget
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		if number, err := s.resolveAccountNumber(id, ""); err == nil {
+			id = number
+		}
+		targets = append(targets, auditTarget{"account", id})
+	}
+	return targets
+}
+
+// operationAccounts is a function that returns the accounts the money of the pending operation moves between as audit targets.
+func (s *server) operationAccounts(id string) []auditTarget {
+	operationID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil
+	}
+	o, err := s.store.Approvals().GetOperation(operationID)
+	if err != nil {
+		return nil
+	}
+	return s.accountTargets(o.Account, o.To)
+}
+
+// createdTarget is a function that returns the account or customer a response's Location header names,
+// which the request created.
+func createdTarget(location string) (auditTarget, bool) {
+	if number, ok := strings.CutPrefix(location, "/v1/accounts/"); ok && !strings.Contains(number, "/") {
+		return auditTarget{"account", number}, true
+	}
+	if id, ok := strings.CutPrefix(location, "/v1/customers/"); ok && !strings.Contains(id, "/") {
+		return auditTarget{"customer", id}, true
+	}
+	return auditTarget{}, false
+}
+
+// snapshot is a function that returns the state of the target as JSON, in its /v1 representation,
+// and the number of the account it is or belongs to. A target that doesn't exist has no state.
+func (s *server) snapshot(t auditTarget) (state, account string) {
+	var v interface{}
+	switch t.Kind {
+	case "account":
+		account = t.ID
+		if a, err := s.store.Accounts().GetAccountByNumber(t.ID); err == nil {
+			v = newAPIAccount(a)
+		}
+	case "customer":
+		if id, err := strconv.ParseInt(t.ID, 10, 64); err == nil {
+			if c, err := s.store.Customers().GetCustomer(id); err == nil {
+				v = newAPICustomer(c)
+			}
+		}
+	case "operation":
+		if id, err := strconv.ParseInt(t.ID, 10, 64); err == nil {
+			if o, err := s.store.Approvals().GetOperation(id); err == nil {
+				v, account = newAPIOperation(o), o.Account
+			}
+		}
+	}
+	if v == nil {
+		return "", account
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", account
+	}
+	return string(b), account
+}
+
+// appendAudit is a function that appends the entry to the store's audit log,
+// chaining it again to the last entry if another one was appended in the meantime.
+func appendAudit(store db.Store, e *db.AuditEntry) error {
+	var err error
+	for i := 0; i < appendAttempts; i++ {
+		if err = store.Audit().AppendEntry(e); !errors.Is(err, db.ErrDuplicate) {
+			return err
+		}
+	}
+	return err
+}
+
+// audited is a function that handles the mutating request with the server's handlers and, if it succeeds,
+// writes it to the audit log: who made it, the endpoint, the request's ID and the response's status,
+// with an entry for every target it changed with the target's state before and after, see auditTargetsOf.
+// A request that creates an account or customer targets what it created.
+// Requests that fail change nothing and aren't recorded. It returns errRollback if the request failed with a server error,
+// and the error of the audit log if an entry can't be written, for atomic to roll the request back.
+func (s *server) audited(w http.ResponseWriter, req *http.Request, id string) error {
+	mux := s.handlers()
+	_, pattern := mux.Handler(req)
+	targets := s.auditTargetsOf(req, pattern)
+	if len(targets) == 0 {
+		targets = []auditTarget{{}}
+	}
+	before := make([]string, len(targets))
+	for i, target := range targets {
+		before[i], _ = s.snapshot(target)
+	}
+
+	rec := &responseRecorder{ResponseWriter: w}
+	mux.ServeHTTP(rec, req)
+	if rec.status >= http.StatusInternalServerError {
+		return errRollback
+	}
+	if rec.status == 0 || rec.status >= http.StatusBadRequest {
+		return nil
+	}
+
+	if created, ok := createdTarget(rec.Header().Get("Location")); ok && created != targets[0] {
+		targets, before = []auditTarget{created}, []string{""}
+	}
+	for i, target := range targets {
+		after, account := s.snapshot(target)
+		e := &db.AuditEntry{Actor: requester(req), Action: req.Method + " " + pattern, Target: target.String(), Account: account, Before: before[i], After: after, RequestID: id, Status: rec.status}
+		if err := appendAudit(s.store, e); err != nil {
+			return fmt.Errorf("audit %s %s of request %s: %w", req.Method, req.URL.Path, id, err)
+		}
+	}
+	return nil
+}
+
+// commandActor is a function that returns who runs a bankapi subcommand, as recorded in the audit log.
+func commandActor() string {
+	if u, err := user.Current(); err == nil {
+		return "cli:" + u.Username
+	}
+	return "cli"
+}
+
+// recordCommand is a function that records a change a bankapi subcommand made in the store's audit log,
+// with the JSON of what it did as the state after.
+func recordCommand(store db.Store, action string, target auditTarget, result interface{}) error {
+	after, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	e := &db.AuditEntry{Actor: commandActor(), Action: action, Target: target.String(), After: string(after), RequestID: newRequestID()}
+	return appendAudit(store, e)
+}
+
+// auditRoutes is a function that registers GET /v1/admin/audit on the mux. Only the back office uses it,
+// with the audit:read permission.
+func (s *server) auditRoutes(mux *http.ServeMux) {
+	mux.Handle("/v1/admin/audit", backOfficeOnly(methods{http.MethodGet: allow(bank.PermReadAudit, s.v1Audit)}))
+}
+
+// parseAuditFilter is a function that reads the filter from the "actor", "account", "target", "since", "until",
+// "after" and "limit" query parameters. Times are in RFC 3339 format, such as 2024-03-01T12:00:00Z.
+func parseAuditFilter(req *http.Request) (db.AuditFilter, error) {
+	q := req.URL.Query()
+	filter := db.AuditFilter{Actor: q.Get("actor"), Account: q.Get("account"), Target: q.Get("target"), Limit: defaultAuditLimit}
+
+	var err error
+	if v := q.Get("since"); v != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("Invalid since time %q, expected a time such as 2024-03-01T12:00:00Z", v)
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return filter, fmt.Errorf("Invalid until time %q, expected a time such as 2024-03-01T12:00:00Z", v)
+		}
+	}
+	if v := q.Get("after"); v != "" {
+		if filter.After, err = strconv.ParseInt(v, 10, 64); err != nil || filter.After < 0 {
+			return filter, fmt.Errorf("Invalid after %q, expected an entry ID", v)
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 || filter.Limit > maxAuditLimit {
+			return filter, fmt.Errorf("Invalid limit %q, expected 1 to %d", v, maxAuditLimit)
+		}
+	}
+	return filter, nil
+}
+
+// v1Audit is a function that handles GET /v1/admin/audit.
+// It returns the audit log entries matching the query parameters of parseAuditFilter, oldest first,
+// 100 at a time unless a limit is given. The next entries are those after the ID of the last one.
+func (s *server) v1Audit(w http.ResponseWriter, req *http.Request) {
+	filter, err := parseAuditFilter(req)
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: err.Error()})
+		return
+	}
+
+	entries, err := s.store.Audit().AuditEntries(filter)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	list := make([]apiAuditEntry, 0, len(entries))
+	for _, e := range entries {
+		list = append(list, newAPIAuditEntry(e))
+	}
+	writeJSON(w, http.StatusOK, struct {
+		Entries []apiAuditEntry `json:"entries"`
+	}{list})
+}
+
+// verifyAuditLog is a function that checks the hash chain of the store's whole audit log
+// and returns how many entries it has. A broken chain is an error wrapping db.ErrBrokenChain.
+func verifyAuditLog(store db.Store) (int, error) {
+	entries, err := store.Audit().AuditEntries(db.AuditFilter{})
+	if err != nil {
+		return 0, err
+	}
+	return len(entries), db.VerifyAuditChain(entries)
+}
+
+// auditCommand is a function that runs the "bankapi audit verify" subcommand, which checks that no entry
+// of the configured database's audit log was altered, removed or inserted since it was written.
+// With -testing, it checks the test database configured in .env.testing instead.
+func auditCommand(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("audit", flag.ContinueOnError)
+	flags.SetOutput(w)
+	testing := flags.Bool("testing", false, "verify the test database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || flags.Arg(0) != "verify" {
+		return errors.New(auditUsage)
+	}
+
+	cfg := db.LoadConfig()
+	if *testing {
+		cfg = db.LoadTestingConfig()
+	}
+	store, err := db.Open(cfg)
+	if err != nil {
+		return err
+	}
+	if err := checkSchema(store); err != nil {
+		return err
+	}
+
+	n, err := verifyAuditLog(store)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Audit log verified: %d entries chained\n", n)
+	return nil
+}
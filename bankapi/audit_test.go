@@ -0,0 +1,197 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+func TestAuditLog(t *testing.T) {
+	s, admin := newAuthServer(t)
+	teller := staffKey(t, s, "counter", bank.RoleTeller)
+	auditor := staffKey(t, s, "audit", bank.RoleAuditor)
+	jane := signIn(t, s, admin, "1", "jane")
+
+	// Changes are recorded with who made them and the target's state before and after
+	teller["X-Request-ID"] = "till-42"
+	rr := serveWith(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, teller)
+	if rr.Code != http.StatusCreated || rr.Header().Get("X-Request-ID") != "till-42" {
+		t.Fatalf("expected the deposit under the caller's request ID, got %d %q", rr.Code, rr.Header().Get("X-Request-ID"))
+	}
+	delete(teller, "X-Request-ID")
+	serveWith(s, "PUT", "/v1/customers/1", `{"name": "Jane Doe", "email": "jane@gmail.com", "address": "Abuja, Nigeria"}`, jane)
+	rr = serveWith(s, "POST", "/v1/customers", `{"name": "Ada Obi", "email": "ada@example.com"}`, teller)
+	if rr.Header().Get("X-Request-ID") == "" {
+		t.Error("expected a request ID to be given to the request")
+	}
+
+	// Failures and reads change nothing and aren't recorded
+	serveWith(s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 5000}`, jane)
+	serveWith(s, "GET", "/v1/accounts/0017286378", "", jane)
+
+	rr = serveWith(s, "GET", "/v1/admin/audit", "", auditor)
+	var list struct {
+		Entries []apiAuditEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected the audit log, got %d %s", rr.Code, rr.Body.String())
+	}
+	if len(list.Entries) != 4 {
+		t.Fatalf("expected the login, deposit, address change and new customer, got %s", rr.Body.String())
+	}
+
+	login, deposit, update, created := list.Entries[0], list.Entries[1], list.Entries[2], list.Entries[3]
+	if login.Actor != "key:back-office" || login.Action != "PUT /v1/customers/{id}/login" || login.Target != "customer:1" || strings.Contains(string(login.After), "correct horse") {
+		t.Errorf("unexpected login entry %+v", login)
+	}
+	if deposit.Actor != "key:counter" || deposit.Action != "POST /v1/accounts/{number}/deposits" || deposit.Account != "0017286378" || deposit.RequestID != "till-42" || deposit.Status != http.StatusCreated ||
+		!strings.Contains(string(deposit.Before), `"balance":0`) || !strings.Contains(string(deposit.After), `"balance":100`) {
+		t.Errorf("unexpected deposit entry %+v", deposit)
+	}
+	if update.Actor != "customer:1" || !strings.Contains(string(update.Before), `"address":"Los Angeles, California"`) || !strings.Contains(string(update.After), `"address":"Abuja, Nigeria"`) {
+		t.Errorf("unexpected address change entry %+v", update)
+	}
+	if created.Target != "customer:3" || created.Before != nil || !strings.Contains(string(created.After), `"name":"Ada Obi"`) {
+		t.Errorf("unexpected new customer entry %+v", created)
+	}
+	if deposit.PrevHash != login.Hash || created.PrevHash != update.Hash {
+		t.Error("expected the entries to be chained")
+	}
+	if n, err := verifyAuditLog(s.store); err != nil || n != 4 {
+		t.Errorf("expected the chain of 4 entries to hold, got %d %v", n, err)
+	}
+
+	tests := []struct {
+		query   string
+		headers map[string]string
+		status  int
+		ids     []int64
+	}{
+		{"?account=0017286378", auditor, http.StatusOK, []int64{deposit.ID}},
+		{"?actor=customer:1", admin, http.StatusOK, []int64{update.ID}},
+		{"?target=customer:1", auditor, http.StatusOK, []int64{login.ID, update.ID}},
+		{"?after=1&limit=2", auditor, http.StatusOK, []int64{deposit.ID, update.ID}},
+		{"?since=2000-01-01T00:00:00Z&until=2001-01-01T00:00:00Z", auditor, http.StatusOK, nil},
+		{"?since=yesterday", auditor, http.StatusBadRequest, nil},
+		{"?limit=0", auditor, http.StatusBadRequest, nil},
+		{"", teller, http.StatusForbidden, nil},
+		{"", jane, http.StatusForbidden, nil},
+	}
+	for _, tt := range tests {
+		rr := serveWith(s, "GET", "/v1/admin/audit"+tt.query, "", tt.headers)
+		if rr.Code != tt.status {
+			t.Errorf("%s: expected status %d but got %d: %s", tt.query, tt.status, rr.Code, rr.Body.String())
+			continue
+		}
+		if tt.status != http.StatusOK {
+			continue
+		}
+		var list struct {
+			Entries []apiAuditEntry `json:"entries"`
+		}
+		json.Unmarshal(rr.Body.Bytes(), &list)
+		if len(list.Entries) != len(tt.ids) {
+			t.Errorf("%s: expected entries %v, got %s", tt.query, tt.ids, rr.Body.String())
+			continue
+		}
+		for i, e := range list.Entries {
+			if e.ID != tt.ids[i] {
+				t.Errorf("%s: expected entries %v, got entry %d", tt.query, tt.ids, e.ID)
+			}
+		}
+	}
+}
+
+func TestAuditTargets(t *testing.T) {
+	s := newTestServer(t)
+
+	// A new account is the target of the request opening it, and legacy endpoints target the account of their query string
+	rr := serveAPI(t, s, "POST", "/v1/customers/1/accounts", `{"type": "savings"}`)
+	number := strings.TrimPrefix(rr.Header().Get("Location"), "/v1/accounts/")
+	serveAPI(t, s, "POST", "/deposit?number=0018989350&amount=20", "")
+
+	entries, err := s.store.Audit().AuditEntries(db.AuditFilter{})
+	if err != nil || len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %v %v", entries, err)
+	}
+	if entries[0].Target != "account:"+number || entries[0].Account != number || entries[0].Before != "" || entries[0].Actor != "" {
+		t.Errorf("expected the new account to be the target, got %+v", entries[0])
+	}
+	if entries[1].Action != "POST /deposit" || entries[1].Account != "0018989350" || !strings.Contains(entries[1].After, `"balance":20`) {
+		t.Errorf("expected the legacy deposit to be recorded, got %+v", entries[1])
+	}
+
+	// Transfers are recorded for both accounts, and so is the sweep of a closure to its settlement account
+	serveAPI(t, s, "POST", "/v1/accounts/0018989350/transfers", `{"to": "0017286378", "amount": 5}`)
+	serveAPI(t, s, "POST", "/transfer?from=0018989350&to=0017286378&amount=1", "")
+	serveAPI(t, s, "POST", "/v1/admin/accounts/0018989350/close", `{"reason": "Moving abroad", "settlement_account": "0017286378"}`)
+	entries, err = s.store.Audit().AuditEntries(db.AuditFilter{After: entries[1].ID})
+	if err != nil || len(entries) != 6 {
+		t.Fatalf("expected 2 entries of each request, got %v %v", entries, err)
+	}
+	for i, want := range []struct{ target, before, after string }{
+		{"account:0018989350", `"balance":20`, `"balance":15`},
+		{"account:0017286378", `"balance":0`, `"balance":5`},
+		{"account:0018989350", `"balance":15`, `"balance":14`},
+		{"account:0017286378", `"balance":5`, `"balance":6`},
+		{"account:0018989350", `"balance":14`, `"status":"closed"`},
+		{"account:0017286378", `"balance":6`, `"balance":20`},
+	} {
+		e := entries[i]
+		if e.Target != want.target || e.RequestID != entries[i/2*2].RequestID || !strings.Contains(e.Before, want.before) || !strings.Contains(e.After, want.after) {
+			t.Errorf("entry %d: expected %s from %s to %s, got %+v", i, want.target, want.before, want.after, e)
+		}
+	}
+
+	if values := patternValues("/v1/admin/accounts/{number}/holds/{id}", "/v1/admin/accounts/0017286378/holds/3"); values["number"] != "0017286378" || values["id"] != "3" {
+		t.Errorf("unexpected path values %v", values)
+	}
+}
+
+// failingAudit is a store whose audit log refuses every entry.
+type failingAudit struct {
+	db.Store
+}
+
+func (s failingAudit) Audit() db.AuditRepository {
+	return failingAuditLog{s.Store.Audit()}
+}
+
+func (s failingAudit) Atomic(fn func(tx db.Store) error) error {
+	return s.Store.Atomic(func(tx db.Store) error {
+		return fn(failingAudit{tx})
+	})
+}
+
+type failingAuditLog struct {
+	db.AuditRepository
+}
+
+func (failingAuditLog) AppendEntry(*db.AuditEntry) error {
+	return errors.New("disk full")
+}
+
+func TestUnauditedChangesAreRolledBack(t *testing.T) {
+	s := newTestServer(t)
+	store := s.store
+	s.store = failingAudit{store}
+
+	rr := serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`)
+	if rr.Code != http.StatusInternalServerError || errorCode(t, rr) != codeInternal {
+		t.Fatalf("expected the deposit to fail when it can't be audited, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Location") != "" {
+		t.Error("expected the response of the rolled back deposit to be discarded")
+	}
+	if got := balance(t, s, "0017286378"); got != 0 {
+		t.Errorf("expected the deposit to be rolled back, got a balance of %d", got)
+	}
+	if entries, err := store.Audit().AuditEntries(db.AuditFilter{}); err != nil || len(entries) != 0 {
+		t.Errorf("expected no audit entries, got %v %v", entries, err)
+	}
+}
@@ -0,0 +1,436 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+// apiKeyHeader is the request header back-office integrations send their API key in.
+const apiKeyHeader = "X-API-Key"
+
+// apiKeyPrefix starts every API key, so a leaked key is easy to recognize.
+const apiKeyPrefix = "bk_"
+
+// Limits of the usernames and passwords customers sign in with. bcrypt only uses the first 72 bytes of a password.
+const (
+	maxUsernameLength = 100
+	minPasswordLength = 8
+	maxPasswordLength = 72
+)
+
+const apikeyUsage = "usage: bankapi apikey [-testing] -role teller|admin|auditor|approver NAME"
+
+// publicPaths are the endpoints callers reach without credentials: signing in, and the keys tokens are verified with.
+var publicPaths = map[string]bool{"/v1/auth/login": true, "/v1/auth/keys": true}
+
+// dummyPasswordHash is compared with the password of an unknown username,
+// so a failed sign in takes as long whether or not the username exists.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// principal is who a request is made by: a customer signed in with a session token,
+// or a back-office integration with an API key, and the role it acts as.
+type principal struct {
+	CustomerID  int64     // The customer signed in, zero for an API key.
+	APIKey      string    // Name of the API key, for back-office integrations.
+	Role        bank.Role // RoleCustomer for customers, the role of the API key for back-office integrations.
+	permissions map[bank.Permission]bool
+}
+
+// backOffice reports whether the principal is a back-office integration, which acts on every customer and account
+// its role permits.
+func (p *principal) backOffice() bool {
+	return p.CustomerID == 0
+}
+
+// can reports whether the principal's role has the permission.
+func (p *principal) can(permission bank.Permission) bool {
+	return p.permissions[permission]
+}
+
+func (p *principal) String() string {
+	if p.backOffice() {
+		return "key:" + p.APIKey
+	}
+	return "customer:" + strconv.FormatInt(p.CustomerID, 10)
+}
+
+// contextKey is the type of the keys the server stores request values under in a context.
+type contextKey int
+
+// principalKey is the context key of the principal of a request.
+const principalKey contextKey = iota
+
+// principalOf is a function that returns the principal authenticate attached to the request,
+// or nil if the server doesn't authenticate requests.
+func principalOf(req *http.Request) *principal {
+	p, _ := req.Context().Value(principalKey).(*principal)
+	return p
+}
+
+// authenticate is a function that wraps the handler so that every request but those of publicPaths
+// is made by a principal, which it attaches to the request's context.
+// Back-office integrations authenticate with an X-API-Key header, customers with an "Authorization: Bearer" session token
+// from POST /v1/auth/login. It responds 401 to requests without valid credentials.
+// Requests are not authenticated until the server has tokens.
+func (s *server) authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if s.tokens == nil || publicPaths[req.URL.Path] {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		p, err := s.principal(req)
+		if err != nil {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="bankapi"`)
+			writeError(w, err)
+			return
+		}
+		next.ServeHTTP(w, req.WithContext(context.WithValue(req.Context(), principalKey, p)))
+	})
+}
+
+// principal is a function that returns the principal whose credentials the request carries,
+// with the permissions its role has in the store.
+func (s *server) principal(req *http.Request) (*principal, error) {
+	p, err := s.credentials(req)
+	if err != nil {
+		return nil, err
+	}
+
+	permissions, err := s.store.Auth().RolePermissions(p.Role)
+	if err != nil {
+		return nil, err
+	}
+	p.permissions = make(map[bank.Permission]bool, len(permissions))
+	for _, permission := range permissions {
+		p.permissions[permission] = true
+	}
+	return p, nil
+}
+
+// credentials is a function that returns the principal of the API key or session token the request carries,
+// and 401 if it carries neither or they are invalid.
+func (s *server) credentials(req *http.Request) (*principal, error) {
+	if key := req.Header.Get(apiKeyHeader); key != "" {
+		k, err := s.store.Auth().APIKeyByHash(hashAPIKey(key))
+		if errors.Is(err, db.ErrAPIKeyNotFound) {
+			return nil, &apiError{Status: http.StatusUnauthorized, Code: codeUnauthenticated, Message: "Invalid API key"}
+		}
+		if err != nil {
+			return nil, err
+		}
+		return &principal{APIKey: k.Name, Role: k.Role}, nil
+	}
+
+	authorization := req.Header.Get("Authorization")
+	token := strings.TrimPrefix(authorization, "Bearer ")
+	if token == authorization || token == "" {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: codeUnauthenticated, Message: "Sign in and send the session token in an Authorization: Bearer header, or send an API key in an X-API-Key header"}
+	}
+	id, err := s.tokens.verify(token, time.Now())
+	if err != nil {
+		return nil, &apiError{Status: http.StatusUnauthorized, Code: codeUnauthenticated, Message: "Invalid or expired session token, sign in again"}
+	}
+	return &principal{CustomerID: id, Role: bank.RoleCustomer}, nil
+}
+
+// pathValue is a function that returns a function reading the named path segment of a request.
+func pathValue(name string) func(*http.Request) string {
+	return func(req *http.Request) string { return req.PathValue(name) }
+}
+
+// queryValue is a function that returns a function reading the named query string parameter of a request.
+func queryValue(name string) func(*http.Request) string {
+	return func(req *http.Request) string { return req.URL.Query().Get(name) }
+}
+
+// ownAccount is a function that wraps the handler of an endpoint acting on the account that id reads from the request,
+// by number or IBAN, so that customers only act on their own accounts. Back-office integrations act on every account.
+// An account a customer doesn't own is reported as not found, so customers can't tell which numbers exist.
+// Identifiers that aren't account numbers or IBANs are left for the handler to report.
+func (s *server) ownAccount(id func(*http.Request) string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		p := principalOf(req)
+		if p == nil || p.backOffice() {
+			next.ServeHTTP(w, req)
+			return
+		}
+
+		number, err := s.resolveAccountNumber(id(req), "")
+		if err != nil {
+			next.ServeHTTP(w, req)
+			return
+		}
+		account, err := s.store.Accounts().GetAccountByNumber(number)
+		if err == nil && account.ID != p.CustomerID {
+			err = db.ErrAccountNotFound
+		}
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// ownCustomer is a function that wraps the handler of an endpoint acting on the customer of the {id} path segment,
+// so that customers only act on themselves. Back-office integrations act on every customer.
+// Other customers are reported as not found.
+func ownCustomer(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if p := principalOf(req); p != nil && !p.backOffice() && req.PathValue("id") != strconv.FormatInt(p.CustomerID, 10) {
+			writeError(w, db.ErrCustomerNotFound)
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// backOfficeOnly is a function that wraps the handler of an endpoint only back-office integrations use,
+// such as the /v1/admin endpoints. It responds 403 to customers.
+func backOfficeOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if p := principalOf(req); p != nil && !p.backOffice() {
+			writeError(w, &apiError{Status: http.StatusForbidden, Code: codeForbidden, Message: "Only the bank's back office can use this endpoint"})
+			return
+		}
+		next.ServeHTTP(w, req)
+	})
+}
+
+// allow is a function that puts the policy check of the permission in front of the handler:
+// it responds 403 to principals whose role doesn't have the permission.
+// Customers still only act on themselves and their own accounts, see ownAccount and ownCustomer.
+func allow(permission bank.Permission, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if p := principalOf(req); p != nil && !p.can(permission) {
+			writeError(w, &apiError{Status: http.StatusForbidden, Code: codeForbidden, Message: fmt.Sprintf("The %s role doesn't have the %s permission", p.Role, permission)})
+			return
+		}
+		h(w, req)
+	}
+}
+
+// loginRequest is the body of POST /v1/auth/login and PUT /v1/customers/{id}/login.
+type loginRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// sessionResponse is the response to a successful sign in.
+type sessionResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"` // Seconds until the token expires.
+	CustomerID  int64  `json:"customer_id"`
+}
+
+// apiLogin is a customer's login as returned by the /v1 API, without the password.
+type apiLogin struct {
+	CustomerID int64  `json:"customer_id"`
+	Username   string `json:"username"`
+}
+
+// authRoutes is a function that registers the /v1/auth endpoints and the customers' logins on the mux.
+func (s *server) authRoutes(mux *http.ServeMux) {
+	mux.Handle("/v1/auth/login", methods{http.MethodPost: s.v1Login})
+	mux.Handle("/v1/auth/keys", methods{http.MethodGet: s.v1TokenKeys})
+	mux.Handle("/v1/customers/{id}/login", ownCustomer(methods{http.MethodPut: allow(bank.PermUpdateCustomers, s.v1SetLogin)}))
+}
+
+// v1Login is a function that handles POST /v1/auth/login with a loginRequest body.
+// It responds 200 OK with a session token for the customer, to send in an "Authorization: Bearer" header,
+// and 401 if the username or password is wrong.
+func (s *server) v1Login(w http.ResponseWriter, req *http.Request) {
+	if s.tokens == nil {
+		writeError(w, &apiError{Status: http.StatusNotFound, Code: codeNotFound, Message: "Signing in is not enabled"})
+		return
+	}
+
+	var body loginRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	login, err := s.store.Auth().LoginByUsername(body.Username)
+	if err != nil && !errors.Is(err, db.ErrLoginNotFound) {
+		writeError(w, err)
+		return
+	}
+	hash := dummyPasswordHash
+	if login != nil {
+		hash = []byte(login.PasswordHash)
+	}
+	if bcrypt.CompareHashAndPassword(hash, []byte(body.Password)) != nil || login == nil {
+		writeError(w, &apiError{Status: http.StatusUnauthorized, Code: codeInvalidCredentials, Message: "Invalid username or password"})
+		return
+	}
+
+	token, err := s.tokens.issue(login.CustomerID, time.Now())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, sessionResponse{AccessToken: token, TokenType: "Bearer", ExpiresIn: int64(s.tokens.lifetime / time.Second), CustomerID: login.CustomerID})
+}
+
+// v1TokenKeys is a function that handles GET /v1/auth/keys.
+// It returns the public keys session tokens are verified with as a JSON Web Key Set, so they can be verified offline.
+// The set is empty when tokens are signed with a secret.
+func (s *server) v1TokenKeys(w http.ResponseWriter, req *http.Request) {
+	keys := []map[string]string{}
+	if s.tokens != nil && s.tokens.alg == algEdDSA {
+		keys = append(keys, map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"alg": algEdDSA,
+			"use": "sig",
+			"x":   base64.RawURLEncoding.EncodeToString(s.tokens.publicKey()),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": keys})
+}
+
+// v1SetLogin is a function that handles PUT /v1/customers/{id}/login with a loginRequest body.
+// It sets the username and password the customer signs in with, replacing any they had.
+// It responds 200 OK with the login, 422 if the username or password is invalid,
+// and 409 if another customer signs in with the username.
+func (s *server) v1SetLogin(w http.ResponseWriter, req *http.Request) {
+	id, err := pathCustomerID(req)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	var body loginRequest
+	if err := decodeJSON(w, req, &body); err != nil {
+		writeError(w, err)
+		return
+	}
+	if err := validateLogin(body); err != nil {
+		writeError(w, err)
+		return
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(body.Password), bcrypt.DefaultCost)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	login := &db.Login{CustomerID: id, Username: body.Username, PasswordHash: string(hash)}
+	err = s.store.Atomic(func(tx db.Store) error {
+		if _, err := tx.Customers().GetCustomer(id); err != nil {
+			return err
+		}
+		return tx.Auth().SaveLogin(login)
+	})
+	if errors.Is(err, db.ErrDuplicate) {
+		writeError(w, &apiError{Status: http.StatusConflict, Code: codeConflict, Message: "Another customer signs in with this username", Field: "username"})
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, apiLogin{CustomerID: id, Username: login.Username})
+}
+
+// validateLogin is a function that returns an error unless the username and password of the login can be stored.
+func validateLogin(body loginRequest) error {
+	if body.Username == "" || len(body.Username) > maxUsernameLength || strings.IndexFunc(body.Username, unicode.IsSpace) >= 0 {
+		return &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidationFailed, Message: fmt.Sprintf("username should be 1 to %d characters without spaces", maxUsernameLength), Field: "username"}
+	}
+	if len(body.Password) < minPasswordLength || len(body.Password) > maxPasswordLength {
+		return &apiError{Status: http.StatusUnprocessableEntity, Code: codeValidationFailed, Message: fmt.Sprintf("password should be %d to %d bytes long", minPasswordLength, maxPasswordLength), Field: "password"}
+	}
+	return nil
+}
+
+// hashAPIKey is a function that returns the hash an API key is stored and looked up by.
+// API keys are long and random, so a fast hash is enough to keep a leaked table from giving them away.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// issueAPIKey is a function that stores a new API key for the back-office integration with the given name,
+// acting as the role, and returns the key, which can't be recovered once lost.
+func issueAPIKey(store db.Store, name string, role bank.Role) (string, error) {
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return "", err
+	}
+	key := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(random)
+
+	if err := store.Auth().InsertAPIKey(&db.APIKey{Name: name, Hash: hashAPIKey(key), Role: role}); err != nil {
+		return "", err
+	}
+	return key, nil
+}
+
+// apikeyCommand is a function that runs the "bankapi apikey" subcommand, which issues an API key
+// for a back-office integration acting as a staff role on the configured database, records it in the audit log in the same transaction and prints it.
+// Customers sign in instead, so the customer role is refused.
+// With -testing, it issues the key on the test database configured in .env.testing instead.
+func apikeyCommand(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("apikey", flag.ContinueOnError)
+	flags.SetOutput(w)
+	testing := flags.Bool("testing", false, "issue the key on the test database")
+	roleName := flags.String("role", "", "role the integration acts as: teller, admin, auditor or approver")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 || flags.Arg(0) == "" {
+		return errors.New(apikeyUsage)
+	}
+	role, err := bank.ParseRole(*roleName)
+	if err != nil || role == bank.RoleCustomer {
+		return errors.New(apikeyUsage)
+	}
+
+	cfg := db.LoadConfig()
+	if *testing {
+		cfg = db.LoadTestingConfig()
+	}
+	store, err := db.Open(cfg)
+	if err != nil {
+		return err
+	}
+	if err := checkSchema(store); err != nil {
+		return err
+	}
+
+	var key string
+	err = store.Atomic(func(tx db.Store) error {
+		if key, err = issueAPIKey(tx, flags.Arg(0), role); err != nil {
+			return err
+		}
+		return recordCommand(tx, "apikey", auditTarget{"api-key", flags.Arg(0)}, map[string]interface{}{"name": flags.Arg(0), "role": role})
+	})
+	if errors.Is(err, db.ErrDuplicate) {
+		return fmt.Errorf("an API key named %q already exists", flags.Arg(0))
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "API key of %s (%s), send it in the %s header: %s\n", flags.Arg(0), role, apiKeyHeader, key)
+	return nil
+}
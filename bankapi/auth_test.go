@@ -0,0 +1,304 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+// serveWith sends the request with the given headers through the server's routes and returns the response.
+func serveWith(s *server, method, path, body string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	rr := httptest.NewRecorder()
+	s.routes().ServeHTTP(rr, req)
+	return rr
+}
+
+// newAuthServer returns a test server that authenticates requests, and an admin API key of its back office.
+func newAuthServer(t *testing.T) (*server, map[string]string) {
+	s := newTestServer(t)
+	tokens, err := newHMACSigner([]byte(strings.Repeat("s", minSecretLength)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.tokens = tokens
+
+	return s, staffKey(t, s, "back-office", bank.RoleAdmin)
+}
+
+// staffKey issues an API key acting as the role and returns the headers that send it.
+func staffKey(t *testing.T, s *server, name string, role bank.Role) map[string]string {
+	key, err := issueAPIKey(s.store, name, role)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return map[string]string{apiKeyHeader: key}
+}
+
+// signIn sets the customer's login through the back office, signs in with it and returns the session's headers.
+func signIn(t *testing.T, s *server, backOffice map[string]string, customer, username string) map[string]string {
+	rr := serveWith(s, "PUT", "/v1/customers/"+customer+"/login", `{"username": "`+username+`", "password": "correct horse"}`, backOffice)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusOK, rr.Code, rr.Body.String())
+	}
+
+	rr = serveWith(s, "POST", "/v1/auth/login", `{"username": "`+username+`", "password": "correct horse"}`, nil)
+	var session sessionResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &session); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected a session: %d %s", rr.Code, rr.Body.String())
+	}
+	if session.TokenType != "Bearer" || session.ExpiresIn != int64(defaultTokenLifetime/time.Second) || session.CustomerID == 0 {
+		t.Errorf("unexpected session %+v", session)
+	}
+	return map[string]string{"Authorization": "Bearer " + session.AccessToken}
+}
+
+func TestAuthentication(t *testing.T) {
+	s, backOffice := newAuthServer(t)
+
+	rr := serveWith(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, nil)
+	if rr.Code != http.StatusUnauthorized || errorCode(t, rr) != codeUnauthenticated || rr.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("expected an anonymous deposit to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveWith(s, "POST", "/withdraw?number=0017286378&amount=5", "", nil)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected an anonymous legacy withdrawal to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveWith(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, map[string]string{apiKeyHeader: "bk_unknown"})
+	if rr.Code != http.StatusUnauthorized || errorCode(t, rr) != codeUnauthenticated {
+		t.Errorf("expected an unknown API key to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// The back office reaches every account
+	for _, number := range []string{"0017286378", "0018989350"} {
+		rr = serveWith(s, "POST", "/v1/accounts/"+number+"/deposits", `{"amount": 100}`, backOffice)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Customers sign in with the login the back office set for them
+	jane := signIn(t, s, backOffice, "1", "jane")
+	for _, body := range []string{`{"username": "jane", "password": "wrong horse"}`, `{"username": "nobody", "password": "correct horse"}`} {
+		rr = serveWith(s, "POST", "/v1/auth/login", body, nil)
+		if rr.Code != http.StatusUnauthorized || errorCode(t, rr) != codeInvalidCredentials {
+			t.Errorf("%s: expected the sign in to fail, got %d %s", body, rr.Code, rr.Body.String())
+		}
+	}
+
+	// and only act on their own accounts
+	tests := []struct {
+		method, path, body string
+		status             int
+	}{
+		{"POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 5}`, http.StatusCreated},
+		{"POST", "/v1/accounts/0018989350/withdrawals", `{"amount": 5}`, http.StatusNotFound},
+		{"POST", "/v1/accounts/0017286378/transfers", `{"to": "0018989350", "amount": 5}`, http.StatusCreated},
+		{"POST", "/v1/accounts/0018989350/transfers", `{"to": "0017286378", "amount": 5}`, http.StatusNotFound},
+		{"GET", "/v1/accounts/0017286378/statement", "", http.StatusOK},
+		{"GET", "/v1/accounts/0018989350/statement", "", http.StatusNotFound},
+		{"GET", "/v1/accounts/0018989350", "", http.StatusNotFound},
+		{"GET", "/v1/accounts/0018989350/transactions", "", http.StatusNotFound},
+		{"POST", "/withdraw?number=0018989350&amount=5", "", http.StatusNotFound},
+		{"POST", "/transfer?from=0018989350&to=0017286378&amount=5", "", http.StatusNotFound},
+		{"GET", "/statement?number=0018989350", "", http.StatusNotFound},
+		{"GET", "/accounts/0018989350/transactions", "", http.StatusNotFound},
+		{"GET", "/v1/customers/1", "", http.StatusOK},
+		{"GET", "/v1/customers/2/accounts", "", http.StatusNotFound},
+		{"POST", "/v1/customers", `{"name": "John Roe", "email": "john@example.com"}`, http.StatusForbidden},
+		{"POST", "/v1/admin/accounts/0018989350/freeze", `{"reason": "Mine now"}`, http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		rr := serveWith(s, tt.method, tt.path, tt.body, jane)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %d but got %d: %s", tt.method, tt.path, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+	rr = serveWith(s, "GET", "/statement?number=0017286378", "", jane)
+	if !strings.Contains(rr.Body.String(), `"Balance":90.00`) {
+		t.Errorf("expected Jane's legacy statement, got %s", rr.Body.String())
+	}
+
+	// A customer's idempotency keys are their own
+	sam := signIn(t, s, backOffice, "2", "sam")
+	jane[idempotencyHeader], sam[idempotencyHeader] = "shared-key", "shared-key"
+	serveWith(s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 1}`, jane)
+	rr = serveWith(s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 1}`, sam)
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codeIdempotencyMismatch {
+		t.Errorf("expected another customer's key not to replay, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestPermissions(t *testing.T) {
+	s, admin := newAuthServer(t)
+	principals := []map[string]string{
+		signIn(t, s, admin, "1", "jane"),
+		staffKey(t, s, "counter", bank.RoleTeller),
+		admin,
+		staffKey(t, s, "audit", bank.RoleAuditor),
+	}
+
+	// Each role acts on Jane's account, which she owns
+	const ok, created, accepted, forbidden = http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusForbidden
+	tests := []struct {
+		method, path, body string
+		status             [4]int // Of the customer, teller, admin and auditor.
+	}{
+		{"GET", "/v1/accounts/0017286378", "", [4]int{ok, ok, ok, ok}},
+		{"POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, [4]int{forbidden, created, created, forbidden}},
+		{"POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 1}`, [4]int{created, created, created, forbidden}},
+		{"POST", "/v1/accounts/0017286378/transfers", `{"to": "0018989350", "amount": 1}`, [4]int{created, forbidden, created, forbidden}},
+		{"GET", "/v1/accounts/0017286378/transactions", "", [4]int{ok, ok, ok, ok}},
+		{"GET", "/v1/accounts/0017286378/statement", "", [4]int{ok, ok, ok, ok}},
+		{"POST", "/deposit?number=0017286378&amount=1", "", [4]int{forbidden, ok, ok, forbidden}},
+		{"POST", "/withdraw?number=0017286378&amount=1", "", [4]int{ok, ok, ok, forbidden}},
+		{"POST", "/transfer?from=0017286378&to=0018989350&amount=1", "", [4]int{ok, forbidden, ok, forbidden}},
+		{"GET", "/statement?number=0017286378", "", [4]int{ok, ok, ok, ok}},
+		{"GET", "/accounts/0017286378/transactions", "", [4]int{ok, ok, ok, ok}},
+		{"GET", "/v1/customers/1", "", [4]int{ok, ok, ok, ok}},
+		{"PUT", "/v1/customers/1", `{"name": "Jane Doe", "email": "jane@gmail.com"}`, [4]int{ok, ok, ok, forbidden}},
+		{"GET", "/v1/customers/1/accounts", "", [4]int{ok, ok, ok, ok}},
+		{"POST", "/v1/customers/1/accounts", `{}`, [4]int{created, created, created, forbidden}},
+		{"POST", "/v1/customers", `{"name": "John Roe", "email": "john.%d@example.com"}`, [4]int{forbidden, created, created, forbidden}},
+		{"GET", "/v1/admin/accounts/0017286378/holds", "", [4]int{forbidden, ok, ok, ok}},
+		{"PUT", "/v1/admin/accounts/0017286378/overdraft", `{"limit": 50}`, [4]int{forbidden, forbidden, ok, forbidden}},
+		{"POST", "/v1/admin/accounts/0017286378/adjustments", `{"amount": 1}`, [4]int{forbidden, forbidden, accepted, forbidden}},
+		{"POST", "/v1/admin/accounts/0017286378/freeze", `{"reason": "Review"}`, [4]int{forbidden, forbidden, ok, forbidden}},
+		{"POST", "/v1/admin/accounts/0017286378/unfreeze", `{"reason": "Reviewed"}`, [4]int{forbidden, forbidden, ok, forbidden}},
+		{"GET", "/v1/admin/accounts/0017286378/status-changes", "", [4]int{forbidden, ok, ok, ok}},
+	}
+	for _, tt := range tests {
+		for i, headers := range principals {
+			body := tt.body
+			if strings.Contains(body, "%d") {
+				body = fmt.Sprintf(body, i)
+			}
+			rr := serveWith(s, tt.method, tt.path, body, headers)
+			if rr.Code != tt.status[i] {
+				t.Errorf("%s %s as %s: expected status %d but got %d: %s", tt.method, tt.path, []string{"customer", "teller", "admin", "auditor"}[i], tt.status[i], rr.Code, rr.Body.String())
+			}
+			if rr.Code == forbidden && errorCode(t, rr) != codeForbidden {
+				t.Errorf("%s %s: expected %q", tt.method, tt.path, codeForbidden)
+			}
+		}
+	}
+
+	// Permissions come from the store: a role without any can't even read
+	if err := s.store.Auth().InsertAPIKey(&db.APIKey{Name: "intern", Hash: hashAPIKey("bk_intern"), Role: "intern"}); err != nil {
+		t.Fatal(err)
+	}
+	if rr := serveWith(s, "GET", "/v1/accounts/0017286378", "", map[string]string{apiKeyHeader: "bk_intern"}); rr.Code != forbidden {
+		t.Errorf("expected a role without permissions to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestLogins(t *testing.T) {
+	s, backOffice := newAuthServer(t)
+	jane := signIn(t, s, backOffice, "1", "jane")
+
+	tests := []struct {
+		path, body string
+		headers    map[string]string
+		status     int
+	}{
+		{"/v1/customers/1/login", `{"username": "jane doe", "password": "correct horse"}`, backOffice, http.StatusUnprocessableEntity},
+		{"/v1/customers/1/login", `{"username": "jane", "password": "short"}`, backOffice, http.StatusUnprocessableEntity},
+		{"/v1/customers/2/login", `{"username": "jane", "password": "correct horse"}`, backOffice, http.StatusConflict},
+		{"/v1/customers/9/login", `{"username": "nine", "password": "correct horse"}`, backOffice, http.StatusNotFound},
+		{"/v1/customers/2/login", `{"username": "sam", "password": "correct horse"}`, jane, http.StatusNotFound},
+		{"/v1/customers/1/login", `{"username": "jane", "password": "battery staple"}`, jane, http.StatusOK},
+	}
+	for _, tt := range tests {
+		rr := serveWith(s, "PUT", tt.path, tt.body, tt.headers)
+		if rr.Code != tt.status {
+			t.Errorf("%s %s: expected status %d but got %d: %s", tt.path, tt.body, tt.status, rr.Code, rr.Body.String())
+		}
+	}
+
+	// Customers can change their own password
+	if rr := serveWith(s, "POST", "/v1/auth/login", `{"username": "jane", "password": "battery staple"}`, nil); rr.Code != http.StatusOK {
+		t.Errorf("expected the new password to work, got %d %s", rr.Code, rr.Body.String())
+	}
+	if rr := serveWith(s, "POST", "/v1/auth/login", `{"username": "jane", "password": "correct horse"}`, nil); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the old password not to work, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSessionTokens(t *testing.T) {
+	s, _ := newAuthServer(t)
+	now := time.Now()
+
+	token, err := s.tokens.issue(1, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, err := s.tokens.verify(token, now); err != nil || id != 1 {
+		t.Errorf("expected the token of customer 1, got %d %v", id, err)
+	}
+
+	expired, _ := s.tokens.issue(1, now.Add(-defaultTokenLifetime-time.Second))
+	other, _ := newHMACSigner([]byte(strings.Repeat("o", minSecretLength)))
+	forged, _ := other.issue(1, now)
+	parts := strings.Split(token, ".")
+	unsigned := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." + parts[1] + "."
+
+	for name, bad := range map[string]string{"expired": expired, "forged": forged, "unsigned": unsigned, "truncated": parts[0] + "." + parts[1]} {
+		if _, err := s.tokens.verify(bad, now); !errors.Is(err, errInvalidToken) {
+			t.Errorf("%s: expected an invalid token, got %v", name, err)
+		}
+		rr := serveWith(s, "GET", "/v1/accounts/0017286378", "", map[string]string{"Authorization": "Bearer " + bad})
+		if rr.Code != http.StatusUnauthorized {
+			t.Errorf("%s: expected status %d but got %d", name, http.StatusUnauthorized, rr.Code)
+		}
+	}
+	if _, err := newHMACSigner([]byte("short")); err == nil {
+		t.Error("expected a short secret to be refused")
+	}
+
+	// Ed25519 tokens are verified offline with the published key
+	_, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.tokens = newEd25519Signer(private)
+	if token, err = s.tokens.issue(2, now); err != nil {
+		t.Fatal(err)
+	}
+
+	rr := serveWith(s, "GET", "/v1/auth/keys", "", nil)
+	var jwks struct {
+		Keys []struct {
+			Alg string `json:"alg"`
+			X   string `json:"x"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(rr.Body.Bytes(), &jwks); err != nil || len(jwks.Keys) != 1 || jwks.Keys[0].Alg != algEdDSA {
+		t.Fatalf("expected the public key, got %s", rr.Body.String())
+	}
+	public, _ := base64.RawURLEncoding.DecodeString(jwks.Keys[0].X)
+	parts = strings.Split(token, ".")
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	if !ed25519.Verify(public, []byte(parts[0]+"."+parts[1]), signature) {
+		t.Error("expected the token to verify with the published key")
+	}
+	if _, err := s.tokens.verify(forged, now); !errors.Is(err, errInvalidToken) {
+		t.Errorf("expected an HS256 token to be refused, got %v", err)
+	}
+	if rr := serveWith(s, "GET", "/v1/accounts/0018989350", "", map[string]string{"Authorization": "Bearer " + token}); rr.Code != http.StatusOK {
+		t.Errorf("expected customer 2 to reach their account, got %d %s", rr.Code, rr.Body.String())
+	}
+}
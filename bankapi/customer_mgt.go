@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+// createCustomer onboards a new customer without opening an account for them.
+// The customer's details are validated first, and a *bank.FieldError is returned if any is invalid.
+// The stored customer is returned with its ID.
+// If the email address is already taken, the returned error wraps db.ErrDuplicate.
+func (s *server) createCustomer(customer bank.Customer) (*bank.Customer, error) {
+	if err := customer.Validate(); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.store.Customers().InsertCustomer(&customer); err != nil {
+		return nil, fmt.Errorf("insertCustomerError: %w", err)
+	}
+	return &customer, nil
+}
+
+// getCustomer retrieves the customer with the given ID from the customer repository.
+// If no customer has the ID, db.ErrCustomerNotFound is returned.
+func (s *server) getCustomer(id int64) (*bank.Customer, error) {
+	return s.store.Customers().GetCustomer(id)
+}
+
+// updateCustomer replaces the details of the customer with customer.ID.
+// The new details are validated like those of a new customer, and the updated customer is returned.
+// If no customer has the ID, the returned error wraps db.ErrCustomerNotFound,
+// and if the new email address belongs to another customer, it wraps db.ErrDuplicate.
+func (s *server) updateCustomer(customer bank.Customer) (*bank.Customer, error) {
+	if err := customer.Validate(); err != nil {
+		return nil, err
+	}
+
+	err := s.store.Atomic(func(tx db.Store) error {
+		if _, err := tx.Customers().GetCustomer(customer.ID); err != nil {
+			return err
+		}
+		return tx.Customers().UpdateCustomer(&customer)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("updateCustomerError: %w", err)
+	}
+	return &customer, nil
+}
+
+// customerAccounts returns the accounts of the customer with the given ID, with their current balances,
+// in the order they were opened.
+// If no customer has the ID, the returned error wraps db.ErrCustomerNotFound.
+func (s *server) customerAccounts(id int64) ([]*bank.Account, error) {
+	var accounts []*bank.Account
+	err := s.store.Atomic(func(tx db.Store) error {
+		if _, err := tx.Customers().GetCustomer(id); err != nil {
+			return err
+		}
+
+		var err error
+		accounts, err = tx.Accounts().AccountsByCustomer(id)
+		return err
+	})
+	return accounts, err
+}
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS ledger_entries;
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE `ledger_entries` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `transaction_id` INT NOT NULL,
+    `account_number` VARCHAR(20) NOT NULL,
+    `direction` ENUM('debit', 'credit') NOT NULL,
+    `amount` DECIMAL(10, 2) NOT NULL,
+    `balance_after` DECIMAL(10, 2),
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT FK_TransactionEntry FOREIGN KEY (`transaction_id`) REFERENCES transactions(`id`)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE,
+    INDEX IX_EntryAccount (`account_number`)
+);
\ No newline at end of file
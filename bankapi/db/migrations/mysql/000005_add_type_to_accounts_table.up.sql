@@ -0,0 +1 @@
+ALTER TABLE `accounts` ADD COLUMN `type` ENUM('current', 'savings') NOT NULL DEFAULT 'current' AFTER `account_number`;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE accounts MODIFY COLUMN status ENUM('active', 'inactive', 'blacklisted') DEFAULT 'active';
\ No newline at end of file
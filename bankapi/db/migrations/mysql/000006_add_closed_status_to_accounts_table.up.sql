@@ -0,0 +1 @@
+ALTER TABLE `accounts` MODIFY COLUMN `status` ENUM('active', 'inactive', 'blacklisted', 'closed') NOT NULL DEFAULT 'active';
\ No newline at end of file
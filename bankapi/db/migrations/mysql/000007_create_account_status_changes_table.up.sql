@@ -0,0 +1,9 @@
+CREATE TABLE `account_status_changes` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `account_number` VARCHAR(20) NOT NULL,
+    `from_status` ENUM('active', 'inactive', 'blacklisted', 'closed') NOT NULL,
+    `to_status` ENUM('active', 'inactive', 'blacklisted', 'closed') NOT NULL,
+    `reason` VARCHAR(255) NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    INDEX IX_StatusChangeAccount (`account_number`)
+);
\ No newline at end of file
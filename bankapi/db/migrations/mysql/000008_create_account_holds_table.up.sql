@@ -0,0 +1,9 @@
+CREATE TABLE `account_holds` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `account_number` VARCHAR(20) NOT NULL,
+    `amount` DECIMAL(10, 2) NOT NULL,
+    `reason` VARCHAR(255) NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `released_at` TIMESTAMP NULL DEFAULT NULL,
+    INDEX IX_HoldAccount (`account_number`)
+);
\ No newline at end of file
@@ -0,0 +1,12 @@
+CREATE TABLE `account_closures` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `account_number` VARCHAR(20) NOT NULL,
+    `reason` VARCHAR(255) NOT NULL,
+    `total_credits` DECIMAL(10, 2) NOT NULL,
+    `total_debits` DECIMAL(10, 2) NOT NULL,
+    `final_balance` DECIMAL(10, 2) NOT NULL,
+    `settlement_account` VARCHAR(20),
+    `settlement_transaction_id` INT,
+    `closed_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (`account_number`)
+);
\ No newline at end of file
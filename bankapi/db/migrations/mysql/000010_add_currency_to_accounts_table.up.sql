@@ -0,0 +1 @@
+ALTER TABLE `accounts` ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'NGN' AFTER `balance`;
\ No newline at end of file
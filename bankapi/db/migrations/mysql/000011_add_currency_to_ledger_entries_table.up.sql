@@ -0,0 +1 @@
+ALTER TABLE `ledger_entries` ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'NGN' AFTER `amount`;
\ No newline at end of file
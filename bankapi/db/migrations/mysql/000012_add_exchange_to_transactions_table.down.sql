@@ -0,0 +1 @@
+ALTER TABLE transactions DROP COLUMN converted_amount, DROP COLUMN converted_currency, DROP COLUMN rate;
\ No newline at end of file
@@ -0,0 +1,4 @@
+ALTER TABLE `transactions`
+    ADD COLUMN `converted_amount` DECIMAL(10, 2) AFTER `currency`,
+    ADD COLUMN `converted_currency` CHAR(3) AFTER `converted_amount`,
+    ADD COLUMN `rate` DECIMAL(18, 6) AFTER `converted_currency`;
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE `idempotency_keys` (
+    `idempotency_key` VARCHAR(255) NOT NULL PRIMARY KEY,
+    `fingerprint` CHAR(64) NOT NULL,
+    `status_code` INT NULL DEFAULT NULL,
+    `content_type` VARCHAR(255) NULL DEFAULT NULL,
+    `location` VARCHAR(255) NULL DEFAULT NULL,
+    `response_body` MEDIUMBLOB NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `expires_at` DATETIME NOT NULL,
+    INDEX IX_IdempotencyExpiry (`expires_at`)
+);
\ No newline at end of file
@@ -0,0 +1,8 @@
+CREATE TABLE `api_keys` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `name` VARCHAR(100) NOT NULL,
+    `key_hash` CHAR(64) NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (`name`),
+    UNIQUE (`key_hash`)
+);
\ No newline at end of file
@@ -0,0 +1,11 @@
+CREATE TABLE `customer_logins` (
+    `user_id` INT NOT NULL PRIMARY KEY,
+    `username` VARCHAR(100) NOT NULL,
+    `password_hash` VARCHAR(255) NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+    CONSTRAINT FK_UserLogin FOREIGN KEY (`user_id`) REFERENCES users(`id`)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE,
+    UNIQUE (`username`)
+);
\ No newline at end of file
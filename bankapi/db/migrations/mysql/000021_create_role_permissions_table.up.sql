@@ -0,0 +1,5 @@
+CREATE TABLE `role_permissions` (
+    `role` VARCHAR(20) NOT NULL,
+    `permission` VARCHAR(50) NOT NULL,
+    PRIMARY KEY (`role`, `permission`)
+);
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM role_permissions;
\ No newline at end of file
@@ -0,0 +1,26 @@
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+    ('customer', 'accounts:read'),
+    ('customer', 'accounts:open'),
+    ('customer', 'customers:read'),
+    ('customer', 'customers:update'),
+    ('customer', 'money:withdraw'),
+    ('customer', 'money:transfer'),
+    ('teller', 'accounts:read'),
+    ('teller', 'accounts:open'),
+    ('teller', 'customers:read'),
+    ('teller', 'customers:create'),
+    ('teller', 'customers:update'),
+    ('teller', 'money:deposit'),
+    ('teller', 'money:withdraw'),
+    ('admin', 'accounts:read'),
+    ('admin', 'accounts:open'),
+    ('admin', 'accounts:manage'),
+    ('admin', 'customers:read'),
+    ('admin', 'customers:create'),
+    ('admin', 'customers:update'),
+    ('admin', 'money:deposit'),
+    ('admin', 'money:withdraw'),
+    ('admin', 'money:transfer'),
+    ('admin', 'money:adjust'),
+    ('auditor', 'accounts:read'),
+    ('auditor', 'customers:read');
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE `api_keys` ADD COLUMN `role` VARCHAR(20) NOT NULL DEFAULT 'admin' AFTER `key_hash`;
\ No newline at end of file
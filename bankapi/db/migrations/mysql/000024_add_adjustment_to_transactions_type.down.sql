@@ -0,0 +1 @@
+ALTER TABLE transactions MODIFY COLUMN type ENUM('deposit', 'withdrawal', 'transfer', 'interest', 'fee') NOT NULL;
\ No newline at end of file
@@ -0,0 +1,5 @@
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+    ('admin', 'operations:approve'),
+    ('approver', 'accounts:read'),
+    ('approver', 'customers:read'),
+    ('approver', 'operations:approve');
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE `audit_log` (
+    `id` INT AUTO_INCREMENT PRIMARY KEY,
+    `actor` VARCHAR(120) NOT NULL,
+    `action` VARCHAR(120) NOT NULL,
+    `target` VARCHAR(120) NOT NULL,
+    `account_number` VARCHAR(20) NULL DEFAULT NULL,
+    `state_before` TEXT NULL DEFAULT NULL,
+    `state_after` TEXT NULL DEFAULT NULL,
+    `request_id` VARCHAR(64) NOT NULL,
+    `status` INT NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `prev_hash` VARCHAR(64) NOT NULL,
+    `hash` VARCHAR(64) NOT NULL,
+    UNIQUE (`prev_hash`),
+    INDEX IX_AuditLogAccount (`account_number`),
+    INDEX IX_AuditLogActor (`actor`)
+);
\ No newline at end of file
@@ -0,0 +1,3 @@
+INSERT INTO `role_permissions` (`role`, `permission`) VALUES
+    ('admin', 'audit:read'),
+    ('auditor', 'audit:read');
\ No newline at end of file
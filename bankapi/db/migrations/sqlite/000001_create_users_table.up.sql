@@ -0,0 +1,12 @@
+CREATE TABLE `users` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `name` VARCHAR(255) NOT NULL,
+    `email` VARCHAR(255) NOT NULL,
+    `phone_number` VARCHAR(20),
+    `address` VARCHAR(255),
+    `gender` TEXT CHECK (`gender` IN ('Male', 'Female', 'Other')),
+    `date_of_birth` TEXT,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (`email`)
+);
\ No newline at end of file
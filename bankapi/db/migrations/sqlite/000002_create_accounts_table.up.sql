@@ -0,0 +1,13 @@
+CREATE TABLE `accounts` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `user_id` INTEGER NOT NULL,
+    `account_number` VARCHAR(10) NOT NULL,
+    `balance` DECIMAL(10, 2) DEFAULT 0.00,
+    `status` TEXT CHECK (`status` IN ('active', 'inactive', 'blacklisted')) DEFAULT 'active',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `updated_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT FK_UserAccount FOREIGN KEY (`user_id`) REFERENCES users(`id`)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE,
+    UNIQUE (`account_number`)
+);
\ No newline at end of file
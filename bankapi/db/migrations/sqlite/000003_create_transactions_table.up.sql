@@ -0,0 +1,7 @@
+CREATE TABLE `transactions` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `type` TEXT NOT NULL CHECK (`type` IN ('deposit', 'withdrawal', 'transfer')),
+    `amount` DECIMAL(10, 2) NOT NULL,
+    `currency` CHAR(3) NOT NULL DEFAULT 'NGN',
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
\ No newline at end of file
@@ -0,0 +1,13 @@
+CREATE TABLE `ledger_entries` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `transaction_id` INTEGER NOT NULL,
+    `account_number` VARCHAR(20) NOT NULL,
+    `direction` TEXT NOT NULL CHECK (`direction` IN ('debit', 'credit')),
+    `amount` DECIMAL(10, 2) NOT NULL,
+    `balance_after` DECIMAL(10, 2),
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT FK_TransactionEntry FOREIGN KEY (`transaction_id`) REFERENCES transactions(`id`)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+CREATE INDEX IX_EntryAccount ON `ledger_entries` (`account_number`);
\ No newline at end of file
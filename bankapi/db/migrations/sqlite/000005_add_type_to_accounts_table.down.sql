@@ -0,0 +1 @@
+ALTER TABLE accounts DROP COLUMN type;
\ No newline at end of file
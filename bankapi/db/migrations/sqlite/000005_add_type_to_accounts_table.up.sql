@@ -0,0 +1 @@
+ALTER TABLE `accounts` ADD COLUMN `type` TEXT NOT NULL DEFAULT 'current' CHECK (`type` IN ('current', 'savings'));
\ No newline at end of file
@@ -0,0 +1,18 @@
+CREATE TABLE accounts_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    account_number VARCHAR(10) NOT NULL,
+    balance DECIMAL(10, 2) DEFAULT 0.00,
+    status TEXT CHECK (status IN ('active', 'inactive', 'blacklisted')) DEFAULT 'active',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    type TEXT NOT NULL DEFAULT 'current' CHECK (type IN ('current', 'savings')),
+    CONSTRAINT FK_UserAccount FOREIGN KEY (user_id) REFERENCES users(id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE,
+    UNIQUE (account_number)
+);
+INSERT INTO accounts_old (id, user_id, account_number, balance, status, created_at, updated_at, type)
+    SELECT id, user_id, account_number, balance, CASE status WHEN 'closed' THEN 'inactive' ELSE status END, created_at, updated_at, type FROM accounts;
+DROP TABLE accounts;
+ALTER TABLE accounts_old RENAME TO accounts;
\ No newline at end of file
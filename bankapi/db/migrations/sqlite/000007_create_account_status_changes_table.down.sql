@@ -0,0 +1 @@
+DROP TABLE IF EXISTS account_status_changes;
\ No newline at end of file
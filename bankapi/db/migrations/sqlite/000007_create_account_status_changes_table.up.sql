@@ -0,0 +1,9 @@
+CREATE TABLE `account_status_changes` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `account_number` VARCHAR(20) NOT NULL,
+    `from_status` TEXT NOT NULL CHECK (`from_status` IN ('active', 'inactive', 'blacklisted', 'closed')),
+    `to_status` TEXT NOT NULL CHECK (`to_status` IN ('active', 'inactive', 'blacklisted', 'closed')),
+    `reason` VARCHAR(255) NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX IX_StatusChangeAccount ON `account_status_changes` (`account_number`);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS account_holds;
\ No newline at end of file
@@ -0,0 +1,9 @@
+CREATE TABLE `account_holds` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `account_number` VARCHAR(20) NOT NULL,
+    `amount` DECIMAL(10, 2) NOT NULL,
+    `reason` VARCHAR(255) NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `released_at` TIMESTAMP NULL DEFAULT NULL
+);
+CREATE INDEX IX_HoldAccount ON `account_holds` (`account_number`);
\ No newline at end of file
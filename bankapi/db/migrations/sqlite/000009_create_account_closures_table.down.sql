@@ -0,0 +1 @@
+DROP TABLE IF EXISTS account_closures;
\ No newline at end of file
@@ -0,0 +1 @@
+ALTER TABLE `accounts` ADD COLUMN `currency` CHAR(3) NOT NULL DEFAULT 'NGN';
\ No newline at end of file
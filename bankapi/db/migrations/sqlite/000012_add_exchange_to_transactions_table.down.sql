@@ -0,0 +1,3 @@
+ALTER TABLE transactions DROP COLUMN converted_amount;
+ALTER TABLE transactions DROP COLUMN converted_currency;
+ALTER TABLE transactions DROP COLUMN rate;
\ No newline at end of file
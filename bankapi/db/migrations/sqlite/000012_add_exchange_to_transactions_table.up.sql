@@ -0,0 +1,3 @@
+ALTER TABLE `transactions` ADD COLUMN `converted_amount` DECIMAL(10, 2);
+ALTER TABLE `transactions` ADD COLUMN `converted_currency` CHAR(3);
+ALTER TABLE `transactions` ADD COLUMN `rate` DECIMAL(18, 6);
\ No newline at end of file
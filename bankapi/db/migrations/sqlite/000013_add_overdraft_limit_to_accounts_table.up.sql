@@ -0,0 +1 @@
+ALTER TABLE `accounts` ADD COLUMN `overdraft_limit` DECIMAL(10, 2) NOT NULL DEFAULT 0.00;
\ No newline at end of file
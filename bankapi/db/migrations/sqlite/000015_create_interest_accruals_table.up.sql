@@ -0,0 +1,10 @@
+CREATE TABLE `interest_accruals` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `account_number` VARCHAR(20) NOT NULL,
+    `accrual_date` DATE NOT NULL,
+    `balance` DECIMAL(10, 2) NOT NULL,
+    `amount` BIGINT NOT NULL,
+    `transaction_id` INTEGER NULL DEFAULT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (`account_number`, `accrual_date`)
+);
\ No newline at end of file
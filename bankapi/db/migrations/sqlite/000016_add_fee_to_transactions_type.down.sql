@@ -0,0 +1,32 @@
+CREATE TABLE transactions_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL CHECK (type IN ('deposit', 'withdrawal', 'transfer', 'interest')),
+    amount DECIMAL(10, 2) NOT NULL,
+    currency CHAR(3) NOT NULL DEFAULT 'NGN',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    converted_amount DECIMAL(10, 2),
+    converted_currency CHAR(3),
+    rate DECIMAL(18, 6)
+);
+INSERT INTO transactions_old (id, type, amount, currency, created_at, converted_amount, converted_currency, rate)
+    SELECT id, CASE type WHEN 'fee' THEN 'withdrawal' ELSE type END, amount, currency, created_at, converted_amount, converted_currency, rate FROM transactions;
+CREATE TABLE ledger_entries_old (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    transaction_id INTEGER NOT NULL,
+    account_number VARCHAR(20) NOT NULL,
+    direction TEXT NOT NULL CHECK (direction IN ('debit', 'credit')),
+    amount DECIMAL(10, 2) NOT NULL,
+    balance_after DECIMAL(10, 2),
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    currency CHAR(3) NOT NULL DEFAULT 'NGN',
+    CONSTRAINT FK_TransactionEntry FOREIGN KEY (transaction_id) REFERENCES transactions_old(id)
+    ON DELETE CASCADE
+    ON UPDATE CASCADE
+);
+INSERT INTO ledger_entries_old (id, transaction_id, account_number, direction, amount, balance_after, created_at, currency)
+    SELECT id, transaction_id, account_number, direction, amount, balance_after, created_at, currency FROM ledger_entries;
+DROP TABLE ledger_entries;
+DROP TABLE transactions;
+ALTER TABLE transactions_old RENAME TO transactions;
+ALTER TABLE ledger_entries_old RENAME TO ledger_entries;
+CREATE INDEX IX_EntryAccount ON ledger_entries (account_number);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS maintenance_fees;
\ No newline at end of file
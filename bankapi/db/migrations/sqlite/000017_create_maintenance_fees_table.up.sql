@@ -0,0 +1,8 @@
+CREATE TABLE `maintenance_fees` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `account_number` VARCHAR(20) NOT NULL,
+    `fee_month` CHAR(7) NOT NULL,
+    `transaction_id` INTEGER NOT NULL,
+    `charged_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (`account_number`, `fee_month`)
+);
\ No newline at end of file
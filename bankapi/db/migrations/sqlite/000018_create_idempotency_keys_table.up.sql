@@ -0,0 +1,11 @@
+CREATE TABLE `idempotency_keys` (
+    `idempotency_key` VARCHAR(255) NOT NULL PRIMARY KEY,
+    `fingerprint` CHAR(64) NOT NULL,
+    `status_code` INTEGER NULL DEFAULT NULL,
+    `content_type` VARCHAR(255) NULL DEFAULT NULL,
+    `location` VARCHAR(255) NULL DEFAULT NULL,
+    `response_body` BLOB NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `expires_at` DATETIME NOT NULL
+);
+CREATE INDEX IX_IdempotencyExpiry ON `idempotency_keys` (`expires_at`);
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS customer_logins;
\ No newline at end of file
@@ -0,0 +1 @@
+DROP TABLE IF EXISTS pending_operations;
\ No newline at end of file
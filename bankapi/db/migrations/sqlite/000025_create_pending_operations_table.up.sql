@@ -0,0 +1,17 @@
+CREATE TABLE `pending_operations` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `type` VARCHAR(20) NOT NULL,
+    `account_number` VARCHAR(20) NOT NULL,
+    `to_account_number` VARCHAR(20) NULL DEFAULT NULL,
+    `amount` DECIMAL(10, 2) NOT NULL,
+    `note` VARCHAR(255) NULL DEFAULT NULL,
+    `currency` CHAR(3) NOT NULL,
+    `status` VARCHAR(20) NOT NULL DEFAULT 'pending',
+    `requested_by` VARCHAR(120) NOT NULL,
+    `requested_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `decided_by` VARCHAR(120) NULL DEFAULT NULL,
+    `decided_at` TIMESTAMP NULL DEFAULT NULL,
+    `reason` VARCHAR(255) NULL DEFAULT NULL,
+    `transaction_id` INTEGER NULL DEFAULT NULL
+);
+CREATE INDEX IX_PendingOperationStatus ON `pending_operations` (`status`);
\ No newline at end of file
@@ -0,0 +1 @@
+DELETE FROM role_permissions WHERE permission = 'operations:approve' OR role = 'approver';
\ No newline at end of file
@@ -0,0 +1,17 @@
+CREATE TABLE `audit_log` (
+    `id` INTEGER PRIMARY KEY AUTOINCREMENT,
+    `actor` VARCHAR(120) NOT NULL,
+    `action` VARCHAR(120) NOT NULL,
+    `target` VARCHAR(120) NOT NULL,
+    `account_number` VARCHAR(20) NULL DEFAULT NULL,
+    `state_before` TEXT NULL DEFAULT NULL,
+    `state_after` TEXT NULL DEFAULT NULL,
+    `request_id` VARCHAR(64) NOT NULL,
+    `status` INTEGER NOT NULL,
+    `created_at` TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    `prev_hash` VARCHAR(64) NOT NULL,
+    `hash` VARCHAR(64) NOT NULL,
+    UNIQUE (`prev_hash`)
+);
+CREATE INDEX IX_AuditLogAccount ON `audit_log` (`account_number`);
+CREATE INDEX IX_AuditLogActor ON `audit_log` (`actor`);
\ No newline at end of file
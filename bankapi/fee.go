@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+const feesUsage = "usage: bankapi fees [-testing] YYYY-MM"
+
+// maintenanceRun counts what chargeMaintenanceFees did for a month.
+type maintenanceRun struct {
+	Charged  int // Accounts that were charged the month's fee.
+	Repeated int // Accounts that had already been charged in an earlier run.
+	Unpaid   int // Accounts that couldn't pay, which a later run can charge again.
+}
+
+// feesCommand is a function that runs the "bankapi fees" subcommand, which charges the maintenance fees of a month
+// on the configured database by the rules of the file named by FEES, and records the run in the audit log.
+// With -testing, it charges the accounts of the test database configured in .env.testing instead.
+func feesCommand(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("fees", flag.ContinueOnError)
+	flags.SetOutput(w)
+	testing := flags.Bool("testing", false, "charge on the test database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(feesUsage)
+	}
+	month, err := time.Parse("2006-01", flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid month %q; %s", flags.Arg(0), feesUsage)
+	}
+
+	path := os.Getenv("FEES")
+	if path == "" {
+		return errors.New("FEES should name the file of the fee rules")
+	}
+	fees, err := loadFees(path)
+	if err != nil {
+		return err
+	}
+
+	cfg := db.LoadConfig()
+	if *testing {
+		cfg = db.LoadTestingConfig()
+	}
+	store, err := db.Open(cfg)
+	if err != nil {
+		return err
+	}
+	if err := checkSchema(store); err != nil {
+		return err
+	}
+
+	run, err := chargeMaintenanceFees(store, fees, month)
+	if err != nil {
+		return err
+	}
+	if err := recordCommand(store, "fees "+month.Format("2006-01"), auditTarget{}, run); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Maintenance fees of %s: %d accounts charged, %d already charged, %d unpaid\n", month.Format("2006-01"), run.Charged, run.Repeated, run.Unpaid)
+	return nil
+}
+
+// loadFees is a function that reads the fee schedule of the file at path.
+func loadFees(path string) (*bank.FeeSchedule, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	fees, err := bank.LoadFees(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return fees, nil
+}
+
+// chargeMaintenanceFees is a function that charges every account its maintenance fee for the month, if its
+// account type has one. Every account is charged in its own transaction, which also records the fee of the month,
+// so an account is charged once a month however many times the month is run.
+// Accounts that can't pay the fee, because of their balance or their status, are counted as unpaid and left for a later run.
+func chargeMaintenanceFees(store db.Store, fees *bank.FeeSchedule, month time.Time) (maintenanceRun, error) {
+	var run maintenanceRun
+
+	for _, accountType := range bank.AccountTypes {
+		accounts, err := store.Accounts().AccountsByType(accountType)
+		if err != nil {
+			return run, err
+		}
+		for _, account := range accounts {
+			if err := chargeMaintenanceFee(store, fees, account.Number, month, &run); err != nil {
+				return run, fmt.Errorf("charge maintenance fee of %s: %w", account.Number, err)
+			}
+		}
+	}
+	return run, nil
+}
+
+// chargeMaintenanceFee is a function that charges the account its maintenance fee for the month
+// and records it, in a single transaction. It counts what it did in run.
+func chargeMaintenanceFee(store db.Store, fees *bank.FeeSchedule, number string, month time.Time, run *maintenanceRun) error {
+	var charged bool
+
+	err := store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return err
+		}
+		account, ok := accounts[number]
+		if !ok || account.Status == bank.StatusClosed {
+			return nil
+		}
+
+		t, err := bank.NewLedger(tx.Transactions()).WithFees(fees).ChargeMaintenance(account)
+		if err != nil || t == nil {
+			return err
+		}
+		if err := tx.Fees().InsertMaintenanceFee(number, month, t.ID); err != nil {
+			return err
+		}
+		charged = true
+		return tx.Accounts().UpdateBalance(account)
+	})
+	switch {
+	case errors.Is(err, db.ErrDuplicate):
+		run.Repeated++
+	case errors.Is(err, bank.ErrInsufficientFunds), errors.Is(err, bank.ErrOverdraftLimitExceeded), errors.Is(err, bank.ErrAccountRestricted):
+		run.Unpaid++
+	case err != nil:
+		return err
+	case charged:
+		run.Charged++
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/themobileprof/bank"
+)
+
+func TestFees(t *testing.T) {
+	s := newTestServer(t)
+	fees, err := bank.LoadFees(strings.NewReader("withdrawal * 0:1\ntransfer * 0:0.5% min=0.25\nmaintenance current 0:2"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.fees = fees
+
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`)
+
+	rr := serveAPI(t, s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 10}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"fee":1.00`) || !strings.Contains(rr.Body.String(), `"balance":89.00`) {
+		t.Errorf("expected a fee of 1.00 on the withdrawal: %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveAPI(t, s, "POST", "/v1/accounts/0017286378/transfers", `{"to": "0018989350", "amount": 10}`)
+	if rr.Code != http.StatusCreated || !strings.Contains(rr.Body.String(), `"fee":0.25`) || !strings.Contains(rr.Body.String(), `"balance":78.75`) {
+		t.Errorf("expected the minimum fee of 0.25 on the transfer: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// The legacy endpoints show the fee on the statement they return
+	rr = serveAPI(t, s, "POST", "/withdraw?number=0017286378&amount=5", "")
+	if !strings.Contains(rr.Body.String(), `"Fee Charged":1.00`) || !strings.Contains(rr.Body.String(), `"Balance":72.75`) {
+		t.Errorf("unexpected legacy withdrawal response: %s", rr.Body.String())
+	}
+	rr = serveAPI(t, s, "POST", "/transfer?from=0017286378&to=0018989350&amount=50", "")
+	if !strings.Contains(rr.Body.String(), `"Fee Charged":0.25`) || !strings.Contains(rr.Body.String(), `"Balance":22.50`) {
+		t.Errorf("unexpected legacy transfer response: %s", rr.Body.String())
+	}
+
+	// A withdrawal whose fee doesn't fit the balance is refused as a whole
+	rr = serveAPI(t, s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 22}`)
+	if rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeInsufficientFunds {
+		t.Errorf("expected insufficient funds for the fee: %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Maintenance is charged once a month to every current account that can pay it
+	savings, err := s.openAccount(1, bank.SavingsAccount, bank.DefaultCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveAPI(t, s, "POST", "/v1/accounts/"+savings.Number+"/deposits", `{"amount": 10}`)
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 20}`)
+
+	month := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	run, err := chargeMaintenanceFees(s.store, fees, month)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run != (maintenanceRun{Charged: 1, Unpaid: 1}) {
+		t.Errorf("expected one account charged and one unpaid, got %+v", run)
+	}
+	account, _ := s.store.Accounts().GetAccountByNumber("0018989350")
+	if account.Balance.Amount != 5800 {
+		t.Errorf("expected a maintenance fee of 2.00, got a balance of %s", account.Balance)
+	}
+	rr = serveAPI(t, s, "GET", "/v1/accounts/0018989350/transactions?type=fee", "")
+	if !strings.Contains(rr.Body.String(), `"Type":"fee"`) {
+		t.Errorf("expected the fee in the account's history, got %s", rr.Body.String())
+	}
+
+	if run, err = chargeMaintenanceFees(s.store, fees, month); err != nil {
+		t.Fatal(err)
+	}
+	if run != (maintenanceRun{Repeated: 1, Unpaid: 1}) {
+		t.Errorf("expected the month to be charged once, got %+v", run)
+	}
+	account, _ = s.store.Accounts().GetAccountByNumber("0018989350")
+	if account.Balance.Amount != 5800 {
+		t.Errorf("expected a repeated run to charge nothing, got a balance of %s", account.Balance)
+	}
+}
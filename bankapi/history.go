@@ -0,0 +1,219 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/bank/accountnumber"
+	"github.com/themobileprof/db"
+)
+
+const (
+	defaultHistoryLimit = 20  // Transactions per page when no limit is given.
+	maxHistoryLimit     = 100 // Largest page a client can ask for.
+)
+
+// transactionHistory is an account statement followed by a page of transactions.
+type transactionHistory struct {
+	accountStatement
+	Transactions []bank.StatementLine
+	NextCursor   string `json:"Next Cursor,omitempty"` // Pass as "cursor" to get the next page.
+}
+
+// Statement returns the transaction history as a JSON string.
+func (h *transactionHistory) Statement() string {
+	json, err := json.Marshal(h)
+	if err != nil {
+		return err.Error()
+	}
+
+	return string(json)
+}
+
+// historyFilter narrows down the transactions returned for an account.
+// Zero values mean "no restriction".
+type historyFilter struct {
+	From      time.Time            // Earliest date, inclusive.
+	To        time.Time            // Latest date, inclusive.
+	Type      bank.TransactionType // Only this type of transaction.
+	MinAmount *bank.Money          // Smallest amount, inclusive.
+	MaxAmount *bank.Money          // Largest amount, inclusive.
+	Cursor    int64                // Only transactions older than this cursor.
+	Limit     int                  // Page size, zero for no limit.
+}
+
+// parseHistoryFilter reads the filter from the "from", "to", "type", "min_amount", "max_amount",
+// "cursor" and "limit" query parameters. Dates are in YYYY-MM-DD format.
+func parseHistoryFilter(req *http.Request) (historyFilter, error) {
+	q := req.URL.Query()
+	filter := historyFilter{Limit: defaultHistoryLimit}
+
+	var err error
+	if v := q.Get("from"); v != "" {
+		if filter.From, err = time.Parse("2006-01-02", v); err != nil {
+			return filter, fmt.Errorf("Invalid from date!")
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if filter.To, err = time.Parse("2006-01-02", v); err != nil {
+			return filter, fmt.Errorf("Invalid to date!")
+		}
+	}
+
+	switch t := bank.TransactionType(q.Get("type")); t {
+	case "", bank.DepositTransaction, bank.WithdrawalTransaction, bank.TransferTransaction, bank.InterestTransaction, bank.FeeTransaction, bank.AdjustmentTransaction:
+		filter.Type = t
+	default:
+		return filter, fmt.Errorf("Invalid transaction type!")
+	}
+
+	if v := q.Get("min_amount"); v != "" {
+		amount, err := bank.ParseMoney(v, bank.DefaultCurrency)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid minimum amount!")
+		}
+		filter.MinAmount = &amount
+	}
+	if v := q.Get("max_amount"); v != "" {
+		amount, err := bank.ParseMoney(v, bank.DefaultCurrency)
+		if err != nil {
+			return filter, fmt.Errorf("Invalid maximum amount!")
+		}
+		filter.MaxAmount = &amount
+	}
+
+	if v := q.Get("cursor"); v != "" {
+		if filter.Cursor, err = strconv.ParseInt(v, 10, 64); err != nil || filter.Cursor <= 0 {
+			return filter, fmt.Errorf("Invalid cursor!")
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 || filter.Limit > maxHistoryLimit {
+			return filter, fmt.Errorf("Invalid limit!")
+		}
+	}
+
+	return filter, nil
+}
+
+// getTransactions returns the account's transactions matching the filter, newest first.
+// It fetches one more line than the limit to tell whether there is a next page,
+// and returns the cursor of that page, or an empty string if this is the last one.
+// A limit of zero returns every matching transaction.
+func (s *server) getTransactions(number string, filter historyFilter) ([]bank.StatementLine, string, error) {
+	query := db.TransactionFilter{
+		Since:     filter.From,
+		Type:      filter.Type,
+		MinAmount: filter.MinAmount,
+		MaxAmount: filter.MaxAmount,
+		Before:    filter.Cursor,
+	}
+	if !filter.To.IsZero() {
+		query.Until = filter.To.AddDate(0, 0, 1)
+	}
+	if filter.Limit > 0 {
+		query.Limit = filter.Limit + 1
+	}
+
+	lines, err := s.store.Transactions().History(number, query)
+	if err != nil {
+		return nil, "", err
+	}
+
+	cursor := ""
+	if filter.Limit > 0 && len(lines) > filter.Limit {
+		lines = lines[:filter.Limit]
+		cursor = strconv.FormatInt(lines[len(lines)-1].ID, 10)
+	}
+	return lines, cursor, nil
+}
+
+// getPeriodStatement builds the statement of the account for the days from and to, inclusive.
+// The opening balance comes from the running balance of the journal: the balance before the first
+// transaction of the period, or the balance after the last transaction before it if the period is empty.
+func (s *server) getPeriodStatement(account *bank.Account, from, to time.Time) (*bank.PeriodStatement, error) {
+	if to.Before(from) {
+		return nil, bank.ErrInvalidPeriod
+	}
+
+	lines, _, err := s.getTransactions(account.Number, historyFilter{From: from, To: to})
+	if err != nil {
+		return nil, err
+	}
+
+	// getTransactions returns the newest first, a statement reads oldest first
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+
+	var opening bank.Money
+	if len(lines) > 0 {
+		opening, err = bank.OpeningFromLines(lines)
+	} else {
+		opening, err = s.store.Transactions().BalanceBefore(account, from)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return bank.NewPeriodStatement(from, to, opening, lines)
+}
+
+// transactions is a handler function that returns the transaction history of an account.
+// The account number is taken from the {number} path segment of /accounts/{number}/transactions.
+// If the account number is missing or invalid, it returns an appropriate error message.
+// The account is looked up with getAccountByNumber, so unknown accounts are reported the same way as in the other handlers.
+// The transactions can be filtered by date range ("from", "to"), "type" and amount range ("min_amount", "max_amount"),
+// and are returned newest first, a page at a time. The "Next Cursor" of a page is passed as "cursor" to get the next one.
+// The response is the account statement followed by the page of transactions, as JSON.
+func (s *server) transactions(w http.ResponseWriter, req *http.Request) {
+	numberqs := req.PathValue("number")
+
+	if numberqs == "" {
+		fmt.Fprintf(w, "Account number is missing!")
+		return
+	}
+
+	// ensure the account number is well formed, check digit included
+	if !accountnumber.Valid(numberqs) {
+		fmt.Fprintf(w, "Invalid account number!")
+		return
+	}
+
+	filter, err := parseHistoryFilter(req)
+	if err != nil {
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	account, err := s.getAccountByNumber(numberqs)
+	if err != nil {
+		fmt.Fprintf(w, "Error getting account: %v", err)
+		return
+	}
+
+	lines, cursor, err := s.getTransactions(account.Number, filter)
+	if err != nil {
+		fmt.Fprintf(w, "Error getting transactions: %v", err)
+		return
+	}
+
+	history := transactionHistory{
+		accountStatement: accountStatement{
+			Name:      account.Name,
+			Address:   account.Address,
+			Phone:     account.Phone,
+			Number:    account.Number,
+			IBAN:      s.accountIBAN(account.Number),
+			Balance:   account.Balance,
+			Overdraft: newStatementOverdraft(account),
+		},
+		Transactions: lines,
+		NextCursor:   cursor,
+	}
+	fmt.Fprint(w, history.Statement())
+}
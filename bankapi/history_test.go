@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// getHistory calls the transactions handler for the account with the given query string.
+func getHistory(t *testing.T, s *server, number, query string) *httptest.ResponseRecorder {
+	req, err := http.NewRequest("GET", "/accounts/"+number+"/transactions?"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.SetPathValue("number", number)
+
+	rr := httptest.NewRecorder()
+	s.transactions(rr, req)
+	return rr
+}
+
+func TestTransactionsHandler(t *testing.T) {
+	s := newTestServer(t)
+
+	// Make sure the account has at least two transactions
+	for _, q := range []string{"number=0017286378&amount=7", "number=0017286378&amount=3"} {
+		req, _ := http.NewRequest("POST", "/deposit?"+q, nil)
+		s.deposit(httptest.NewRecorder(), req)
+	}
+
+	rr := getHistory(t, s, "0017286378", "type=deposit&limit=1")
+
+	var history transactionHistory
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatalf("response is not a transaction history: %v: %s", err, rr.Body.String())
+	}
+
+	if len(history.Transactions) != 1 {
+		t.Fatalf("expected one transaction per page, got %d", len(history.Transactions))
+	}
+	if history.Transactions[0].Amount.String() != "3.00" || history.Transactions[0].Type != "deposit" {
+		t.Errorf("expected the latest deposit first, got %+v", history.Transactions[0])
+	}
+	if history.NextCursor == "" {
+		t.Fatal("expected a cursor for the next page")
+	}
+
+	// The next page continues with the older deposit
+	rr = getHistory(t, s, "0017286378", "type=deposit&limit=1&cursor="+history.NextCursor)
+
+	var next transactionHistory
+	if err := json.Unmarshal(rr.Body.Bytes(), &next); err != nil {
+		t.Fatalf("response is not a transaction history: %v: %s", err, rr.Body.String())
+	}
+	if len(next.Transactions) != 1 || next.Transactions[0].Amount.String() != "7.00" {
+		t.Errorf("unexpected second page: %+v", next.Transactions)
+	}
+}
+
+func TestTransactionsHandlerAmountFilter(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := getHistory(t, s, "0017286378", "min_amount=1000000")
+
+	var history transactionHistory
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatalf("response is not a transaction history: %v: %s", err, rr.Body.String())
+	}
+	if len(history.Transactions) != 0 {
+		t.Errorf("expected no transactions above the minimum amount, got %d", len(history.Transactions))
+	}
+}
+
+func TestTransactionsHandlerInvalidFilters(t *testing.T) {
+	s := newTestServer(t)
+	tests := map[string]string{
+		"from=yesterday":   "Invalid from date!",
+		"to=2024-13-01":    "Invalid to date!",
+		"type=refund":      "Invalid transaction type!",
+		"min_amount=1.234": "Invalid minimum amount!",
+		"max_amount=abc":   "Invalid maximum amount!",
+		"cursor=-1":        "Invalid cursor!",
+		"limit=1000":       "Invalid limit!",
+	}
+
+	for query, expectedBody := range tests {
+		rr := getHistory(t, s, "0017286378", query)
+		if rr.Body.String() != expectedBody {
+			t.Errorf("%s: expected body %q but got %q", query, expectedBody, rr.Body.String())
+		}
+	}
+}
+
+func TestTransactionsHandlerInvalidAccountNumber(t *testing.T) {
+	s := newTestServer(t)
+	rr := getHistory(t, s, "abc", "")
+
+	expectedBody := "Invalid account number!"
+	if rr.Body.String() != expectedBody {
+		t.Errorf("expected body %q but got %q", expectedBody, rr.Body.String())
+	}
+}
+
+func TestTransactionsHandlerAccountNotFound(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := getHistory(t, s, "0010000008", "")
+
+	expectedBody := "Error getting account: account not found"
+	if rr.Body.String() != expectedBody {
+		t.Errorf("expected body %q but got %q", expectedBody, rr.Body.String())
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/themobileprof/db"
+)
+
+// idempotencyHeader is the request header that makes retrying a mutating request safe.
+const idempotencyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the longest idempotency key the API stores.
+const maxIdempotencyKeyLength = 255
+
+// defaultIdempotencyWindow is how long a response is replayed for the key of its request, unless IDEMPOTENCY_WINDOW says otherwise.
+const defaultIdempotencyWindow = 24 * time.Hour
+
+// mutating is a function that reports whether the request can change anything: any request but GET, HEAD and OPTIONS.
+func mutating(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+// fingerprint is a function that returns the hash of the principal, method, URL and body of a request,
+// which tells a retry of the request apart from another request made with the same idempotency key,
+// including one made by another caller.
+func fingerprint(req *http.Request, body []byte) string {
+	h := sha256.New()
+	if p := principalOf(req); p != nil {
+		fmt.Fprintf(h, "%s\n", p)
+	}
+	fmt.Fprintf(h, "%s %s\n", req.Method, req.URL.RequestURI())
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// responseRecorder is an http.ResponseWriter that keeps a copy of the status and body it writes,
+// so the response can be stored for the idempotency key of its request.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// idempotent is a function that handles the mutating request, see audited, so that if it is made with an Idempotency-Key header
+// it is handled only once while its key lasts. The key is stored with the request's fingerprint before the request is handled,
+// and the response after, both in the request's transaction, and a retry with the same key and request gets the stored response
+// without being handled again. It responds 409 if the key was used for a different request, or if the request is still being handled.
+// A request that fails with a server error is rolled back with its key, so it can be retried,
+// and so is one whose response can't be stored, which responds 500.
+// Requests without the header are handled as they are.
+func (s *server) idempotent(w http.ResponseWriter, req *http.Request, id string) error {
+	key := req.Header.Get(idempotencyHeader)
+	if key == "" {
+		return s.audited(w, req, id)
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: fmt.Sprintf("%s should be at most %d characters", idempotencyHeader, maxIdempotencyKeyLength)})
+		return nil
+	}
+
+	body, err := io.ReadAll(http.MaxBytesReader(w, req.Body, maxBodySize))
+	if err != nil {
+		writeError(w, &apiError{Status: http.StatusBadRequest, Code: codeInvalidRequest, Message: "Unreadable request body: " + err.Error()})
+		return nil
+	}
+	req.Body = io.NopCloser(bytes.NewReader(body))
+
+	r := &db.IdempotentRequest{Key: key, Fingerprint: fingerprint(req, body), ExpiresAt: time.Now().UTC().Add(s.idempotencyWindow)}
+	err = s.reserveIdempotencyKey(r)
+	if errors.Is(err, db.ErrDuplicate) {
+		s.replay(w, r)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	rec := &responseRecorder{ResponseWriter: w}
+	if err := s.audited(rec, req, id); err != nil {
+		return err
+	}
+	if rec.status == 0 {
+		return s.store.Idempotency().DeleteRequest(key)
+	}
+	r.Status, r.ContentType, r.Location, r.Body = rec.status, rec.Header().Get("Content-Type"), rec.Header().Get("Location"), rec.body.Bytes()
+	if err := s.store.Idempotency().SaveResponse(r); err != nil {
+		return fmt.Errorf("save response of idempotency key %q: %w", key, err)
+	}
+	return nil
+}
+
+// reserveIdempotencyKey is a function that stores the request before it is handled.
+// A key whose window has passed is used again; any other key already stored is an ErrDuplicate.
+func (s *server) reserveIdempotencyKey(r *db.IdempotentRequest) error {
+	err := s.store.Idempotency().InsertRequest(r)
+	if !errors.Is(err, db.ErrDuplicate) {
+		return err
+	}
+
+	if _, err := s.store.Idempotency().DeleteExpired(time.Now().UTC()); err != nil {
+		return err
+	}
+	return s.store.Idempotency().InsertRequest(r)
+}
+
+// replay is a function that responds to a retried request with the stored response of the first request made with its key.
+// Replayed responses have an Idempotent-Replayed header.
+func (s *server) replay(w http.ResponseWriter, r *db.IdempotentRequest) {
+	stored, err := s.store.Idempotency().GetRequest(r.Key)
+	if errors.Is(err, db.ErrRequestNotFound) || (err == nil && !stored.Done()) {
+		writeError(w, &apiError{Status: http.StatusConflict, Code: codeIdempotencyInProgress, Message: "A request with this Idempotency-Key is still being handled, retry it later"})
+		return
+	}
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	if stored.Fingerprint != r.Fingerprint {
+		writeError(w, &apiError{Status: http.StatusConflict, Code: codeIdempotencyMismatch, Message: "This Idempotency-Key was used for a different request"})
+		return
+	}
+
+	if stored.ContentType != "" {
+		w.Header().Set("Content-Type", stored.ContentType)
+	}
+	if stored.Location != "" {
+		w.Header().Set("Location", stored.Location)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(stored.Status)
+	w.Write(stored.Body)
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/themobileprof/db"
+)
+
+// serveIdempotent serves a request made with the idempotency key and returns the response.
+func serveIdempotent(s *server, method, path, body, key string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(idempotencyHeader, key)
+	rr := httptest.NewRecorder()
+	s.routes().ServeHTTP(rr, req)
+	return rr
+}
+
+func TestIdempotencyKeys(t *testing.T) {
+	s := newTestServer(t)
+
+	rr := serveIdempotent(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, "deposit-1")
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+	first := rr.Body.String()
+
+	// A retry gets the original response, and the money moves once
+	rr = serveIdempotent(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, "deposit-1")
+	if rr.Code != http.StatusCreated || rr.Body.String() != first || rr.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("expected the original response to be replayed, got %d %s", rr.Code, rr.Body.String())
+	}
+	account, _ := s.store.Accounts().GetAccountByNumber("0017286378")
+	if account.Balance.Amount != 10000 {
+		t.Errorf("expected a single deposit of 100.00, got a balance of %s", account.Balance)
+	}
+
+	// The same key for another request is refused
+	rr = serveIdempotent(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 200}`, "deposit-1")
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codeIdempotencyMismatch {
+		t.Errorf("expected a reused key to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveIdempotent(s, "POST", "/v1/accounts/0018989350/deposits", `{"amount": 100}`, "deposit-1")
+	if rr.Code != http.StatusConflict || errorCode(t, rr) != codeIdempotencyMismatch {
+		t.Errorf("expected a key reused on another account to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	// Client errors are replayed too, and the location of created resources
+	rr = serveIdempotent(s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 500}`, "withdrawal-1")
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Fatalf("expected status %v but got %v: %s", http.StatusUnprocessableEntity, rr.Code, rr.Body.String())
+	}
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 1000}`)
+	rr = serveIdempotent(s, "POST", "/v1/accounts/0017286378/withdrawals", `{"amount": 500}`, "withdrawal-1")
+	if rr.Code != http.StatusUnprocessableEntity || errorCode(t, rr) != codeInsufficientFunds {
+		t.Errorf("expected the refusal to be replayed, got %d %s", rr.Code, rr.Body.String())
+	}
+	rr = serveIdempotent(s, "POST", "/v1/customers", `{"name": "John Roe", "email": "john@example.com"}`, "customer-1")
+	location := rr.Header().Get("Location")
+	rr = serveIdempotent(s, "POST", "/v1/customers", `{"name": "John Roe", "email": "john@example.com"}`, "customer-1")
+	if rr.Code != http.StatusCreated || location == "" || rr.Header().Get("Location") != location {
+		t.Errorf("expected the customer's creation to be replayed, got %d %q %s", rr.Code, rr.Header().Get("Location"), rr.Body.String())
+	}
+
+	// The legacy endpoints take keys as well
+	for i := 0; i < 2; i++ {
+		rr = serveIdempotent(s, "POST", "/transfer?from=0017286378&to=0018989350&amount=10", "", "transfer-1")
+		if !strings.Contains(rr.Body.String(), `"Balance":1090.00`) {
+			t.Errorf("expected a single legacy transfer, got %s", rr.Body.String())
+		}
+	}
+
+	// Reads ignore the header
+	rr = serveIdempotent(s, "GET", "/v1/accounts/0017286378", "", "deposit-1")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"balance":1090.00`) {
+		t.Errorf("expected the account, got %d %s", rr.Code, rr.Body.String())
+	}
+
+	rr = serveIdempotent(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 1}`, strings.Repeat("k", maxIdempotencyKeyLength+1))
+	if rr.Code != http.StatusBadRequest || errorCode(t, rr) != codeInvalidRequest {
+		t.Errorf("expected an overlong key to be refused, got %d %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestIdempotencyKeyExpiry(t *testing.T) {
+	s := newTestServer(t)
+	s.idempotencyWindow = time.Millisecond
+
+	serveIdempotent(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, "deposit-1")
+	time.Sleep(10 * time.Millisecond)
+
+	// Once its window has passed, a key can be used again, even for another request
+	rr := serveIdempotent(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 50}`, "deposit-1")
+	if rr.Code != http.StatusCreated || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected the expired key to be used again, got %d %s", rr.Code, rr.Body.String())
+	}
+	account, _ := s.store.Accounts().GetAccountByNumber("0017286378")
+	if account.Balance.Amount != 15000 {
+		t.Errorf("expected both deposits, got a balance of %s", account.Balance)
+	}
+}
+
+func TestIdempotencyConcurrentReplays(t *testing.T) {
+	s := newTestServer(t)
+	serveAPI(t, s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 1000}`)
+
+	const retries = 20
+	responses := make([]*httptest.ResponseRecorder, retries)
+	var wg sync.WaitGroup
+	for i := range responses {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			responses[i] = serveIdempotent(s, "POST", "/v1/accounts/0017286378/transfers", `{"to": "0018989350", "amount": 10}`, "transfer-1")
+		}(i)
+	}
+	wg.Wait()
+
+	// Every retry either moved the money, replays the response of the one that did, or was told to wait for it
+	var created string
+	for _, rr := range responses {
+		switch rr.Code {
+		case http.StatusCreated:
+			if created != "" && rr.Body.String() != created {
+				t.Errorf("expected every response to be the original one, got %s and %s", created, rr.Body.String())
+			}
+			created = rr.Body.String()
+		case http.StatusConflict:
+			if code := errorCode(t, rr); code != codeIdempotencyInProgress {
+				t.Errorf("expected the retry to wait for the original, got %q", code)
+			}
+		default:
+			t.Errorf("unexpected response %d %s", rr.Code, rr.Body.String())
+		}
+	}
+	if created == "" {
+		t.Error("expected the transfer to be made")
+	}
+
+	for number, balance := range map[string]int64{"0017286378": 99000, "0018989350": 1000} {
+		account, _ := s.store.Accounts().GetAccountByNumber(number)
+		if account.Balance.Amount != balance {
+			t.Errorf("expected the transfer to be made once, got a balance of %s for %s", account.Balance, number)
+		}
+	}
+	if stored, err := s.store.Idempotency().GetRequest("transfer-1"); err != nil || !stored.Done() {
+		t.Errorf("expected the response to be stored, got %+v %v", stored, err)
+	}
+	if _, err := s.store.Idempotency().GetRequest("unused"); !errors.Is(err, db.ErrRequestNotFound) {
+		t.Errorf("expected no request for an unused key, got %v", err)
+	}
+}
+
+// unsavedResponses is a store that can't store the responses of idempotency keys while failing is set.
+type unsavedResponses struct {
+	db.Store
+	failing *bool
+}
+
+func (s unsavedResponses) Idempotency() db.IdempotencyRepository {
+	return unsavedResponseLog{s.Store.Idempotency(), s.failing}
+}
+
+func (s unsavedResponses) Atomic(fn func(tx db.Store) error) error {
+	return s.Store.Atomic(func(tx db.Store) error {
+		return fn(unsavedResponses{tx, s.failing})
+	})
+}
+
+type unsavedResponseLog struct {
+	db.IdempotencyRepository
+	failing *bool
+}
+
+func (r unsavedResponseLog) SaveResponse(stored *db.IdempotentRequest) error {
+	if *r.failing {
+		return errors.New("disk full")
+	}
+	return r.IdempotencyRepository.SaveResponse(stored)
+}
+
+func TestIdempotencyResponseNotSaved(t *testing.T) {
+	s := newTestServer(t)
+	failing := true
+	s.store = unsavedResponses{s.store, &failing}
+
+	// A request whose response can't be stored fails and is rolled back with its key
+	rr := serveIdempotent(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, "deposit-1")
+	if rr.Code != http.StatusInternalServerError || errorCode(t, rr) != codeInternal {
+		t.Fatalf("expected the deposit to fail, got %d %s", rr.Code, rr.Body.String())
+	}
+	if got := balance(t, s, "0017286378"); got != 0 {
+		t.Errorf("expected the deposit to be rolled back, got a balance of %d", got)
+	}
+	if _, err := s.store.Idempotency().GetRequest("deposit-1"); !errors.Is(err, db.ErrRequestNotFound) {
+		t.Errorf("expected the key to be released, got %v", err)
+	}
+
+	// So the retry is handled
+	failing = false
+	rr = serveIdempotent(s, "POST", "/v1/accounts/0017286378/deposits", `{"amount": 100}`, "deposit-1")
+	if rr.Code != http.StatusCreated || rr.Header().Get("Idempotent-Replayed") != "" {
+		t.Errorf("expected the retry to be handled, got %d %s", rr.Code, rr.Body.String())
+	}
+	if got := balance(t, s, "0017286378"); got != 10000 {
+		t.Errorf("expected a single deposit of 100.00, got a balance of %d", got)
+	}
+}
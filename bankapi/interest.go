@@ -0,0 +1,179 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+const accrueUsage = "usage: bankapi accrue [-testing] YYYY-MM-DD"
+
+// accrualRun counts what accrueInterest did for a business date.
+type accrualRun struct {
+	Accrued     int // Accounts that accrued the day's interest.
+	Repeated    int // Accounts that had already accrued it in an earlier run.
+	Capitalized int // Accounts that were paid the interest of the month.
+}
+
+// accrueCommand is a function that runs the "bankapi accrue" subcommand, which accrues the interest of a business date
+// on the configured database with the interest products of the file named by INTEREST_PRODUCTS,
+// and records the run in the audit log.
+// With -testing, it accrues on the test database configured in .env.testing instead.
+func accrueCommand(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("accrue", flag.ContinueOnError)
+	flags.SetOutput(w)
+	testing := flags.Bool("testing", false, "accrue on the test database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New(accrueUsage)
+	}
+	date, err := time.Parse("2006-01-02", flags.Arg(0))
+	if err != nil {
+		return fmt.Errorf("invalid business date %q; %s", flags.Arg(0), accrueUsage)
+	}
+
+	path := os.Getenv("INTEREST_PRODUCTS")
+	if path == "" {
+		return errors.New("INTEREST_PRODUCTS should name the file of the interest products")
+	}
+	products, err := loadInterestProducts(path)
+	if err != nil {
+		return err
+	}
+
+	cfg := db.LoadConfig()
+	if *testing {
+		cfg = db.LoadTestingConfig()
+	}
+	store, err := db.Open(cfg)
+	if err != nil {
+		return err
+	}
+	if err := checkSchema(store); err != nil {
+		return err
+	}
+
+	run, err := accrueInterest(store, products, date)
+	if err != nil {
+		return err
+	}
+	if err := recordCommand(store, "accrue "+date.Format("2006-01-02"), auditTarget{}, run); err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Interest of %s: %d accounts accrued, %d already accrued, %d capitalized\n", date.Format("2006-01-02"), run.Accrued, run.Repeated, run.Capitalized)
+	return nil
+}
+
+// loadInterestProducts is a function that reads the interest products of the file at path.
+func loadInterestProducts(path string) (map[bank.AccountType]*bank.InterestProduct, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	products, err := bank.LoadInterestProducts(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return products, nil
+}
+
+// accrueInterest is a function that accrues a day of interest for the business date on every account
+// that has a product, worked out on the account's balance at the end of that day.
+// On the last day of a month, the accruals of the month are then capitalized into the accounts.
+// Every account is accrued in its own transaction, and one that has already accrued for the date is left alone,
+// so running the same date again, e.g. after a failure, only finishes what the first run didn't.
+// Accounts that can't receive money, such as closed ones, earn nothing.
+func accrueInterest(store db.Store, products map[bank.AccountType]*bank.InterestProduct, date time.Time) (accrualRun, error) {
+	var run accrualRun
+
+	types := make([]string, 0, len(products))
+	for accountType := range products {
+		types = append(types, string(accountType))
+	}
+	sort.Strings(types)
+
+	for _, accountType := range types {
+		product := products[bank.AccountType(accountType)]
+
+		accounts, err := store.Accounts().AccountsByType(product.Type)
+		if err != nil {
+			return run, err
+		}
+		for _, account := range accounts {
+			if err := accrueAccount(store, product, account.Number, date, &run); err != nil {
+				return run, fmt.Errorf("accrue interest of %s: %w", account.Number, err)
+			}
+		}
+	}
+	return run, nil
+}
+
+// accrueAccount is a function that accrues the account's interest for the business date, and capitalizes
+// its pending accruals at the end of the month, in a single transaction. It counts what it did in run.
+func accrueAccount(store db.Store, product *bank.InterestProduct, number string, date time.Time, run *accrualRun) error {
+	var accrued, capitalized bool
+
+	err := store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return err
+		}
+		account, ok := accounts[number]
+		if !ok || !account.Status.CanReceive() {
+			return nil
+		}
+
+		balance, err := tx.Transactions().BalanceBefore(account, date.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		accrual := product.Accrue(number, balance, date)
+		if err := tx.Interest().InsertAccrual(&accrual); err != nil {
+			return err
+		}
+		accrued = true
+
+		if date.AddDate(0, 0, 1).Day() != 1 {
+			return nil
+		}
+		pending, err := tx.Interest().PendingAccruals(number, accrual.Date)
+		if err != nil {
+			return err
+		}
+		t, err := bank.NewLedger(tx.Transactions()).Capitalize(account, pending)
+		if err != nil || t == nil {
+			return err
+		}
+		if err := tx.Accounts().UpdateBalance(account); err != nil {
+			return err
+		}
+		capitalized = true
+		return tx.Interest().MarkCapitalized(pending, t.ID)
+	})
+	if errors.Is(err, db.ErrDuplicate) {
+		run.Repeated++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if accrued {
+		run.Accrued++
+	}
+	if capitalized {
+		run.Capitalized++
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/themobileprof/bank"
+)
+
+func TestAccrueInterest(t *testing.T) {
+	s := newTestServer(t)
+
+	// A savings account with 1,000,000.00 earns 100.00 a day at 3.65%, a blacklisted one nothing
+	savings, err := s.openAccount(1, bank.SavingsAccount, bank.DefaultCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blacklisted, err := s.openAccount(1, bank.SavingsAccount, bank.DefaultCurrency)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serveAPI(t, s, "POST", "/v1/accounts/"+savings.Number+"/deposits", `{"amount": 1000000}`)
+	serveAPI(t, s, "POST", "/v1/admin/accounts/"+blacklisted.Number+"/blacklist", `{"reason": "Fraud"}`)
+
+	products, err := bank.LoadInterestProducts(strings.NewReader("savings actual/365 0:3.65"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UTC()
+	monthEnd := time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.UTC)
+
+	// The last day of the month accrues the day and pays the month's interest
+	run, err := accrueInterest(s.store, products, monthEnd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run != (accrualRun{Accrued: 1, Capitalized: 1}) {
+		t.Errorf("expected one account accrued and capitalized, got %+v", run)
+	}
+	account, _ := s.store.Accounts().GetAccountByNumber(savings.Number)
+	if account.Balance.Amount != 100010000 {
+		t.Errorf("expected 100.00 of interest, got a balance of %s", account.Balance)
+	}
+	rr := serveAPI(t, s, "GET", "/v1/accounts/"+savings.Number+"/transactions?type=interest", "")
+	if !strings.Contains(rr.Body.String(), `"Type":"interest"`) {
+		t.Errorf("expected the interest in the account's history, got %s", rr.Body.String())
+	}
+
+	// Running the date again changes nothing
+	if run, err = accrueInterest(s.store, products, monthEnd); err != nil {
+		t.Fatal(err)
+	}
+	if run != (accrualRun{Repeated: 1}) {
+		t.Errorf("expected the account to have accrued already, got %+v", run)
+	}
+	account, _ = s.store.Accounts().GetAccountByNumber(savings.Number)
+	if account.Balance.Amount != 100010000 {
+		t.Errorf("expected a repeated run to pay nothing, got a balance of %s", account.Balance)
+	}
+
+	// Other days only accrue, until the next capitalization
+	if run, err = accrueInterest(s.store, products, monthEnd.AddDate(0, 0, -1)); err != nil {
+		t.Fatal(err)
+	}
+	if run != (accrualRun{Accrued: 1}) {
+		t.Errorf("expected the account to accrue without capitalization, got %+v", run)
+	}
+	pending, err := s.store.Interest().PendingAccruals(savings.Number, monthEnd)
+	if err != nil || len(pending) != 1 {
+		t.Errorf("expected one pending accrual, got %v %v", pending, err)
+	}
+}
@@ -1,27 +1,168 @@
 package main
 
 import (
+	"embed"
 	"fmt"
+	"io/fs"
 	"log"
 	"net/http"
+	"os"
+	"time"
 
 	"github.com/themobileprof/bank"
+	"github.com/themobileprof/bank/accountnumber"
 	"github.com/themobileprof/db"
 )
 
+// migrations holds the schema of every storage dialect, one directory per driver.
+//
+//go:embed db/migrations
+var migrations embed.FS
+
+// schema returns the embedded migrations rooted at the dialect directories.
+func schema() fs.FS {
+	sub, err := fs.Sub(migrations, "db/migrations")
+	if err != nil {
+		panic(err)
+	}
+	return sub
+}
+
+// loadRates reads the exchange rate table of the file at path.
+func loadRates(path string) (*bank.StaticRates, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	rates, err := bank.LoadRates(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return rates, nil
+}
+
 func main() {
-	db.Connect()
-	var accounts = bank.Account{}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := migrateCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
-	fmt.Println(bank.Welcome())
-	account, err := createAccount(&accounts)
+	// Interest is accrued by running "bankapi accrue" once per business date, e.g. from cron at the end of the day
+	if len(os.Args) > 1 && os.Args[1] == "accrue" {
+		if err := accrueCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Maintenance fees are charged by running "bankapi fees" once a month
+	if len(os.Args) > 1 && os.Args[1] == "fees" {
+		if err := feesCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// Back-office integrations are given API keys by running "bankapi apikey NAME"
+	if len(os.Args) > 1 && os.Args[1] == "apikey" {
+		if err := apikeyCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	// The audit log's hash chain is checked by running "bankapi audit verify"
+	if len(os.Args) > 1 && os.Args[1] == "audit" {
+		if err := auditCommand(os.Args[2:], os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg := db.LoadConfig()
+	cfg.Schema = schema()
+
+	store, err := db.Open(cfg)
 	if err != nil {
 		log.Fatal(err)
 	}
-	fmt.Printf("Account successfully created for user: %v\n", account.Name)
+	if err := checkSchema(store); err != nil {
+		log.Fatal(err)
+	}
+	s := newServer(store)
+
+	// New accounts are numbered in the branch given by BRANCH_PREFIX, randomly or sequentially as ACCOUNT_NUMBERS says
+	strategy, err := accountnumber.ParseStrategy(os.Getenv("ACCOUNT_NUMBERS"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	if s.numbers, err = accountnumber.NewAllocator(os.Getenv("BRANCH_PREFIX"), strategy); err != nil {
+		log.Fatal(err)
+	}
+
+	// Accounts get IBANs once the bank's IBAN_COUNTRY and IBAN_BANK_CODE are set
+	if country, bankCode := os.Getenv("IBAN_COUNTRY"), os.Getenv("IBAN_BANK_CODE"); country != "" || bankCode != "" {
+		if s.iban, err = bank.NewIBANScheme(country, bankCode, accountnumber.Length); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Transfers between currencies use the rates of the FX_RATES file, one "USD NGN 1500" per line
+	if path := os.Getenv("FX_RATES"); path != "" {
+		if s.rates, err = loadRates(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Withdrawals and transfers are charged by the rules of the FEES file, such as "withdrawal * 0:50"
+	if path := os.Getenv("FEES"); path != "" {
+		if s.fees, err = loadFees(path); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Deposits, withdrawals, transfers and closure sweeps over the APPROVAL_LIMITS, such as "NGN 1000000, USD 5000", await a second person's approval,
+	// and so do those in a currency without a limit
+	if limits := os.Getenv("APPROVAL_LIMITS"); limits != "" {
+		if s.approvalLimits, err = bank.ParseApprovalLimits(limits); err != nil {
+			log.Fatalf("APPROVAL_LIMITS: %v", err)
+		}
+	}
+
+	// Retried requests get the response of the first request with their Idempotency-Key for IDEMPOTENCY_WINDOW, such as "24h"
+	if window := os.Getenv("IDEMPOTENCY_WINDOW"); window != "" {
+		if s.idempotencyWindow, err = time.ParseDuration(window); err != nil || s.idempotencyWindow <= 0 {
+			log.Fatalf("IDEMPOTENCY_WINDOW should be a positive duration such as 24h, not %q", window)
+		}
+	}
+
+	// Customer sessions are signed with the Ed25519 key of the JWT_ED25519_KEY file, or else with the JWT_SECRET secret
+	switch path, secret := os.Getenv("JWT_ED25519_KEY"), os.Getenv("JWT_SECRET"); {
+	case path != "":
+		key, err := loadEd25519Key(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		s.tokens = newEd25519Signer(key)
+	case secret != "":
+		if s.tokens, err = newHMACSigner([]byte(secret)); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatal("JWT_ED25519_KEY or JWT_SECRET should be set to sign the sessions of customers")
+	}
+	if lifetime := os.Getenv("JWT_LIFETIME"); lifetime != "" {
+		if s.tokens.lifetime, err = time.ParseDuration(lifetime); err != nil || s.tokens.lifetime <= 0 {
+			log.Fatalf("JWT_LIFETIME should be a positive duration such as 15m, not %q", lifetime)
+		}
+	}
+
+	fmt.Println(bank.Welcome())
+	fmt.Println("Listening on localhost:8000")
 
-	http.HandleFunc("/statement", statement)
-	http.HandleFunc("/deposit", deposit)
-	http.HandleFunc("/withdraw", withdraw)
-	log.Fatal(http.ListenAndServe("localhost:8000", nil))
+	log.Fatal(http.ListenAndServe("localhost:8000", s.routes()))
 }
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/themobileprof/db"
+)
+
+const migrateUsage = "usage: bankapi migrate [-testing] up|down|status|to N"
+
+// migrateCommand is a function that runs the "bankapi migrate" subcommand on the configured database.
+// With -testing, it migrates the test database configured in .env.testing instead.
+func migrateCommand(args []string, w io.Writer) error {
+	flags := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	flags.SetOutput(w)
+	testing := flags.Bool("testing", false, "migrate the test database")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	cfg := db.LoadConfig()
+	if *testing {
+		cfg = db.LoadTestingConfig()
+	}
+
+	store, err := db.Open(cfg)
+	if err != nil {
+		return err
+	}
+	m, err := db.NewMigrator(store, schema())
+	if err != nil {
+		return err
+	}
+	return runMigrate(m, flags.Args(), w)
+}
+
+// runMigrate is a function that applies the migrate action in args with m, and writes the resulting schema version to w.
+func runMigrate(m *db.Migrator, args []string, w io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = m.Up()
+	case "down":
+		err = m.Down()
+	case "to":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			return fmt.Errorf("invalid version %q", args[1])
+		}
+		err = m.To(version)
+	case "status":
+		return printStatus(m, w)
+	default:
+		return errors.New(migrateUsage)
+	}
+	if err != nil {
+		return err
+	}
+
+	version, _, err := m.Version()
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Schema at version %d\n", version)
+	return nil
+}
+
+// printStatus is a function that writes every migration and whether it has been applied to w.
+func printStatus(m *db.Migrator, w io.Writer) error {
+	status, err := m.Status()
+	if err != nil {
+		return err
+	}
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+	for _, s := range status {
+		applied := "no"
+		if s.Applied {
+			applied = "yes"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\n", s.Version, s.Name, applied)
+	}
+	tw.Flush()
+
+	if dirty {
+		fmt.Fprintf(w, "Schema at version %d is dirty: the last migration failed and has to be fixed by hand\n", version)
+	}
+	return nil
+}
+
+// checkSchema is a function that refuses to serve against a database whose schema isn't up to date.
+// Stores without a schema, such as the in-memory store, always pass.
+func checkSchema(store db.Store) error {
+	m, err := db.NewMigrator(store, schema())
+	if err == db.ErrNoSchema {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := m.Check(); err != nil {
+		return fmt.Errorf("%v; run bankapi migrate up", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/themobileprof/db"
+)
+
+func TestRunMigrate(t *testing.T) {
+	store, err := db.Open(db.Config{Driver: db.SQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := db.NewMigrator(store, schema())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := checkSchema(store); err == nil || !strings.Contains(err.Error(), "bankapi migrate up") {
+		t.Errorf("expected an empty database to be refused, got %v", err)
+	}
+
+	var out bytes.Buffer
+	if err := runMigrate(m, []string{"to", "2"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "Schema at version 2\n" {
+		t.Errorf("unexpected output %q", out.String())
+	}
+
+	out.Reset()
+	if err := runMigrate(m, []string{"status"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != m.Latest()+1 || !strings.HasSuffix(lines[2], "yes") || !strings.HasSuffix(lines[3], "no") {
+		t.Errorf("unexpected status:\n%s", out.String())
+	}
+
+	out.Reset()
+	if err := runMigrate(m, []string{"up"}, &out); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkSchema(store); err != nil {
+		t.Errorf("expected the migrated database to be served, got %v", err)
+	}
+
+	for _, args := range [][]string{nil, {"sideways"}, {"to"}, {"to", "two"}} {
+		if err := runMigrate(m, args, &out); err == nil {
+			t.Errorf("%q: expected an error", args)
+		}
+	}
+}
+
+func TestCheckSchemaMemoryStore(t *testing.T) {
+	if err := checkSchema(db.NewMemoryStore()); err != nil {
+		t.Errorf("expected the in-memory store to need no schema, got %v", err)
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/themobileprof/bank"
+)
+
+// statementRenderer writes an account statement in one output format.
+type statementRenderer interface {
+	// ContentType is the MIME type of the rendered statement.
+	ContentType() string
+	// Render writes the statement to w.
+	Render(w io.Writer, s *accountStatement) error
+}
+
+// statementRenderers maps the "format" query parameter to its renderer.
+var statementRenderers = map[string]statementRenderer{
+	"json": jsonRenderer{},
+	"csv":  csvRenderer{},
+	"ofx":  ofxRenderer{},
+	"pdf":  pdfRenderer{},
+}
+
+// statementFormat picks the statement format of a request.
+// The "format" query parameter wins over the Accept header, and JSON is the default.
+// It returns an empty string if the requested format isn't supported.
+func statementFormat(req *http.Request) string {
+	if format := req.URL.Query().Get("format"); format != "" {
+		format = strings.ToLower(format)
+		if _, ok := statementRenderers[format]; ok {
+			return format
+		}
+		return ""
+	}
+
+	accept := req.Header.Get("Accept")
+	if accept == "" {
+		return "json"
+	}
+
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		switch mediaType {
+		case "application/json", "*/*", "application/*":
+			return "json"
+		case "text/csv":
+			return "csv"
+		case "application/x-ofx", "application/ofx":
+			return "ofx"
+		case "application/pdf":
+			return "pdf"
+		}
+	}
+	return ""
+}
+
+// jsonRenderer renders the statement as the JSON produced by accountStatement.Statement().
+type jsonRenderer struct{}
+
+func (jsonRenderer) ContentType() string { return "application/json" }
+
+func (jsonRenderer) Render(w io.Writer, s *accountStatement) error {
+	_, err := io.WriteString(w, bank.Statement(s))
+	return err
+}
+
+// csvRenderer renders the transactions of the statement period as CSV, one row per transaction,
+// with separate debit and credit columns as most accounting software expects.
+type csvRenderer struct{}
+
+func (csvRenderer) ContentType() string { return "text/csv" }
+
+func (csvRenderer) Render(w io.Writer, s *accountStatement) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Date", "Type", "Counterparty", "Debit", "Credit", "Balance"})
+
+	if s.Period != nil {
+		for _, l := range s.Period.Lines {
+			debit, credit := "", ""
+			if l.Direction == bank.Debit {
+				debit = l.Amount.String()
+			} else {
+				credit = l.Amount.String()
+			}
+			cw.Write([]string{l.Date.Format("2006-01-02"), string(l.Type), l.Counterparty, debit, credit, l.Balance.String()})
+		}
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
+
+// ofxRenderer renders the statement as an OFX 2.1.1 bank statement response,
+// which Quicken, GnuCash and most accounting software can import.
+type ofxRenderer struct{}
+
+// ofxBankID identifies the bank in BANKACCTFROM.
+const ofxBankID = "GOBANK"
+
+func (ofxRenderer) ContentType() string { return "application/x-ofx" }
+
+// ofxTransaction is a STMTTRN aggregate.
+type ofxTransaction struct {
+	Type   string `xml:"TRNTYPE"`
+	Posted string `xml:"DTPOSTED"`
+	Amount string `xml:"TRNAMT"`
+	FITID  string `xml:"FITID"`
+	Name   string `xml:"NAME"`
+	Memo   string `xml:"MEMO,omitempty"`
+}
+
+// ofxStatus is a STATUS aggregate.
+type ofxStatus struct {
+	Code     int    `xml:"CODE"`
+	Severity string `xml:"SEVERITY"`
+}
+
+// ofxDocument is the OFX response with a single bank statement.
+type ofxDocument struct {
+	XMLName xml.Name `xml:"OFX"`
+	Signon  struct {
+		Status   ofxStatus `xml:"STATUS"`
+		Server   string    `xml:"DTSERVER"`
+		Language string    `xml:"LANGUAGE"`
+	} `xml:"SIGNONMSGSRSV1>SONRS"`
+	Statement struct {
+		TransactionID string    `xml:"TRNUID"`
+		Status        ofxStatus `xml:"STATUS"`
+		Response      struct {
+			Currency string `xml:"CURDEF"`
+			Account  struct {
+				BankID    string `xml:"BANKID"`
+				AccountID string `xml:"ACCTID"`
+				Type      string `xml:"ACCTTYPE"`
+			} `xml:"BANKACCTFROM"`
+			Transactions struct {
+				Start string           `xml:"DTSTART"`
+				End   string           `xml:"DTEND"`
+				Lines []ofxTransaction `xml:"STMTTRN"`
+			} `xml:"BANKTRANLIST"`
+			Balance struct {
+				Amount string `xml:"BALAMT"`
+				AsOf   string `xml:"DTASOF"`
+			} `xml:"LEDGERBAL"`
+		} `xml:"STMTRS"`
+	} `xml:"BANKMSGSRSV1>STMTTRNRS"`
+}
+
+// ofxDate formats a time as an OFX date-time.
+func ofxDate(t time.Time) string {
+	return t.UTC().Format("20060102150405")
+}
+
+func (ofxRenderer) Render(w io.Writer, s *accountStatement) error {
+	var doc ofxDocument
+	doc.Signon.Server = ofxDate(s.Date)
+	doc.Signon.Language = "ENG"
+	doc.Signon.Status.Severity = "INFO"
+
+	doc.Statement.TransactionID = "0"
+	doc.Statement.Status.Severity = "INFO"
+
+	resp := &doc.Statement.Response
+	resp.Currency = s.Balance.Currency
+	if resp.Currency == "" {
+		resp.Currency = bank.DefaultCurrency
+	}
+	resp.Account.BankID = ofxBankID
+	resp.Account.AccountID = s.Number
+	resp.Account.Type = "CHECKING"
+
+	resp.Balance.Amount = s.Balance.String()
+	resp.Balance.AsOf = ofxDate(s.Date)
+
+	resp.Transactions.Start = ofxDate(s.Date)
+	resp.Transactions.End = ofxDate(s.Date)
+	if s.Period != nil {
+		resp.Transactions.Start = ofxDate(s.Period.From)
+		resp.Transactions.End = ofxDate(s.Period.To.AddDate(0, 0, 1).Add(-time.Second))
+		resp.Balance.Amount = s.Period.ClosingBalance.String()
+		resp.Balance.AsOf = resp.Transactions.End
+
+		for _, l := range s.Period.Lines {
+			t := ofxTransaction{
+				Type:   "CREDIT",
+				Posted: ofxDate(l.Date),
+				Amount: l.Amount.String(),
+				FITID:  strconv.FormatInt(l.ID, 10),
+				Name:   strings.ToUpper(string(l.Type[:1])) + string(l.Type[1:]),
+			}
+			if l.Direction == bank.Debit {
+				t.Type = "DEBIT"
+				t.Amount = l.Amount.Neg().String()
+			}
+			if l.Counterparty != "" {
+				t.Memo = "Account " + l.Counterparty
+			}
+			resp.Transactions.Lines = append(resp.Transactions.Lines, t)
+		}
+	}
+
+	body, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = fmt.Fprintf(w, "%s\n%s\n%s\n", `<?xml version="1.0" encoding="UTF-8" standalone="no"?>`,
+		`<?OFX OFXHEADER="200" VERSION="211" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>`, body)
+	return err
+}
+
+// pdfRenderer renders the statement as a printable PDF, split into pages
+// with the account details and page number at the top of each.
+type pdfRenderer struct{}
+
+const (
+	pdfLinesPerPage = 45  // Transaction lines on each page.
+	pdfPageWidth    = 595 // A4 width in points.
+	pdfPageHeight   = 842 // A4 height in points.
+)
+
+func (pdfRenderer) ContentType() string { return "application/pdf" }
+
+// pdfEscape escapes a string for use in a PDF text literal.
+func pdfEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`).Replace(s)
+}
+
+func (pdfRenderer) Render(w io.Writer, s *accountStatement) error {
+	var lines []bank.StatementLine
+	if s.Period != nil {
+		lines = s.Period.Lines
+	}
+
+	pages := (len(lines) + pdfLinesPerPage - 1) / pdfLinesPerPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	// Lay out the text of every page in a fixed-width font so the columns line up
+	var contents []string
+	for p := 0; p < pages; p++ {
+		var text []string
+		text = append(text,
+			fmt.Sprintf("Account Statement - %s", s.Name),
+			fmt.Sprintf("Account Number: %s    Page %d of %d", s.Number, p+1, pages),
+		)
+		if s.IBAN != "" {
+			text = append(text, fmt.Sprintf("IBAN: %s", bank.FormatIBAN(s.IBAN)))
+		}
+		if s.Period != nil {
+			text = append(text, fmt.Sprintf("Period: %s to %s", s.Period.From.Format("2006-01-02"), s.Period.To.Format("2006-01-02")))
+		} else {
+			text = append(text, fmt.Sprintf("Date: %s", s.Date.Format("2006-01-02")))
+		}
+		text = append(text, "")
+
+		if p == 0 && s.Period != nil {
+			text = append(text, fmt.Sprintf("Opening Balance: %s", s.Period.OpeningBalance), "")
+		}
+		text = append(text, fmt.Sprintf("%-10s  %-10s  %-12s  %12s  %12s  %12s", "Date", "Type", "Counterparty", "Debit", "Credit", "Balance"))
+
+		end := (p + 1) * pdfLinesPerPage
+		if end > len(lines) {
+			end = len(lines)
+		}
+		for _, l := range lines[p*pdfLinesPerPage : end] {
+			debit, credit := "", ""
+			if l.Direction == bank.Debit {
+				debit = l.Amount.String()
+			} else {
+				credit = l.Amount.String()
+			}
+			text = append(text, fmt.Sprintf("%-10s  %-10s  %-12s  %12s  %12s  %12s", l.Date.Format("2006-01-02"), l.Type, l.Counterparty, debit, credit, l.Balance))
+		}
+
+		if p == pages-1 {
+			text = append(text, "")
+			if s.Period != nil {
+				text = append(text,
+					fmt.Sprintf("Total Credits: %s", s.Period.TotalCredits),
+					fmt.Sprintf("Total Debits: %s", s.Period.TotalDebits),
+					fmt.Sprintf("Closing Balance: %s", s.Period.ClosingBalance),
+				)
+				if s.Period.OverdraftUsed != nil {
+					text = append(text, fmt.Sprintf("Most Overdraft Used: %s", s.Period.OverdraftUsed))
+				}
+			} else {
+				text = append(text, fmt.Sprintf("Balance: %s", s.Balance))
+			}
+			if s.Overdraft != nil {
+				text = append(text, fmt.Sprintf("Overdraft Limit: %s    Used: %s", s.Overdraft.Limit, s.Overdraft.Used))
+			}
+		}
+
+		var c bytes.Buffer
+		c.WriteString("BT\n/F1 9 Tf\n12 TL\n40 800 Td\n")
+		for _, t := range text {
+			fmt.Fprintf(&c, "(%s) Tj T*\n", pdfEscape(t))
+		}
+		c.WriteString("ET\n")
+		contents = append(contents, c.String())
+	}
+
+	// Objects: 1 catalog, 2 page tree, 3 font, then a page and its content stream for each page
+	var objects []string
+	kids := make([]string, pages)
+	for p := range contents {
+		kids[p] = fmt.Sprintf("%d 0 R", 4+2*p)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), pages),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>",
+	)
+	for p, c := range contents {
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %d %d] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", pdfPageWidth, pdfPageHeight, 5+2*p),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(c), c),
+		)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, o := range objects {
+		offsets[i] = buf.Len()
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
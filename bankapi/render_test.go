@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/themobileprof/bank"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata")
+
+// goldenStatement returns a fixed statement with the given number of transactions.
+func goldenStatement(t *testing.T, n int) *accountStatement {
+	day := time.Date(2024, 5, 1, 9, 30, 0, 0, time.UTC)
+	balance := bank.NewMoney(10000, bank.DefaultCurrency)
+
+	var lines []bank.StatementLine
+	for i := 0; i < n; i++ {
+		line := bank.StatementLine{
+			ID:        int64(100 + i),
+			Type:      bank.DepositTransaction,
+			Direction: bank.Credit,
+			Amount:    bank.NewMoney(int64(1000+i), bank.DefaultCurrency),
+			Date:      day.Add(time.Duration(i) * time.Hour),
+		}
+		if i%3 == 1 {
+			line.Type, line.Direction = bank.WithdrawalTransaction, bank.Debit
+		}
+		if i%3 == 2 {
+			line.Type, line.Direction, line.Counterparty = bank.TransferTransaction, bank.Debit, "0012222222"
+		}
+
+		amount := line.Amount
+		if line.Direction == bank.Debit {
+			amount = amount.Neg()
+		}
+		balance, _ = balance.Add(amount)
+		line.Balance = balance
+		lines = append(lines, line)
+	}
+
+	period, err := bank.NewPeriodStatement(day.Truncate(24*time.Hour), day.AddDate(0, 0, 30).Truncate(24*time.Hour), bank.NewMoney(10000, bank.DefaultCurrency), lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &accountStatement{
+		Name:    "Samuel (Sam) O'Neil",
+		Address: "3 Thorborn Avenue, Sabo, Yaba, Lagos",
+		Phone:   "(234) 803 395 4301",
+		Number:  "0012345267",
+		Balance: balance,
+		Period:  period,
+		Date:    time.Date(2024, 6, 1, 8, 0, 0, 0, time.UTC),
+	}
+}
+
+// checkGolden compares got with the golden file, or rewrites the file when -update is set.
+func checkGolden(t *testing.T, name string, got []byte) {
+	path := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing golden file, run go test -update: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s doesn't match the golden file:\n%s", name, got)
+	}
+}
+
+func TestRenderers(t *testing.T) {
+	tests := map[string]int{
+		"statement.json":      3,
+		"statement.csv":       3,
+		"statement.ofx":       3,
+		"statement.pdf":       3,
+		"statement_paged.pdf": pdfLinesPerPage + 5,
+	}
+
+	for name, n := range tests {
+		format := filepath.Ext(name)[1:]
+
+		var buf bytes.Buffer
+		if err := statementRenderers[format].Render(&buf, goldenStatement(t, n)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		checkGolden(t, name, buf.Bytes())
+	}
+}
+
+func TestPDFRendererPages(t *testing.T) {
+	var buf bytes.Buffer
+	if err := (pdfRenderer{}).Render(&buf, goldenStatement(t, pdfLinesPerPage*2+1)); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := bytes.Count(buf.Bytes(), []byte("/Type /Page ")); got != 3 {
+		t.Errorf("expected 3 pages, got %d", got)
+	}
+}
+
+func TestStatementFormat(t *testing.T) {
+	tests := []struct {
+		query, accept, want string
+	}{
+		{"", "", "json"},
+		{"", "text/csv", "csv"},
+		{"", "application/pdf;q=0.9, application/json", "pdf"},
+		{"", "application/x-ofx", "ofx"},
+		{"", "*/*", "json"},
+		{"format=CSV", "application/pdf", "csv"},
+		{"format=xls", "", ""},
+		{"", "image/png", ""},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/statement?number=0012345267&"+tt.query, nil)
+		if tt.accept != "" {
+			req.Header.Set("Accept", tt.accept)
+		}
+
+		if got := statementFormat(req); got != tt.want {
+			t.Errorf("format %q, accept %q: got %q, want %q", tt.query, tt.accept, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/bank/accountnumber"
+	"github.com/themobileprof/db"
+)
+
+// server owns the HTTP handlers and the storage they read and write through.
+type server struct {
+	store   db.Store
+	numbers *accountnumber.Allocator // Allocates the numbers of new accounts.
+	iban    *bank.IBANScheme         // Derives the IBANs of accounts, nil if the bank has none.
+	rates   bank.RateProvider        // Exchange rates of transfers between currencies.
+	fees    *bank.FeeSchedule        // Fees of withdrawals, transfers and maintenance, nil if nothing is charged.
+
+	approvalLimits bank.ApprovalLimits // Amounts over which money only moves once a second person approves it.
+
+	tokens *tokenSigner // Signs the session tokens of customers, nil if requests aren't authenticated.
+
+	idempotencyWindow time.Duration // How long the response of a request is replayed for its Idempotency-Key.
+}
+
+// newServer returns a server that keeps its customers, accounts and transactions in the given store.
+// New accounts get random numbers in the default branch until numbers is replaced,
+// accounts have no IBAN until iban is set, there are no exchange rates until rates is replaced,
+// nothing is charged until fees is set, no operation awaits approval until approvalLimits is set,
+// idempotency keys last for defaultIdempotencyWindow,
+// and anyone can make any request until tokens is set.
+func newServer(store db.Store) *server {
+	numbers, _ := accountnumber.NewAllocator(accountnumber.DefaultPrefix, accountnumber.Random)
+	return &server{store: store, numbers: numbers, rates: bank.NewStaticRates(), idempotencyWindow: defaultIdempotencyWindow}
+}
+
+// ledger returns a ledger that posts to the journal of the store,
+// converting transfers between currencies at the server's rates and charging the server's fees.
+func (s *server) ledger(tx db.Store) *bank.Ledger {
+	return bank.NewLedger(tx.Transactions()).WithRates(s.rates).WithFees(s.fees)
+}
+
+// routes returns the handlers of the server, see handlers.
+// Requests are authenticated, see authenticate, every handler is behind the policy check of its permission, see allow,
+// and mutating requests are handled in a transaction of the store together with the audit log entries of their changes
+// and the responses of their Idempotency-Key, see atomic.
+func (s *server) routes() http.Handler {
+	return s.authenticate(s.atomic())
+}
+
+// handlers registers the handlers of the server on a new ServeMux:
+// the /v1 JSON API and the original query string endpoints it replaces, which only move money on POST.
+func (s *server) handlers() *http.ServeMux {
+	mux := http.NewServeMux()
+	s.v1Routes(mux)
+
+	mux.Handle("/statement", s.ownAccount(queryValue("number"), allow(bank.PermReadAccounts, s.statement)))
+	mux.Handle("/deposit", s.ownAccount(queryValue("number"), methods{http.MethodPost: allow(bank.PermDeposit, s.deposit)}))
+	mux.Handle("/withdraw", s.ownAccount(queryValue("number"), methods{http.MethodPost: allow(bank.PermWithdraw, s.withdraw)}))
+	mux.Handle("/transfer", s.ownAccount(queryValue("from"), methods{http.MethodPost: allow(bank.PermTransfer, s.transfer)}))
+	mux.Handle("/accounts/{number}/transactions", s.ownAccount(pathValue("number"), allow(bank.PermReadAccounts, s.transactions)))
+	return mux
+}
+
+// using returns a copy of the server that reads and writes through the given store, such as a transaction of its own.
+func (s *server) using(store db.Store) *server {
+	c := *s
+	c.store = store
+	return &c
+}
+
+// errRollback is returned in a transaction to roll back a request that failed after its response was written.
+var errRollback = errors.New("request failed")
+
+// atomic is a function that returns the handlers of the server so that every mutating request but those of publicPaths
+// is handled in a single transaction of the store, with the handlers reading and writing through the transaction,
+// handled once for its Idempotency-Key, see idempotent, and written to the audit log, see audited, in the same transaction.
+// A request that fails with a server error, or whose audit log entry or idempotent response can't be written, is rolled back;
+// the latter responds 500. Responses are held until the transaction ends.
+// Every response carries the request's ID in an X-Request-ID header.
+func (s *server) atomic() http.Handler {
+	mux := s.handlers()
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := requestID(req)
+		w.Header().Set(requestIDHeader, id)
+		if !mutating(req) || publicPaths[req.URL.Path] {
+			mux.ServeHTTP(w, req)
+			return
+		}
+
+		res := newBufferedResponse()
+		err := s.store.Atomic(func(tx db.Store) error {
+			return s.using(tx).idempotent(res, req, id)
+		})
+		if err != nil && !errors.Is(err, errRollback) {
+			res = newBufferedResponse()
+			writeError(res, err)
+		}
+		res.flush(w)
+	})
+}
+
+// bufferedResponse is an http.ResponseWriter that holds the response until it is flushed to another one.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newBufferedResponse() *bufferedResponse {
+	return &bufferedResponse{header: http.Header{}}
+}
+
+func (r *bufferedResponse) Header() http.Header {
+	return r.header
+}
+
+func (r *bufferedResponse) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+}
+
+func (r *bufferedResponse) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.body.Write(b)
+}
+
+// flush writes the held response to w.
+func (r *bufferedResponse) flush(w http.ResponseWriter) {
+	for name, values := range r.header {
+		w.Header()[name] = values
+	}
+	if r.status != 0 {
+		w.WriteHeader(r.status)
+	}
+	w.Write(r.body.Bytes())
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/db"
+)
+
+// newTestStore returns an empty store for the handler tests.
+// They run on the in-memory store unless DBTESTDRIVER selects SQLite,
+// which then gets a fresh in-memory database per test.
+func newTestStore(t *testing.T) db.Store {
+	cfg := db.LoadTestingConfig()
+	switch cfg.Driver {
+	case "", db.Memory:
+		return db.NewMemoryStore()
+	case db.SQLite:
+		cfg.Path = ":memory:"
+		cfg.Schema = schema()
+		store, err := db.Open(cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return store
+	}
+
+	t.Fatalf("the handler tests need a memory or sqlite DBTESTDRIVER, not %q", cfg.Driver)
+	return nil
+}
+
+// newTestServer returns a server holding the accounts the handler tests use.
+func newTestServer(t *testing.T) *server {
+	s := newServer(newTestStore(t))
+
+	for _, account := range []*bank.Account{
+		{
+			Customer: bank.Customer{
+				Name:    "Jane Doe",
+				Email:   "jane@gmail.com",
+				Phone:   "(213) 555 0147",
+				Address: "Los Angeles, California",
+				Gender:  "Female",
+				DoB:     "2003-01-01",
+			},
+			Number:  "0017286378",
+			Balance: bank.NewMoney(0, bank.DefaultCurrency),
+		},
+		{
+			Customer: bank.Customer{
+				Name:    "Sam Song",
+				Email:   "samuel@gmail.com",
+				Phone:   "(803) 555 0147",
+				Address: "Lagos, Nigeria",
+				Gender:  "Male",
+				DoB:     "1983-10-10",
+			},
+			Number:  "0018989350",
+			Balance: bank.NewMoney(0, bank.DefaultCurrency),
+		},
+	} {
+		seedAccount(t, s.store, account)
+	}
+	return s
+}
+
+// seedAccount stores the account and its customer, as the handler tests find them.
+func seedAccount(t *testing.T, store db.Store, account *bank.Account) {
+	customerID, err := store.Customers().InsertCustomer(&account.Customer)
+	if err != nil {
+		t.Fatalf("customer not inserted. %s", err)
+	}
+	if _, err := store.Accounts().InsertAccount(customerID, account); err != nil {
+		t.Fatalf("account not inserted. %s", err)
+	}
+}
+
+func TestSQLiteServer(t *testing.T) {
+	store, err := db.Open(db.Config{Driver: db.SQLite, Path: ":memory:", Schema: schema()})
+	if err != nil {
+		t.Fatalf("embedded schema not applied: %v", err)
+	}
+	s := newServer(store)
+
+	account := &bank.Account{
+		Customer: bank.Customer{Name: "Jane Doe", Email: "jane@gmail.com"},
+		Number:   "0017286378",
+		Balance:  bank.NewMoney(0, bank.DefaultCurrency),
+	}
+	seedAccount(t, store, account)
+
+	req, _ := http.NewRequest("POST", "/deposit?number=0017286378&amount=12.5", nil)
+	rr := httptest.NewRecorder()
+	s.routes().ServeHTTP(rr, req)
+
+	var statement accountStatement
+	if err := json.Unmarshal(rr.Body.Bytes(), &statement); err != nil {
+		t.Fatalf("response is not a statement: %v: %s", err, rr.Body.String())
+	}
+	if statement.Balance.String() != "12.50" {
+		t.Errorf("expected a balance of 12.50, got %s", statement.Balance)
+	}
+
+	req, _ = http.NewRequest("GET", "/accounts/0017286378/transactions", nil)
+	rr = httptest.NewRecorder()
+	s.routes().ServeHTTP(rr, req)
+
+	var history transactionHistory
+	if err := json.Unmarshal(rr.Body.Bytes(), &history); err != nil {
+		t.Fatalf("response is not a transaction history: %v: %s", err, rr.Body.String())
+	}
+	if len(history.Transactions) != 1 || history.Transactions[0].Amount.String() != "12.50" {
+		t.Errorf("unexpected history: %+v", history.Transactions)
+	}
+}
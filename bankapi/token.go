@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// tokenIssuer is the "iss" claim of the session tokens the API issues.
+const tokenIssuer = "bankapi"
+
+// defaultTokenLifetime is how long a session token is valid, unless JWT_LIFETIME says otherwise.
+const defaultTokenLifetime = 15 * time.Minute
+
+// minSecretLength is the shortest HMAC secret tokens are signed with, the size of a SHA-256 hash.
+const minSecretLength = 32
+
+// Signing algorithms of session tokens.
+const (
+	algHS256 = "HS256" // HMAC with SHA-256, verified with the secret they were signed with.
+	algEdDSA = "EdDSA" // Ed25519, verified with the public key of the signing key.
+)
+
+// errInvalidToken is returned for a token that is malformed, badly signed, expired or not from this API.
+var errInvalidToken = errors.New("invalid token")
+
+// tokenClaims are the claims of a session token: the customer it was issued to and when it is valid.
+type tokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"` // The customer's ID.
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// tokenSigner signs and verifies the JWTs customer sessions are carried in, with HMAC or Ed25519.
+// Ed25519 tokens can be verified offline by anyone with the public key, HMAC tokens by anyone with the secret.
+type tokenSigner struct {
+	alg      string
+	secret   []byte             // HS256 secret.
+	private  ed25519.PrivateKey // EdDSA signing key.
+	lifetime time.Duration      // How long the tokens it issues are valid.
+}
+
+// newHMACSigner is a function that returns a signer of HS256 tokens with the secret,
+// which should be at least minSecretLength bytes long.
+func newHMACSigner(secret []byte) (*tokenSigner, error) {
+	if len(secret) < minSecretLength {
+		return nil, fmt.Errorf("the token secret should be at least %d bytes long", minSecretLength)
+	}
+	return &tokenSigner{alg: algHS256, secret: secret, lifetime: defaultTokenLifetime}, nil
+}
+
+// newEd25519Signer is a function that returns a signer of EdDSA tokens with the key.
+func newEd25519Signer(key ed25519.PrivateKey) *tokenSigner {
+	return &tokenSigner{alg: algEdDSA, private: key, lifetime: defaultTokenLifetime}
+}
+
+// loadEd25519Key is a function that reads the PEM encoded PKCS #8 Ed25519 private key of the file at path,
+// such as one made by "openssl genpkey -algorithm ed25519".
+func loadEd25519Key(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, fmt.Errorf("%s: expected a PEM encoded private key", path)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	private, ok := key.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s: expected an Ed25519 key, got %T", path, key)
+	}
+	return private, nil
+}
+
+// publicKey is a function that returns the key EdDSA tokens are verified with, or nil for HS256 tokens.
+func (s *tokenSigner) publicKey() ed25519.PublicKey {
+	if s.private == nil {
+		return nil
+	}
+	return s.private.Public().(ed25519.PublicKey)
+}
+
+// sign is a function that returns the signature of the signing input of a token.
+func (s *tokenSigner) sign(input string) []byte {
+	if s.alg == algEdDSA {
+		return ed25519.Sign(s.private, []byte(input))
+	}
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(input))
+	return mac.Sum(nil)
+}
+
+// issue is a function that returns a token for the customer, valid from now for the signer's lifetime.
+func (s *tokenSigner) issue(customerID int64, now time.Time) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": s.alg, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	claims, err := json.Marshal(tokenClaims{
+		Issuer:    tokenIssuer,
+		Subject:   strconv.FormatInt(customerID, 10),
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(s.lifetime).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	return input + "." + base64.RawURLEncoding.EncodeToString(s.sign(input)), nil
+}
+
+// verify is a function that returns the ID of the customer the token was issued to,
+// or an error matching errInvalidToken unless the token was signed by the signer and hasn't expired.
+// Tokens signed with another algorithm than the signer's are refused, whatever their header says.
+func (s *tokenSigner) verify(token string, now time.Time) (int64, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return 0, fmt.Errorf("%w: expected three parts", errInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeTokenPart(parts[0], &header); err != nil || header.Alg != s.alg {
+		return 0, fmt.Errorf("%w: expected an %s token", errInvalidToken, s.alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return 0, fmt.Errorf("%w: malformed signature", errInvalidToken)
+	}
+	input := parts[0] + "." + parts[1]
+	var valid bool
+	if s.alg == algEdDSA {
+		valid = ed25519.Verify(s.publicKey(), []byte(input), signature)
+	} else {
+		valid = hmac.Equal(signature, s.sign(input))
+	}
+	if !valid {
+		return 0, fmt.Errorf("%w: bad signature", errInvalidToken)
+	}
+
+	var claims tokenClaims
+	if err := decodeTokenPart(parts[1], &claims); err != nil {
+		return 0, fmt.Errorf("%w: malformed claims", errInvalidToken)
+	}
+	if claims.Issuer != tokenIssuer {
+		return 0, fmt.Errorf("%w: issued by %q", errInvalidToken, claims.Issuer)
+	}
+	if now.Unix() >= claims.ExpiresAt {
+		return 0, fmt.Errorf("%w: expired", errInvalidToken)
+	}
+	id, err := strconv.ParseInt(claims.Subject, 10, 64)
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("%w: no customer", errInvalidToken)
+	}
+	return id, nil
+}
+
+// decodeTokenPart is a function that decodes a base64url encoded JSON part of a token into v.
+func decodeTokenPart(part string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
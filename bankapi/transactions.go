@@ -4,19 +4,48 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
+	"time"
 
 	"github.com/themobileprof/bank"
+	"github.com/themobileprof/bank/accountnumber"
 	"github.com/themobileprof/db"
 )
 
 // accountStatement represents a bank account statement.
 type accountStatement struct {
-	Name    string  // Name of the account holder.
-	Address string  `json:"Address,omitempty"` // Address of the account holder. (optional)
-	Phone   string  // Phone number of the account holder.
-	Number  string  `json:"Account Number"` // Account number of the bank account.
-	Balance float64 // Current balance of the bank account.
+	Name      string                // Name of the account holder.
+	Address   string                `json:"Address,omitempty"` // Address of the account holder. (optional)
+	Phone     string                // Phone number of the account holder.
+	Number    string                `json:"Account Number"` // Account number of the bank account.
+	IBAN      string                `json:"IBAN,omitempty"` // IBAN of the bank account. (optional)
+	Balance   bank.Money            // Current balance of the bank account.
+	Fee       *bank.Money           `json:"Fee Charged,omitempty"` // Fee of the withdrawal or transfer the statement follows. (optional)
+	Overdraft *statementOverdraft   `json:"Overdraft,omitempty"`   // Arranged overdraft of the bank account. (optional)
+	Period    *bank.PeriodStatement `json:"Period,omitempty"`      // Activity over a statement period. (optional)
+	Date      time.Time             `json:"-"`                     // When the statement was produced.
+}
+
+// statementOverdraft is the arranged overdraft of an account and how much of it the account uses.
+type statementOverdraft struct {
+	Limit bank.Money
+	Used  bank.Money
+}
+
+// newStatementOverdraft returns the overdraft of the account for its statement, or nil if it has none
+// and doesn't use one.
+func newStatementOverdraft(a *bank.Account) *statementOverdraft {
+	if !a.Overdraft.IsPositive() && !a.Balance.IsNegative() {
+		return nil
+	}
+	return &statementOverdraft{Limit: a.Overdraft, Used: a.OverdraftUsed()}
+}
+
+// chargedFee returns the fee charged with the transaction for its statement, or nil if there was none.
+func chargedFee(t *bank.Transaction) *bank.Money {
+	if !t.Fee.IsPositive() {
+		return nil
+	}
+	return &t.Fee
 }
 
 // Statement returns the account statement as a JSON string.
@@ -31,23 +60,132 @@ func (a *accountStatement) Statement() string {
 	return string(json)
 }
 
+// postDeposit is a function that deposits the amount into the account with the given number.
+// It locks the account inside a transaction of the store, posts the deposit to the ledger and stores the new balance.
+// If any step fails, the whole transaction is rolled back; a store already in a transaction posts inside it.
+// A missing account is reported with an error wrapping db.ErrAccountNotFound.
+func (s *server) postDeposit(store db.Store, number string, amount bank.Money) (*bank.Account, *bank.Transaction, error) {
+	var account *bank.Account
+	var transaction *bank.Transaction
+	err := store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return fmt.Errorf("Error getting account: %v", err)
+		}
+		if account = accounts[number]; account == nil {
+			return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+		}
+
+		// Update account struct and post it to the journal
+		if transaction, err = s.ledger(tx).Deposit(account, amount); err != nil {
+			return err
+		}
+
+		// Synchronize with database
+		return tx.Accounts().UpdateBalance(account)
+	})
+	return account, transaction, err
+}
+
+// postWithdrawal is a function that withdraws the amount from the account with the given number.
+// It locks the account inside a transaction of the store, posts the withdrawal to the ledger and stores the new balance.
+// If any step fails, the whole transaction is rolled back; a store already in a transaction posts inside it.
+// A missing account is reported with an error wrapping db.ErrAccountNotFound.
+func (s *server) postWithdrawal(store db.Store, number string, amount bank.Money) (*bank.Account, *bank.Transaction, error) {
+	var account *bank.Account
+	var transaction *bank.Transaction
+	err := store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return fmt.Errorf("Error getting account: %v", err)
+		}
+		if account = accounts[number]; account == nil {
+			return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+		}
+
+		if transaction, err = s.ledger(tx).Withdraw(account, amount); err != nil {
+			return err
+		}
+
+		// Synchronize with database
+		return tx.Accounts().UpdateBalance(account)
+	})
+	return account, transaction, err
+}
+
+// postTransfer is a function that transfers the amount between the accounts with the given numbers.
+// It locks both accounts inside a single transaction of the store using LockAccounts,
+// which always locks them in the same order so concurrent transfers can't deadlock.
+// It then posts the transfer to the ledger and stores both balances.
+// If any step fails, the whole transaction is rolled back; a store already in a transaction posts inside it.
+// It returns the debited account, and reports a missing account with an error wrapping db.ErrAccountNotFound.
+func (s *server) postTransfer(store db.Store, from, to string, amount bank.Money) (*bank.Account, *bank.Transaction, error) {
+	var fromAccount *bank.Account
+	var transaction *bank.Transaction
+	err := store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(from, to)
+		if err != nil {
+			return fmt.Errorf("Error getting accounts: %v", err)
+		}
+		if fromAccount = accounts[from]; fromAccount == nil {
+			return fmt.Errorf("Error getting Debit account: %w", db.ErrAccountNotFound)
+		}
+		toAccount := accounts[to]
+		if toAccount == nil {
+			return fmt.Errorf("Error getting Receiving account: %w", db.ErrAccountNotFound)
+		}
+
+		if transaction, err = s.ledger(tx).Transfer(fromAccount, toAccount, amount); err != nil {
+			return err
+		}
+
+		// Synchronize with database
+		if err := tx.Accounts().UpdateBalance(fromAccount); err != nil {
+			return err
+		}
+		return tx.Accounts().UpdateBalance(toAccount)
+	})
+	return fromAccount, transaction, err
+}
+
+// postAdjustment is a function that corrects the balance of the account with the given number by the amount,
+// up if it is positive and down if it is negative.
+// It locks the account inside a transaction of the store, posts the adjustment to the ledger and stores the new balance.
+// If any step fails, the whole transaction is rolled back; a store already in a transaction posts inside it.
+// A missing account is reported with an error wrapping db.ErrAccountNotFound.
+func (s *server) postAdjustment(store db.Store, number string, amount bank.Money) (*bank.Account, *bank.Transaction, error) {
+	var account *bank.Account
+	var transaction *bank.Transaction
+	err := store.Atomic(func(tx db.Store) error {
+		accounts, err := tx.Accounts().LockAccounts(number)
+		if err != nil {
+			return fmt.Errorf("Error getting account: %v", err)
+		}
+		if account = accounts[number]; account == nil {
+			return fmt.Errorf("Error getting account: %w", db.ErrAccountNotFound)
+		}
+
+		if transaction, err = s.ledger(tx).Adjust(account, amount); err != nil {
+			return err
+		}
+
+		// Synchronize with database
+		return tx.Accounts().UpdateBalance(account)
+	})
+	return account, transaction, err
+}
+
 // deposit is a function that handles the deposit operation for a bank account.
 // It takes in an http.ResponseWriter and an http.Request as parameters.
-// The function first checks if the database connection is nil, and if so, it returns an error message.
-// It then retrieves the account number and amount from the query parameters of the request.
+// It retrieves the account number and amount from the query parameters of the POST request.
 // If the account number is missing or invalid, an error message is returned.
-// If the account number is valid, the function retrieves the account details from the database.
-// It then updates the account balance by depositing the specified amount.
+// If the account number is valid, the deposit is posted with postDeposit,
+// unless its amount is over the approval limit and it awaits approval instead.
 // If there is an error during the deposit operation, an error message is returned.
-// Otherwise, the function synchronizes the updated account details with the database.
 // Finally, it generates a statement for the account and returns it as a response.
-func deposit(w http.ResponseWriter, req *http.Request) {
-
-	if db.DB == nil {
-		fmt.Fprintf(w, "database connection is nil")
-		return
-	}
-
+//
+// Deprecated: use POST /v1/accounts/{number}/deposits.
+func (s *server) deposit(w http.ResponseWriter, req *http.Request) {
 	numberqs := req.URL.Query().Get("number")
 	amountqs := req.URL.Query().Get("amount")
 
@@ -56,47 +194,48 @@ func deposit(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if _, err := strconv.ParseFloat(numberqs, 64); err != nil {
+	if !accountnumber.Valid(numberqs) {
 		fmt.Fprintf(w, "Invalid account number!")
-	} else if amount, err := strconv.ParseFloat(amountqs, 64); err != nil {
+	} else if amount, err := bank.ParseMoney(amountqs, ""); err != nil {
 		fmt.Fprintf(w, "Invalid amount number!")
 	} else {
-		account, err := getAccountByNumber(numberqs)
+		o := &bank.PendingOperation{Type: bank.DepositTransaction, Account: numberqs, Amount: amount}
+		if pending, err := s.submitForApproval(req, o); err != nil || pending {
+			legacySubmitted(w, o, err)
+			return
+		}
+
+		account, _, err := s.postDeposit(s.store, numberqs, amount)
+
 		if err != nil {
-			fmt.Fprintf(w, "Error getting account: %v", err)
+			fmt.Fprintf(w, "%v", err)
 		} else {
-			// Update account struct
-			err := account.Deposit(amount)
-
-			if err != nil {
-				fmt.Fprintf(w, "%v", err)
-			} else {
-				// Synchronize with database
-				updateBalance(w, account)
-
-				// Print the statement
-				statement := accountStatement{
-					Name:    account.Name,
-					Number:  account.Number,
-					Balance: account.Balance,
-				}
-				fmt.Fprint(w, statement.Statement())
+			// Print the statement
+			statement := accountStatement{
+				Name:      account.Name,
+				Number:    account.Number,
+				IBAN:      s.accountIBAN(account.Number),
+				Balance:   account.Balance,
+				Overdraft: newStatementOverdraft(account),
 			}
+			fmt.Fprint(w, statement.Statement())
 		}
 	}
 }
 
 // withdraw is a function that handles the withdrawal of funds from a bank account.
 // It takes in an http.ResponseWriter and an http.Request as parameters.
-// The function retrieves the account number and withdrawal amount from the request URL query parameters.
+// The function retrieves the account number and withdrawal amount from the query parameters of the POST request.
 // If the account number is missing, it returns an error message.
 // If the account number is invalid, it returns an error message.
 // If the withdrawal amount is invalid, it returns an error message.
-// Otherwise, it retrieves the account information using the account number.
-// If there is an error retrieving the account, it returns an error message.
-// If the withdrawal is successful, it updates the account balance in the database.
+// Otherwise, the withdrawal is posted with postWithdrawal, unless its amount is over the approval limit
+// and it awaits approval instead.
+// If there is an error retrieving the account or withdrawing, it returns an error message.
 // Finally, it generates a statement with the account information and returns it as a response.
-func withdraw(w http.ResponseWriter, req *http.Request) {
+//
+// Deprecated: use POST /v1/accounts/{number}/withdrawals.
+func (s *server) withdraw(w http.ResponseWriter, req *http.Request) {
 	numberqs := req.URL.Query().Get("number")
 	amountqs := req.URL.Query().Get("amount")
 
@@ -105,47 +244,49 @@ func withdraw(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if _, err := strconv.ParseFloat(numberqs, 64); err != nil {
+	if !accountnumber.Valid(numberqs) {
 		fmt.Fprintf(w, "Invalid account number!")
-	} else if amount, err := strconv.ParseFloat(amountqs, 64); err != nil {
+	} else if amount, err := bank.ParseMoney(amountqs, ""); err != nil {
 		fmt.Fprintf(w, "Invalid amount number!")
 	} else {
-		account, err := getAccountByNumber(numberqs)
+		o := &bank.PendingOperation{Type: bank.WithdrawalTransaction, Account: numberqs, Amount: amount}
+		if pending, err := s.submitForApproval(req, o); err != nil || pending {
+			legacySubmitted(w, o, err)
+			return
+		}
+
+		account, transaction, err := s.postWithdrawal(s.store, numberqs, amount)
+
 		if err != nil {
-			fmt.Fprintf(w, "Error getting account: %v", err)
+			fmt.Fprintf(w, "%v", err)
 		} else {
-			err := account.Withdraw(amount)
-			if err != nil {
-				fmt.Fprintf(w, "%v", err)
-			} else {
-				// Synchronize with database
-				updateBalance(w, account)
-
-				// Print the statement
-				statement := accountStatement{
-					Name:    account.Name,
-					Address: account.Address,
-					Phone:   account.Phone,
-					Number:  account.Number,
-					Balance: account.Balance,
-				}
-				fmt.Fprint(w, statement.Statement())
+			// Print the statement
+			statement := accountStatement{
+				Name:      account.Name,
+				Address:   account.Address,
+				Phone:     account.Phone,
+				Number:    account.Number,
+				IBAN:      s.accountIBAN(account.Number),
+				Balance:   account.Balance,
+				Fee:       chargedFee(transaction),
+				Overdraft: newStatementOverdraft(account),
 			}
+			fmt.Fprint(w, statement.Statement())
 		}
 	}
 }
 
 // transfer is a function that handles the transfer of funds between two accounts.
 // It takes in the http.ResponseWriter and *http.Request as parameters.
-// The function retrieves the "from", "to", and "amount" query parameters from the request URL.
+// The function retrieves the "from", "to", and "amount" query parameters of the POST request.
 // If either "from" or "to" is empty, it returns an error message indicating that two account numbers are required to complete a transfer.
-// If the account numbers are valid, it retrieves the corresponding accounts using the getAccountByNumber function.
-// If any error occurs during the retrieval of accounts, it returns an error message.
-// Otherwise, it calls the Transfer method on the "fromAccount" to transfer the specified amount to the "toAccount".
-// If an error occurs during the transfer, it returns the error message.
-// After a successful transfer, it updates the balances of both accounts in the database using the updateBalance function.
+// Either account may be given by its number or its IBAN. If both are valid, the transfer is posted with postTransfer,
+// unless its amount is over the approval limit and it awaits approval instead.
+// If any error occurs during the retrieval of accounts or the transfer, it returns an error message.
 // Finally, it generates a statement for the "fromAccount" and writes it to the http.ResponseWriter.
-func transfer(w http.ResponseWriter, req *http.Request) {
+//
+// Deprecated: use POST /v1/accounts/{number}/transfers.
+func (s *server) transfer(w http.ResponseWriter, req *http.Request) {
 	fromqs := req.URL.Query().Get("from")
 	toqs := req.URL.Query().Get("to")
 	amountqs := req.URL.Query().Get("amount")
@@ -155,94 +296,141 @@ func transfer(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if _, err := strconv.ParseFloat(fromqs, 64); err != nil {
+	// either account may be given by its IBAN
+	from, fromErr := s.resolveAccountNumber(fromqs, "from")
+	to, toErr := s.resolveAccountNumber(toqs, "to")
+
+	if fromErr != nil {
 		fmt.Fprintf(w, "Invalid debiting account number!")
-	} else if _, err := strconv.ParseFloat(toqs, 64); err != nil {
+	} else if toErr != nil {
 		fmt.Fprintf(w, "Invalid receiving account number!")
-	} else if amount, err := strconv.ParseFloat(amountqs, 64); err != nil {
+	} else if amount, err := bank.ParseMoney(amountqs, ""); err != nil {
 		fmt.Fprintf(w, "Amount is invalid!")
 	} else {
-		fromAccount, err := getAccountByNumber(fromqs)
+		o := &bank.PendingOperation{Type: bank.TransferTransaction, Account: from, To: to, Amount: amount}
+		if pending, err := s.submitForApproval(req, o); err != nil || pending {
+			legacySubmitted(w, o, err)
+			return
+		}
+
+		fromAccount, transaction, err := s.postTransfer(s.store, from, to, amount)
+
 		if err != nil {
-			fmt.Fprintf(w, "Error getting Debit account: %v", err)
+			fmt.Fprintf(w, "%v", err)
 		} else {
-			toAccount, err := getAccountByNumber(toqs)
-			if err != nil {
-				fmt.Fprintf(w, "Error getting Receiving account: %v", err)
-			} else {
-				err := fromAccount.Transfer(toAccount, amount)
-				if err != nil {
-					fmt.Fprintf(w, "%v", err)
-				} else {
-					// Synchronize with database
-					updateBalance(w, fromAccount)
-					updateBalance(w, toAccount)
-
-					// Print the statement
-					statement := accountStatement{
-						Name:    fromAccount.Name,
-						Address: fromAccount.Address,
-						Phone:   fromAccount.Phone,
-						Number:  fromAccount.Number,
-						Balance: fromAccount.Balance,
-					}
-					fmt.Fprint(w, statement.Statement())
-				}
+			// Print the statement
+			statement := accountStatement{
+				Name:      fromAccount.Name,
+				Address:   fromAccount.Address,
+				Phone:     fromAccount.Phone,
+				Number:    fromAccount.Number,
+				IBAN:      s.accountIBAN(fromAccount.Number),
+				Balance:   fromAccount.Balance,
+				Fee:       chargedFee(transaction),
+				Overdraft: newStatementOverdraft(fromAccount),
 			}
+			fmt.Fprint(w, statement.Statement())
 		}
 	}
 }
 
-// updateBalance updates the balance of an account in the database.
-// It takes a http.ResponseWriter and a *bank.Account as parameters.
-// It returns a boolean value indicating whether the balance update was successful or not.
-// If the update fails, it writes the error message to the http.ResponseWriter.
-func updateBalance(w http.ResponseWriter, account *bank.Account) bool {
-	// Update the deposit in the database
-	_, err := db.DB.Exec("UPDATE accounts SET balance = ? WHERE account_number = ?", account.Balance, account.Number)
-	if err != nil {
-		fmt.Fprintf(w, "UpdateDeposit: %v", err)
-		return false
-	} else {
-		return true
-	}
-
-}
-
 // statement is a handler function that generates and returns the account statement for a given account number.
 // It expects the account number to be provided as a query parameter in the request URL.
 // If the account number is missing or invalid, it returns an appropriate error message.
 // If the account number is valid, it retrieves the account details from the database and generates the statement.
 // The statement includes the account holder's name, address, phone number, account number, and balance.
+// If a "from" or "to" date (YYYY-MM-DD) is given, the statement also covers that period: the opening balance,
+// every transaction with its running balance, the totals of credits and debits, and the closing balance.
+// A missing "from" starts the period at the beginning of the month of "to", and a missing "to" ends it today.
+// The statement is rendered as JSON, CSV, OFX or PDF, chosen by the "format" query parameter or the Accept header.
+// Formats other than JSON always cover a period, the current month by default.
 // The generated statement is written to the http.ResponseWriter.
-func statement(w http.ResponseWriter, req *http.Request) {
+func (s *server) statement(w http.ResponseWriter, req *http.Request) {
 
 	numberqs := req.URL.Query().Get("number")
+	fromqs := req.URL.Query().Get("from")
+	toqs := req.URL.Query().Get("to")
 
 	if numberqs == "" {
 		fmt.Fprintf(w, "Account number is missing!")
 		return
 	}
 
-	// ensure the account number is like a number
-	if _, err := strconv.ParseFloat(numberqs, 64); err != nil {
+	// ensure the account number is well formed, check digit included
+	if !accountnumber.Valid(numberqs) {
 		fmt.Fprintf(w, "Invalid account number!")
-	} else {
-		// Get the account from the database
+		return
+	}
+
+	format := statementFormat(req)
+	if format == "" {
+		fmt.Fprintf(w, "Unsupported statement format!")
+		return
+	}
 
-		account, err := getAccountByNumber(numberqs)
+	from, to, err := parsePeriod(fromqs, toqs)
+	if err != nil {
+		fmt.Fprintf(w, "%v", err)
+		return
+	}
+
+	// Get the account from the database
+	account, err := s.getAccountByNumber(numberqs)
+	if err != nil {
+		fmt.Fprintf(w, "Error getting account: %v", err)
+		return
+	}
+
+	// Print the statement
+	statement := accountStatement{
+		Name:      account.Name,
+		Address:   account.Address,
+		Phone:     account.Phone,
+		Number:    account.Number,
+		IBAN:      s.accountIBAN(account.Number),
+		Balance:   account.Balance,
+		Overdraft: newStatementOverdraft(account),
+		Date:      time.Now().UTC(),
+	}
+
+	if fromqs != "" || toqs != "" || format != "json" {
+		statement.Period, err = s.getPeriodStatement(account, from, to)
 		if err != nil {
-			fmt.Fprintf(w, "Error getting account: %v", err)
-		} else {
-			// Print the statement
-			statement := accountStatement{
-				Name:    account.Name,
-				Address: account.Address,
-				Phone:   account.Phone,
-				Number:  account.Number,
-				Balance: account.Balance,
-			}
-			fmt.Fprint(w, statement.Statement())
+			fmt.Fprintf(w, "Error getting statement: %v", err)
+			return
 		}
 	}
+
+	renderer := statementRenderers[format]
+	w.Header().Set("Content-Type", renderer.ContentType())
+	if format != "json" {
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"statement-%s.%s\"", account.Number, format))
+	}
+	renderer.Render(w, &statement)
+}
+
+// parsePeriod parses the "from" and "to" dates of a statement period in YYYY-MM-DD format.
+// A missing "to" is today, and a missing "from" is the first day of the month of "to".
+func parsePeriod(fromqs, toqs string) (time.Time, time.Time, error) {
+	now := time.Now().UTC()
+	to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+
+	var err error
+	if toqs != "" {
+		if to, err = time.Parse("2006-01-02", toqs); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid to date!")
+		}
+	}
+
+	from := time.Date(to.Year(), to.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if fromqs != "" {
+		if from, err = time.Parse("2006-01-02", fromqs); err != nil {
+			return time.Time{}, time.Time{}, fmt.Errorf("Invalid from date!")
+		}
+	}
+
+	if to.Before(from) {
+		return time.Time{}, time.Time{}, fmt.Errorf("Invalid period!")
+	}
+	return from, to, nil
 }
@@ -1,15 +1,21 @@
 package main
 
 import (
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strings"
+	"sync"
 	"testing"
+
+	"github.com/themobileprof/bank"
+	"github.com/themobileprof/bank/accountnumber"
 )
 
 // TEST DEPOSITS
 func TestDepositHandler(t *testing.T) {
 	// Create a mock HTTP request
-	req, err := http.NewRequest("GET", "/deposit?number=0017286376&amount=10", nil)
+	req, err := http.NewRequest("POST", "/deposit?number=0017286378&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -18,7 +24,7 @@ func TestDepositHandler(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the deposit handler function
-	deposit(rr, req)
+	newTestServer(t).deposit(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -28,7 +34,7 @@ func TestDepositHandler(t *testing.T) {
 
 func TestDepositHandlerMissingAccountNumber(t *testing.T) {
 	// Create a mock HTTP request without the account number query parameter
-	req, err := http.NewRequest("GET", "/deposit?amount=10", nil)
+	req, err := http.NewRequest("POST", "/deposit?amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -37,7 +43,7 @@ func TestDepositHandlerMissingAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the deposit handler function
-	deposit(rr, req)
+	newTestServer(t).deposit(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -53,7 +59,7 @@ func TestDepositHandlerMissingAccountNumber(t *testing.T) {
 
 func TestDepositHandlerInvalidAccountNumber(t *testing.T) {
 	// Create a mock HTTP request with an invalid account number query parameter
-	req, err := http.NewRequest("GET", "/deposit?number=abc&amount=10", nil)
+	req, err := http.NewRequest("POST", "/deposit?number=abc&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,7 +68,7 @@ func TestDepositHandlerInvalidAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the deposit handler function
-	deposit(rr, req)
+	newTestServer(t).deposit(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -78,7 +84,7 @@ func TestDepositHandlerInvalidAccountNumber(t *testing.T) {
 
 func TestDepositHandlerInvalidAmount(t *testing.T) {
 	// Create a mock HTTP request with an invalid amount query parameter
-	req, err := http.NewRequest("GET", "/deposit?number=0017286376&amount=xyz", nil)
+	req, err := http.NewRequest("POST", "/deposit?number=0017286378&amount=xyz", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -87,7 +93,7 @@ func TestDepositHandlerInvalidAmount(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the deposit handler function
-	deposit(rr, req)
+	newTestServer(t).deposit(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -103,7 +109,7 @@ func TestDepositHandlerInvalidAmount(t *testing.T) {
 
 func TestDepositHandlerAccountNotFound(t *testing.T) {
 	// Create a mock HTTP request with a non-existent account number query parameter
-	req, err := http.NewRequest("GET", "/deposit?number=9999&amount=10", nil)
+	req, err := http.NewRequest("POST", "/deposit?number=0010000008&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -112,7 +118,7 @@ func TestDepositHandlerAccountNotFound(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the deposit handler function
-	deposit(rr, req)
+	newTestServer(t).deposit(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -128,7 +134,7 @@ func TestDepositHandlerAccountNotFound(t *testing.T) {
 
 func TestDepositHandlerNegativeAmount(t *testing.T) {
 	// Create a mock HTTP request with a negative amount query parameter
-	req, err := http.NewRequest("GET", "/deposit?number=0017286376&amount=-10", nil)
+	req, err := http.NewRequest("POST", "/deposit?number=0017286378&amount=-10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -137,7 +143,7 @@ func TestDepositHandlerNegativeAmount(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the deposit handler function
-	deposit(rr, req)
+	newTestServer(t).deposit(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -151,10 +157,70 @@ func TestDepositHandlerNegativeAmount(t *testing.T) {
 	}
 }
 
+func TestLegacyMutationsOnGetAreRefused(t *testing.T) {
+	s := newTestServer(t)
+	serveAPI(t, s, "POST", "/deposit?number=0017286378&amount=100", "")
+
+	for _, path := range []string{"/deposit?number=0017286378&amount=10", "/withdraw?number=0017286378&amount=10", "/transfer?from=0017286378&to=0018989350&amount=10"} {
+		rr := serveAPI(t, s, "GET", path, "")
+		if rr.Code != http.StatusMethodNotAllowed || rr.Header().Get("Allow") != "POST" {
+			t.Errorf("%s: expected status %v but got %v", path, http.StatusMethodNotAllowed, rr.Code)
+		}
+	}
+	if got := balance(t, s, "0017286378"); got != 10000 {
+		t.Errorf("expected GET not to move money, got a balance of %d", got)
+	}
+}
+
+func TestDepositIsJournaled(t *testing.T) {
+	s := newTestServer(t)
+
+	req, err := http.NewRequest("POST", "/deposit?number=0017286378&amount=5", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.deposit(httptest.NewRecorder(), req)
+
+	account, err := s.getAccountByNumber("0017286378")
+	if err != nil {
+		t.Fatalf("failed to get account. %s", err)
+	}
+
+	entries, err := s.store.Transactions().Entries(account.Number)
+	if err != nil {
+		t.Fatalf("failed to get entries. %s", err)
+	}
+	if len(entries) == 0 {
+		t.Fatal("no ledger entries recorded for the account")
+	}
+
+	// The last entry should credit the deposit and carry the stored balance
+	last := entries[len(entries)-1]
+	if last.Direction != bank.Credit || last.Amount.Amount != 500 || last.Balance != account.Balance {
+		t.Errorf("unexpected last entry: %+v", last)
+	}
+}
+
+func TestLegacyStatementsShowIBAN(t *testing.T) {
+	s := newTestServer(t)
+	var err error
+	if s.iban, err = bank.NewIBANScheme("DE", "37040044", accountnumber.Length); err != nil {
+		t.Fatal(err)
+	}
+	iban, _ := s.iban.IBAN("0017286378")
+
+	for _, path := range []string{"/deposit?number=0017286378&amount=10", "/withdraw?number=0017286378&amount=5"} {
+		rr := serveAPI(t, s, "POST", path, "")
+		if !strings.Contains(rr.Body.String(), `"IBAN":"`+iban+`"`) {
+			t.Errorf("%s: expected the statement to show the IBAN: %s", path, rr.Body.String())
+		}
+	}
+}
+
 // TEST STATEMENTS
 func TestStatementHandler(t *testing.T) {
 	// Create a mock HTTP request
-	req, err := http.NewRequest("GET", "/statement?number=0017286376", nil)
+	req, err := http.NewRequest("GET", "/statement?number=0017286378", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -163,7 +229,7 @@ func TestStatementHandler(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the statement handler function
-	statement(rr, req)
+	newTestServer(t).statement(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -182,7 +248,7 @@ func TestStatementHandlerMissingAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the statement handler function
-	statement(rr, req)
+	newTestServer(t).statement(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -207,7 +273,7 @@ func TestStatementHandlerInvalidAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the statement handler function
-	statement(rr, req)
+	newTestServer(t).statement(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -223,7 +289,7 @@ func TestStatementHandlerInvalidAccountNumber(t *testing.T) {
 
 func TestStatementHandlerAccountNotFound(t *testing.T) {
 	// Create a mock HTTP request with a non-existent account number query parameter
-	req, err := http.NewRequest("GET", "/statement?number=9999", nil)
+	req, err := http.NewRequest("GET", "/statement?number=0010000008", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -232,7 +298,7 @@ func TestStatementHandlerAccountNotFound(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the statement handler function
-	statement(rr, req)
+	newTestServer(t).statement(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -246,10 +312,112 @@ func TestStatementHandlerAccountNotFound(t *testing.T) {
 	}
 }
 
+func TestStatementHandlerPeriod(t *testing.T) {
+	s := newTestServer(t)
+
+	dep, _ := http.NewRequest("POST", "/deposit?number=0017286378&amount=2", nil)
+	s.deposit(httptest.NewRecorder(), dep)
+
+	// A period ending today includes the deposit and closes at the current balance
+	req, err := http.NewRequest("GET", "/statement?number=0017286378&from=2000-01-01", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	s.statement(rr, req)
+
+	var st accountStatement
+	if err := json.Unmarshal(rr.Body.Bytes(), &st); err != nil {
+		t.Fatalf("response is not a statement: %v: %s", err, rr.Body.String())
+	}
+	if st.Period == nil {
+		t.Fatal("expected the statement to cover a period")
+	}
+	if len(st.Period.Lines) == 0 {
+		t.Error("expected the period to include the deposit")
+	}
+	if st.Period.ClosingBalance.Amount != st.Balance.Amount {
+		t.Errorf("closing balance %s doesn't match the current balance %s", st.Period.ClosingBalance, st.Balance)
+	}
+
+	// A period before any transaction is empty
+	req, _ = http.NewRequest("GET", "/statement?number=0017286378&from=2000-01-01&to=2000-01-31", nil)
+	rr = httptest.NewRecorder()
+	s.statement(rr, req)
+
+	st = accountStatement{}
+	if err := json.Unmarshal(rr.Body.Bytes(), &st); err != nil {
+		t.Fatalf("response is not a statement: %v: %s", err, rr.Body.String())
+	}
+	if st.Period == nil || len(st.Period.Lines) != 0 || !st.Period.OpeningBalance.IsZero() || !st.Period.ClosingBalance.IsZero() {
+		t.Errorf("unexpected empty period: %+v", st.Period)
+	}
+}
+
+func TestStatementHandlerInvalidPeriod(t *testing.T) {
+	s := newTestServer(t)
+	tests := map[string]string{
+		"from=yesterday":                "Invalid from date!",
+		"to=2024-02-30":                 "Invalid to date!",
+		"from=2024-02-01&to=2024-01-01": "Invalid period!",
+	}
+
+	for query, expectedBody := range tests {
+		req, err := http.NewRequest("GET", "/statement?number=0017286378&"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		s.statement(rr, req)
+
+		if rr.Body.String() != expectedBody {
+			t.Errorf("%s: expected body %q but got %q", query, expectedBody, rr.Body.String())
+		}
+	}
+}
+
+func TestStatementHandlerFormats(t *testing.T) {
+	s := newTestServer(t)
+
+	tests := map[string]string{
+		"format=csv": "text/csv",
+		"format=ofx": "application/x-ofx",
+		"format=pdf": "application/pdf",
+		"":           "application/json",
+	}
+
+	for query, contentType := range tests {
+		req, err := http.NewRequest("GET", "/statement?number=0017286378&"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := httptest.NewRecorder()
+		s.statement(rr, req)
+
+		if got := rr.Header().Get("Content-Type"); got != contentType {
+			t.Errorf("%q: expected content type %q but got %q: %s", query, contentType, got, rr.Body.String())
+		}
+	}
+}
+
+func TestStatementHandlerUnsupportedFormat(t *testing.T) {
+	req, err := http.NewRequest("GET", "/statement?number=0017286378&format=xls", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rr := httptest.NewRecorder()
+	newTestServer(t).statement(rr, req)
+
+	expectedBody := "Unsupported statement format!"
+	if rr.Body.String() != expectedBody {
+		t.Errorf("expected body %q but got %q", expectedBody, rr.Body.String())
+	}
+}
+
 // TEST WITHDRAWALS
 func TestWithdrawHandler(t *testing.T) {
 	// Create a mock HTTP request
-	req, err := http.NewRequest("GET", "/withdraw?number=1001&amount=10", nil)
+	req, err := http.NewRequest("POST", "/withdraw?number=1001&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -258,7 +426,7 @@ func TestWithdrawHandler(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the withdraw handler function
-	withdraw(rr, req)
+	newTestServer(t).withdraw(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -268,7 +436,7 @@ func TestWithdrawHandler(t *testing.T) {
 
 func TestWithdrawHandlerMissingAccountNumber(t *testing.T) {
 	// Create a mock HTTP request without the account number query parameter
-	req, err := http.NewRequest("GET", "/withdraw?amount=10", nil)
+	req, err := http.NewRequest("POST", "/withdraw?amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -277,7 +445,7 @@ func TestWithdrawHandlerMissingAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the withdraw handler function
-	withdraw(rr, req)
+	newTestServer(t).withdraw(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -293,7 +461,7 @@ func TestWithdrawHandlerMissingAccountNumber(t *testing.T) {
 
 func TestWithdrawHandlerInvalidAccountNumber(t *testing.T) {
 	// Create a mock HTTP request with an invalid account number query parameter
-	req, err := http.NewRequest("GET", "/withdraw?number=abc&amount=10", nil)
+	req, err := http.NewRequest("POST", "/withdraw?number=abc&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -302,7 +470,7 @@ func TestWithdrawHandlerInvalidAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the withdraw handler function
-	withdraw(rr, req)
+	newTestServer(t).withdraw(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -318,7 +486,7 @@ func TestWithdrawHandlerInvalidAccountNumber(t *testing.T) {
 
 func TestWithdrawHandlerInvalidAmount(t *testing.T) {
 	// Create a mock HTTP request with an invalid amount query parameter
-	req, err := http.NewRequest("GET", "/withdraw?number=0017286376&amount=xyz", nil)
+	req, err := http.NewRequest("POST", "/withdraw?number=0017286378&amount=xyz", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -327,7 +495,7 @@ func TestWithdrawHandlerInvalidAmount(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the withdraw handler function
-	withdraw(rr, req)
+	newTestServer(t).withdraw(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -343,7 +511,7 @@ func TestWithdrawHandlerInvalidAmount(t *testing.T) {
 
 func TestWithdrawHandlerAccountNotFound(t *testing.T) {
 	// Create a mock HTTP request with a non-existent account number query parameter
-	req, err := http.NewRequest("GET", "/withdraw?number=9999&amount=10", nil)
+	req, err := http.NewRequest("POST", "/withdraw?number=0010000008&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -352,7 +520,7 @@ func TestWithdrawHandlerAccountNotFound(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the withdraw handler function
-	withdraw(rr, req)
+	newTestServer(t).withdraw(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -369,7 +537,7 @@ func TestWithdrawHandlerAccountNotFound(t *testing.T) {
 // TEST TRANSFERS
 func TestTransferHandler(t *testing.T) {
 	// Create a mock HTTP request
-	req, err := http.NewRequest("GET", "/transfer?from=0018989351&to=0017286376&amount=10", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0018989350&to=0017286378&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -378,7 +546,7 @@ func TestTransferHandler(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -388,7 +556,7 @@ func TestTransferHandler(t *testing.T) {
 
 func TestTransferHandlerMissingFromAccountNumber(t *testing.T) {
 	// Create a mock HTTP request without the from account number query parameter
-	req, err := http.NewRequest("GET", "/transfer?to=0017286376&amount=10", nil)
+	req, err := http.NewRequest("POST", "/transfer?to=0017286378&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -397,7 +565,7 @@ func TestTransferHandlerMissingFromAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -413,7 +581,7 @@ func TestTransferHandlerMissingFromAccountNumber(t *testing.T) {
 
 func TestTransferHandlerMissingToAccountNumber(t *testing.T) {
 	// Create a mock HTTP request without the to account number query parameter
-	req, err := http.NewRequest("GET", "/transfer?from=0018989351&amount=10", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0018989350&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -422,7 +590,7 @@ func TestTransferHandlerMissingToAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -438,7 +606,7 @@ func TestTransferHandlerMissingToAccountNumber(t *testing.T) {
 
 func TestTransferHandlerMissingAmount(t *testing.T) {
 	// Create a mock HTTP request without the amount query parameter
-	req, err := http.NewRequest("GET", "/transfer?from=0018989351&to=0017286376", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0018989350&to=0017286378", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -447,7 +615,7 @@ func TestTransferHandlerMissingAmount(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -463,7 +631,7 @@ func TestTransferHandlerMissingAmount(t *testing.T) {
 
 func TestTransferHandlerInvalidFromAccountNumber(t *testing.T) {
 	// Create a mock HTTP request with an invalid from account number query parameter
-	req, err := http.NewRequest("GET", "/transfer?from=abc&to=0017286376&amount=10", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=abc&to=0017286378&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -472,7 +640,7 @@ func TestTransferHandlerInvalidFromAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -488,7 +656,7 @@ func TestTransferHandlerInvalidFromAccountNumber(t *testing.T) {
 
 func TestTransferHandlerInvalidToAccountNumber(t *testing.T) {
 	// Create a mock HTTP request with an invalid to account number query parameter
-	req, err := http.NewRequest("GET", "/transfer?from=0018989351&to=abc&amount=10", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0018989350&to=abc&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -497,7 +665,7 @@ func TestTransferHandlerInvalidToAccountNumber(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -513,7 +681,7 @@ func TestTransferHandlerInvalidToAccountNumber(t *testing.T) {
 
 func TestTransferHandlerInvalidAmount(t *testing.T) {
 	// Create a mock HTTP request with an invalid amount query parameter
-	req, err := http.NewRequest("GET", "/transfer?from=0018989351&to=0017286376&amount=xyz", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0018989350&to=0017286378&amount=xyz", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -522,7 +690,7 @@ func TestTransferHandlerInvalidAmount(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -538,7 +706,7 @@ func TestTransferHandlerInvalidAmount(t *testing.T) {
 
 func TestTransferHandlerFromAccountNotFound(t *testing.T) {
 	// Create a mock HTTP request with a non-existent from account number query parameter
-	req, err := http.NewRequest("GET", "/transfer?from=9999&to=0017286376&amount=10", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0010000008&to=0017286378&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -547,7 +715,7 @@ func TestTransferHandlerFromAccountNotFound(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -563,7 +731,7 @@ func TestTransferHandlerFromAccountNotFound(t *testing.T) {
 
 func TestTransferHandlerToAccountNotFound(t *testing.T) {
 	// Create a mock HTTP request with a non-existent to account number query parameter
-	req, err := http.NewRequest("GET", "/transfer?from=0018989351&to=9999&amount=10", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0018989350&to=0010000008&amount=10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -572,7 +740,7 @@ func TestTransferHandlerToAccountNotFound(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -588,7 +756,7 @@ func TestTransferHandlerToAccountNotFound(t *testing.T) {
 
 func TestTransferHandlerNegativeAmount(t *testing.T) {
 	// Create a mock HTTP request with a negative amount query parameter
-	req, err := http.NewRequest("GET", "/transfer?from=0018989351&to=0017286376&amount=-10", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0018989350&to=0017286378&amount=-10", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -597,7 +765,7 @@ func TestTransferHandlerNegativeAmount(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -613,7 +781,7 @@ func TestTransferHandlerNegativeAmount(t *testing.T) {
 
 func TestTransferHandlerInsufficientBalance(t *testing.T) {
 	// Create a mock HTTP request with an amount greater than the from account balance
-	req, err := http.NewRequest("GET", "/transfer?from=0018989351&to=0017286376&amount=1000000", nil)
+	req, err := http.NewRequest("POST", "/transfer?from=0018989350&to=0017286378&amount=1000000", nil)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -622,7 +790,7 @@ func TestTransferHandlerInsufficientBalance(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	// Call the transfer handler function
-	transfer(rr, req)
+	newTestServer(t).transfer(rr, req)
 
 	// Check the response status code
 	if rr.Code != http.StatusOK {
@@ -635,3 +803,47 @@ func TestTransferHandlerInsufficientBalance(t *testing.T) {
 		t.Errorf("expected body %q but got %q", expectedBody, rr.Body.String())
 	}
 }
+
+// TEST CONCURRENCY
+func TestConcurrentTransfersConserveMoney(t *testing.T) {
+	s := newTestServer(t)
+
+	numbers := []string{"0017286378", "0018989350"}
+	for _, number := range numbers {
+		req, _ := http.NewRequest("POST", "/deposit?number="+number+"&amount=100", nil)
+		s.deposit(httptest.NewRecorder(), req)
+	}
+
+	// Fire transfers in both directions, each moving more than half the balance
+	// a transfer would see if it read a stale balance
+	var wg sync.WaitGroup
+	for i := 0; i < 200; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			from, to := numbers[i%2], numbers[(i+1)%2]
+			req, _ := http.NewRequest("POST", "/transfer?from="+from+"&to="+to+"&amount=60", nil)
+			s.transfer(httptest.NewRecorder(), req)
+		}(i)
+	}
+	wg.Wait()
+
+	total := bank.NewMoney(0, bank.DefaultCurrency)
+	for _, number := range numbers {
+		account, err := s.getAccountByNumber(number)
+		if err != nil {
+			t.Fatalf("failed to get account. %s", err)
+		}
+		if account.Balance.IsNegative() {
+			t.Errorf("account %s was overdrawn: %s", number, account.Balance)
+		}
+		if err := bank.NewLedger(s.store.Transactions()).Verify(account); err != nil {
+			t.Error(err)
+		}
+		total, _ = total.Add(account.Balance)
+	}
+
+	if total.String() != "200.00" {
+		t.Errorf("expected total money of 200.00 to be conserved, got %s", total)
+	}
+}
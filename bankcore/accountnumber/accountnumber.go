@@ -0,0 +1,217 @@
+// Package accountnumber allocates and validates account numbers.
+//
+// An account number has 10 digits: a 3-digit branch prefix, a 6-digit serial and a check digit.
+// The check digit is the Luhn (mod 10) digit of the first nine, which catches any single mistyped digit
+// and most swaps of neighbouring digits before a number reaches the database.
+package accountnumber
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Lengths of an account number and of its parts.
+const (
+	Length       = 10
+	PrefixLength = 3
+	SerialLength = Length - PrefixLength - 1
+)
+
+// DefaultPrefix is the branch prefix of an allocator configured without one.
+const DefaultPrefix = "001"
+
+// maxSerial is the highest serial a branch can allocate.
+const maxSerial = 999999
+
+// Errors of validation and allocation, matched with errors.Is.
+var (
+	ErrInvalid   = errors.New("invalid account number")
+	ErrExhausted = errors.New("no account numbers left to allocate")
+)
+
+// isDigits reports whether s is made of ASCII digits only.
+func isDigits(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckDigit returns the Luhn check digit of the digits in payload.
+func CheckDigit(payload string) (byte, error) {
+	if payload == "" || !isDigits(payload) {
+		return 0, fmt.Errorf("%w: %q should be made of digits", ErrInvalid, payload)
+	}
+
+	sum := 0
+	for i := 0; i < len(payload); i++ {
+		d := int(payload[len(payload)-1-i] - '0')
+		if i%2 == 0 {
+			if d *= 2; d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return byte('0' + (10-sum%10)%10), nil
+}
+
+// Validate returns an error wrapping ErrInvalid unless number has 10 digits and a matching check digit.
+func Validate(number string) error {
+	if len(number) != Length || !isDigits(number) {
+		return fmt.Errorf("%w: %q should be %d digits", ErrInvalid, number, Length)
+	}
+
+	check, _ := CheckDigit(number[:Length-1])
+	if number[Length-1] != check {
+		return fmt.Errorf("%w: %q has a wrong check digit", ErrInvalid, number)
+	}
+	return nil
+}
+
+// Valid reports whether number passes Validate.
+func Valid(number string) bool {
+	return Validate(number) == nil
+}
+
+// New returns the account number with the branch prefix and serial, and its check digit.
+func New(prefix string, serial int) (string, error) {
+	if len(prefix) != PrefixLength || !isDigits(prefix) {
+		return "", fmt.Errorf("%w: branch prefix %q should be %d digits", ErrInvalid, prefix, PrefixLength)
+	}
+	if serial < 0 || serial > maxSerial {
+		return "", fmt.Errorf("%w: serial %d is out of range", ErrInvalid, serial)
+	}
+
+	payload := fmt.Sprintf("%s%0*d", prefix, SerialLength, serial)
+	check, _ := CheckDigit(payload)
+	return payload + string(check), nil
+}
+
+// Strategy is how an allocator picks serials.
+type Strategy string
+
+// Allocation strategies.
+const (
+	Random     Strategy = "random"     // A random serial, so numbers don't tell how many accounts a branch has.
+	Sequential Strategy = "sequential" // The serial after the highest one allocated in the branch.
+)
+
+// ParseStrategy returns the strategy named s, Random if s is empty.
+func ParseStrategy(s string) (Strategy, error) {
+	switch st := Strategy(s); st {
+	case "":
+		return Random, nil
+	case Random, Sequential:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown account number strategy %q, should be %s or %s", s, Random, Sequential)
+}
+
+// Registry tells an allocator which numbers are already in use.
+type Registry interface {
+	// Exists reports whether an account has the number.
+	Exists(number string) (bool, error)
+	// Last returns the highest number in use with the branch prefix, or "" if there is none.
+	Last(prefix string) (string, error)
+}
+
+// Allocator hands out the account numbers of a branch.
+// It is safe for concurrent use, but two allocators can still pick the same number
+// before either is stored: callers should retry when storing a number fails as a duplicate.
+type Allocator struct {
+	prefix   string
+	strategy Strategy
+	attempts int // Numbers tried before giving up.
+
+	mu   sync.Mutex
+	rand *rand.Rand
+}
+
+// NewAllocator returns an allocator of numbers with the branch prefix, DefaultPrefix if it is empty.
+func NewAllocator(prefix string, strategy Strategy) (*Allocator, error) {
+	if prefix == "" {
+		prefix = DefaultPrefix
+	}
+	if _, err := New(prefix, 0); err != nil {
+		return nil, err
+	}
+	if _, err := ParseStrategy(string(strategy)); err != nil {
+		return nil, err
+	}
+
+	return &Allocator{
+		prefix:   prefix,
+		strategy: strategy,
+		attempts: 20,
+		rand:     rand.New(rand.NewSource(time.Now().UnixNano())),
+	}, nil
+}
+
+// Prefix returns the branch prefix of the numbers the allocator hands out.
+func (a *Allocator) Prefix() string {
+	return a.prefix
+}
+
+// Allocate returns a number that isn't in use in the registry.
+// It gives up with ErrExhausted when the branch has no serials left,
+// or when too many random serials in a row turned out to be taken.
+func (a *Allocator) Allocate(r Registry) (string, error) {
+	if a.strategy == Sequential {
+		return a.sequential(r)
+	}
+
+	for i := 0; i < a.attempts; i++ {
+		a.mu.Lock()
+		serial := a.rand.Intn(maxSerial + 1)
+		a.mu.Unlock()
+
+		number, _ := New(a.prefix, serial)
+		taken, err := r.Exists(number)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return number, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %d random numbers in a row were taken in branch %s", ErrExhausted, a.attempts, a.prefix)
+}
+
+// sequential returns the first free number after the highest one in use.
+func (a *Allocator) sequential(r Registry) (string, error) {
+	last, err := r.Last(a.prefix)
+	if err != nil {
+		return "", err
+	}
+
+	serial := 0
+	if last != "" {
+		if len(last) != Length {
+			return "", fmt.Errorf("%w: %q", ErrInvalid, last)
+		}
+		n, err := strconv.Atoi(last[PrefixLength : PrefixLength+SerialLength])
+		if err != nil {
+			return "", fmt.Errorf("%w: %q", ErrInvalid, last)
+		}
+		serial = n + 1
+	}
+
+	for ; serial <= maxSerial; serial++ {
+		number, _ := New(a.prefix, serial)
+		taken, err := r.Exists(number)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return number, nil
+		}
+	}
+	return "", fmt.Errorf("%w: branch %s has used every serial", ErrExhausted, a.prefix)
+}
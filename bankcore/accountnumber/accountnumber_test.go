@@ -0,0 +1,120 @@
+package accountnumber
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	for _, number := range []string{"0017286378", "0018989350", "0000000000"} {
+		if err := Validate(number); err != nil {
+			t.Errorf("%s: %v", number, err)
+		}
+	}
+
+	for _, number := range []string{"", "1e5", "-3", "00172863781", "001728637", "0017286376", "0017286387", "00172x6378", "+017286378"} {
+		if err := Validate(number); !errors.Is(err, ErrInvalid) {
+			t.Errorf("%q: expected an invalid number, got %v", number, err)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	number, err := New("001", 728637)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != "0017286378" {
+		t.Errorf("expected 0017286378, got %s", number)
+	}
+
+	// Every single mistyped digit is caught
+	for i := 0; i < Length; i++ {
+		for d := byte('0'); d <= '9'; d++ {
+			if d == number[i] {
+				continue
+			}
+			typo := number[:i] + string(d) + number[i+1:]
+			if Valid(typo) {
+				t.Errorf("typo %s of %s is valid", typo, number)
+			}
+		}
+	}
+
+	if _, err := New("01", 1); err == nil {
+		t.Error("expected a 2-digit prefix to be rejected")
+	}
+	if _, err := New("001", 1000000); err == nil {
+		t.Error("expected a 7-digit serial to be rejected")
+	}
+}
+
+// registry is a Registry of the numbers in the map.
+type registry map[string]bool
+
+func (r registry) Exists(number string) (bool, error) { return r[number], nil }
+
+func (r registry) Last(prefix string) (string, error) {
+	last := ""
+	for number := range r {
+		if number[:PrefixLength] == prefix && number > last {
+			last = number
+		}
+	}
+	return last, nil
+}
+
+func TestAllocatorSequential(t *testing.T) {
+	a, err := NewAllocator("042", Sequential)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := registry{}
+	for i := 0; i < 3; i++ {
+		number, err := a.Allocate(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r[number] = true
+	}
+	if last, _ := r.Last("042"); last != "0420000028" {
+		t.Errorf("expected serials 0 to 2, got %v", r)
+	}
+
+	full := registry{}
+	last, _ := New("042", maxSerial)
+	full[last] = true
+	if _, err := a.Allocate(full); !errors.Is(err, ErrExhausted) {
+		t.Errorf("expected the branch to be exhausted, got %v", err)
+	}
+}
+
+func TestAllocatorRandom(t *testing.T) {
+	a, err := NewAllocator("", Random)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Prefix() != DefaultPrefix {
+		t.Errorf("expected the default prefix, got %s", a.Prefix())
+	}
+
+	r := registry{}
+	for i := 0; i < 100; i++ {
+		number, err := a.Allocate(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r[number] || !Valid(number) || number[:PrefixLength] != DefaultPrefix {
+			t.Fatalf("unexpected number %s", number)
+		}
+		r[number] = true
+	}
+
+	if _, err := NewAllocator("1", Random); err == nil {
+		t.Error("expected a short prefix to be rejected")
+	}
+	if _, err := ParseStrategy("luhn"); err == nil {
+		t.Error("expected an unknown strategy to be rejected")
+	}
+}
@@ -0,0 +1,69 @@
+package bank
+
+import "fmt"
+
+// AdjustmentAccount is the internal account that balances the manual adjustments of customer accounts' balances.
+// Adjusting an account up debits it, and adjusting an account down credits it.
+const AdjustmentAccount = "ADJUSTMENTS"
+
+// Adjust corrects the account's balance by the amount, which is added to the balance if positive
+// and taken from it if negative. Any account but a blacklisted or closed one can be adjusted,
+// but only down as far as its available balance and overdraft go.
+func (a *Account) Adjust(amount Money) error {
+	if amount.IsZero() {
+		return &accountError{"the amount of the adjustment should not be zero", ErrNonPositiveAmount}
+	}
+
+	if err := a.checkCurrency(amount); err != nil {
+		return err
+	}
+	if !a.Status.CanReceive() {
+		return &accountError{fmt.Sprintf("account %s is %s and cannot be adjusted", a.Number, a.Status), ErrAccountRestricted}
+	}
+
+	balance, err := a.Balance.Add(amount)
+	if err != nil {
+		return err
+	}
+	if !amount.IsPositive() {
+		if err := a.checkFunds(balance, "the adjustment should be less than the account's available balance"); err != nil {
+			return err
+		}
+	}
+
+	a.Balance = balance
+	return nil
+}
+
+// Adjust corrects the account's balance by the amount, see Account.Adjust, with AdjustmentAccount on the other side,
+// and records the transaction. The transaction's amount is the size of the adjustment; its entries say which way it went.
+func (l *Ledger) Adjust(a *Account, amount Money) (*Transaction, error) {
+	if amount.Currency == "" {
+		amount.Currency = a.Currency()
+	}
+
+	before := a.Balance
+	if err := a.Adjust(amount); err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{Type: AdjustmentTransaction}
+	if amount.IsPositive() {
+		t.Amount = amount
+		t.Entries = []Entry{
+			{Account: AdjustmentAccount, Direction: Debit, Amount: amount},
+			{Account: a.Number, Direction: Credit, Amount: amount, Balance: a.Balance},
+		}
+	} else {
+		t.Amount = amount.Neg()
+		t.Entries = []Entry{
+			{Account: a.Number, Direction: Debit, Amount: t.Amount, Balance: a.Balance},
+			{Account: AdjustmentAccount, Direction: Credit, Amount: t.Amount},
+		}
+	}
+	if err := l.post(t); err != nil {
+		a.Balance = before
+		return nil, err
+	}
+	return t, nil
+}
@@ -0,0 +1,61 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLedgerAdjust(t *testing.T) {
+	journal := &memJournal{}
+	ledger := NewLedger(journal)
+	a := &Account{Number: "0011111111", Balance: NewMoney(0, "NGN")}
+
+	up, err := ledger.Adjust(a, NewMoney(12500, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance.Amount != 12500 || up.Type != AdjustmentTransaction || up.Amount.Amount != 12500 || !up.Balanced() ||
+		up.Entries[0].Account != AdjustmentAccount || up.Entries[1].Direction != Credit || up.Entries[1].Balance.Amount != 12500 {
+		t.Errorf("expected the account to be credited 125.00, got %+v on a balance of %s", up, a.Balance)
+	}
+
+	down, err := ledger.Adjust(a, NewMoney(-12000, "NGN"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance.Amount != 500 || down.Amount.Amount != 12000 || !down.Balanced() || down.Entries[0].Account != a.Number || down.Entries[0].Direction != Debit {
+		t.Errorf("expected the account to be debited 120.00, got %+v on a balance of %s", down, a.Balance)
+	}
+	if err := ledger.Verify(a); err != nil {
+		t.Error(err)
+	}
+	if !IsInternal(AdjustmentAccount) {
+		t.Error("expected the adjustment account to be internal")
+	}
+
+	// Frozen accounts can be corrected, but not blacklisted or closed ones, and not below their available balance
+	a.Status = StatusInactive
+	if _, err := ledger.Adjust(a, NewMoney(100, "")); err != nil {
+		t.Errorf("expected a frozen account to be adjusted, got %v", err)
+	}
+	tests := []struct {
+		status AccountStatus
+		amount Money
+		err    error
+	}{
+		{StatusActive, NewMoney(0, ""), ErrNonPositiveAmount},
+		{StatusActive, NewMoney(-601, ""), ErrInsufficientFunds},
+		{StatusActive, NewMoney(100, "USD"), ErrCurrencyMismatch},
+		{StatusBlacklisted, NewMoney(100, ""), ErrAccountRestricted},
+		{StatusClosed, NewMoney(-100, ""), ErrAccountRestricted},
+	}
+	for _, tt := range tests {
+		a.Status = tt.status
+		if _, err := ledger.Adjust(a, tt.amount); !errors.Is(err, tt.err) {
+			t.Errorf("%s %s: expected %v, got %v", tt.status, tt.amount, tt.err, err)
+		}
+	}
+	if a.Balance.Amount != 600 || len(journal.transactions) != 3 {
+		t.Errorf("expected the refused adjustments to change nothing, got %s and %d transactions", a.Balance, len(journal.transactions))
+	}
+}
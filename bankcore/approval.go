@@ -0,0 +1,110 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Errors of approvals, matched with errors.Is.
+var (
+	ErrInvalidApprovalLimit = errors.New("invalid approval limit")
+	ErrNotPending           = errors.New("operation is not awaiting approval")
+	ErrSameApprover         = errors.New("operation must be decided by someone other than who requested it")
+)
+
+// ApprovalLimits are the largest amounts, by currency, that are deposited, withdrawn, transferred or swept on closure
+// without a second person approving them. Amounts in a currency without a limit always need approval,
+// unless there are no limits at all.
+type ApprovalLimits map[string]Money
+
+// ParseApprovalLimits parses comma separated limits of a currency and an amount, such as "NGN 1000000, USD 5000".
+func ParseApprovalLimits(s string) (ApprovalLimits, error) {
+	limits := ApprovalLimits{}
+	for _, limit := range strings.Split(s, ",") {
+		fields := strings.Fields(limit)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%w: %q should be a currency and an amount", ErrInvalidApprovalLimit, strings.TrimSpace(limit))
+		}
+		currency, err := ParseCurrency(fields[0])
+		if err != nil {
+			return nil, err
+		}
+		amount, err := ParseMoney(fields[1], currency)
+		if err != nil || amount.IsNegative() {
+			return nil, fmt.Errorf("%w: %q is not an amount", ErrInvalidApprovalLimit, fields[1])
+		}
+		limits[currency] = amount
+	}
+	return limits, nil
+}
+
+// NeedsApproval reports whether the amount is over the limit of its currency,
+// or has no limit while other currencies do.
+func (l ApprovalLimits) NeedsApproval(amount Money) bool {
+	limit, ok := l[amount.Currency]
+	if !ok {
+		return len(l) > 0
+	}
+	return amount.Amount > limit.Amount
+}
+
+// OperationStatus says where a pending operation is in its approval.
+type OperationStatus string
+
+// Statuses of pending operations.
+const (
+	OperationPending  OperationStatus = "pending"  // Awaiting a decision; no money has moved.
+	OperationApproved OperationStatus = "approved" // Approved and posted.
+	OperationRejected OperationStatus = "rejected" // Rejected; no money moves.
+)
+
+// ParseOperationStatus returns the operation status named s.
+func ParseOperationStatus(s string) (OperationStatus, error) {
+	switch st := OperationStatus(s); st {
+	case OperationPending, OperationApproved, OperationRejected:
+		return st, nil
+	}
+	return "", fmt.Errorf("unknown operation status %q", s)
+}
+
+// ClosureOperation is the type of a pending operation that closes an account and sweeps its balance to another one.
+// No transaction has the type: the sweep is posted as a transfer.
+const ClosureOperation TransactionType = "closure"
+
+// PendingOperation is a deposit, withdrawal, transfer or closure sweep over the approval limit, or a balance adjustment,
+// which waits for a second person to approve it before it is posted, and the trail of who requested and decided it.
+type PendingOperation struct {
+	ID          int64
+	Type        TransactionType // DepositTransaction, WithdrawalTransaction, TransferTransaction, AdjustmentTransaction or ClosureOperation.
+	Account     string          // Number of the account deposited into, withdrawn from, transferred from, adjusted or closed.
+	To          string          // Number of the account transferred to, or the closed account's balance is swept to.
+	Amount      Money           // Negative for an adjustment down.
+	Note        string          // Why it was requested, such as why an account is closed.
+	Status      OperationStatus
+	RequestedBy string // Who requested the operation.
+	RequestedAt time.Time
+	DecidedBy   string // Who approved or rejected it.
+	DecidedAt   time.Time
+	Reason      string // Why it was approved or rejected.
+	Transaction int64  // ID of the transaction posted when it was approved.
+}
+
+// Decide records the decision of the approver, at the given time. Only pending operations are decided,
+// by someone other than who requested them; approving one doesn't post it.
+func (o *PendingOperation) Decide(approver string, approve bool, reason string, at time.Time) error {
+	if o.Status != OperationPending {
+		return fmt.Errorf("%w: operation %d is %s", ErrNotPending, o.ID, o.Status)
+	}
+	if approver == "" || approver == o.RequestedBy {
+		return fmt.Errorf("%w: operation %d", ErrSameApprover, o.ID)
+	}
+
+	o.Status = OperationRejected
+	if approve {
+		o.Status = OperationApproved
+	}
+	o.DecidedBy, o.DecidedAt, o.Reason = approver, at, reason
+	return nil
+}
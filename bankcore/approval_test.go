@@ -0,0 +1,69 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestApprovalLimits(t *testing.T) {
+	limits, err := ParseApprovalLimits("NGN 1000000, usd 5000.50")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		amount Money
+		needs  bool
+	}{
+		{NewMoney(100000000, "NGN"), false},
+		{NewMoney(100000001, "NGN"), true},
+		{NewMoney(500050, "USD"), false},
+		{NewMoney(500051, "USD"), true},
+		{NewMoney(1, "EUR"), true},
+	}
+	for _, tt := range tests {
+		if got := limits.NeedsApproval(tt.amount); got != tt.needs {
+			t.Errorf("%s: expected %v, got %v", tt.amount, tt.needs, got)
+		}
+	}
+
+	if (ApprovalLimits{}).NeedsApproval(NewMoney(999999999, "EUR")) {
+		t.Error("expected no approval without limits")
+	}
+
+	for _, s := range []string{"", "NGN", "NGN 10, USD", "NGN -5", "NGN ten"} {
+		if _, err := ParseApprovalLimits(s); !errors.Is(err, ErrInvalidApprovalLimit) {
+			t.Errorf("%q: expected an invalid limit, got %v", s, err)
+		}
+	}
+	if _, err := ParseApprovalLimits("GBP 10"); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("expected an unsupported currency, got %v", err)
+	}
+}
+
+func TestDecidePendingOperation(t *testing.T) {
+	now := time.Now()
+	o := &PendingOperation{ID: 1, Type: TransferTransaction, Status: OperationPending, RequestedBy: "key:teller"}
+
+	if err := o.Decide("key:teller", true, "", now); !errors.Is(err, ErrSameApprover) {
+		t.Errorf("expected the requester not to decide, got %v", err)
+	}
+	if err := o.Decide("", true, "", now); !errors.Is(err, ErrSameApprover) {
+		t.Errorf("expected an anonymous approver to be refused, got %v", err)
+	}
+	if err := o.Decide("key:approver", false, "Unusual amount", now); err != nil {
+		t.Fatal(err)
+	}
+	if o.Status != OperationRejected || o.DecidedBy != "key:approver" || o.Reason != "Unusual amount" || !o.DecidedAt.Equal(now) {
+		t.Errorf("unexpected decision %+v", o)
+	}
+	if err := o.Decide("key:other", true, "", now); !errors.Is(err, ErrNotPending) {
+		t.Errorf("expected a decided operation to stay decided, got %v", err)
+	}
+
+	o = &PendingOperation{ID: 2, Status: OperationPending, RequestedBy: "customer:1"}
+	if err := o.Decide("key:approver", true, "", now); err != nil || o.Status != OperationApproved {
+		t.Errorf("expected the operation to be approved, got %s %v", o.Status, err)
+	}
+}
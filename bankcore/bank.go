@@ -2,8 +2,25 @@ package bank
 
 import (
 	"errors"
+	"fmt"
 )
 
+// Errors of account operations, matched with errors.Is.
+var (
+	ErrNonPositiveAmount = errors.New("amount should be greater than zero")
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	ErrSameAccount       = errors.New("cannot transfer to the same account")
+)
+
+// accountError keeps the message of an operation's error while matching one of the errors above.
+type accountError struct {
+	msg  string
+	kind error
+}
+
+func (e *accountError) Error() string { return e.msg }
+func (e *accountError) Unwrap() error { return e.kind }
+
 // Create an interface with a Statement() string function.
 type Bank interface {
 	Statement() string
@@ -11,6 +28,7 @@ type Bank interface {
 
 // Customer struct ...
 type Customer struct {
+	ID      int64 // Set once the customer is stored.
 	Name    string
 	Email   string
 	Phone   string
@@ -19,11 +37,59 @@ type Customer struct {
 	DoB     string
 }
 
+// AccountType is the kind of product an account is.
+type AccountType string
+
+// Account types. An account without a type is a current account.
+const (
+	CurrentAccount AccountType = "current"
+	SavingsAccount AccountType = "savings"
+)
+
+// AccountTypes lists every account type.
+var AccountTypes = []AccountType{CurrentAccount, SavingsAccount}
+
+// ErrInvalidAccountType is returned for an account type other than current or savings.
+var ErrInvalidAccountType = errors.New("account type should be current or savings")
+
+// ParseAccountType returns the account type named s, CurrentAccount if s is empty.
+func ParseAccountType(s string) (AccountType, error) {
+	switch t := AccountType(s); t {
+	case "":
+		return CurrentAccount, nil
+	case CurrentAccount, SavingsAccount:
+		return t, nil
+	}
+	return "", ErrInvalidAccountType
+}
+
 // Account ...
 type Account struct {
 	Customer
-	Number  string
-	Balance float64
+	Number    string
+	Type      AccountType
+	Status    AccountStatus
+	Balance   Money
+	Held      Money // Total of the pending holds, which can't be withdrawn or transferred.
+	Overdraft Money // Arranged overdraft limit: the balance can go down to minus this amount.
+}
+
+// Currency returns the currency the account is kept in.
+// An account whose balance has no currency is in DefaultCurrency.
+func (a *Account) Currency() string {
+	if a.Balance.Currency == "" {
+		return DefaultCurrency
+	}
+	return a.Balance.Currency
+}
+
+// checkCurrency returns an error unless the amount is in the account's currency.
+// An amount without a currency is taken to be in the account's.
+func (a *Account) checkCurrency(amount Money) error {
+	if amount.Currency != "" && amount.Currency != a.Currency() {
+		return &accountError{fmt.Sprintf("the amount is in %s but account %s is in %s", amount.Currency, a.Number, a.Currency()), ErrCurrencyMismatch}
+	}
+	return nil
 }
 
 // Welcome placeholder function
@@ -32,41 +98,101 @@ func Welcome() string {
 }
 
 // Deposit ...
-func (a *Account) Deposit(amount float64) error {
-	if amount <= 0 {
-		return errors.New("the amount to deposit should be greater than zero")
+func (a *Account) Deposit(amount Money) error {
+	if !amount.IsPositive() {
+		return &accountError{"the amount to deposit should be greater than zero", ErrNonPositiveAmount}
 	}
 
-	a.Balance += amount
+	if err := a.checkCurrency(amount); err != nil {
+		return err
+	}
+	if err := a.canReceive(); err != nil {
+		return err
+	}
+
+	balance, err := a.Balance.Add(amount)
+	if err != nil {
+		return err
+	}
+
+	a.Balance = balance
 	return nil
 }
 
 // Withdraw ...
-func (a *Account) Withdraw(amount float64) error {
-	if amount <= 0 {
-		return errors.New("the amount to withdraw should be greater than zero")
+func (a *Account) Withdraw(amount Money) error {
+	if !amount.IsPositive() {
+		return &accountError{"the amount to withdraw should be greater than zero", ErrNonPositiveAmount}
+	}
+
+	if err := a.checkCurrency(amount); err != nil {
+		return err
+	}
+	if err := a.canSend(); err != nil {
+		return err
 	}
 
-	if a.Balance < amount {
-		return errors.New("the amount to withdraw should be less than the account's balance")
+	balance, err := a.Balance.Sub(amount)
+	if err != nil {
+		return err
 	}
 
-	a.Balance -= amount
+	if err := a.checkFunds(balance, "the amount to withdraw should be less than the account's balance"); err != nil {
+		return err
+	}
+
+	a.Balance = balance
 	return nil
 }
 
 // Transfer ...
-func (a *Account) Transfer(to *Account, amount float64) error {
-	if amount <= 0 {
-		return errors.New("the amount to transfer should be greater than zero")
+func (a *Account) Transfer(to *Account, amount Money) error {
+	return a.transfer(to, amount, amount, false)
+}
+
+// transfer debits the account and credits the other one, each in its own currency.
+// The amounts differ when the accounts are in different currencies.
+// A sweep, which settles the account on its closure, takes money out of it whatever its status.
+func (a *Account) transfer(to *Account, debit, credit Money, sweep bool) error {
+	if !debit.IsPositive() || !credit.IsPositive() {
+		return &accountError{"the amount to transfer should be greater than zero", ErrNonPositiveAmount}
+	}
+
+	if a == to || a.Number == to.Number {
+		return ErrSameAccount
+	}
+
+	if err := a.checkCurrency(debit); err != nil {
+		return err
+	}
+	if err := to.checkCurrency(credit); err != nil {
+		return err
+	}
+	if !sweep {
+		if err := a.canSend(); err != nil {
+			return err
+		}
+	}
+	if err := to.canReceive(); err != nil {
+		return err
+	}
+
+	fromBalance, err := a.Balance.Sub(debit)
+	if err != nil {
+		return err
+	}
+
+	if err := a.checkFunds(fromBalance, "insufficient balance to transfer"); err != nil {
+		return err
 	}
 
-	if a.Balance < amount {
-		return errors.New("insufficient balance to transfer")
+	toBalance, err := to.Balance.Add(credit)
+	if err != nil {
+		return err
 	}
 
-	a.Balance -= amount
-	to.Balance += amount
+	a.Balance = fromBalance
+	to.Balance = toBalance
 	return nil
 }
 
@@ -1,7 +1,7 @@
 package bank
 
 import (
-	"strconv"
+	"errors"
 	"testing"
 )
 
@@ -14,7 +14,7 @@ func TestAccount(t *testing.T) {
 			Phone:   "(234) 803 395 4301",
 		},
 		Number:  "1001",
-		Balance: 0,
+		Balance: NewMoney(0, DefaultCurrency),
 	}
 
 	if account.Name == "" {
@@ -31,15 +31,15 @@ func TestDeposit(t *testing.T) {
 			Phone:   "(213) 555 0147",
 		},
 		Number:  "1001",
-		Balance: 0,
+		Balance: NewMoney(0, DefaultCurrency),
 	}
 
-	err := account.Deposit(10)
+	err := account.Deposit(NewMoney(1000, DefaultCurrency))
 	if err != nil {
 		t.Error("balance is not being updated after a deposit")
 	}
 
-	if account.Balance != 10 {
+	if account.Balance != NewMoney(1000, DefaultCurrency) {
 		t.Error("balance is not reflecting the right amount after a deposit")
 	}
 }
@@ -52,10 +52,10 @@ func TestDepositInvalid(t *testing.T) {
 			Phone:   "(213) 555 0147",
 		},
 		Number:  "1001",
-		Balance: 0,
+		Balance: NewMoney(0, DefaultCurrency),
 	}
 
-	if err := account.Deposit(-10); err == nil { // Note the err == nil for negative test
+	if err := account.Deposit(NewMoney(-1000, DefaultCurrency)); err == nil { // Note the err == nil for negative test
 		t.Error("only positive numbers should be allowed to deposit")
 	}
 }
@@ -68,13 +68,13 @@ func TestWithdraw(t *testing.T) {
 			Phone:   "(213) 555 0147",
 		},
 		Number:  "1001",
-		Balance: 0,
+		Balance: NewMoney(0, DefaultCurrency),
 	}
 
-	account.Deposit(10)
-	account.Withdraw(10)
+	account.Deposit(NewMoney(1000, DefaultCurrency))
+	account.Withdraw(NewMoney(1000, DefaultCurrency))
 
-	if account.Balance != 0 {
+	if !account.Balance.IsZero() {
 		t.Error("balance is not being updated after withdraw")
 	}
 }
@@ -87,7 +87,7 @@ func TestStatement(t *testing.T) {
 			Phone:   "(213) 555 0147",
 		},
 		Number:  "0012345267",
-		Balance: 0,
+		Balance: NewMoney(0, DefaultCurrency),
 	}
 
 	// create a struct to hold a custom account
@@ -98,16 +98,85 @@ func TestStatement(t *testing.T) {
 
 	// create a function variable that implements the Statement() method
 	statementFunc := func(c *customAccount) string {
-		return c.Account.Number + " - " + c.Account.Customer.Name + " - " + strconv.FormatFloat(c.Account.Balance, 'f', -1, 64)
+		return c.Account.Number + " - " + c.Account.Customer.Name + " - " + c.Account.Balance.String()
 	}
 
 	// create a custom account
 	acc := &customAccount{&account}
 
-	acc.Deposit(100)
+	acc.Deposit(NewMoney(10000, DefaultCurrency))
 	statement := statementFunc(acc)
 
-	if statement != "0012345267 - John - 100" {
+	if statement != "0012345267 - John - 100.00" {
 		t.Errorf("statement doesn't have the proper format: %v", statement)
 	}
 }
+
+func TestWithdrawInsufficient(t *testing.T) {
+	account := Account{Number: "1001", Balance: NewMoney(500, DefaultCurrency)}
+
+	err := account.Withdraw(NewMoney(501, DefaultCurrency))
+	if !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("withdrawing more than the balance should fail with ErrInsufficientFunds, got %v", err)
+	}
+	if err != nil && err.Error() != "the amount to withdraw should be less than the account's balance" {
+		t.Errorf("unexpected message: %v", err)
+	}
+
+	if account.Balance != NewMoney(500, DefaultCurrency) {
+		t.Errorf("balance changed after a failed withdrawal: %v", account.Balance)
+	}
+}
+
+func TestTransfer(t *testing.T) {
+	from := Account{Number: "1001", Balance: NewMoney(1000, DefaultCurrency)}
+	to := Account{Number: "1002", Balance: NewMoney(0, DefaultCurrency)}
+
+	if err := from.Transfer(&to, NewMoney(250, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+
+	if from.Balance.Amount != 750 || to.Balance.Amount != 250 {
+		t.Errorf("unexpected balances after transfer: %v, %v", from.Balance, to.Balance)
+	}
+}
+
+func TestNonPositiveAmount(t *testing.T) {
+	from := Account{Number: "1001", Balance: NewMoney(1000, DefaultCurrency)}
+	to := Account{Number: "1002"}
+
+	for _, err := range []error{
+		from.Deposit(NewMoney(0, DefaultCurrency)),
+		from.Withdraw(NewMoney(-1, DefaultCurrency)),
+		from.Transfer(&to, NewMoney(0, DefaultCurrency)),
+	} {
+		if !errors.Is(err, ErrNonPositiveAmount) {
+			t.Errorf("expected ErrNonPositiveAmount, got %v", err)
+		}
+	}
+}
+
+func TestTransferSameAccount(t *testing.T) {
+	account := Account{Number: "1001", Balance: NewMoney(1000, DefaultCurrency)}
+
+	if err := account.Transfer(&account, NewMoney(100, DefaultCurrency)); !errors.Is(err, ErrSameAccount) {
+		t.Errorf("transferring to the same account should fail with ErrSameAccount, got %v", err)
+	}
+
+	if account.Balance.Amount != 1000 {
+		t.Errorf("balance changed after a self transfer: %v", account.Balance)
+	}
+}
+
+func TestParseAccountType(t *testing.T) {
+	tests := map[string]AccountType{"": CurrentAccount, "current": CurrentAccount, "savings": SavingsAccount}
+	for s, want := range tests {
+		if got, err := ParseAccountType(s); err != nil || got != want {
+			t.Errorf("%q: got %q, %v", s, got, err)
+		}
+	}
+
+	if _, err := ParseAccountType("checking"); err != ErrInvalidAccountType {
+		t.Errorf("expected ErrInvalidAccountType, got %v", err)
+	}
+}
@@ -0,0 +1,81 @@
+package bank
+
+import (
+	"fmt"
+	"time"
+)
+
+// ClosingStatement is the final statement of a closed account: what went through it over its life,
+// the balance it was closed with and where that balance went.
+type ClosingStatement struct {
+	Number            string
+	Reason            string
+	TotalCredits      Money
+	TotalDebits       Money  // Including the settlement, if any.
+	FinalBalance      Money  // Balance the account was closed with, before it was swept to the settlement account.
+	SettlementAccount string `json:",omitempty"` // Account the final balance was swept to.
+	SettlementID      int64  `json:",omitempty"` // Transaction of the sweep.
+	ClosedAt          time.Time
+
+	Settlement *Transaction `json:"-"` // Transaction of the sweep, only set on the statement Close returns.
+}
+
+// CanClose returns an error unless the account can be closed: it must have no pending holds and not be closed already.
+func (a *Account) CanClose() error {
+	if a.Held.IsPositive() {
+		return &accountError{fmt.Sprintf("account %s has %s on hold and cannot be closed", a.Number, a.Held), ErrPendingHolds}
+	}
+	if !a.Status.CanChangeTo(StatusClosed) {
+		return &accountError{fmt.Sprintf("account %s is already %s", a.Number, a.Status), ErrInvalidStatusChange}
+	}
+	return nil
+}
+
+// Close settles the account and closes it for good.
+// The account must have no pending holds, see CanClose. A positive balance is swept to the settlement account
+// with a transfer, free of fees and whatever the account's status; without a settlement account, the balance must already be zero.
+// It returns the closing statement and the status change to record.
+func (l *Ledger) Close(a *Account, settlement *Account, reason string) (*ClosingStatement, *StatusChange, error) {
+	if err := a.CanClose(); err != nil {
+		return nil, nil, err
+	}
+
+	statement := &ClosingStatement{
+		Number:       a.Number,
+		Reason:       reason,
+		FinalBalance: a.Balance,
+	}
+
+	if a.Balance.IsPositive() && settlement != nil {
+		t, err := l.transfer(a, settlement, a.Balance, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		statement.SettlementAccount, statement.SettlementID, statement.Settlement = settlement.Number, t.ID, t
+	}
+
+	change, err := a.ChangeStatus(StatusClosed, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+	statement.ClosedAt = change.CreatedAt
+
+	entries, err := l.journal.Entries(a.Number)
+	if err != nil {
+		return nil, nil, err
+	}
+	statement.TotalCredits = NewMoney(0, a.Balance.Currency)
+	statement.TotalDebits = NewMoney(0, a.Balance.Currency)
+	for _, e := range entries {
+		if e.Direction == Debit {
+			statement.TotalDebits, err = statement.TotalDebits.Add(e.Amount)
+		} else {
+			statement.TotalCredits, err = statement.TotalCredits.Add(e.Amount)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return statement, change, nil
+}
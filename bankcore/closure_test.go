@@ -0,0 +1,73 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestLedgerClose(t *testing.T) {
+	journal := &memJournal{}
+	ledger := NewLedger(journal)
+
+	a := &Account{Number: "0011111111", Balance: NewMoney(0, DefaultCurrency)}
+	b := &Account{Number: "0012222222", Balance: NewMoney(0, DefaultCurrency)}
+	if _, err := ledger.Deposit(a, NewMoney(10000, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ledger.Withdraw(a, NewMoney(2500, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+
+	hold, _ := a.PlaceHold(NewMoney(500, DefaultCurrency), "card payment")
+	if err := a.CanClose(); !errors.Is(err, ErrPendingHolds) {
+		t.Errorf("expected pending holds to block the closure, got %v", err)
+	}
+	if _, _, err := ledger.Close(a, b, "customer request"); !errors.Is(err, ErrPendingHolds) {
+		t.Errorf("expected pending holds to block the closure, got %v", err)
+	}
+	a.ReleaseHold(hold)
+	if err := a.CanClose(); err != nil {
+		t.Errorf("expected the account to be closable, got %v", err)
+	}
+
+	if _, _, err := ledger.Close(a, nil, "customer request"); !errors.Is(err, ErrBalanceNotZero) {
+		t.Errorf("expected a balance without a settlement account to block the closure, got %v", err)
+	}
+
+	statement, change, err := ledger.Close(a, b, "customer request")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Status != StatusClosed || change.To != StatusClosed || !a.Balance.IsZero() || b.Balance.Amount != 7500 {
+		t.Errorf("expected the balance to be swept and the account closed, got %+v and %+v", a, b)
+	}
+	if statement.FinalBalance.Amount != 7500 || statement.TotalCredits.Amount != 10000 || statement.TotalDebits.Amount != 10000 ||
+		statement.SettlementAccount != b.Number || statement.SettlementID != 3 || statement.Settlement.ID != 3 || statement.ClosedAt.IsZero() {
+		t.Errorf("unexpected closing statement: %+v", statement)
+	}
+
+	if _, _, err := ledger.Close(a, b, "again"); !errors.Is(err, ErrInvalidStatusChange) {
+		t.Errorf("expected a closed account to stay closed, got %v", err)
+	}
+	if _, err := ledger.Deposit(a, NewMoney(100, DefaultCurrency)); !errors.Is(err, ErrAccountRestricted) {
+		t.Errorf("expected a closed account to refuse deposits, got %v", err)
+	}
+
+	// A dormant account can't send money, but its balance is still swept on its closure
+	c := &Account{Number: "0013333333", Balance: NewMoney(0, DefaultCurrency)}
+	if _, err := ledger.Deposit(c, NewMoney(4000, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.ChangeStatus(StatusInactive, "no activity"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ledger.Transfer(c, b, NewMoney(100, DefaultCurrency)); !errors.Is(err, ErrAccountRestricted) {
+		t.Errorf("expected an inactive account not to send money, got %v", err)
+	}
+	if _, _, err := ledger.Close(c, b, "dormant"); err != nil || c.Status != StatusClosed || !c.Balance.IsZero() || b.Balance.Amount != 11500 {
+		t.Errorf("expected the inactive account to be swept and closed, got %v, %+v and %+v", err, c, b)
+	}
+	if err := ledger.Verify(c); err != nil {
+		t.Error(err)
+	}
+}
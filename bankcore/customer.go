@@ -0,0 +1,100 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCustomer is matched by every FieldError.
+var ErrInvalidCustomer = errors.New("invalid customer details")
+
+// FieldError reports a customer detail that failed validation.
+type FieldError struct {
+	Field  string // Name of the invalid detail.
+	Reason string
+}
+
+func (e *FieldError) Error() string { return e.Field + ": " + e.Reason }
+func (e *FieldError) Unwrap() error { return ErrInvalidCustomer }
+
+// Genders accepted in Customer.Gender, which is optional.
+var Genders = []string{"Male", "Female", "Other"}
+
+// Validate checks the customer's details before they are stored.
+// Name and email are required; phone, address, gender and date of birth are optional.
+// It returns the first *FieldError found.
+func (c *Customer) Validate() error {
+	c.Name = strings.TrimSpace(c.Name)
+	c.Email = strings.TrimSpace(c.Email)
+	c.Phone = strings.TrimSpace(c.Phone)
+	c.Address = strings.TrimSpace(c.Address)
+
+	switch {
+	case c.Name == "":
+		return &FieldError{"name", "is required"}
+	case len(c.Name) > 255:
+		return &FieldError{"name", "is longer than 255 characters"}
+	case c.Email == "":
+		return &FieldError{"email", "is required"}
+	case len(c.Email) > 255 || !validEmail(c.Email):
+		return &FieldError{"email", "is not a valid email address"}
+	case len(c.Phone) > 20 || !validPhone(c.Phone):
+		return &FieldError{"phone", "is not a valid phone number"}
+	case len(c.Address) > 255:
+		return &FieldError{"address", "is longer than 255 characters"}
+	}
+
+	if c.Gender != "" {
+		valid := false
+		for _, g := range Genders {
+			if strings.EqualFold(c.Gender, g) {
+				c.Gender, valid = g, true
+			}
+		}
+		if !valid {
+			return &FieldError{"gender", fmt.Sprintf("should be one of %s", strings.Join(Genders, ", "))}
+		}
+	}
+
+	if c.DoB != "" {
+		dob, err := time.Parse("2006-01-02", c.DoB)
+		if err != nil {
+			return &FieldError{"date_of_birth", "should be a date in YYYY-MM-DD format"}
+		}
+		if dob.After(time.Now()) {
+			return &FieldError{"date_of_birth", "is in the future"}
+		}
+	}
+	return nil
+}
+
+// validEmail reports whether s looks like local@domain.tld.
+func validEmail(s string) bool {
+	at := strings.LastIndex(s, "@")
+	if at < 1 || strings.ContainsAny(s, " \t\r\n") {
+		return false
+	}
+	domain := s[at+1:]
+	dot := strings.LastIndex(domain, ".")
+	return dot > 0 && dot < len(domain)-1
+}
+
+// validPhone reports whether s is empty or made of digits, spaces and + ( ) - with at least one digit.
+func validPhone(s string) bool {
+	if s == "" {
+		return true
+	}
+	digits := 0
+	for _, r := range s {
+		switch {
+		case r >= '0' && r <= '9':
+			digits++
+		case strings.ContainsRune(" +()-", r):
+		default:
+			return false
+		}
+	}
+	return digits > 0
+}
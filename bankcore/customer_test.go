@@ -0,0 +1,46 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCustomerValidate(t *testing.T) {
+	c := Customer{
+		Name:    " Jane Doe ",
+		Email:   "jane@gmail.com",
+		Phone:   "(213) 555 0147",
+		Address: "Los Angeles, California",
+		Gender:  "female",
+		DoB:     "2003-01-01",
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Name != "Jane Doe" || c.Gender != "Female" {
+		t.Errorf("details not normalized: %+v", c)
+	}
+}
+
+func TestCustomerValidateInvalid(t *testing.T) {
+	tests := map[string]Customer{
+		"name":          {Email: "jane@gmail.com"},
+		"email":         {Name: "Jane", Email: "jane@gmail"},
+		"phone":         {Name: "Jane", Email: "jane@gmail.com", Phone: "call me"},
+		"gender":        {Name: "Jane", Email: "jane@gmail.com", Gender: "Unknown"},
+		"date_of_birth": {Name: "Jane", Email: "jane@gmail.com", DoB: "01/01/2003"},
+	}
+
+	for field, c := range tests {
+		err := c.Validate()
+		var fe *FieldError
+		if !errors.As(err, &fe) || fe.Field != field || !errors.Is(err, ErrInvalidCustomer) {
+			t.Errorf("%s: expected a field error, got %v", field, err)
+		}
+	}
+
+	future := Customer{Name: "Jane", Email: "jane@gmail.com", DoB: "2999-01-01"}
+	if err := future.Validate(); err == nil {
+		t.Error("a date of birth in the future should be invalid")
+	}
+}
@@ -0,0 +1,339 @@
+package bank
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+)
+
+// FeeAccount is the internal fee income account. Every fee charged to a customer account is credited to it.
+const FeeAccount = "FEES"
+
+// ErrInvalidFeeRule is returned for a fee rule with an unknown operation, badly ordered tiers, a cap below its minimum
+// or an amount in another currency than the rule's.
+var ErrInvalidFeeRule = errors.New("invalid fee rule")
+
+// Operation is what a fee is charged for.
+type Operation string
+
+// Operations with fees.
+const (
+	WithdrawalOperation  Operation = "withdrawal"
+	TransferOperation    Operation = "transfer"
+	MaintenanceOperation Operation = "maintenance" // The monthly upkeep of an account.
+)
+
+// ParseOperation returns the operation named s.
+func ParseOperation(s string) (Operation, error) {
+	switch op := Operation(strings.ToLower(s)); op {
+	case WithdrawalOperation, TransferOperation, MaintenanceOperation:
+		return op, nil
+	}
+	return "", fmt.Errorf("%w: unknown operation %q", ErrInvalidFeeRule, s)
+}
+
+// FeeTier is a band of the amounts a fee rule applies to.
+// Amounts of the band are charged its flat fee plus its rate of the amount.
+type FeeTier struct {
+	From Money // Smallest amount of the band, in the rule's currency.
+	Flat Money // Fixed part of the fee.
+	Rate int64 // Percentage of the amount in basis points, e.g. 50 for 0.5%.
+}
+
+// FeeRule is the fee of an operation on the accounts of a type and currency. A flat fee is a single tier with
+// a flat part, a percentage a single tier with a rate, and a tiered fee has a tier per band of amounts.
+// The fee of any of them can be capped.
+type FeeRule struct {
+	Operation   Operation
+	AccountType AccountType // Accounts the rule applies to, "" for every account without a rule of its own.
+	Currency    string      // Currency of the accounts the rule applies to and of its amounts, "" for DefaultCurrency.
+	Tiers       []FeeTier   // By ascending From, the first from zero.
+	Min         Money       // Smallest fee, zero for none.
+	Max         Money       // Largest fee, zero for no cap.
+}
+
+// validate returns an error matching ErrInvalidFeeRule unless the rule can work out fees.
+func (r FeeRule) validate() error {
+	if _, err := ParseOperation(string(r.Operation)); err != nil {
+		return err
+	}
+	if len(r.Tiers) == 0 || !r.Tiers[0].From.IsZero() {
+		return fmt.Errorf("%w: the first %s tier should start at zero", ErrInvalidFeeRule, r.Operation)
+	}
+	for i, tier := range r.Tiers {
+		if tier.Flat.IsNegative() || tier.Rate < 0 {
+			return fmt.Errorf("%w: the %s fee from %s is negative", ErrInvalidFeeRule, r.Operation, tier.From)
+		}
+		if i > 0 && tier.From.Amount <= r.Tiers[i-1].From.Amount {
+			return fmt.Errorf("%w: the %s tier from %s should come after the tier from %s", ErrInvalidFeeRule, r.Operation, tier.From, r.Tiers[i-1].From)
+		}
+	}
+	if r.Min.IsNegative() || r.Max.IsNegative() || (r.Max.IsPositive() && r.Max.Amount < r.Min.Amount) {
+		return fmt.Errorf("%w: the %s fee cap of %s should not be below its minimum of %s", ErrInvalidFeeRule, r.Operation, r.Max, r.Min)
+	}
+
+	currency, err := ParseCurrency(r.Currency)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidFeeRule, err)
+	}
+	amounts := []Money{r.Min, r.Max}
+	for _, tier := range r.Tiers {
+		amounts = append(amounts, tier.From, tier.Flat)
+	}
+	for _, m := range amounts {
+		if m.Currency != "" && m.Currency != currency {
+			return fmt.Errorf("%w: the %s rule in %s has an amount in %s", ErrInvalidFeeRule, r.Operation, currency, m.Currency)
+		}
+	}
+	return nil
+}
+
+// Fee returns the fee of the amount: the flat part and rate of the tier whose band the amount is in,
+// rounded to the nearest minor unit, then raised to the minimum and lowered to the cap.
+// The amount and the fee are in the rule's currency.
+func (r FeeRule) Fee(amount Money) Money {
+	if amount.IsNegative() {
+		amount.Amount = 0
+	}
+
+	tier := r.Tiers[0]
+	for _, t := range r.Tiers[1:] {
+		if amount.Amount >= t.From.Amount {
+			tier = t
+		}
+	}
+
+	// amount * rate / 10000, rounded, in big integers as the product can overflow an int64
+	part := new(big.Int).Mul(big.NewInt(amount.Amount), big.NewInt(tier.Rate))
+	part.Add(part, big.NewInt(5000))
+	part.Quo(part, big.NewInt(10000))
+
+	fee := tier.Flat.Amount + part.Int64()
+	if fee < r.Min.Amount {
+		fee = r.Min.Amount
+	}
+	if r.Max.IsPositive() && fee > r.Max.Amount {
+		fee = r.Max.Amount
+	}
+	return Money{Amount: fee, Currency: r.Currency}
+}
+
+// FeeSchedule is the set of fee rules the bank charges by.
+type FeeSchedule struct {
+	rules map[Operation]map[feeKey]FeeRule
+}
+
+// feeKey is the account type and currency of the accounts a fee rule applies to.
+type feeKey struct {
+	accountType AccountType
+	currency    string
+}
+
+// NewFeeSchedule returns a schedule with the given rules.
+// Two rules can't have the same operation, account type and currency.
+func NewFeeSchedule(rules ...FeeRule) (*FeeSchedule, error) {
+	s := &FeeSchedule{rules: map[Operation]map[feeKey]FeeRule{}}
+	for _, r := range rules {
+		if err := r.validate(); err != nil {
+			return nil, err
+		}
+		r.Currency, _ = ParseCurrency(r.Currency)
+		if s.rules[r.Operation] == nil {
+			s.rules[r.Operation] = map[feeKey]FeeRule{}
+		}
+		key := feeKey{r.AccountType, r.Currency}
+		if _, ok := s.rules[r.Operation][key]; ok {
+			return nil, fmt.Errorf("%w: a second %s rule for %q accounts in %s", ErrInvalidFeeRule, r.Operation, r.AccountType, r.Currency)
+		}
+		s.rules[r.Operation][key] = r
+	}
+	return s, nil
+}
+
+// LoadFees reads a fee schedule with one rule per line: the operation, the account type or * for any,
+// optionally the currency of the accounts and amounts, DefaultCurrency if there is none,
+// then the tiers as "from:fee" where the fee is a flat amount, a percentage such as "0.5%" or both, such as "10+0.5%",
+// optionally followed by "min=" and "max=" amounts, all separated by spaces.
+// "transfer * 0:10+0.5% 100000:0.25% max=1000" charges transfers 10 plus 0.5% up to 100,000, 0.25% from then on, and never more than 1,000,
+// and "withdrawal * USD 0:1" charges withdrawals from USD accounts 1 USD.
+// Blank lines and lines starting with # are skipped.
+func LoadFees(r io.Reader) (*FeeSchedule, error) {
+	var rules []FeeRule
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%w: line %d should be an operation, an account type and tiers", ErrInvalidFeeRule, line)
+		}
+		op, err := ParseOperation(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rule := FeeRule{Operation: op, Currency: DefaultCurrency}
+		if fields[1] != "*" {
+			if rule.AccountType, err = ParseAccountType(fields[1]); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		tiers := fields[2:]
+		if !strings.ContainsAny(tiers[0], ":=") {
+			if rule.Currency, err = ParseCurrency(tiers[0]); err != nil {
+				return nil, fmt.Errorf("line %d: %w: %v", line, ErrInvalidFeeRule, err)
+			}
+			tiers = tiers[1:]
+		}
+
+		for _, field := range tiers {
+			if err := parseFeeField(&rule, field); err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+		}
+		rules = append(rules, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewFeeSchedule(rules...)
+}
+
+// parseFeeField adds a "from:fee" tier, a "min=" or a "max=" amount of a LoadFees line to the rule.
+func parseFeeField(r *FeeRule, field string) error {
+	if strings.HasPrefix(field, "min=") || strings.HasPrefix(field, "max=") {
+		amount, err := ParseMoney(field[4:], r.Currency)
+		if err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidFeeRule, field, err)
+		}
+		if field[:3] == "min" {
+			r.Min = amount
+		} else {
+			r.Max = amount
+		}
+		return nil
+	}
+
+	i := strings.IndexByte(field, ':')
+	if i < 0 {
+		return fmt.Errorf("%w: tier %q should be from:fee", ErrInvalidFeeRule, field)
+	}
+	from, err := ParseMoney(field[:i], r.Currency)
+	if err != nil {
+		return fmt.Errorf("%w: %s: %v", ErrInvalidFeeRule, field, err)
+	}
+	tier := FeeTier{From: from}
+
+	for _, part := range strings.Split(field[i+1:], "+") {
+		if strings.HasSuffix(part, "%") {
+			if tier.Rate, err = parseMinor(strings.TrimSuffix(part, "%")); err != nil {
+				return fmt.Errorf("%w: %s: %v", ErrInvalidFeeRule, field, err)
+			}
+		} else if tier.Flat, err = ParseMoney(part, r.Currency); err != nil {
+			return fmt.Errorf("%w: %s: %v", ErrInvalidFeeRule, field, err)
+		}
+	}
+	r.Tiers = append(r.Tiers, tier)
+	return nil
+}
+
+// Fee returns the fee of the operation on the amount for the account, in the account's currency:
+// by the rule for the account's type and currency, or else the rule for any account in its currency.
+// It is zero without a rule, such as for an account in a currency the schedule has no rule in.
+func (s *FeeSchedule) Fee(op Operation, a *Account, amount Money) Money {
+	rules := s.rules[op]
+	r, ok := rules[feeKey{a.Type, a.Currency()}]
+	if !ok {
+		r, ok = rules[feeKey{"", a.Currency()}]
+	}
+	if !ok {
+		return NewMoney(0, a.Currency())
+	}
+	return r.Fee(amount)
+}
+
+// ChargeFee takes the fee out of the account. Like a withdrawal, it can only use the available balance
+// and the overdraft, but frozen accounts still pay their fees: only accounts no money moves in or out of can't.
+func (a *Account) ChargeFee(fee Money) error {
+	if !fee.IsPositive() {
+		return &accountError{"the fee should be greater than zero", ErrNonPositiveAmount}
+	}
+
+	if err := a.checkCurrency(fee); err != nil {
+		return err
+	}
+	if !a.Status.CanReceive() {
+		return &accountError{fmt.Sprintf("account %s is %s and cannot be charged", a.Number, a.Status), ErrAccountRestricted}
+	}
+
+	balance, err := a.Balance.Sub(fee)
+	if err != nil {
+		return err
+	}
+	if err := a.checkFunds(balance, fmt.Sprintf("insufficient balance to pay the fee of %s", fee)); err != nil {
+		return err
+	}
+
+	a.Balance = balance
+	return nil
+}
+
+// chargeFee charges the account the fee of the operation on the transaction's amount, if the ledger has fees,
+// and adds the fee's entries to the transaction: a debit of the account and a credit of FeeAccount.
+func (l *Ledger) chargeFee(t *Transaction, op Operation, a *Account) error {
+	if l.fees == nil {
+		return nil
+	}
+	fee := l.fees.Fee(op, a, t.Amount)
+	if !fee.IsPositive() {
+		return nil
+	}
+
+	if err := a.ChargeFee(fee); err != nil {
+		return err
+	}
+	t.Fee = fee
+	t.Entries = append(t.Entries,
+		Entry{Account: a.Number, Direction: Debit, Amount: fee, Balance: a.Balance},
+		Entry{Account: FeeAccount, Direction: Credit, Amount: fee},
+	)
+	return nil
+}
+
+// ChargeMaintenance charges the account its monthly maintenance fee, worked out on its balance,
+// credits FeeAccount and records the transaction. It returns a nil transaction if the account has no fee to pay.
+func (l *Ledger) ChargeMaintenance(a *Account) (*Transaction, error) {
+	if l.fees == nil {
+		return nil, nil
+	}
+	fee := l.fees.Fee(MaintenanceOperation, a, a.Balance)
+	if !fee.IsPositive() {
+		return nil, nil
+	}
+
+	before := a.Balance
+	if err := a.ChargeFee(fee); err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{
+		Type:   FeeTransaction,
+		Amount: fee,
+		Entries: []Entry{
+			{Account: a.Number, Direction: Debit, Amount: fee, Balance: a.Balance},
+			{Account: FeeAccount, Direction: Credit, Amount: fee},
+		},
+	}
+	if err := l.post(t); err != nil {
+		a.Balance = before
+		return nil, err
+	}
+	return t, nil
+}
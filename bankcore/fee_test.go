@@ -0,0 +1,167 @@
+package bank
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFeeRule(t *testing.T) {
+	tests := []struct {
+		name   string
+		rule   FeeRule
+		amount int64
+		fee    int64
+	}{
+		{"flat", FeeRule{Tiers: []FeeTier{{Flat: NewMoney(2500, "")}}}, 100000, 2500},
+		{"percentage", FeeRule{Tiers: []FeeTier{{Rate: 50}}}, 12345, 62}, // 61.725 rounds up.
+		{"flat and percentage", FeeRule{Tiers: []FeeTier{{Flat: NewMoney(1000, ""), Rate: 50}}}, 100000, 1500},
+		{"lower tier", FeeRule{Tiers: []FeeTier{{Flat: NewMoney(1000, "")}, {From: NewMoney(500000, ""), Rate: 25}}}, 499999, 1000},
+		{"upper tier", FeeRule{Tiers: []FeeTier{{Flat: NewMoney(1000, "")}, {From: NewMoney(500000, ""), Rate: 25}}}, 1000000, 2500},
+		{"capped", FeeRule{Tiers: []FeeTier{{Rate: 100}}, Max: NewMoney(5000, "")}, 10000000, 5000},
+		{"minimum", FeeRule{Tiers: []FeeTier{{Rate: 100}}, Min: NewMoney(300, "")}, 10000, 300},
+	}
+
+	for _, tt := range tests {
+		tt.rule.Operation = WithdrawalOperation
+		if err := tt.rule.validate(); err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if fee := tt.rule.Fee(NewMoney(tt.amount, "NGN")); fee.Amount != tt.fee {
+			t.Errorf("%s: expected a fee of %d on %d, got %d", tt.name, tt.fee, tt.amount, fee.Amount)
+		}
+	}
+
+	invalid := []FeeRule{
+		{Operation: "deposit", Tiers: []FeeTier{{Flat: NewMoney(100, "")}}},
+		{Operation: WithdrawalOperation},
+		{Operation: WithdrawalOperation, Tiers: []FeeTier{{Rate: 10}, {Rate: 20}}},
+		{Operation: WithdrawalOperation, Tiers: []FeeTier{{Rate: -10}}},
+		{Operation: WithdrawalOperation, Tiers: []FeeTier{{Rate: 10}}, Min: NewMoney(500, ""), Max: NewMoney(100, "")},
+		{Operation: WithdrawalOperation, Currency: "USD", Tiers: []FeeTier{{Flat: NewMoney(100, "NGN")}}},
+		{Operation: WithdrawalOperation, Currency: "GBP", Tiers: []FeeTier{{Flat: NewMoney(100, "")}}},
+	}
+	for _, r := range invalid {
+		if err := r.validate(); !errors.Is(err, ErrInvalidFeeRule) {
+			t.Errorf("%+v: expected an invalid rule, got %v", r, err)
+		}
+	}
+}
+
+func TestLoadFees(t *testing.T) {
+	fees, err := LoadFees(strings.NewReader("# fees\nwithdrawal * 0:50\nwithdrawal * USD 0:1\ntransfer * NGN 0:10+0.5% 100000:0.25% max=1000\n\nwithdrawal savings 0:100 min=100\nmaintenance current 0:200\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := &Account{Number: "0011111111", Type: CurrentAccount}
+	savings := &Account{Number: "0012222222", Type: SavingsAccount}
+	dollars := &Account{Number: "0013333333", Type: SavingsAccount, Balance: NewMoney(0, "USD")}
+
+	if fee := fees.Fee(WithdrawalOperation, current, NewMoney(100, "")); fee != NewMoney(5000, "NGN") {
+		t.Errorf("expected the rule for any account, got %v", fee)
+	}
+	if fee := fees.Fee(WithdrawalOperation, savings, NewMoney(100, "")); fee != NewMoney(10000, "NGN") {
+		t.Errorf("expected the savings rule, got %v", fee)
+	}
+	// 10 + 0.5% of 50,000 is 260, 0.25% of 1,000,000 is 2,500 capped to 1,000
+	if fee := fees.Fee(TransferOperation, current, NewMoney(5000000, "")); fee.Amount != 26000 {
+		t.Errorf("expected 260.00, got %s", fee)
+	}
+	if fee := fees.Fee(TransferOperation, current, NewMoney(100000000, "")); fee.Amount != 100000 {
+		t.Errorf("expected the cap of 1,000.00, got %s", fee)
+	}
+	if fee := fees.Fee(MaintenanceOperation, savings, savings.Balance); !fee.IsZero() {
+		t.Errorf("expected no maintenance fee on savings accounts, got %s", fee)
+	}
+
+	// Accounts are charged by the rules in their currency, and nothing in a currency without one
+	if fee := fees.Fee(WithdrawalOperation, dollars, NewMoney(100, "USD")); fee != NewMoney(100, "USD") {
+		t.Errorf("expected the rule for USD accounts, got %v", fee)
+	}
+	if fee := fees.Fee(TransferOperation, dollars, NewMoney(5000000, "USD")); fee != NewMoney(0, "USD") {
+		t.Errorf("expected no fee without a USD rule, got %v", fee)
+	}
+
+	for _, text := range []string{"withdrawal *", "withdrawal * USD", "deposit * 0:10", "withdrawal gold 0:10", "withdrawal * GBP 0:10", "withdrawal * 0-10", "withdrawal * 0:10%%", "withdrawal * 0:10\nwithdrawal * NGN 0:20"} {
+		if _, err := LoadFees(strings.NewReader(text)); err == nil {
+			t.Errorf("%q: expected an error", text)
+		}
+	}
+}
+
+func TestLedgerFees(t *testing.T) {
+	fees, err := NewFeeSchedule(
+		FeeRule{Operation: WithdrawalOperation, Tiers: []FeeTier{{Flat: NewMoney(100, "")}}},
+		FeeRule{Operation: TransferOperation, Tiers: []FeeTier{{Rate: 100}}, Min: NewMoney(50, "")},
+		FeeRule{Operation: MaintenanceOperation, Tiers: []FeeTier{{Flat: NewMoney(500, "")}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	journal := &memJournal{}
+	ledger := NewLedger(journal).WithFees(fees)
+	a := &Account{Number: "0011111111", Balance: NewMoney(0, "NGN")}
+	b := &Account{Number: "0012222222", Balance: NewMoney(0, "NGN")}
+
+	// Deposits are free, and the fee is a separate pair of entries of the withdrawal
+	if _, err := ledger.Deposit(a, NewMoney(10000, "")); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := ledger.Withdraw(a, NewMoney(2000, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance.Amount != 7900 || tx.Fee != NewMoney(100, "NGN") || tx.Amount.Amount != 2000 {
+		t.Errorf("expected 20.00 withdrawn and a fee of 1.00, got %+v and a balance of %s", tx, a.Balance)
+	}
+	if !tx.Balanced() || len(tx.Entries) != 4 || tx.Entries[3].Account != FeeAccount || tx.Entries[2].Balance.Amount != 7900 {
+		t.Errorf("unexpected entries %+v", tx.Entries)
+	}
+	if err := ledger.Verify(a); err != nil {
+		t.Error(err)
+	}
+
+	// The fee comes out of the sender of a transfer
+	if tx, err = ledger.Transfer(a, b, NewMoney(1000, "")); err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance.Amount != 6850 || b.Balance.Amount != 1000 || tx.Fee.Amount != 50 {
+		t.Errorf("expected a fee of 0.50 on top of the 10.00 transferred, got %s and %s", a.Balance, b.Balance)
+	}
+
+	// An operation whose fee can't be paid doesn't happen
+	if _, err := ledger.Withdraw(a, NewMoney(6800, "")); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected the fee to be unaffordable, got %v", err)
+	}
+	if a.Balance.Amount != 6850 || len(journal.transactions) != 3 {
+		t.Errorf("expected the refused withdrawal to change nothing, got %s and %d transactions", a.Balance, len(journal.transactions))
+	}
+
+	// Frozen accounts still pay their maintenance, accounts nothing moves through don't
+	a.Status = StatusInactive
+	if tx, err = ledger.ChargeMaintenance(a); err != nil {
+		t.Fatal(err)
+	}
+	if tx.Type != FeeTransaction || a.Balance.Amount != 6350 || !tx.Balanced() {
+		t.Errorf("expected a 5.00 maintenance fee, got %+v and a balance of %s", tx, a.Balance)
+	}
+	b.Status = StatusBlacklisted
+	if _, err := ledger.ChargeMaintenance(b); !errors.Is(err, ErrAccountRestricted) {
+		t.Errorf("expected a blacklisted account not to be charged, got %v", err)
+	}
+	if tx, err := NewLedger(journal).ChargeMaintenance(a); tx != nil || err != nil {
+		t.Errorf("expected nothing to charge without fees, got %v %v", tx, err)
+	}
+
+	// Closing sweeps the whole balance without a fee
+	b.Status = StatusActive
+	a.Status = StatusActive
+	if _, _, err := ledger.Close(a, b, "customer request"); err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance.Amount != 0 || b.Balance.Amount != 7350 {
+		t.Errorf("expected the whole balance swept, got %s and %s", a.Balance, b.Balance)
+	}
+}
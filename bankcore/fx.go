@@ -0,0 +1,194 @@
+package bank
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// FXAccount is the internal account that exchanges currencies for transfers between accounts
+// of different currencies. It is credited the debited amount in one currency and debited the
+// converted amount in the other, so the entries of each currency balance on their own.
+const FXAccount = "FX"
+
+// Errors of exchange rates, matched with errors.Is.
+var (
+	ErrRateNotFound = errors.New("exchange rate not found")
+	ErrInvalidRate  = errors.New("invalid exchange rate")
+)
+
+// rateDecimals is the number of decimal places of an exchange rate.
+const rateDecimals = 6
+
+// rateScale is one unit of an exchange rate in millionths.
+const rateScale = 1000000
+
+// Rate is the price of one unit of the From currency in the To currency.
+type Rate struct {
+	From  string
+	To    string
+	Value int64 // Millionths of a unit of To, e.g. 1500000000 for 1500.
+}
+
+// ParseRate parses a positive decimal rate such as "1500" or "0.000667" from one currency to another.
+// Rates with more than six decimal places are rejected.
+func ParseRate(from, to, s string) (Rate, error) {
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+	if whole == "" || len(frac) > rateDecimals || !isDigits(whole) || !isDigits(frac) {
+		return Rate{}, fmt.Errorf("%w: %q", ErrInvalidRate, s)
+	}
+
+	frac += strings.Repeat("0", rateDecimals-len(frac))
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (1<<63-1)/rateScale-1 {
+		return Rate{}, fmt.Errorf("%w: %q is out of range", ErrInvalidRate, s)
+	}
+	millionths, _ := strconv.ParseInt(frac, 10, 64)
+
+	r := Rate{From: from, To: to, Value: units*rateScale + millionths}
+	if r.Value == 0 {
+		return Rate{}, fmt.Errorf("%w: %q should be greater than zero", ErrInvalidRate, s)
+	}
+	return r, nil
+}
+
+// String formats the rate with six decimal places, e.g. "1500.000000".
+func (r Rate) String() string {
+	return fmt.Sprintf("%d.%06d", r.Value/rateScale, r.Value%rateScale)
+}
+
+// MarshalJSON encodes the rate as an exact JSON number.
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		From  string      `json:"from"`
+		To    string      `json:"to"`
+		Value json.Number `json:"rate"`
+	}{r.From, r.To, json.Number(r.String())})
+}
+
+// Inverse returns the rate the other way round, rounded to six decimal places.
+func (r Rate) Inverse() Rate {
+	return Rate{From: r.To, To: r.From, Value: (rateScale*rateScale + r.Value/2) / r.Value}
+}
+
+// Convert returns the amount, in the From currency, converted to the To currency.
+// The result is rounded to the nearest minor unit, halves away from zero.
+func (r Rate) Convert(m Money) (Money, error) {
+	if m.Currency != "" && m.Currency != r.From {
+		return Money{}, fmt.Errorf("%w: a %s to %s rate can't convert %s", ErrCurrencyMismatch, r.From, r.To, m.Currency)
+	}
+
+	// amount * value / scale, rounded, in big integers as the product can overflow an int64
+	product := new(big.Int).Mul(big.NewInt(m.Amount), big.NewInt(r.Value))
+	half := big.NewInt(rateScale / 2)
+	if product.Sign() < 0 {
+		half.Neg(half)
+	}
+	converted := new(big.Int).Quo(product.Add(product, half), big.NewInt(rateScale))
+	if !converted.IsInt64() {
+		return Money{}, errors.New("amount overflow")
+	}
+	return Money{Amount: converted.Int64(), Currency: r.To}, nil
+}
+
+// RateProvider gives the exchange rates of transfers between accounts of different currencies.
+type RateProvider interface {
+	// Rate returns the rate from one currency to another, or an error matching ErrRateNotFound.
+	Rate(from, to string) (Rate, error)
+}
+
+// StaticRates is a RateProvider with a fixed table of rates.
+// A rate from one currency to another also gives the rate the other way round,
+// unless the table has that one too.
+type StaticRates struct {
+	rates map[[2]string]Rate
+}
+
+// NewStaticRates returns a rate table with the given rates.
+func NewStaticRates(rates ...Rate) *StaticRates {
+	s := &StaticRates{rates: make(map[[2]string]Rate, len(rates))}
+	for _, r := range rates {
+		s.rates[[2]string{r.From, r.To}] = r
+	}
+	return s
+}
+
+// LoadRates reads a rate table with one rate per line: the currency converted from,
+// the currency converted to and the rate, separated by spaces, such as "USD NGN 1500".
+// Blank lines and lines starting with # are skipped.
+func LoadRates(r io.Reader) (*StaticRates, error) {
+	var rates []Rate
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("%w: line %d should be two currencies and a rate", ErrInvalidRate, line)
+		}
+		from, err := ParseCurrency(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		to, err := ParseCurrency(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rate, err := ParseRate(from, to, fields[2])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		rates = append(rates, rate)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return NewStaticRates(rates...), nil
+}
+
+// Rate returns the rate of the table from one currency to another, or its inverse.
+func (s *StaticRates) Rate(from, to string) (Rate, error) {
+	if r, ok := s.rates[[2]string{from, to}]; ok {
+		return r, nil
+	}
+	if r, ok := s.rates[[2]string{to, from}]; ok {
+		return r.Inverse(), nil
+	}
+	return Rate{}, fmt.Errorf("%w: %s to %s", ErrRateNotFound, from, to)
+}
+
+// Exchange moves the amount out of the account and its conversion at the rate into the other account,
+// which is in the rate's To currency. It returns the converted amount.
+// Like Transfer, it requires an available balance that covers the amount.
+func (a *Account) Exchange(to *Account, amount Money, rate Rate) (Money, error) {
+	return a.exchange(to, amount, rate, false)
+}
+
+// exchange is Exchange, or the sweep of a closure if sweep is set, see transfer.
+func (a *Account) exchange(to *Account, amount Money, rate Rate, sweep bool) (Money, error) {
+	if rate.From != a.Currency() || rate.To != to.Currency() {
+		return Money{}, fmt.Errorf("%w: a %s to %s rate can't exchange %s for %s", ErrCurrencyMismatch, rate.From, rate.To, a.Currency(), to.Currency())
+	}
+
+	converted, err := rate.Convert(amount)
+	if err != nil {
+		return Money{}, err
+	}
+	if err := a.transfer(to, amount, converted, sweep); err != nil {
+		return Money{}, err
+	}
+	return converted, nil
+}
@@ -0,0 +1,109 @@
+package bank
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRates(t *testing.T) {
+	rate, err := ParseRate("USD", "NGN", "1500.25")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate.String() != "1500.250000" {
+		t.Errorf("unexpected rate %s", rate)
+	}
+
+	converted, err := rate.Convert(NewMoney(1001, "USD"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 10.01 * 1500.25 = 15017.5025, rounded to the kobo
+	if converted.Amount != 1501750 || converted.Currency != "NGN" {
+		t.Errorf("expected 15017.50 NGN, got %s %s", converted, converted.Currency)
+	}
+	if _, err := rate.Convert(NewMoney(100, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected a currency mismatch, got %v", err)
+	}
+
+	for _, s := range []string{"", "0", "-1.5", "1.1234567", "1,5", "abc"} {
+		if _, err := ParseRate("USD", "NGN", s); !errors.Is(err, ErrInvalidRate) {
+			t.Errorf("%q: expected an invalid rate, got %v", s, err)
+		}
+	}
+}
+
+func TestStaticRates(t *testing.T) {
+	rates, err := LoadRates(strings.NewReader("# rates of the day\nUSD NGN 1600\n\neur usd 1.08\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rate, err := rates.Rate("EUR", "USD")
+	if err != nil || rate.Value != 1080000 {
+		t.Errorf("expected the EUR to USD rate of the table, got %v %v", rate, err)
+	}
+	rate, err = rates.Rate("NGN", "USD")
+	if err != nil || rate.String() != "0.000625" {
+		t.Errorf("expected the inverse of the USD to NGN rate, got %v %v", rate, err)
+	}
+	if _, err := rates.Rate("EUR", "NGN"); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("expected no EUR to NGN rate, got %v", err)
+	}
+
+	if _, err := LoadRates(strings.NewReader("USD GBP 0.79\n")); !errors.Is(err, ErrUnsupportedCurrency) {
+		t.Errorf("expected an unsupported currency, got %v", err)
+	}
+	if _, err := LoadRates(strings.NewReader("USD NGN\n")); !errors.Is(err, ErrInvalidRate) {
+		t.Errorf("expected an invalid line, got %v", err)
+	}
+}
+
+func TestLedgerExchange(t *testing.T) {
+	journal := &memJournal{}
+	usd := &Account{Number: "0011111111", Balance: NewMoney(10000, "USD")}
+	ngn := &Account{Number: "0012222222", Balance: NewMoney(0, "NGN")}
+
+	if _, err := NewLedger(journal).Transfer(usd, ngn, NewMoney(1000, "")); !errors.Is(err, ErrRateNotFound) {
+		t.Errorf("expected a transfer between currencies to need rates, got %v", err)
+	}
+
+	rate, _ := ParseRate("USD", "NGN", "1500")
+	ledger := NewLedger(journal).WithRates(NewStaticRates(rate))
+
+	tx, err := ledger.Transfer(usd, ngn, NewMoney(1000, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usd.Balance.Amount != 9000 || ngn.Balance.Amount != 1500000 || ngn.Balance.Currency != "NGN" {
+		t.Errorf("unexpected balances %s USD and %s NGN", usd.Balance, ngn.Balance)
+	}
+	if tx.Amount != NewMoney(1000, "USD") || tx.Converted != NewMoney(1500000, "NGN") || tx.Rate == nil || tx.Rate.Value != rate.Value {
+		t.Errorf("expected the transaction to record both amounts and the rate, got %+v", tx)
+	}
+	if !tx.Balanced() || len(tx.Entries) != 4 {
+		t.Errorf("expected four balanced entries through the FX account, got %+v", tx.Entries)
+	}
+
+	// The other way round uses the inverse rate
+	if _, err := ledger.Transfer(ngn, usd, NewMoney(150000, "NGN")); err != nil {
+		t.Fatal(err)
+	}
+	if usd.Balance.Amount != 9100 || ngn.Balance.Amount != 1350000 {
+		t.Errorf("unexpected balances %s USD and %s NGN", usd.Balance, ngn.Balance)
+	}
+
+	if _, err := ledger.Transfer(usd, ngn, NewMoney(1000, "NGN")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected the amount to be in the debited account's currency, got %v", err)
+	}
+	if err := usd.Deposit(NewMoney(100, "EUR")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected a deposit in another currency to be refused, got %v", err)
+	}
+	if err := usd.Withdraw(NewMoney(100, "NGN")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected a withdrawal in another currency to be refused, got %v", err)
+	}
+	if usd.Balance.Amount != 9100 {
+		t.Errorf("refused operations changed the balance to %s", usd.Balance)
+	}
+}
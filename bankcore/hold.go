@@ -0,0 +1,70 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrPendingHolds is returned when an account with pending holds is closed.
+var ErrPendingHolds = errors.New("account has pending holds")
+
+// Hold reserves part of an account's balance, such as for a card payment that hasn't settled yet.
+// Held money stays in the balance but can't be withdrawn or transferred until the hold is released.
+type Hold struct {
+	ID        int64
+	Account   string // Account number.
+	Amount    Money
+	Reason    string
+	CreatedAt time.Time
+}
+
+// Available returns what can be withdrawn or transferred: the part of the balance that isn't held,
+// plus the overdraft limit.
+func (a *Account) Available() Money {
+	return Money{Amount: a.Balance.Amount - a.Held.Amount + a.Overdraft.Amount, Currency: a.Balance.Currency}
+}
+
+// PlaceHold reserves the amount of the available balance, returning the hold to record.
+func (a *Account) PlaceHold(amount Money, reason string) (*Hold, error) {
+	if !amount.IsPositive() {
+		return nil, &accountError{"the amount to hold should be greater than zero", ErrNonPositiveAmount}
+	}
+
+	if err := a.checkCurrency(amount); err != nil {
+		return nil, err
+	}
+	if err := a.canSend(); err != nil {
+		return nil, err
+	}
+
+	held, err := a.Held.Add(amount)
+	if err != nil {
+		return nil, err
+	}
+
+	if held.Amount > a.Balance.Amount+a.Overdraft.Amount {
+		return nil, &accountError{"the amount to hold should be less than the account's available balance", ErrInsufficientFunds}
+	}
+
+	if amount.Currency == "" {
+		amount.Currency = a.Currency()
+	}
+	a.Held = held
+	return &Hold{Account: a.Number, Amount: amount, Reason: reason, CreatedAt: time.Now().UTC()}, nil
+}
+
+// ReleaseHold gives the held amount back to the available balance.
+func (a *Account) ReleaseHold(h *Hold) error {
+	if h.Account != a.Number {
+		return fmt.Errorf("hold %d is on account %s, not %s", h.ID, h.Account, a.Number)
+	}
+
+	held, err := a.Held.Sub(h.Amount)
+	if err != nil {
+		return err
+	}
+
+	a.Held = held
+	return nil
+}
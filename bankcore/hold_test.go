@@ -0,0 +1,44 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHolds(t *testing.T) {
+	a := &Account{Number: "0011111111", Balance: NewMoney(10000, DefaultCurrency)}
+	other := &Account{Number: "0012222222", Balance: NewMoney(0, DefaultCurrency)}
+
+	hold, err := a.PlaceHold(NewMoney(7000, DefaultCurrency), "card payment")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Available().Amount != 3000 || a.Balance.Amount != 10000 {
+		t.Errorf("expected 30.00 available of 100.00, got %s of %s", a.Available(), a.Balance)
+	}
+
+	// Held money can't be withdrawn, transferred or held again
+	if err := a.Withdraw(NewMoney(3500, DefaultCurrency)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected insufficient funds, got %v", err)
+	}
+	if err := a.Transfer(other, NewMoney(3500, DefaultCurrency)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected insufficient funds, got %v", err)
+	}
+	if _, err := a.PlaceHold(NewMoney(3500, DefaultCurrency), "another payment"); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected insufficient funds, got %v", err)
+	}
+	if err := a.Withdraw(NewMoney(3000, DefaultCurrency)); err != nil {
+		t.Errorf("the available balance should be withdrawable, got %v", err)
+	}
+
+	hold.ID = 1
+	if err := a.ReleaseHold(hold); err != nil {
+		t.Fatal(err)
+	}
+	if !a.Held.IsZero() || a.Available().Amount != 7000 {
+		t.Errorf("expected the whole balance to be available, got %s", a.Available())
+	}
+	if err := other.ReleaseHold(hold); err == nil {
+		t.Error("expected a hold to be released only from its own account")
+	}
+}
@@ -0,0 +1,160 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Errors of IBAN derivation and validation, matched with errors.Is.
+var (
+	ErrInvalidIBAN = errors.New("invalid IBAN")
+	ErrForeignIBAN = errors.New("IBAN belongs to another bank")
+)
+
+// Bounds of an IBAN's length, whatever its country.
+const (
+	minIBANLength = 15
+	maxIBANLength = 34
+)
+
+// ibanLengths is the IBAN length of the countries we deal with most.
+// IBANs of other countries are only checked against the general bounds.
+var ibanLengths = map[string]int{
+	"AT": 20, "BE": 16, "CH": 21, "DE": 22, "DK": 18, "ES": 24, "FI": 18, "FR": 27,
+	"GB": 22, "IE": 22, "IT": 27, "LU": 20, "NL": 18, "NO": 15, "PL": 28, "PT": 25, "SE": 24,
+}
+
+// IBANScheme derives the IBANs of the bank's accounts: the country code, the check digits,
+// then a BBAN made of the bank code followed by the account number.
+type IBANScheme struct {
+	Country  string // ISO 3166 country code, such as "DE".
+	BankCode string // National bank code that comes before the account number.
+}
+
+// NewIBANScheme returns the IBAN scheme of a bank in the country with the bank code.
+// numberLength is the length of the bank's account numbers, which must fit the country's IBAN length.
+func NewIBANScheme(country, bankCode string, numberLength int) (*IBANScheme, error) {
+	country, bankCode = strings.ToUpper(country), strings.ToUpper(bankCode)
+	if len(country) != 2 || !isUpper(country) {
+		return nil, fmt.Errorf("%w: country code %q should be two letters", ErrInvalidIBAN, country)
+	}
+	if bankCode == "" || !isAlphanumeric(bankCode) {
+		return nil, fmt.Errorf("%w: bank code %q should be letters and digits", ErrInvalidIBAN, bankCode)
+	}
+
+	length := 4 + len(bankCode) + numberLength
+	if want, ok := ibanLengths[country]; ok && length != want {
+		return nil, fmt.Errorf("%w: %s IBANs have %d characters, bank code %s gives %d", ErrInvalidIBAN, country, want, bankCode, length)
+	}
+	if length < minIBANLength || length > maxIBANLength {
+		return nil, fmt.Errorf("%w: bank code %s gives IBANs of %d characters", ErrInvalidIBAN, bankCode, length)
+	}
+
+	return &IBANScheme{Country: country, BankCode: bankCode}, nil
+}
+
+// IBAN returns the IBAN of the account number, in its electronic form without spaces.
+func (s *IBANScheme) IBAN(number string) (string, error) {
+	if number == "" || !isAlphanumeric(number) {
+		return "", fmt.Errorf("%w: account number %q should be letters and digits", ErrInvalidIBAN, number)
+	}
+
+	bban := s.BankCode + number
+	check := 98 - mod97(bban+s.Country+"00")
+	return fmt.Sprintf("%s%02d%s", s.Country, check, bban), nil
+}
+
+// AccountNumber returns the account number of one of the bank's IBANs.
+// The IBAN may be in its printed form, with spaces. An IBAN of another country
+// or bank is reported with an error matching ErrForeignIBAN.
+func (s *IBANScheme) AccountNumber(iban string) (string, error) {
+	iban = NormalizeIBAN(iban)
+	if err := ValidateIBAN(iban); err != nil {
+		return "", err
+	}
+
+	if iban[:2] != s.Country || !strings.HasPrefix(iban[4:], s.BankCode) {
+		return "", fmt.Errorf("%w: %s is not an IBAN of bank %s in %s", ErrForeignIBAN, iban, s.BankCode, s.Country)
+	}
+	return iban[4+len(s.BankCode):], nil
+}
+
+// NormalizeIBAN returns the electronic form of an IBAN: upper case and without spaces.
+func NormalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.Join(strings.Fields(iban), ""))
+}
+
+// FormatIBAN returns the printed form of an IBAN, in groups of four characters.
+func FormatIBAN(iban string) string {
+	iban = NormalizeIBAN(iban)
+
+	var b strings.Builder
+	for i := 0; i < len(iban); i += 4 {
+		if i > 0 {
+			b.WriteByte(' ')
+		}
+		end := i + 4
+		if end > len(iban) {
+			end = len(iban)
+		}
+		b.WriteString(iban[i:end])
+	}
+	return b.String()
+}
+
+// ValidateIBAN returns an error matching ErrInvalidIBAN unless iban, in its electronic form,
+// has a country code, the length of that country's IBANs and check digits that pass the mod-97 check.
+func ValidateIBAN(iban string) error {
+	if len(iban) < minIBANLength || len(iban) > maxIBANLength {
+		return fmt.Errorf("%w: %q should have between %d and %d characters", ErrInvalidIBAN, iban, minIBANLength, maxIBANLength)
+	}
+	if !isUpper(iban[:2]) || !isDigits(iban[2:4]) || !isAlphanumeric(iban[4:]) {
+		return fmt.Errorf("%w: %q should be a country code, two check digits and letters or digits", ErrInvalidIBAN, iban)
+	}
+	if want, ok := ibanLengths[iban[:2]]; ok && len(iban) != want {
+		return fmt.Errorf("%w: %s IBANs have %d characters, %q has %d", ErrInvalidIBAN, iban[:2], want, iban, len(iban))
+	}
+
+	// Moving the first four characters to the end gives a number that leaves 1 when divided by 97
+	if mod97(iban[4:]+iban[:4]) != 1 {
+		return fmt.Errorf("%w: the check digits of %s don't match", ErrInvalidIBAN, iban)
+	}
+	return nil
+}
+
+// mod97 returns the remainder of the division by 97 of s read as a number,
+// with each letter standing for two digits: A is 10, B is 11 and so on up to Z, 35.
+// It works one digit at a time, as s can be far longer than an int holds.
+func mod97(s string) int {
+	r := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c >= 'A' && c <= 'Z' {
+			r = (r*100 + int(c-'A') + 10) % 97
+		} else {
+			r = (r*10 + int(c-'0')) % 97
+		}
+	}
+	return r
+}
+
+// isUpper reports whether s is only upper case ASCII letters.
+func isUpper(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] < 'A' || s[i] > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// isAlphanumeric reports whether s is only upper case ASCII letters and digits.
+func isAlphanumeric(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if !isUpper(s[i:i+1]) && !isDigits(s[i:i+1]) {
+			return false
+		}
+	}
+	return true
+}
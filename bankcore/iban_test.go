@@ -0,0 +1,81 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIBAN(t *testing.T) {
+	scheme, err := NewIBANScheme("de", "37040044", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	iban, err := scheme.IBAN("0532013000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if iban != "DE89370400440532013000" {
+		t.Errorf("expected DE89370400440532013000, got %s", iban)
+	}
+	if got := FormatIBAN(iban); got != "DE89 3704 0044 0532 0130 00" {
+		t.Errorf("unexpected printed form %q", got)
+	}
+
+	number, err := scheme.AccountNumber("de89 3704 0044 0532 0130 00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if number != "0532013000" {
+		t.Errorf("expected account number 0532013000, got %s", number)
+	}
+
+	if _, err := scheme.AccountNumber("GB82WEST12345698765432"); !errors.Is(err, ErrForeignIBAN) {
+		t.Errorf("expected a foreign IBAN, got %v", err)
+	}
+	if _, err := scheme.AccountNumber("DE89370400440532013001"); !errors.Is(err, ErrInvalidIBAN) {
+		t.Errorf("expected an invalid IBAN, got %v", err)
+	}
+}
+
+func TestNewIBANScheme(t *testing.T) {
+	// German IBANs have 22 characters: 4, then an 8-digit bank code and a 10-digit account number
+	if _, err := NewIBANScheme("DE", "370400", 10); !errors.Is(err, ErrInvalidIBAN) {
+		t.Errorf("expected a bank code too short for German IBANs to be rejected, got %v", err)
+	}
+	if _, err := NewIBANScheme("D1", "37040044", 10); !errors.Is(err, ErrInvalidIBAN) {
+		t.Errorf("expected an invalid country code to be rejected, got %v", err)
+	}
+	if _, err := NewIBANScheme("XK", "12-34", 10); !errors.Is(err, ErrInvalidIBAN) {
+		t.Errorf("expected an invalid bank code to be rejected, got %v", err)
+	}
+	if _, err := NewIBANScheme("XK", "1234", 10); err != nil {
+		t.Errorf("a country without a known length should only be bounded, got %v", err)
+	}
+}
+
+func TestValidateIBAN(t *testing.T) {
+	tests := []struct {
+		iban  string
+		valid bool
+	}{
+		{"GB82WEST12345698765432", true},
+		{"NL91ABNA0417164300", true},
+		{"FR1420041010050500013M02606", true},
+		{"GB82WEST12345698765423", false}, // Swapped digits.
+		{"GB82WEST1234569876543", false},  // Too short for the country.
+		{"gb82WEST12345698765432", false}, // Not normalized.
+		{"GB8AWEST12345698765432", false},
+		{"GB82", false},
+	}
+
+	for _, tt := range tests {
+		err := ValidateIBAN(tt.iban)
+		if tt.valid && err != nil {
+			t.Errorf("%s: expected a valid IBAN, got %v", tt.iban, err)
+		}
+		if !tt.valid && !errors.Is(err, ErrInvalidIBAN) {
+			t.Errorf("%s: expected an invalid IBAN, got %v", tt.iban, err)
+		}
+	}
+}
@@ -0,0 +1,252 @@
+package bank
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// InterestAccount is the internal account that pays the interest capitalized into customer accounts.
+// Capitalization debits it and credits the account, like a deposit does with CashAccount.
+const InterestAccount = "INTEREST"
+
+// ErrInvalidInterestProduct is returned for a product with an unknown day count or badly ordered tiers.
+var ErrInvalidInterestProduct = errors.New("invalid interest product")
+
+// accrualScale is one minor unit in the millionths accruals are kept in,
+// so the interest of a single day isn't lost to rounding.
+const accrualScale = 1000000
+
+// DayCount is the convention that says how many days of interest a period earns out of a year.
+type DayCount string
+
+// Day count conventions.
+const (
+	Actual365 DayCount = "actual/365" // Calendar days out of 365.
+	Thirty360 DayCount = "30/360"     // Every month has 30 days, out of 360.
+)
+
+// ParseDayCount returns the day count convention named s.
+func ParseDayCount(s string) (DayCount, error) {
+	switch d := DayCount(strings.ToLower(s)); d {
+	case Actual365, Thirty360:
+		return d, nil
+	}
+	return "", fmt.Errorf("%w: unknown day count %q", ErrInvalidInterestProduct, s)
+}
+
+// Days returns the days of interest from one date to the other under the convention.
+// With 30/360, the 31st counts as the 30th, so a day that ends on the 31st earns nothing
+// and the last day of February earns up to the 30th.
+func (d DayCount) Days(from, to time.Time) int64 {
+	y1, m1, d1 := from.Date()
+	y2, m2, d2 := to.Date()
+
+	if d == Thirty360 {
+		if d1 == 31 {
+			d1 = 30
+		}
+		if d2 == 31 {
+			d2 = 30
+		}
+		return int64(360*(y2-y1) + 30*(int(m2)-int(m1)) + d2 - d1)
+	}
+
+	start := time.Date(y1, m1, d1, 0, 0, 0, 0, time.UTC)
+	end := time.Date(y2, m2, d2, 0, 0, 0, 0, time.UTC)
+	return int64(end.Sub(start) / (24 * time.Hour))
+}
+
+// YearDays returns the days of a year under the convention.
+func (d DayCount) YearDays() int64 {
+	if d == Thirty360 {
+		return 360
+	}
+	return 365
+}
+
+// InterestTier is a balance band of an interest product.
+type InterestTier struct {
+	From Money // Lowest balance of the band, in the account's currency.
+	Rate int64 // Annual rate in basis points, e.g. 525 for 5.25%.
+}
+
+// ParseInterestRate parses an annual percentage such as "5" or "5.25" into basis points.
+func ParseInterestRate(s string) (int64, error) {
+	rate, err := parseMinor(s)
+	if err != nil || rate < 0 {
+		return 0, fmt.Errorf("%w: rate %q should be a percentage with up to two decimal places", ErrInvalidInterestProduct, s)
+	}
+	return rate, nil
+}
+
+// InterestProduct sets the interest earned by the accounts of a type.
+// Each tier's rate applies to the part of the balance in its band, which runs up to the next tier's From,
+// so a balance that crosses into a higher band only earns the higher rate on what is above it.
+type InterestProduct struct {
+	Type     AccountType
+	DayCount DayCount
+	Tiers    []InterestTier // By ascending From, the first from zero.
+}
+
+// NewInterestProduct returns the interest product of the account type.
+// A product with a single rate has a single tier from zero.
+func NewInterestProduct(accountType AccountType, dayCount DayCount, tiers ...InterestTier) (*InterestProduct, error) {
+	if _, err := ParseDayCount(string(dayCount)); err != nil {
+		return nil, err
+	}
+	if len(tiers) == 0 || !tiers[0].From.IsZero() {
+		return nil, fmt.Errorf("%w: the first tier should start at zero", ErrInvalidInterestProduct)
+	}
+	for i, tier := range tiers {
+		if tier.Rate < 0 {
+			return nil, fmt.Errorf("%w: the rate from %s is negative", ErrInvalidInterestProduct, tier.From)
+		}
+		if i > 0 && tier.From.Amount <= tiers[i-1].From.Amount {
+			return nil, fmt.Errorf("%w: the tier from %s should come after the tier from %s", ErrInvalidInterestProduct, tier.From, tiers[i-1].From)
+		}
+	}
+	return &InterestProduct{Type: accountType, DayCount: dayCount, Tiers: tiers}, nil
+}
+
+// LoadInterestProducts reads interest products, one per line: the account type, the day count
+// and the tiers as "from:rate" pairs with the rate in percent, separated by spaces,
+// such as "savings actual/365 0:2.5 100000:4". Blank lines and lines starting with # are skipped.
+func LoadInterestProducts(r io.Reader) (map[AccountType]*InterestProduct, error) {
+	products := map[AccountType]*InterestProduct{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) < 3 {
+			return nil, fmt.Errorf("%w: line %d should be an account type, a day count and tiers", ErrInvalidInterestProduct, line)
+		}
+		accountType, err := ParseAccountType(fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if _, ok := products[accountType]; ok {
+			return nil, fmt.Errorf("%w: line %d repeats the %s product", ErrInvalidInterestProduct, line, accountType)
+		}
+		dayCount, err := ParseDayCount(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+
+		var tiers []InterestTier
+		for _, field := range fields[2:] {
+			i := strings.IndexByte(field, ':')
+			if i < 0 {
+				return nil, fmt.Errorf("%w: line %d: tier %q should be from:rate", ErrInvalidInterestProduct, line, field)
+			}
+			from, err := ParseMoney(field[:i], "")
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			rate, err := ParseInterestRate(field[i+1:])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", line, err)
+			}
+			tiers = append(tiers, InterestTier{From: from, Rate: rate})
+		}
+
+		product, err := NewInterestProduct(accountType, dayCount, tiers...)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		products[accountType] = product
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return products, nil
+}
+
+// Accrual is the interest an account earned on a business date, kept until it is capitalized.
+type Accrual struct {
+	Account       string
+	Date          time.Time // Business date, at midnight UTC.
+	Balance       Money     // End of day balance the interest was worked out on.
+	Amount        int64     // Interest in millionths of a minor unit of the balance's currency.
+	TransactionID int64     // Transaction that capitalized the accrual, zero until then.
+}
+
+// Accrue works out the interest the account earns on the business date with the end of day balance.
+// Zero and negative balances earn nothing, and neither does a day the day count gives no days to.
+func (p *InterestProduct) Accrue(number string, balance Money, date time.Time) Accrual {
+	y, m, d := date.Date()
+	date = time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	accrual := Accrual{Account: number, Date: date, Balance: balance}
+
+	days := p.DayCount.Days(date, date.AddDate(0, 0, 1))
+	if !balance.IsPositive() || days <= 0 {
+		return accrual
+	}
+
+	// The sum of each band's part of the balance times its rate, in big integers as it can overflow an int64
+	weighted := new(big.Int)
+	for i, tier := range p.Tiers {
+		upper := balance.Amount
+		if i+1 < len(p.Tiers) && p.Tiers[i+1].From.Amount < upper {
+			upper = p.Tiers[i+1].From.Amount
+		}
+		if upper <= tier.From.Amount {
+			break
+		}
+		part := new(big.Int).Mul(big.NewInt(upper-tier.From.Amount), big.NewInt(tier.Rate))
+		weighted.Add(weighted, part)
+	}
+
+	// Basis points over a year: weighted * days * scale / (10000 * year days), rounded down
+	weighted.Mul(weighted, big.NewInt(days*accrualScale))
+	weighted.Quo(weighted, big.NewInt(10000*p.DayCount.YearDays()))
+	accrual.Amount = weighted.Int64()
+	return accrual
+}
+
+// Capitalize credits the account with the total of the accruals, rounded to the nearest minor unit,
+// debits InterestAccount and records the transaction. The interest is paid in like a deposit,
+// so the account must be able to receive money. It returns a nil transaction if there is nothing to pay.
+func (l *Ledger) Capitalize(a *Account, accruals []Accrual) (*Transaction, error) {
+	var total int64
+	for _, accrual := range accruals {
+		if accrual.Account != a.Number {
+			return nil, fmt.Errorf("accrual of account %s can't be capitalized into %s", accrual.Account, a.Number)
+		}
+		total += accrual.Amount
+	}
+
+	amount := NewMoney((total+accrualScale/2)/accrualScale, a.Currency())
+	if !amount.IsPositive() {
+		return nil, nil
+	}
+
+	before := a.Balance
+	if err := a.Deposit(amount); err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{
+		Type:   InterestTransaction,
+		Amount: amount,
+		Entries: []Entry{
+			{Account: InterestAccount, Direction: Debit, Amount: amount},
+			{Account: a.Number, Direction: Credit, Amount: amount, Balance: a.Balance},
+		},
+	}
+	if err := l.post(t); err != nil {
+		a.Balance = before
+		return nil, err
+	}
+	return t, nil
+}
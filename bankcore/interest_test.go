@@ -0,0 +1,148 @@
+package bank
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	d, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		panic(err)
+	}
+	return d
+}
+
+func TestDayCount(t *testing.T) {
+	tests := []struct {
+		dayCount DayCount
+		from, to string
+		days     int64
+	}{
+		{Actual365, "2024-01-31", "2024-02-01", 1},
+		{Actual365, "2024-02-28", "2024-03-01", 2},
+		{Actual365, "2024-01-01", "2025-01-01", 366},
+		{Thirty360, "2024-01-30", "2024-01-31", 0}, // The 31st counts as the 30th.
+		{Thirty360, "2024-01-31", "2024-02-01", 1},
+		{Thirty360, "2023-02-28", "2023-03-01", 3}, // February earns up to the 30th.
+		{Thirty360, "2024-01-01", "2025-01-01", 360},
+	}
+
+	for _, tt := range tests {
+		if got := tt.dayCount.Days(date(tt.from), date(tt.to)); got != tt.days {
+			t.Errorf("%s from %s to %s: expected %d days, got %d", tt.dayCount, tt.from, tt.to, tt.days, got)
+		}
+	}
+
+	// A month of daily accruals is always 30 days under 30/360
+	for _, month := range []string{"2023-02-01", "2024-02-01", "2024-03-01", "2024-04-01"} {
+		var days int64
+		for d := date(month); d.Month() == date(month).Month(); d = d.AddDate(0, 0, 1) {
+			days += Thirty360.Days(d, d.AddDate(0, 0, 1))
+		}
+		if days != 30 {
+			t.Errorf("expected the month of %s to have 30 days, got %d", month, days)
+		}
+	}
+}
+
+func TestInterestProductAccrue(t *testing.T) {
+	flat, err := NewInterestProduct(SavingsAccount, Actual365, InterestTier{Rate: 365})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 3.65% a year of 1,000,000.00 is 100.00 a day
+	accrual := flat.Accrue("0011111111", NewMoney(100000000, "NGN"), date("2024-05-10").Add(15*time.Hour))
+	if accrual.Amount != 10000*accrualScale || !accrual.Date.Equal(date("2024-05-10")) {
+		t.Errorf("expected 100.00 on 2024-05-10, got %d on %s", accrual.Amount, accrual.Date)
+	}
+	if accrual := flat.Accrue("0011111111", NewMoney(-5000, "NGN"), date("2024-05-10")); accrual.Amount != 0 {
+		t.Errorf("expected a negative balance to earn nothing, got %d", accrual.Amount)
+	}
+
+	// 1% up to 100,000.00 and 3.65% above: on 200,000.00, (10000000 * 100 + 10000000 * 365) / 10000 / 365 a day
+	tiered, err := NewInterestProduct(SavingsAccount, Thirty360, InterestTier{Rate: 100}, InterestTier{From: NewMoney(10000000, ""), Rate: 365})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if accrual := tiered.Accrue("0011111111", NewMoney(20000000, "NGN"), date("2024-05-10")); accrual.Amount != 1291666666 {
+		t.Errorf("expected 12.91666666 a day, got %d millionths", accrual.Amount)
+	}
+	if accrual := tiered.Accrue("0011111111", NewMoney(5000000, "NGN"), date("2024-05-10")); accrual.Amount != 138888888 {
+		t.Errorf("expected only the first band's rate below 100,000.00, got %d millionths", accrual.Amount)
+	}
+	if accrual := tiered.Accrue("0011111111", NewMoney(20000000, "NGN"), date("2024-05-30")); accrual.Amount != 0 {
+		t.Errorf("expected the day to the 31st to earn nothing under 30/360, got %d millionths", accrual.Amount)
+	}
+
+	if _, err := NewInterestProduct(SavingsAccount, Actual365, InterestTier{From: NewMoney(100, ""), Rate: 100}); !errors.Is(err, ErrInvalidInterestProduct) {
+		t.Errorf("expected tiers to start at zero, got %v", err)
+	}
+	if _, err := NewInterestProduct(SavingsAccount, Actual365, InterestTier{Rate: 100}, InterestTier{Rate: 200}); !errors.Is(err, ErrInvalidInterestProduct) {
+		t.Errorf("expected tiers in ascending order, got %v", err)
+	}
+	if _, err := NewInterestProduct(SavingsAccount, "actual/actual", InterestTier{Rate: 100}); !errors.Is(err, ErrInvalidInterestProduct) {
+		t.Errorf("expected an unknown day count to be rejected, got %v", err)
+	}
+}
+
+func TestLoadInterestProducts(t *testing.T) {
+	products, err := LoadInterestProducts(strings.NewReader("# savings bands\nsavings actual/365 0:2.5 100000:4\n\ncurrent 30/360 0:0.1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	savings := products[SavingsAccount]
+	if savings == nil || savings.DayCount != Actual365 || len(savings.Tiers) != 2 || savings.Tiers[1].From.Amount != 10000000 || savings.Tiers[1].Rate != 400 {
+		t.Errorf("unexpected savings product %+v", savings)
+	}
+	if current := products[CurrentAccount]; current == nil || current.DayCount != Thirty360 || current.Tiers[0].Rate != 10 {
+		t.Errorf("unexpected current account product %+v", current)
+	}
+
+	for _, text := range []string{"savings actual/365", "savings actual/365 0-2.5", "savings actual/365 0:2.555", "savings 30/365 0:2", "savings 30/360 0:1\nsavings 30/360 0:2"} {
+		if _, err := LoadInterestProducts(strings.NewReader(text)); !errors.Is(err, ErrInvalidInterestProduct) {
+			t.Errorf("%q: expected an invalid product, got %v", text, err)
+		}
+	}
+}
+
+func TestLedgerCapitalize(t *testing.T) {
+	journal := &memJournal{}
+	a := &Account{Number: "0011111111", Type: SavingsAccount, Balance: NewMoney(10000, "NGN")}
+	accruals := []Accrual{
+		{Account: a.Number, Amount: 1500000},
+		{Account: a.Number, Amount: 1500000},
+		{Account: a.Number, Amount: 1500000},
+	}
+
+	// 4.5 kobo is paid as 5
+	tx, err := NewLedger(journal).Capitalize(a, accruals)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance.Amount != 10005 || tx.Type != InterestTransaction || tx.Amount.Amount != 5 {
+		t.Errorf("expected 0.05 of interest, got %s on a balance of %s", tx.Amount, a.Balance)
+	}
+	if !tx.Balanced() || tx.Entries[0].Account != InterestAccount || tx.Entries[1].Balance.Amount != 10005 {
+		t.Errorf("expected the interest account to pay the interest, got %+v", tx.Entries)
+	}
+	if !IsInternal(InterestAccount) {
+		t.Error("expected the interest account to be internal")
+	}
+
+	if tx, err := NewLedger(journal).Capitalize(a, accruals[:0]); tx != nil || err != nil {
+		t.Errorf("expected nothing to pay without accruals, got %v %v", tx, err)
+	}
+
+	a.Status = StatusClosed
+	if _, err := NewLedger(journal).Capitalize(a, accruals); !errors.Is(err, ErrAccountRestricted) {
+		t.Errorf("expected a closed account to refuse interest, got %v", err)
+	}
+	if a.Balance.Amount != 10005 || len(journal.transactions) != 1 {
+		t.Errorf("expected the refused interest to change nothing, got %s and %d transactions", a.Balance, len(journal.transactions))
+	}
+}
@@ -0,0 +1,322 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// CashAccount is the internal account that holds the cash paid in and out over the counter.
+// Deposits debit it and withdrawals credit it, so every customer movement has a balancing entry.
+const CashAccount = "CASH"
+
+// ErrUnbalanced is returned when a transaction's debits and credits don't add up.
+var ErrUnbalanced = errors.New("transaction is not balanced")
+
+// ErrBalanceMismatch is returned when an account balance doesn't match its journal.
+var ErrBalanceMismatch = errors.New("account balance does not match the journal")
+
+// Direction is the side of the ledger an entry is posted to.
+type Direction string
+
+// Ledger entry directions.
+const (
+	Debit  Direction = "debit"
+	Credit Direction = "credit"
+)
+
+// TransactionType identifies the operation that produced a transaction.
+type TransactionType string
+
+// Transaction types.
+const (
+	DepositTransaction    TransactionType = "deposit"
+	WithdrawalTransaction TransactionType = "withdrawal"
+	TransferTransaction   TransactionType = "transfer"
+	InterestTransaction   TransactionType = "interest"
+	FeeTransaction        TransactionType = "fee"        // A fee charged on its own, such as a maintenance fee.
+	AdjustmentTransaction TransactionType = "adjustment" // A manual correction of a balance, see Ledger.Adjust.
+)
+
+// Entry is a single debit or credit line of a transaction.
+type Entry struct {
+	Account   string    // Account number, or an internal account such as CashAccount.
+	Direction Direction // Debit or Credit.
+	Amount    Money     // Always positive.
+	Balance   Money     // Balance of a customer account after the entry. Zero for internal accounts.
+}
+
+// Transaction is a balanced group of entries recorded in the journal.
+type Transaction struct {
+	ID        int64
+	Type      TransactionType
+	Amount    Money
+	Converted Money // Amount credited in the other currency of a transfer between currencies.
+	Rate      *Rate // Exchange rate of a transfer between currencies, nil for any other transaction.
+	Fee       Money // Fee of a withdrawal or transfer, posted as extra entries of the transaction.
+	Entries   []Entry
+	CreatedAt time.Time
+}
+
+// IsInternal reports whether number is one of the bank's own accounts rather than a customer's.
+func IsInternal(number string) bool {
+	return number == CashAccount || number == FXAccount || number == InterestAccount || number == FeeAccount || number == AdjustmentAccount
+}
+
+// Balanced reports whether the sum of debits equals the sum of credits in every currency.
+func (t *Transaction) Balanced() bool {
+	totals := map[string]int64{} // Debits less credits of each currency.
+	for _, e := range t.Entries {
+		if !e.Amount.IsPositive() {
+			return false
+		}
+
+		currency := e.Amount.Currency
+		if currency == "" {
+			currency = DefaultCurrency
+		}
+		switch e.Direction {
+		case Debit:
+			totals[currency] += e.Amount.Amount
+		case Credit:
+			totals[currency] -= e.Amount.Amount
+		default:
+			return false
+		}
+	}
+
+	for _, total := range totals {
+		if total != 0 {
+			return false
+		}
+	}
+	return len(t.Entries) >= 2
+}
+
+// Journal stores posted transactions and returns the entries of an account.
+type Journal interface {
+	// Record persists the transaction and its entries, setting its ID.
+	Record(t *Transaction) error
+	// Entries returns every entry posted to the account, oldest first.
+	Entries(account string) ([]Entry, error)
+}
+
+// Ledger posts a balanced transaction to the journal for every balance change.
+type Ledger struct {
+	journal Journal
+	rates   RateProvider
+	fees    *FeeSchedule
+}
+
+// NewLedger returns a ledger that records into the given journal.
+// It can only transfer between accounts of different currencies once given rates with WithRates.
+func NewLedger(journal Journal) *Ledger {
+	return &Ledger{journal: journal}
+}
+
+// WithRates sets the provider of the exchange rates of transfers between currencies, and returns the ledger.
+func (l *Ledger) WithRates(rates RateProvider) *Ledger {
+	l.rates = rates
+	return l
+}
+
+// WithFees sets the schedule of the fees charged for withdrawals, transfers and maintenance, and returns the ledger.
+// Without one, nothing is charged.
+func (l *Ledger) WithFees(fees *FeeSchedule) *Ledger {
+	l.fees = fees
+	return l
+}
+
+// Deposit credits the account, debits CashAccount and records the transaction.
+func (l *Ledger) Deposit(a *Account, amount Money) (*Transaction, error) {
+	if amount.Currency == "" {
+		amount.Currency = a.Currency()
+	}
+
+	before := a.Balance
+	if err := a.Deposit(amount); err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{
+		Type:   DepositTransaction,
+		Amount: amount,
+		Entries: []Entry{
+			{Account: CashAccount, Direction: Debit, Amount: amount},
+			{Account: a.Number, Direction: Credit, Amount: amount, Balance: a.Balance},
+		},
+	}
+	if err := l.post(t); err != nil {
+		a.Balance = before
+		return nil, err
+	}
+	return t, nil
+}
+
+// Withdraw debits the account, credits CashAccount and records the transaction.
+// The fee of the withdrawal, if any, is charged in the same transaction.
+func (l *Ledger) Withdraw(a *Account, amount Money) (*Transaction, error) {
+	if amount.Currency == "" {
+		amount.Currency = a.Currency()
+	}
+
+	before := a.Balance
+	if err := a.Withdraw(amount); err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{
+		Type:   WithdrawalTransaction,
+		Amount: amount,
+		Entries: []Entry{
+			{Account: a.Number, Direction: Debit, Amount: amount, Balance: a.Balance},
+			{Account: CashAccount, Direction: Credit, Amount: amount},
+		},
+	}
+	if err := l.chargeFee(t, WithdrawalOperation, a); err != nil {
+		a.Balance = before
+		return nil, err
+	}
+	if err := l.post(t); err != nil {
+		a.Balance = before
+		return nil, err
+	}
+	return t, nil
+}
+
+// Transfer debits from, credits to and records the transaction.
+// The amount is in the currency of from. Between accounts of different currencies,
+// the amount is converted at the rate of the ledger's rate provider, see exchange.
+// The fee of the transfer, if any, is charged to from in the same transaction.
+func (l *Ledger) Transfer(from, to *Account, amount Money) (*Transaction, error) {
+	return l.transfer(from, to, amount, false)
+}
+
+// transfer is Transfer, or if sweep is set the sweep that settles from on its closure:
+// it is free of fees and takes the money out of from whatever its status.
+func (l *Ledger) transfer(from, to *Account, amount Money, sweep bool) (*Transaction, error) {
+	if amount.Currency == "" {
+		amount.Currency = from.Currency()
+	}
+	if from.Currency() != to.Currency() {
+		return l.exchange(from, to, amount, sweep)
+	}
+
+	fromBefore, toBefore := from.Balance, to.Balance
+	if err := from.transfer(to, amount, amount, sweep); err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{
+		Type:   TransferTransaction,
+		Amount: amount,
+		Entries: []Entry{
+			{Account: from.Number, Direction: Debit, Amount: amount, Balance: from.Balance},
+			{Account: to.Number, Direction: Credit, Amount: amount, Balance: to.Balance},
+		},
+	}
+	if err := l.chargeTransfer(t, from, sweep); err != nil {
+		from.Balance, to.Balance = fromBefore, toBefore
+		return nil, err
+	}
+	if err := l.post(t); err != nil {
+		from.Balance, to.Balance = fromBefore, toBefore
+		return nil, err
+	}
+	return t, nil
+}
+
+// exchange debits from, credits to with the amount converted to its currency and records the transaction.
+// The exchange goes through FXAccount, which takes the amount in one currency and pays out the other,
+// and the transaction records the rate applied and both amounts.
+func (l *Ledger) exchange(from, to *Account, amount Money, sweep bool) (*Transaction, error) {
+	if l.rates == nil {
+		return nil, fmt.Errorf("%w: %s to %s", ErrRateNotFound, from.Currency(), to.Currency())
+	}
+	rate, err := l.rates.Rate(from.Currency(), to.Currency())
+	if err != nil {
+		return nil, err
+	}
+
+	fromBefore, toBefore := from.Balance, to.Balance
+	converted, err := from.exchange(to, amount, rate, sweep)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Transaction{
+		Type:      TransferTransaction,
+		Amount:    amount,
+		Converted: converted,
+		Rate:      &rate,
+		Entries: []Entry{
+			{Account: from.Number, Direction: Debit, Amount: amount, Balance: from.Balance},
+			{Account: FXAccount, Direction: Credit, Amount: amount},
+			{Account: FXAccount, Direction: Debit, Amount: converted},
+			{Account: to.Number, Direction: Credit, Amount: converted, Balance: to.Balance},
+		},
+	}
+	if err := l.chargeTransfer(t, from, sweep); err != nil {
+		from.Balance, to.Balance = fromBefore, toBefore
+		return nil, err
+	}
+	if err := l.post(t); err != nil {
+		from.Balance, to.Balance = fromBefore, toBefore
+		return nil, err
+	}
+	return t, nil
+}
+
+// chargeTransfer charges from the fee of the transfer, unless it is a sweep.
+func (l *Ledger) chargeTransfer(t *Transaction, from *Account, sweep bool) error {
+	if sweep {
+		return nil
+	}
+	return l.chargeFee(t, TransferOperation, from)
+}
+
+// post checks the transaction is balanced and records it.
+func (l *Ledger) post(t *Transaction) error {
+	if !t.Balanced() {
+		return ErrUnbalanced
+	}
+
+	if err := l.journal.Record(t); err != nil {
+		return fmt.Errorf("record transaction: %v", err)
+	}
+	return nil
+}
+
+// Balance derives a customer account's balance from its journal entries.
+// Credits increase the balance and debits reduce it.
+func (l *Ledger) Balance(number string) (Money, error) {
+	entries, err := l.journal.Entries(number)
+	if err != nil {
+		return Money{}, err
+	}
+
+	balance := Money{}
+	for _, e := range entries {
+		amount := e.Amount
+		if e.Direction == Debit {
+			amount = amount.Neg()
+		}
+		if balance, err = balance.Add(amount); err != nil {
+			return Money{}, err
+		}
+	}
+	return balance, nil
+}
+
+// Verify checks the account's balance against the balance derived from the journal.
+func (l *Ledger) Verify(a *Account) error {
+	balance, err := l.Balance(a.Number)
+	if err != nil {
+		return err
+	}
+
+	if balance.Amount != a.Balance.Amount {
+		return fmt.Errorf("%w: %s has %s, journal has %s", ErrBalanceMismatch, a.Number, a.Balance, balance)
+	}
+	return nil
+}
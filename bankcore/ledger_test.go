@@ -0,0 +1,122 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+// memJournal is an in-memory Journal for tests.
+type memJournal struct {
+	transactions []*Transaction
+	fail         bool
+}
+
+func (j *memJournal) Record(t *Transaction) error {
+	if j.fail {
+		return errors.New("journal unavailable")
+	}
+
+	j.transactions = append(j.transactions, t)
+	t.ID = int64(len(j.transactions))
+	return nil
+}
+
+func (j *memJournal) Entries(account string) ([]Entry, error) {
+	var entries []Entry
+	for _, t := range j.transactions {
+		for _, e := range t.Entries {
+			if e.Account == account {
+				entries = append(entries, e)
+			}
+		}
+	}
+	return entries, nil
+}
+
+func TestLedgerPostsBalancedEntries(t *testing.T) {
+	journal := &memJournal{}
+	ledger := NewLedger(journal)
+
+	a := &Account{Number: "0011111111", Balance: NewMoney(0, DefaultCurrency)}
+	b := &Account{Number: "0012222222", Balance: NewMoney(0, DefaultCurrency)}
+
+	if _, err := ledger.Deposit(a, NewMoney(10000, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ledger.Withdraw(a, NewMoney(2500, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := ledger.Transfer(a, b, NewMoney(1500, DefaultCurrency))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(journal.transactions) != 3 {
+		t.Fatalf("expected 3 journal transactions, got %d", len(journal.transactions))
+	}
+	for _, tx := range journal.transactions {
+		if !tx.Balanced() {
+			t.Errorf("transaction %d is not balanced: %+v", tx.ID, tx.Entries)
+		}
+	}
+
+	if tx.Type != TransferTransaction || tx.Entries[0].Balance.Amount != 6000 || tx.Entries[1].Balance.Amount != 1500 {
+		t.Errorf("unexpected transfer entries: %+v", tx.Entries)
+	}
+
+	for _, acc := range []*Account{a, b} {
+		if err := ledger.Verify(acc); err != nil {
+			t.Error(err)
+		}
+	}
+
+	cash, err := ledger.Balance(CashAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cash.Amount != -7500 {
+		t.Errorf("expected cash account to mirror customer deposits, got %s", cash)
+	}
+}
+
+func TestLedgerRejectedOperationIsNotRecorded(t *testing.T) {
+	journal := &memJournal{}
+	ledger := NewLedger(journal)
+	a := &Account{Number: "0011111111", Balance: NewMoney(100, DefaultCurrency)}
+
+	if _, err := ledger.Withdraw(a, NewMoney(500, DefaultCurrency)); err == nil {
+		t.Error("expected the withdrawal to fail")
+	}
+
+	if len(journal.transactions) != 0 {
+		t.Errorf("a failed withdrawal should not be journaled")
+	}
+}
+
+func TestLedgerJournalFailureRestoresBalances(t *testing.T) {
+	ledger := NewLedger(&memJournal{fail: true})
+	a := &Account{Number: "0011111111", Balance: NewMoney(1000, DefaultCurrency)}
+	b := &Account{Number: "0012222222", Balance: NewMoney(0, DefaultCurrency)}
+
+	if _, err := ledger.Transfer(a, b, NewMoney(400, DefaultCurrency)); err == nil {
+		t.Fatal("expected the transfer to fail")
+	}
+
+	if a.Balance.Amount != 1000 || b.Balance.Amount != 0 {
+		t.Errorf("balances changed after a failed post: %s, %s", a.Balance, b.Balance)
+	}
+}
+
+func TestLedgerVerifyDetectsMismatch(t *testing.T) {
+	ledger := NewLedger(&memJournal{})
+	a := &Account{Number: "0011111111", Balance: NewMoney(0, DefaultCurrency)}
+
+	if _, err := ledger.Deposit(a, NewMoney(1000, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	a.Balance = NewMoney(99999, DefaultCurrency)
+
+	if err := ledger.Verify(a); !errors.Is(err, ErrBalanceMismatch) {
+		t.Errorf("expected ErrBalanceMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,252 @@
+package bank
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency used when none is specified.
+const DefaultCurrency = "NGN"
+
+// ErrCurrencyMismatch is returned when combining amounts of different currencies.
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// ErrInvalidAmount is returned when an amount can't be parsed as money.
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// ErrUnsupportedCurrency is returned for a currency the bank doesn't keep accounts in.
+var ErrUnsupportedCurrency = errors.New("unsupported currency")
+
+// currencies are the ISO 4217 codes of the currencies the bank keeps accounts in.
+var currencies = map[string]bool{"NGN": true, "USD": true, "EUR": true}
+
+// ParseCurrency returns the currency with the code s, in any case, or DefaultCurrency if s is empty.
+func ParseCurrency(s string) (string, error) {
+	if s == "" {
+		return DefaultCurrency, nil
+	}
+
+	code := strings.ToUpper(s)
+	if !currencies[code] {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedCurrency, s)
+	}
+	return code, nil
+}
+
+// Money is an exact amount held as integer minor units (kobo, cents) plus a currency.
+// The zero value has no currency and behaves as zero in any currency.
+type Money struct {
+	Amount   int64  // Amount in minor units, e.g. 1050 for 10.50.
+	Currency string // ISO 4217 code, e.g. "NGN".
+}
+
+// NewMoney returns an amount of minor units in the given currency.
+func NewMoney(minor int64, currency string) Money {
+	return Money{Amount: minor, Currency: currency}
+}
+
+// ParseMoney parses a decimal string such as "10", "10.5" or "-10.50".
+// Amounts with more than two decimal places are rejected.
+func ParseMoney(s string, currency string) (Money, error) {
+	minor, err := parseMinor(s)
+	if err != nil {
+		return Money{}, err
+	}
+
+	return Money{Amount: minor, Currency: currency}, nil
+}
+
+// parseMinor converts a plain decimal string into minor units.
+func parseMinor(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0, ErrInvalidAmount
+	}
+
+	negative := false
+	switch s[0] {
+	case '-':
+		negative = true
+		s = s[1:]
+	case '+':
+		s = s[1:]
+	}
+
+	whole, frac := s, ""
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		whole, frac = s[:i], s[i+1:]
+	}
+
+	if whole == "" && frac == "" {
+		return 0, ErrInvalidAmount
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("%w: more than two decimal places", ErrInvalidAmount)
+	}
+	if !isDigits(whole) || !isDigits(frac) {
+		return 0, ErrInvalidAmount
+	}
+
+	for len(frac) < 2 {
+		frac += "0"
+	}
+	if whole == "" {
+		whole = "0"
+	}
+
+	units, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil || units > (1<<63-1)/100-1 {
+		return 0, fmt.Errorf("%w: out of range", ErrInvalidAmount)
+	}
+	cents, _ := strconv.ParseInt(frac, 10, 64)
+
+	minor := units*100 + cents
+	if negative {
+		minor = -minor
+	}
+	return minor, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// IsZero reports whether the amount is zero.
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+// IsPositive reports whether the amount is greater than zero.
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// IsNegative reports whether the amount is less than zero.
+func (m Money) IsNegative() bool {
+	return m.Amount < 0
+}
+
+// currency returns the currency shared by m and o.
+// An empty currency is compatible with any other.
+func (m Money) currency(o Money) (string, error) {
+	switch {
+	case m.Currency == o.Currency, o.Currency == "":
+		return m.Currency, nil
+	case m.Currency == "":
+		return o.Currency, nil
+	}
+	return "", fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+}
+
+// Add returns m + o.
+func (m Money) Add(o Money) (Money, error) {
+	cur, err := m.currency(o)
+	if err != nil {
+		return Money{}, err
+	}
+
+	sum := m.Amount + o.Amount
+	if (o.Amount > 0 && sum < m.Amount) || (o.Amount < 0 && sum > m.Amount) {
+		return Money{}, errors.New("amount overflow")
+	}
+	return Money{Amount: sum, Currency: cur}, nil
+}
+
+// Sub returns m - o.
+func (m Money) Sub(o Money) (Money, error) {
+	return m.Add(o.Neg())
+}
+
+// Neg returns -m.
+func (m Money) Neg() Money {
+	return Money{Amount: -m.Amount, Currency: m.Currency}
+}
+
+// Cmp compares m and o and returns -1, 0 or +1.
+func (m Money) Cmp(o Money) (int, error) {
+	if _, err := m.currency(o); err != nil {
+		return 0, err
+	}
+
+	switch {
+	case m.Amount < o.Amount:
+		return -1, nil
+	case m.Amount > o.Amount:
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// String formats the amount with two decimal places, e.g. "10.50".
+// The currency is not included.
+func (m Money) String() string {
+	minor := m.Amount
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, minor/100, minor%100)
+}
+
+// MarshalJSON encodes the amount as an exact JSON number, e.g. 10.50.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalJSON decodes a JSON number or string into the amount.
+// The currency is left unchanged.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := strings.Trim(string(data), `"`)
+	minor, err := parseMinor(s)
+	if err != nil {
+		return err
+	}
+
+	m.Amount = minor
+	return nil
+}
+
+// Scan implements sql.Scanner so a DECIMAL column can be read into Money.
+// The currency defaults to DefaultCurrency when unset.
+func (m *Money) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case nil:
+		s = "0"
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case int64:
+		s = strconv.FormatInt(v, 10)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	default:
+		return fmt.Errorf("cannot scan %T into Money", src)
+	}
+
+	minor, err := parseMinor(s)
+	if err != nil {
+		return fmt.Errorf("scan money %q: %v", s, err)
+	}
+
+	m.Amount = minor
+	if m.Currency == "" {
+		m.Currency = DefaultCurrency
+	}
+	return nil
+}
+
+// Value implements driver.Valuer so Money can be written to a DECIMAL column.
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
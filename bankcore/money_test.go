@@ -0,0 +1,90 @@
+package bank
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		in   string
+		want int64
+	}{
+		{"10", 1000},
+		{"10.5", 1050},
+		{"10.50", 1050},
+		{"0.01", 1},
+		{".5", 50},
+		{"-10", -1000},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseMoney(tt.in, DefaultCurrency)
+		if err != nil {
+			t.Errorf("ParseMoney(%q): %v", tt.in, err)
+			continue
+		}
+		if got.Amount != tt.want || got.Currency != DefaultCurrency {
+			t.Errorf("ParseMoney(%q) = %+v, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseMoneyInvalid(t *testing.T) {
+	for _, in := range []string{"", "abc", "1e5", "10.505", "0.001", "1.2.3", "-", ".", "99999999999999999999"} {
+		if _, err := ParseMoney(in, DefaultCurrency); !errors.Is(err, ErrInvalidAmount) {
+			t.Errorf("ParseMoney(%q) should fail with ErrInvalidAmount, got %v", in, err)
+		}
+	}
+}
+
+func TestMoneyNoDrift(t *testing.T) {
+	balance := NewMoney(0, DefaultCurrency)
+	cent := NewMoney(1, DefaultCurrency)
+
+	for i := 0; i < 10000; i++ {
+		balance, _ = balance.Add(cent)
+	}
+
+	if balance.String() != "100.00" {
+		t.Errorf("expected 100.00 after 10000 one-cent deposits, got %s", balance)
+	}
+}
+
+func TestMoneyCurrencyMismatch(t *testing.T) {
+	_, err := NewMoney(100, "NGN").Add(NewMoney(100, "USD"))
+	if !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("expected ErrCurrencyMismatch, got %v", err)
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	b, err := json.Marshal(struct{ Balance Money }{NewMoney(-1005, DefaultCurrency)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(b) != `{"Balance":-10.05}` {
+		t.Errorf("unexpected JSON: %s", b)
+	}
+
+	var v struct{ Balance Money }
+	if err := json.Unmarshal(b, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.Balance.Amount != -1005 {
+		t.Errorf("unexpected amount after round trip: %d", v.Balance.Amount)
+	}
+}
+
+func TestMoneyScan(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("123.40")); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Amount != 12340 || m.Currency != DefaultCurrency {
+		t.Errorf("unexpected scanned value: %+v", m)
+	}
+}
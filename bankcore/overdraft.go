@@ -0,0 +1,49 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrOverdraftLimitExceeded is returned when a withdrawal or transfer would take an account
+// with an arranged overdraft below minus its limit. Accounts without one get ErrInsufficientFunds.
+var ErrOverdraftLimitExceeded = errors.New("overdraft limit exceeded")
+
+// SetOverdraft arranges an overdraft of up to limit on the account, or removes it with a zero limit.
+// The limit can't be lowered below what the account already uses of it, holds included.
+func (a *Account) SetOverdraft(limit Money) error {
+	if limit.IsNegative() {
+		return &accountError{"the overdraft limit should not be negative", ErrNonPositiveAmount}
+	}
+	if err := a.checkCurrency(limit); err != nil {
+		return err
+	}
+
+	if used := a.Held.Amount - a.Balance.Amount; used > limit.Amount {
+		return &accountError{fmt.Sprintf("account %s already uses %s of its overdraft", a.Number, Money{Amount: used}), ErrOverdraftLimitExceeded}
+	}
+
+	a.Overdraft = Money{Amount: limit.Amount, Currency: a.Currency()}
+	return nil
+}
+
+// OverdraftUsed returns how much of its overdraft the account uses: minus its balance if it is negative, zero otherwise.
+func (a *Account) OverdraftUsed() Money {
+	if a.Balance.IsNegative() {
+		return a.Balance.Neg()
+	}
+	return NewMoney(0, a.Currency())
+}
+
+// checkFunds returns an error unless the account can go down to the balance
+// without dipping into its held money beyond its overdraft limit.
+// msg is the message of the error of an account without an overdraft.
+func (a *Account) checkFunds(balance Money, msg string) error {
+	if balance.Amount-a.Held.Amount >= -a.Overdraft.Amount {
+		return nil
+	}
+	if a.Overdraft.IsPositive() {
+		return &accountError{fmt.Sprintf("the amount would exceed the overdraft limit of %s of account %s", a.Overdraft, a.Number), ErrOverdraftLimitExceeded}
+	}
+	return &accountError{msg, ErrInsufficientFunds}
+}
@@ -0,0 +1,59 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOverdraft(t *testing.T) {
+	a := &Account{Number: "0011111111", Balance: NewMoney(1000, DefaultCurrency)}
+	other := &Account{Number: "0012222222", Balance: NewMoney(0, DefaultCurrency)}
+
+	if err := a.Withdraw(NewMoney(1500, DefaultCurrency)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected insufficient funds without an overdraft, got %v", err)
+	}
+
+	if err := a.SetOverdraft(NewMoney(5000, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	if a.Available().Amount != 6000 {
+		t.Errorf("expected the overdraft to be available, got %s", a.Available())
+	}
+
+	if err := a.Withdraw(NewMoney(4000, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Transfer(other, NewMoney(2000, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	if a.Balance.Amount != -5000 || a.OverdraftUsed().Amount != 5000 {
+		t.Errorf("expected the whole overdraft to be used, got a balance of %s", a.Balance)
+	}
+
+	if err := a.Withdraw(NewMoney(1, DefaultCurrency)); !errors.Is(err, ErrOverdraftLimitExceeded) || errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected the overdraft limit to be exceeded, got %v", err)
+	}
+	if err := a.Transfer(other, NewMoney(1, DefaultCurrency)); !errors.Is(err, ErrOverdraftLimitExceeded) {
+		t.Errorf("expected the overdraft limit to be exceeded, got %v", err)
+	}
+	if _, err := a.PlaceHold(NewMoney(1, DefaultCurrency), "card payment"); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("expected no money left to hold, got %v", err)
+	}
+
+	if err := a.SetOverdraft(NewMoney(4000, DefaultCurrency)); !errors.Is(err, ErrOverdraftLimitExceeded) || a.Overdraft.Amount != 5000 {
+		t.Errorf("expected the limit not to go below the overdraft used, got %v", err)
+	}
+	if err := a.SetOverdraft(NewMoney(-1, DefaultCurrency)); !errors.Is(err, ErrNonPositiveAmount) {
+		t.Errorf("expected a negative limit to be refused, got %v", err)
+	}
+
+	if err := a.Deposit(NewMoney(5000, DefaultCurrency)); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.SetOverdraft(NewMoney(0, DefaultCurrency)); err != nil {
+		t.Errorf("expected the overdraft to be removable once repaid, got %v", err)
+	}
+	if !a.OverdraftUsed().IsZero() {
+		t.Errorf("expected no overdraft used, got %s", a.OverdraftUsed())
+	}
+}
@@ -0,0 +1,63 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Role is what a caller of the bank acts as, which decides what it is permitted to do.
+type Role string
+
+// Roles of the bank's customers and staff.
+const (
+	RoleCustomer Role = "customer" // Moves their own money, on their own accounts only.
+	RoleTeller   Role = "teller"   // Serves customers at the counter: onboards them and handles cash on any account.
+	RoleAdmin    Role = "admin"    // Does everything, including freezing accounts and adjusting balances.
+	RoleAuditor  Role = "auditor"  // Reads everything, including the audit log, and changes nothing.
+	RoleApprover Role = "approver" // Approves or rejects the operations others requested over the approval limits.
+)
+
+// Roles lists every role.
+var Roles = []Role{RoleCustomer, RoleTeller, RoleAdmin, RoleAuditor, RoleApprover}
+
+// ErrUnknownRole is returned for a role other than those of Roles.
+var ErrUnknownRole = errors.New("unknown role")
+
+// ParseRole returns the role named s.
+func ParseRole(s string) (Role, error) {
+	for _, r := range Roles {
+		if Role(s) == r {
+			return r, nil
+		}
+	}
+	return "", fmt.Errorf("%w %q", ErrUnknownRole, s)
+}
+
+// Permission is an operation a role can be permitted to do.
+type Permission string
+
+// Permissions of the bank's operations.
+const (
+	PermReadAccounts    Permission = "accounts:read"      // Read accounts, their transactions, statements, holds and status changes.
+	PermOpenAccounts    Permission = "accounts:open"      // Open an account for an existing customer.
+	PermManageAccounts  Permission = "accounts:manage"    // Freeze, unfreeze, blacklist and close accounts, place and release holds, set overdrafts.
+	PermReadCustomers   Permission = "customers:read"     // Read customers' details.
+	PermCreateCustomers Permission = "customers:create"   // Onboard new customers.
+	PermUpdateCustomers Permission = "customers:update"   // Change customers' details and logins.
+	PermDeposit         Permission = "money:deposit"      // Pay cash into an account.
+	PermWithdraw        Permission = "money:withdraw"     // Pay cash out of an account.
+	PermTransfer        Permission = "money:transfer"     // Move money between accounts.
+	PermAdjustBalances  Permission = "money:adjust"       // Correct an account's balance with a manual adjustment.
+	PermApprove         Permission = "operations:approve" // Approve or reject the operations others requested over the approval limits.
+	PermReadAudit       Permission = "audit:read"         // Read the audit log of every change made.
+)
+
+// DefaultPermissions are the permissions of each role when the bank's database is created.
+// The database holds the permissions in force, which can be changed there.
+var DefaultPermissions = map[Role][]Permission{
+	RoleCustomer: {PermReadAccounts, PermOpenAccounts, PermReadCustomers, PermUpdateCustomers, PermWithdraw, PermTransfer},
+	RoleTeller:   {PermReadAccounts, PermOpenAccounts, PermReadCustomers, PermCreateCustomers, PermUpdateCustomers, PermDeposit, PermWithdraw},
+	RoleAdmin:    {PermReadAccounts, PermOpenAccounts, PermManageAccounts, PermReadCustomers, PermCreateCustomers, PermUpdateCustomers, PermDeposit, PermWithdraw, PermTransfer, PermAdjustBalances, PermApprove, PermReadAudit},
+	RoleAuditor:  {PermReadAccounts, PermReadCustomers, PermReadAudit},
+	RoleApprover: {PermReadAccounts, PermReadCustomers, PermApprove},
+}
@@ -0,0 +1,22 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseRole(t *testing.T) {
+	for _, r := range Roles {
+		if parsed, err := ParseRole(string(r)); err != nil || parsed != r {
+			t.Errorf("expected %q, got %q %v", r, parsed, err)
+		}
+		if len(DefaultPermissions[r]) == 0 {
+			t.Errorf("expected %q to have default permissions", r)
+		}
+	}
+	for _, s := range []string{"", "Admin", "superuser"} {
+		if _, err := ParseRole(s); !errors.Is(err, ErrUnknownRole) {
+			t.Errorf("%q: expected an unknown role, got %v", s, err)
+		}
+	}
+}
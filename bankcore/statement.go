@@ -0,0 +1,102 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrInvalidPeriod is returned when a statement period ends before it starts.
+var ErrInvalidPeriod = errors.New("the statement period should end after it starts")
+
+// StatementLine is one transaction on an account statement.
+type StatementLine struct {
+	ID           int64           `json:"-"`
+	Type         TransactionType // deposit, withdrawal or transfer.
+	Direction    Direction       // credit (money in) or debit (money out).
+	Amount       Money
+	Counterparty string `json:",omitempty"`      // The other account of a transfer.
+	Balance      Money  `json:"Running Balance"` // Balance of the account after the transaction.
+	Date         time.Time
+}
+
+// signed returns the line's amount as it affects the balance: positive for credits, negative for debits.
+func (l StatementLine) signed() Money {
+	if l.Direction == Debit {
+		return l.Amount.Neg()
+	}
+	return l.Amount
+}
+
+// PeriodStatement is an account's activity over a period: the opening balance,
+// every transaction with its running balance, the totals and the closing balance.
+type PeriodStatement struct {
+	From           time.Time       `json:"From"`
+	To             time.Time       `json:"To"`
+	OpeningBalance Money           `json:"Opening Balance"`
+	Lines          []StatementLine `json:"Transactions"`
+	TotalCredits   Money           `json:"Total Credits"`
+	TotalDebits    Money           `json:"Total Debits"`
+	ClosingBalance Money           `json:"Closing Balance"`
+	OverdraftUsed  *Money          `json:"Overdraft Used,omitempty"` // Most of the overdraft used at any time, if the balance went below zero.
+}
+
+// NewPeriodStatement works out the totals, closing balance and overdraft usage of a period from its opening
+// balance and lines, oldest first. It returns an error if a line's running balance doesn't
+// follow from the lines before it.
+func NewPeriodStatement(from, to time.Time, opening Money, lines []StatementLine) (*PeriodStatement, error) {
+	if to.Before(from) {
+		return nil, ErrInvalidPeriod
+	}
+
+	s := &PeriodStatement{
+		From:           from,
+		To:             to,
+		OpeningBalance: opening,
+		Lines:          lines,
+		TotalCredits:   NewMoney(0, opening.Currency),
+		TotalDebits:    NewMoney(0, opening.Currency),
+	}
+	if s.Lines == nil {
+		s.Lines = []StatementLine{}
+	}
+
+	balance, lowest := opening, opening
+	var err error
+	for _, l := range lines {
+		if l.Direction == Debit {
+			s.TotalDebits, err = s.TotalDebits.Add(l.Amount)
+		} else {
+			s.TotalCredits, err = s.TotalCredits.Add(l.Amount)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if balance, err = balance.Add(l.signed()); err != nil {
+			return nil, err
+		}
+		if balance.Amount != l.Balance.Amount {
+			return nil, fmt.Errorf("%w: running balance %s on %s, expected %s", ErrBalanceMismatch, l.Balance, l.Date.Format("2006-01-02"), balance)
+		}
+		if balance.Amount < lowest.Amount {
+			lowest = balance
+		}
+	}
+
+	s.ClosingBalance = balance
+	if lowest.IsNegative() {
+		used := lowest.Neg()
+		s.OverdraftUsed = &used
+	}
+	return s, nil
+}
+
+// OpeningFromLines returns the balance an account had before the first of the given lines,
+// oldest first, as implied by that line's running balance.
+func OpeningFromLines(lines []StatementLine) (Money, error) {
+	if len(lines) == 0 {
+		return Money{}, errors.New("no lines to derive the opening balance from")
+	}
+	return lines[0].Balance.Sub(lines[0].signed())
+}
@@ -0,0 +1,100 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func statementLines() []StatementLine {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	return []StatementLine{
+		{Type: DepositTransaction, Direction: Credit, Amount: NewMoney(5000, DefaultCurrency), Balance: NewMoney(15000, DefaultCurrency), Date: day},
+		{Type: WithdrawalTransaction, Direction: Debit, Amount: NewMoney(2000, DefaultCurrency), Balance: NewMoney(13000, DefaultCurrency), Date: day.AddDate(0, 0, 1)},
+		{Type: TransferTransaction, Direction: Debit, Amount: NewMoney(500, DefaultCurrency), Balance: NewMoney(12500, DefaultCurrency), Date: day.AddDate(0, 0, 2), Counterparty: "0012222222"},
+	}
+}
+
+func TestNewPeriodStatement(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+
+	s, err := NewPeriodStatement(from, to, NewMoney(10000, DefaultCurrency), statementLines())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.TotalCredits.String() != "50.00" || s.TotalDebits.String() != "25.00" {
+		t.Errorf("unexpected totals: credits %s, debits %s", s.TotalCredits, s.TotalDebits)
+	}
+	if s.ClosingBalance.String() != "125.00" {
+		t.Errorf("unexpected closing balance: %s", s.ClosingBalance)
+	}
+}
+
+func TestNewPeriodStatementOverdraft(t *testing.T) {
+	from := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+
+	s, err := NewPeriodStatement(from, to, NewMoney(10000, DefaultCurrency), statementLines())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.OverdraftUsed != nil {
+		t.Errorf("a period in credit should use no overdraft, got %s", s.OverdraftUsed)
+	}
+
+	// The same lines from 150.00 lower dip to -20.00 on the withdrawal
+	lines := statementLines()
+	for i := range lines {
+		lines[i].Balance.Amount -= 15000
+	}
+	s, err = NewPeriodStatement(from, to, NewMoney(-5000, DefaultCurrency), lines)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.OverdraftUsed == nil || s.OverdraftUsed.String() != "50.00" {
+		t.Errorf("expected the opening overdraft of 50.00 to be the most used, got %v", s.OverdraftUsed)
+	}
+}
+
+func TestNewPeriodStatementNoLines(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	s, err := NewPeriodStatement(day, day, NewMoney(700, DefaultCurrency), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.ClosingBalance != s.OpeningBalance || len(s.Lines) != 0 {
+		t.Errorf("an empty period should close at its opening balance: %+v", s)
+	}
+}
+
+func TestNewPeriodStatementBrokenRunningBalance(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := NewPeriodStatement(day, day.AddDate(0, 1, 0), NewMoney(9999, DefaultCurrency), statementLines())
+	if !errors.Is(err, ErrBalanceMismatch) {
+		t.Errorf("expected ErrBalanceMismatch, got %v", err)
+	}
+}
+
+func TestNewPeriodStatementInvalidPeriod(t *testing.T) {
+	day := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	if _, err := NewPeriodStatement(day, day.AddDate(0, 0, -1), Money{}, nil); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("expected ErrInvalidPeriod, got %v", err)
+	}
+}
+
+func TestOpeningFromLines(t *testing.T) {
+	opening, err := OpeningFromLines(statementLines())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if opening.String() != "100.00" {
+		t.Errorf("unexpected opening balance: %s", opening)
+	}
+}
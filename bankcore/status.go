@@ -0,0 +1,110 @@
+package bank
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// AccountStatus says which operations an account allows.
+type AccountStatus string
+
+// Account statuses. An account without a status is active.
+const (
+	StatusActive      AccountStatus = "active"      // Everything is allowed.
+	StatusInactive    AccountStatus = "inactive"    // Frozen: the account can receive money but not send it.
+	StatusBlacklisted AccountStatus = "blacklisted" // No money moves in or out.
+	StatusClosed      AccountStatus = "closed"      // No money moves in or out, for good.
+)
+
+// Errors of account status checks and changes, matched with errors.Is.
+var (
+	ErrAccountRestricted   = errors.New("account status does not allow the operation")
+	ErrInvalidStatusChange = errors.New("invalid account status change")
+	ErrBalanceNotZero      = errors.New("account balance is not zero")
+)
+
+// statusChanges lists the statuses each status can change to. Closed is final.
+var statusChanges = map[AccountStatus][]AccountStatus{
+	StatusActive:      {StatusInactive, StatusBlacklisted, StatusClosed},
+	StatusInactive:    {StatusActive, StatusBlacklisted, StatusClosed},
+	StatusBlacklisted: {StatusActive, StatusInactive, StatusClosed},
+}
+
+// ParseAccountStatus returns the account status named s.
+func ParseAccountStatus(s string) (AccountStatus, error) {
+	switch st := AccountStatus(s); st {
+	case StatusActive, StatusInactive, StatusBlacklisted, StatusClosed:
+		return st, nil
+	}
+	return "", fmt.Errorf("%w: unknown status %q", ErrInvalidStatusChange, s)
+}
+
+// CanSend reports whether money can leave an account with the status.
+func (s AccountStatus) CanSend() bool {
+	return s == "" || s == StatusActive
+}
+
+// CanReceive reports whether money can be paid into an account with the status.
+func (s AccountStatus) CanReceive() bool {
+	return s == "" || s == StatusActive || s == StatusInactive
+}
+
+// CanChangeTo reports whether an account with the status can be given the other one.
+func (s AccountStatus) CanChangeTo(to AccountStatus) bool {
+	if s == "" {
+		s = StatusActive
+	}
+	for _, allowed := range statusChanges[s] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// StatusChange records an account moving from one status to another, and why.
+type StatusChange struct {
+	From      AccountStatus
+	To        AccountStatus
+	Reason    string
+	CreatedAt time.Time
+}
+
+// ChangeStatus moves the account to the status, returning the change to record.
+// Closing an account requires a zero balance and no pending holds.
+func (a *Account) ChangeStatus(to AccountStatus, reason string) (*StatusChange, error) {
+	from := a.Status
+	if from == "" {
+		from = StatusActive
+	}
+
+	if !from.CanChangeTo(to) {
+		return nil, &accountError{fmt.Sprintf("account %s is %s and cannot become %s", a.Number, from, to), ErrInvalidStatusChange}
+	}
+	if to == StatusClosed && a.Held.IsPositive() {
+		return nil, &accountError{fmt.Sprintf("account %s has %s on hold and cannot be closed", a.Number, a.Held), ErrPendingHolds}
+	}
+	if to == StatusClosed && !a.Balance.IsZero() {
+		return nil, &accountError{fmt.Sprintf("account %s has a balance of %s and cannot be closed", a.Number, a.Balance), ErrBalanceNotZero}
+	}
+
+	a.Status = to
+	return &StatusChange{From: from, To: to, Reason: reason, CreatedAt: time.Now().UTC()}, nil
+}
+
+// canSend returns an error unless money can leave the account.
+func (a *Account) canSend() error {
+	if !a.Status.CanSend() {
+		return &accountError{fmt.Sprintf("account %s is %s and cannot send money", a.Number, a.Status), ErrAccountRestricted}
+	}
+	return nil
+}
+
+// canReceive returns an error unless money can be paid into the account.
+func (a *Account) canReceive() error {
+	if !a.Status.CanReceive() {
+		return &accountError{fmt.Sprintf("account %s is %s and cannot receive money", a.Number, a.Status), ErrAccountRestricted}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package bank
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestStatusRules(t *testing.T) {
+	tests := []struct {
+		status             AccountStatus
+		deposit, withdraw  bool
+		sendTransfer, recv bool
+	}{
+		{"", true, true, true, true},
+		{StatusActive, true, true, true, true},
+		{StatusInactive, true, false, false, true},
+		{StatusBlacklisted, false, false, false, false},
+		{StatusClosed, false, false, false, false},
+	}
+
+	for _, tt := range tests {
+		a := &Account{Number: "0001", Status: tt.status, Balance: NewMoney(10000, DefaultCurrency)}
+		other := &Account{Number: "0002", Balance: NewMoney(10000, DefaultCurrency)}
+		amount := NewMoney(100, DefaultCurrency)
+
+		check := func(op string, err error, allowed bool) {
+			if allowed && err != nil {
+				t.Errorf("%q: %s should be allowed, got %v", tt.status, op, err)
+			}
+			if !allowed && !errors.Is(err, ErrAccountRestricted) {
+				t.Errorf("%q: %s should be restricted, got %v", tt.status, op, err)
+			}
+		}
+		check("deposit", a.Deposit(amount), tt.deposit)
+		check("withdrawal", a.Withdraw(amount), tt.withdraw)
+		check("outgoing transfer", a.Transfer(other, amount), tt.sendTransfer)
+		check("incoming transfer", other.Transfer(a, amount), tt.recv)
+	}
+}
+
+func TestChangeStatus(t *testing.T) {
+	a := &Account{Number: "0001", Balance: NewMoney(0, DefaultCurrency)}
+
+	change, err := a.ChangeStatus(StatusInactive, "suspicious activity")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Status != StatusInactive || change.From != StatusActive || change.To != StatusInactive || change.Reason != "suspicious activity" {
+		t.Errorf("unexpected change: %+v", change)
+	}
+
+	if _, err := a.ChangeStatus(StatusInactive, "again"); !errors.Is(err, ErrInvalidStatusChange) {
+		t.Errorf("expected an invalid status change, got %v", err)
+	}
+
+	a.Balance = NewMoney(100, DefaultCurrency)
+	if _, err := a.ChangeStatus(StatusClosed, "customer request"); !errors.Is(err, ErrBalanceNotZero) || a.Status != StatusInactive {
+		t.Errorf("expected a non-zero balance to block the closure, got %v", err)
+	}
+
+	a.Balance = NewMoney(0, DefaultCurrency)
+	if _, err := a.ChangeStatus(StatusClosed, "customer request"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := a.ChangeStatus(StatusActive, "reopen"); !errors.Is(err, ErrInvalidStatusChange) {
+		t.Errorf("a closed account should stay closed, got %v", err)
+	}
+
+	if _, err := ParseAccountStatus("frozen"); err == nil {
+		t.Error("expected an unknown status to be rejected")
+	}
+}
@@ -2,45 +2,126 @@ package db
 
 import (
 	"database/sql"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
 
 	"github.com/go-sql-driver/mysql"
 	"github.com/joho/godotenv"
+	_ "modernc.org/sqlite"
+)
+
+// Storage drivers accepted in Config.Driver.
+const (
+	MySQL  = "mysql"
+	SQLite = "sqlite"
+	Memory = "memory"
 )
 
 var DB *sql.DB
 
-func Connect() {
+// Config selects the storage backend and how to reach it.
+type Config struct {
+	Driver string       // MySQL, SQLite or Memory. Empty means MySQL.
+	MySQL  mysql.Config // Connection properties of the MySQL server.
+	Path   string       // SQLite database file, or ":memory:" for a database that lives as long as the store.
+
+	// Schema holds the migrations of every dialect, one directory per driver
+	// (bankapi/db/migrations). When set, Open migrates SQLite databases in memory.
+	Schema fs.FS
+}
+
+// LoadConfig reads the storage configuration from .env and the environment.
+func LoadConfig() Config {
 	godotenv.Load(".env")
 
-	// Capture connection properties.
-	cfg := mysql.Config{
-		User:   os.Getenv("DBUSER"),
-		Passwd: os.Getenv("DBPASS"),
-		Net:    "tcp",
-		Addr:   "127.0.0.1:3306",
-		DBName: os.Getenv("DB"),
+	return Config{
+		Driver: os.Getenv("DBDRIVER"),
+		MySQL: mysql.Config{
+			User:   os.Getenv("DBUSER"),
+			Passwd: os.Getenv("DBPASS"),
+			Net:    "tcp",
+			Addr:   "127.0.0.1:3306",
+			DBName: os.Getenv("DB"),
+		},
+		Path: os.Getenv("DBPATH"),
 	}
-
-	// Get a database handle.
-	process(&cfg)
 }
 
-func ConnectTesting() {
+// LoadTestingConfig reads the storage configuration of the test database from .env.testing and the environment.
+func LoadTestingConfig() Config {
 	godotenv.Load(".env.testing")
 
-	// Capture connection properties.
-	cfg := mysql.Config{
-		User:   os.Getenv("DBTESTUSER"),
-		Passwd: os.Getenv("DBTESTPASS"),
-		Net:    "tcp",
-		Addr:   "127.0.0.1:3306",
-		DBName: os.Getenv("DBTEST"),
+	return Config{
+		Driver: os.Getenv("DBTESTDRIVER"),
+		MySQL: mysql.Config{
+			User:   os.Getenv("DBTESTUSER"),
+			Passwd: os.Getenv("DBTESTPASS"),
+			Net:    "tcp",
+			Addr:   "127.0.0.1:3306",
+			DBName: os.Getenv("DBTEST"),
+		},
+		Path: os.Getenv("DBTESTPATH"),
 	}
+}
+
+// Open connects to the configured backend and returns its store.
+func Open(cfg Config) (Store, error) {
+	switch cfg.Driver {
+	case "", MySQL:
+		conn, err := sql.Open("mysql", cfg.MySQL.FormatDSN())
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.Ping(); err != nil {
+			return nil, err
+		}
+		return NewMySQLStore(conn), nil
+
+	case SQLite:
+		if cfg.Path == "" {
+			return nil, fmt.Errorf("no SQLite database file configured")
+		}
+		conn, err := sql.Open("sqlite", cfg.Path+"?_pragma=foreign_keys(1)")
+		if err != nil {
+			return nil, err
+		}
+		if err := conn.Ping(); err != nil {
+			return nil, err
+		}
+
+		store := NewSQLiteStore(conn)
+		if cfg.Schema != nil && cfg.Path == ":memory:" {
+			// A database in memory always starts empty, so it is migrated straight away.
+			m, err := NewMigrator(store, cfg.Schema)
+			if err != nil {
+				return nil, err
+			}
+			if err := m.Up(); err != nil {
+				return nil, err
+			}
+		}
+		return store, nil
+
+	case Memory:
+		return NewMemoryStore(), nil
+	}
+	return nil, fmt.Errorf("unknown database driver %q", cfg.Driver)
+}
+
+func Connect() {
+	cfg := LoadConfig()
+
+	// Get a database handle.
+	process(&cfg.MySQL)
+}
+
+func ConnectTesting() {
+	cfg := LoadTestingConfig()
 
 	// Get a database handle.
-	process(&cfg)
+	process(&cfg.MySQL)
 }
 
 func process(cfg *mysql.Config) {
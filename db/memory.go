@@ -0,0 +1,829 @@
+package db
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/themobileprof/bank"
+)
+
+// MemoryStore is a Store that keeps everything in memory.
+// It needs no database server, which makes it handy for tests and demos.
+// Transactions are serialized: Atomic holds a lock for the whole of fn,
+// and restores a snapshot of the data if fn fails.
+type MemoryStore struct {
+	mu   *sync.Mutex
+	data *memoryData
+	inTx bool // The lock is already held by Atomic.
+}
+
+// memoryAccount is a row of the "accounts" table.
+type memoryAccount struct {
+	id          int64
+	customerID  int64
+	number      string
+	accountType bank.AccountType
+	status      bank.AccountStatus
+	balance     bank.Money
+	overdraft   bank.Money
+}
+
+// memoryEntry is a row of the "ledger_entries" table.
+type memoryEntry struct {
+	id    int64
+	tx    *bank.Transaction
+	entry bank.Entry
+}
+
+// memoryStatusChange is a row of the "account_status_changes" table.
+type memoryStatusChange struct {
+	number string
+	change bank.StatusChange
+}
+
+// memoryFee is a row of the "maintenance_fees" table.
+type memoryFee struct {
+	number        string
+	month         string
+	transactionID int64
+}
+
+// memoryHold is a row of the "account_holds" table.
+type memoryHold struct {
+	hold     bank.Hold
+	released bool
+}
+
+type memoryData struct {
+	customers     []bank.Customer // customers[id-1] is the customer with that ID.
+	accounts      map[string]*memoryAccount
+	transactions  []*bank.Transaction
+	entries       []memoryEntry
+	statusChanges []memoryStatusChange
+	holds         []memoryHold // holds[id-1] is the hold with that ID.
+	closures      map[string]bank.ClosingStatement
+	accruals      []bank.Accrual
+	fees          []memoryFee
+	requests      map[string]IdempotentRequest
+	apiKeys       []APIKey // apiKeys[id-1] is the key with that ID.
+	logins        map[int64]Login
+	permissions   map[bank.Role][]bank.Permission
+	operations    []bank.PendingOperation // operations[id-1] is the operation with that ID.
+	audit         []AuditEntry            // audit[id-1] is the entry with that ID.
+}
+
+// clone returns a copy of the data that shares nothing mutable with d.
+func (d *memoryData) clone() *memoryData {
+	c := &memoryData{
+		customers:     append([]bank.Customer(nil), d.customers...),
+		accounts:      make(map[string]*memoryAccount, len(d.accounts)),
+		transactions:  append([]*bank.Transaction(nil), d.transactions...),
+		entries:       append([]memoryEntry(nil), d.entries...),
+		statusChanges: append([]memoryStatusChange(nil), d.statusChanges...),
+		holds:         append([]memoryHold(nil), d.holds...),
+		closures:      make(map[string]bank.ClosingStatement, len(d.closures)),
+		accruals:      append([]bank.Accrual(nil), d.accruals...),
+		fees:          append([]memoryFee(nil), d.fees...),
+		requests:      make(map[string]IdempotentRequest, len(d.requests)),
+		apiKeys:       append([]APIKey(nil), d.apiKeys...),
+		logins:        make(map[int64]Login, len(d.logins)),
+		permissions:   make(map[bank.Role][]bank.Permission, len(d.permissions)),
+		operations:    append([]bank.PendingOperation(nil), d.operations...),
+		audit:         append([]AuditEntry(nil), d.audit...),
+	}
+	for role, permissions := range d.permissions {
+		c.permissions[role] = append([]bank.Permission(nil), permissions...)
+	}
+	for id, l := range d.logins {
+		c.logins[id] = l
+	}
+	for key, r := range d.requests {
+		c.requests[key] = r
+	}
+	for number, closure := range d.closures {
+		c.closures[number] = closure
+	}
+	for number, a := range d.accounts {
+		copied := *a
+		c.accounts[number] = &copied
+	}
+	return c
+}
+
+// NewMemoryStore returns an empty in-memory store, whose roles have the default permissions.
+func NewMemoryStore() *MemoryStore {
+	d := &memoryData{accounts: map[string]*memoryAccount{}, closures: map[string]bank.ClosingStatement{}, requests: map[string]IdempotentRequest{}, logins: map[int64]Login{}, permissions: map[bank.Role][]bank.Permission{}}
+	for role, permissions := range bank.DefaultPermissions {
+		d.permissions[role] = append([]bank.Permission(nil), permissions...)
+	}
+	return &MemoryStore{mu: &sync.Mutex{}, data: d}
+}
+
+func (s *MemoryStore) Customers() CustomerRepository       { return s }
+func (s *MemoryStore) Accounts() AccountRepository         { return s }
+func (s *MemoryStore) Transactions() TransactionRepository { return s }
+func (s *MemoryStore) Holds() HoldRepository               { return s }
+func (s *MemoryStore) Interest() InterestRepository        { return s }
+func (s *MemoryStore) Fees() FeeRepository                 { return s }
+func (s *MemoryStore) Idempotency() IdempotencyRepository  { return s }
+func (s *MemoryStore) Auth() AuthRepository                { return s }
+func (s *MemoryStore) Approvals() ApprovalRepository       { return s }
+func (s *MemoryStore) Audit() AuditRepository              { return s }
+
+// lock takes the store lock unless Atomic already holds it, and returns the function that releases it.
+func (s *MemoryStore) lock() func() {
+	if s.inTx {
+		return func() {}
+	}
+	s.mu.Lock()
+	return s.mu.Unlock
+}
+
+// Atomic runs fn while holding the store lock.
+// If fn returns an error, the data is restored to what it was before fn ran,
+// also when Atomic is called on the store an outer Atomic passed to its fn.
+func (s *MemoryStore) Atomic(fn func(tx Store) error) error {
+	if s.inTx {
+		snapshot := s.data.clone()
+		if err := fn(s); err != nil {
+			*s.data = *snapshot
+			return err
+		}
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	snapshot := s.data.clone()
+	if err := fn(&MemoryStore{mu: s.mu, data: s.data, inTx: true}); err != nil {
+		*s.data = *snapshot
+		return err
+	}
+	return nil
+}
+
+// emailTaken reports whether a customer other than the one with the given ID has the email.
+func (s *MemoryStore) emailTaken(email string, id int64) bool {
+	for _, existing := range s.data.customers {
+		if existing.Email == email && existing.ID != id {
+			return true
+		}
+	}
+	return false
+}
+
+// InsertCustomer stores the customer. Emails must be unique.
+func (s *MemoryStore) InsertCustomer(c *bank.Customer) (int64, error) {
+	defer s.lock()()
+
+	if s.emailTaken(c.Email, 0) {
+		return 0, fmt.Errorf("AddUser: %w: email %s", ErrDuplicate, c.Email)
+	}
+
+	c.ID = int64(len(s.data.customers) + 1)
+	s.data.customers = append(s.data.customers, *c)
+	return c.ID, nil
+}
+
+// GetCustomer returns a copy of the customer.
+func (s *MemoryStore) GetCustomer(id int64) (*bank.Customer, error) {
+	defer s.lock()()
+
+	if id < 1 || id > int64(len(s.data.customers)) {
+		return nil, ErrCustomerNotFound
+	}
+	c := s.data.customers[id-1]
+	return &c, nil
+}
+
+// UpdateCustomer replaces the customer's details. Emails must stay unique.
+func (s *MemoryStore) UpdateCustomer(c *bank.Customer) error {
+	defer s.lock()()
+
+	if c.ID < 1 || c.ID > int64(len(s.data.customers)) {
+		return fmt.Errorf("updateCustomer: %w", ErrCustomerNotFound)
+	}
+	if s.emailTaken(c.Email, c.ID) {
+		return fmt.Errorf("updateCustomer: %w: email %s", ErrDuplicate, c.Email)
+	}
+
+	s.data.customers[c.ID-1] = *c
+	return nil
+}
+
+// InsertAccount stores the account. Account numbers must be unique.
+func (s *MemoryStore) InsertAccount(customerID int64, a *bank.Account) (int64, error) {
+	defer s.lock()()
+
+	if customerID < 1 || customerID > int64(len(s.data.customers)) {
+		return 0, fmt.Errorf("addAccount: customer %d not found", customerID)
+	}
+	if _, ok := s.data.accounts[a.Number]; ok {
+		return 0, fmt.Errorf("addAccount: %w: account number %s", ErrDuplicate, a.Number)
+	}
+
+	balance := a.Balance
+	if balance.Currency == "" {
+		balance.Currency = bank.DefaultCurrency
+	}
+	if a.Type == "" {
+		a.Type = bank.CurrentAccount
+	}
+	if a.Status == "" {
+		a.Status = bank.StatusActive
+	}
+
+	id := int64(len(s.data.accounts) + 1)
+	overdraft := bank.NewMoney(a.Overdraft.Amount, balance.Currency)
+	s.data.accounts[a.Number] = &memoryAccount{id: id, customerID: customerID, number: a.Number, accountType: a.Type, status: a.Status, balance: balance, overdraft: overdraft}
+	return id, nil
+}
+
+// account returns a copy of the stored account with its owner's details.
+func (s *MemoryStore) account(number string) (*bank.Account, bool) {
+	a, ok := s.data.accounts[number]
+	if !ok {
+		return nil, false
+	}
+
+	held := bank.NewMoney(0, a.balance.Currency)
+	for _, h := range s.data.holds {
+		if h.hold.Account == number && !h.released {
+			held.Amount += h.hold.Amount.Amount
+		}
+	}
+
+	return &bank.Account{
+		Customer:  s.data.customers[a.customerID-1],
+		Number:    a.number,
+		Type:      a.accountType,
+		Status:    a.status,
+		Balance:   a.balance,
+		Held:      held,
+		Overdraft: a.overdraft,
+	}, true
+}
+
+// GetAccountByNumber returns a copy of the account.
+func (s *MemoryStore) GetAccountByNumber(number string) (*bank.Account, error) {
+	defer s.lock()()
+
+	account, ok := s.account(number)
+	if !ok {
+		return nil, ErrAccountNotFound
+	}
+	return account, nil
+}
+
+// LastAccountNumber returns the highest stored account number with the prefix.
+func (s *MemoryStore) LastAccountNumber(prefix string) (string, error) {
+	defer s.lock()()
+
+	last := ""
+	for number := range s.data.accounts {
+		if strings.HasPrefix(number, prefix) && number > last {
+			last = number
+		}
+	}
+	return last, nil
+}
+
+// AccountsByCustomer returns copies of the customer's accounts in the order they were inserted.
+func (s *MemoryStore) AccountsByCustomer(customerID int64) ([]*bank.Account, error) {
+	defer s.lock()()
+
+	return s.accounts(func(a *memoryAccount) bool { return a.customerID == customerID }), nil
+}
+
+// AccountsByType returns copies of the accounts of the type in the order they were inserted.
+func (s *MemoryStore) AccountsByType(accountType bank.AccountType) ([]*bank.Account, error) {
+	defer s.lock()()
+
+	return s.accounts(func(a *memoryAccount) bool { return a.accountType == accountType }), nil
+}
+
+// accounts returns copies of the accounts keep reports true for, in the order they were inserted.
+func (s *MemoryStore) accounts(keep func(a *memoryAccount) bool) []*bank.Account {
+	var kept []*memoryAccount
+	for _, a := range s.data.accounts {
+		if keep(a) {
+			kept = append(kept, a)
+		}
+	}
+	sort.Slice(kept, func(i, j int) bool { return kept[i].id < kept[j].id })
+
+	accounts := make([]*bank.Account, 0, len(kept))
+	for _, a := range kept {
+		account, _ := s.account(a.number)
+		accounts = append(accounts, account)
+	}
+	return accounts
+}
+
+// LockAccounts returns copies of the accounts. Inside Atomic the whole store is already locked.
+func (s *MemoryStore) LockAccounts(numbers ...string) (map[string]*bank.Account, error) {
+	defer s.lock()()
+
+	accounts := make(map[string]*bank.Account, len(numbers))
+	for _, number := range numbers {
+		if account, ok := s.account(number); ok {
+			accounts[number] = account
+		}
+	}
+	return accounts, nil
+}
+
+// UpdateBalance stores the balance of the account.
+func (s *MemoryStore) UpdateBalance(a *bank.Account) error {
+	defer s.lock()()
+
+	stored, ok := s.data.accounts[a.Number]
+	if !ok {
+		return fmt.Errorf("UpdateBalance: %w", ErrAccountNotFound)
+	}
+	stored.balance = a.Balance
+	return nil
+}
+
+// UpdateOverdraft stores the overdraft limit of the account.
+func (s *MemoryStore) UpdateOverdraft(a *bank.Account) error {
+	defer s.lock()()
+
+	stored, ok := s.data.accounts[a.Number]
+	if !ok {
+		return fmt.Errorf("updateOverdraft: %w", ErrAccountNotFound)
+	}
+	stored.overdraft = a.Overdraft
+	return nil
+}
+
+// UpdateStatus stores the status of the account and a copy of the change.
+func (s *MemoryStore) UpdateStatus(a *bank.Account, change *bank.StatusChange) error {
+	defer s.lock()()
+
+	stored, ok := s.data.accounts[a.Number]
+	if !ok {
+		return fmt.Errorf("updateStatus: %w", ErrAccountNotFound)
+	}
+	stored.status = a.Status
+
+	recorded := *change
+	if recorded.CreatedAt.IsZero() {
+		recorded.CreatedAt = time.Now().UTC()
+	}
+	s.data.statusChanges = append(s.data.statusChanges, memoryStatusChange{number: a.Number, change: recorded})
+	return nil
+}
+
+// StatusChanges returns copies of the account's status changes, oldest first.
+func (s *MemoryStore) StatusChanges(number string) ([]bank.StatusChange, error) {
+	defer s.lock()()
+
+	changes := []bank.StatusChange{}
+	for _, c := range s.data.statusChanges {
+		if c.number == number {
+			changes = append(changes, c.change)
+		}
+	}
+	return changes, nil
+}
+
+// InsertClosure stores a copy of the closing statement. An account is closed only once.
+func (s *MemoryStore) InsertClosure(c *bank.ClosingStatement) error {
+	defer s.lock()()
+
+	if _, ok := s.data.closures[c.Number]; ok {
+		return fmt.Errorf("insertClosure: %w: account number %s", ErrDuplicate, c.Number)
+	}
+	s.data.closures[c.Number] = *c
+	return nil
+}
+
+// GetClosure returns a copy of the account's closing statement.
+func (s *MemoryStore) GetClosure(number string) (*bank.ClosingStatement, error) {
+	defer s.lock()()
+
+	c, ok := s.data.closures[number]
+	if !ok {
+		return nil, ErrClosureNotFound
+	}
+	return &c, nil
+}
+
+// InsertHold stores a copy of the hold, setting its ID and creation time.
+func (s *MemoryStore) InsertHold(h *bank.Hold) error {
+	defer s.lock()()
+
+	h.ID = int64(len(s.data.holds) + 1)
+	if h.CreatedAt.IsZero() {
+		h.CreatedAt = time.Now().UTC()
+	}
+	s.data.holds = append(s.data.holds, memoryHold{hold: *h})
+	return nil
+}
+
+// PendingHold returns a copy of the hold, if it hasn't been released.
+func (s *MemoryStore) PendingHold(id int64) (*bank.Hold, error) {
+	defer s.lock()()
+
+	if id < 1 || id > int64(len(s.data.holds)) || s.data.holds[id-1].released {
+		return nil, ErrHoldNotFound
+	}
+	h := s.data.holds[id-1].hold
+	return &h, nil
+}
+
+// PendingHolds returns copies of the account's holds that haven't been released, oldest first.
+func (s *MemoryStore) PendingHolds(number string) ([]bank.Hold, error) {
+	defer s.lock()()
+
+	holds := []bank.Hold{}
+	for _, h := range s.data.holds {
+		if h.hold.Account == number && !h.released {
+			holds = append(holds, h.hold)
+		}
+	}
+	return holds, nil
+}
+
+// ReleaseHold marks the hold released.
+func (s *MemoryStore) ReleaseHold(h *bank.Hold) error {
+	defer s.lock()()
+
+	if h.ID < 1 || h.ID > int64(len(s.data.holds)) || s.data.holds[h.ID-1].released {
+		return fmt.Errorf("releaseHold: %w", ErrHoldNotFound)
+	}
+	s.data.holds[h.ID-1].released = true
+	return nil
+}
+
+// InsertAccrual stores the accrual. An account accrues once per date.
+func (s *MemoryStore) InsertAccrual(a *bank.Accrual) error {
+	defer s.lock()()
+
+	for _, existing := range s.data.accruals {
+		if existing.Account == a.Account && existing.Date.Equal(a.Date) {
+			return fmt.Errorf("insertAccrual: %w: account %s on %s", ErrDuplicate, a.Account, a.Date.Format("2006-01-02"))
+		}
+	}
+	s.data.accruals = append(s.data.accruals, *a)
+	return nil
+}
+
+// PendingAccruals returns the account's uncapitalized accruals up to the date, oldest first.
+func (s *MemoryStore) PendingAccruals(number string, through time.Time) ([]bank.Accrual, error) {
+	defer s.lock()()
+
+	accruals := []bank.Accrual{}
+	for _, a := range s.data.accruals {
+		if a.Account == number && !a.Date.After(through) && a.TransactionID == 0 {
+			accruals = append(accruals, a)
+		}
+	}
+	sort.Slice(accruals, func(i, j int) bool { return accruals[i].Date.Before(accruals[j].Date) })
+	return accruals, nil
+}
+
+// MarkCapitalized records the transaction that capitalized the accruals.
+func (s *MemoryStore) MarkCapitalized(accruals []bank.Accrual, transactionID int64) error {
+	defer s.lock()()
+
+	for _, capitalized := range accruals {
+		for i, a := range s.data.accruals {
+			if a.Account == capitalized.Account && a.Date.Equal(capitalized.Date) {
+				s.data.accruals[i].TransactionID = transactionID
+			}
+		}
+	}
+	return nil
+}
+
+// InsertMaintenanceFee records the account's maintenance fee for the month. An account is charged once a month.
+func (s *MemoryStore) InsertMaintenanceFee(number string, month time.Time, transactionID int64) error {
+	defer s.lock()()
+
+	fee := memoryFee{number: number, month: month.Format("2006-01"), transactionID: transactionID}
+	for _, existing := range s.data.fees {
+		if existing.number == fee.number && existing.month == fee.month {
+			return fmt.Errorf("insertMaintenanceFee: %w: account %s in %s", ErrDuplicate, number, fee.month)
+		}
+	}
+	s.data.fees = append(s.data.fees, fee)
+	return nil
+}
+
+// InsertRequest stores a copy of the request without a response, setting its creation time. A key is used once.
+func (s *MemoryStore) InsertRequest(r *IdempotentRequest) error {
+	defer s.lock()()
+
+	if _, ok := s.data.requests[r.Key]; ok {
+		return fmt.Errorf("insertRequest: %w: key %q", ErrDuplicate, r.Key)
+	}
+	if r.CreatedAt.IsZero() {
+		r.CreatedAt = time.Now().UTC()
+	}
+	s.data.requests[r.Key] = IdempotentRequest{Key: r.Key, Fingerprint: r.Fingerprint, CreatedAt: r.CreatedAt, ExpiresAt: r.ExpiresAt}
+	return nil
+}
+
+// GetRequest returns a copy of the request made with the key.
+func (s *MemoryStore) GetRequest(key string) (*IdempotentRequest, error) {
+	defer s.lock()()
+
+	r, ok := s.data.requests[key]
+	if !ok {
+		return nil, ErrRequestNotFound
+	}
+	r.Body = append([]byte(nil), r.Body...)
+	return &r, nil
+}
+
+// SaveResponse stores a copy of the response of the request.
+func (s *MemoryStore) SaveResponse(r *IdempotentRequest) error {
+	defer s.lock()()
+
+	stored, ok := s.data.requests[r.Key]
+	if !ok {
+		return fmt.Errorf("saveResponse: %w", ErrRequestNotFound)
+	}
+	stored.Status, stored.ContentType, stored.Location = r.Status, r.ContentType, r.Location
+	stored.Body = append([]byte(nil), r.Body...)
+	s.data.requests[r.Key] = stored
+	return nil
+}
+
+// DeleteRequest removes the request made with the key.
+func (s *MemoryStore) DeleteRequest(key string) error {
+	defer s.lock()()
+
+	delete(s.data.requests, key)
+	return nil
+}
+
+// DeleteExpired removes the requests that expired at or before t.
+func (s *MemoryStore) DeleteExpired(t time.Time) (int64, error) {
+	defer s.lock()()
+
+	var n int64
+	for key, r := range s.data.requests {
+		if !r.ExpiresAt.After(t) {
+			delete(s.data.requests, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// InsertAPIKey stores a copy of the API key, setting its ID and creation time. Names are unique.
+func (s *MemoryStore) InsertAPIKey(k *APIKey) error {
+	defer s.lock()()
+
+	for _, existing := range s.data.apiKeys {
+		if existing.Name == k.Name || existing.Hash == k.Hash {
+			return fmt.Errorf("insertAPIKey: %w: key %q", ErrDuplicate, k.Name)
+		}
+	}
+	k.ID = int64(len(s.data.apiKeys) + 1)
+	if k.CreatedAt.IsZero() {
+		k.CreatedAt = time.Now().UTC()
+	}
+	s.data.apiKeys = append(s.data.apiKeys, *k)
+	return nil
+}
+
+// APIKeyByHash returns a copy of the API key with the hash.
+func (s *MemoryStore) APIKeyByHash(hash string) (*APIKey, error) {
+	defer s.lock()()
+
+	for _, k := range s.data.apiKeys {
+		if k.Hash == hash {
+			return &k, nil
+		}
+	}
+	return nil, ErrAPIKeyNotFound
+}
+
+// SaveLogin stores a copy of the customer's login. Usernames are unique.
+func (s *MemoryStore) SaveLogin(l *Login) error {
+	defer s.lock()()
+
+	for id, existing := range s.data.logins {
+		if existing.Username == l.Username && id != l.CustomerID {
+			return fmt.Errorf("saveLogin: %w: username %q", ErrDuplicate, l.Username)
+		}
+	}
+	s.data.logins[l.CustomerID] = *l
+	return nil
+}
+
+// LoginByUsername returns a copy of the login with the username.
+func (s *MemoryStore) LoginByUsername(username string) (*Login, error) {
+	defer s.lock()()
+
+	for _, l := range s.data.logins {
+		if l.Username == username {
+			return &l, nil
+		}
+	}
+	return nil, ErrLoginNotFound
+}
+
+// RolePermissions returns a copy of the role's permissions.
+func (s *MemoryStore) RolePermissions(role bank.Role) ([]bank.Permission, error) {
+	defer s.lock()()
+
+	return append([]bank.Permission(nil), s.data.permissions[role]...), nil
+}
+
+// InsertOperation stores a copy of the operation, setting its ID and request time.
+func (s *MemoryStore) InsertOperation(o *bank.PendingOperation) error {
+	defer s.lock()()
+
+	o.ID = int64(len(s.data.operations) + 1)
+	if o.RequestedAt.IsZero() {
+		o.RequestedAt = time.Now().UTC()
+	}
+	s.data.operations = append(s.data.operations, *o)
+	return nil
+}
+
+// GetOperation returns a copy of the operation.
+func (s *MemoryStore) GetOperation(id int64) (*bank.PendingOperation, error) {
+	defer s.lock()()
+
+	if id < 1 || id > int64(len(s.data.operations)) {
+		return nil, ErrOperationNotFound
+	}
+	o := s.data.operations[id-1]
+	return &o, nil
+}
+
+// Operations returns copies of the operations with the status.
+func (s *MemoryStore) Operations(status bank.OperationStatus) ([]*bank.PendingOperation, error) {
+	defer s.lock()()
+
+	operations := []*bank.PendingOperation{}
+	for _, o := range s.data.operations {
+		if status == "" || o.Status == status {
+			o := o
+			operations = append(operations, &o)
+		}
+	}
+	return operations, nil
+}
+
+// DecideOperation stores a copy of the operation's decision, if it is still pending.
+func (s *MemoryStore) DecideOperation(o *bank.PendingOperation) error {
+	defer s.lock()()
+
+	if o.ID < 1 || o.ID > int64(len(s.data.operations)) {
+		return ErrOperationNotFound
+	}
+	stored := &s.data.operations[o.ID-1]
+	if stored.Status != bank.OperationPending {
+		return fmt.Errorf("decideOperation: %w: operation %d", bank.ErrNotPending, o.ID)
+	}
+	stored.Status, stored.DecidedBy, stored.DecidedAt, stored.Reason, stored.Transaction = o.Status, o.DecidedBy, o.DecidedAt, o.Reason, o.Transaction
+	return nil
+}
+
+// AppendEntry chains the entry to the last one and stores a copy of it.
+func (s *MemoryStore) AppendEntry(e *AuditEntry) error {
+	defer s.lock()()
+
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Second)
+	e.PrevHash = ""
+	if n := len(s.data.audit); n > 0 {
+		e.PrevHash = s.data.audit[n-1].Hash
+	}
+	e.Hash = e.Sum()
+	e.ID = int64(len(s.data.audit) + 1)
+	s.data.audit = append(s.data.audit, *e)
+	return nil
+}
+
+// AuditEntries returns copies of the entries matching the filter.
+func (s *MemoryStore) AuditEntries(filter AuditFilter) ([]*AuditEntry, error) {
+	defer s.lock()()
+
+	entries := []*AuditEntry{}
+	for _, e := range s.data.audit {
+		switch {
+		case filter.Actor != "" && e.Actor != filter.Actor,
+			filter.Account != "" && e.Account != filter.Account,
+			filter.Target != "" && e.Target != filter.Target,
+			!filter.Since.IsZero() && e.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !e.CreatedAt.Before(filter.Until),
+			e.ID <= filter.After:
+			continue
+		}
+		e := e
+		entries = append(entries, &e)
+		if filter.Limit > 0 && len(entries) == filter.Limit {
+			break
+		}
+	}
+	return entries, nil
+}
+
+// Record stores a copy of the transaction, setting its ID and creation time.
+func (s *MemoryStore) Record(t *bank.Transaction) error {
+	defer s.lock()()
+
+	t.ID = int64(len(s.data.transactions) + 1)
+	if t.CreatedAt.IsZero() {
+		t.CreatedAt = time.Now().UTC()
+	}
+
+	stored := *t
+	stored.Entries = append([]bank.Entry(nil), t.Entries...)
+	s.data.transactions = append(s.data.transactions, &stored)
+
+	for _, e := range stored.Entries {
+		if bank.IsInternal(e.Account) {
+			e.Balance = bank.Money{}
+		}
+		s.data.entries = append(s.data.entries, memoryEntry{id: int64(len(s.data.entries) + 1), tx: &stored, entry: e})
+	}
+	return nil
+}
+
+// Entries returns every entry posted to the account, oldest first.
+func (s *MemoryStore) Entries(account string) ([]bank.Entry, error) {
+	defer s.lock()()
+
+	var entries []bank.Entry
+	for _, e := range s.data.entries {
+		if e.entry.Account == account {
+			entries = append(entries, e.entry)
+		}
+	}
+	return entries, nil
+}
+
+// matches reports whether the entry passes the filter.
+func (f TransactionFilter) matches(e memoryEntry) bool {
+	switch {
+	case !f.Since.IsZero() && e.tx.CreatedAt.Before(f.Since),
+		!f.Until.IsZero() && !e.tx.CreatedAt.Before(f.Until),
+		f.Type != "" && e.tx.Type != f.Type,
+		f.MinAmount != nil && e.entry.Amount.Amount < f.MinAmount.Amount,
+		f.MaxAmount != nil && e.entry.Amount.Amount > f.MaxAmount.Amount,
+		f.Before > 0 && e.id >= f.Before:
+		return false
+	}
+	return true
+}
+
+// History returns the account's entries matching the filter as statement lines, newest first.
+func (s *MemoryStore) History(number string, filter TransactionFilter) ([]bank.StatementLine, error) {
+	defer s.lock()()
+
+	lines := []bank.StatementLine{}
+	for i := len(s.data.entries) - 1; i >= 0; i-- {
+		e := s.data.entries[i]
+		if e.entry.Account != number || !filter.matches(e) {
+			continue
+		}
+
+		line := bank.StatementLine{
+			ID:        e.id,
+			Type:      e.tx.Type,
+			Direction: e.entry.Direction,
+			Amount:    e.entry.Amount,
+			Balance:   e.entry.Balance,
+			Date:      e.tx.CreatedAt,
+		}
+		for _, other := range e.tx.Entries {
+			if other.Account != number && !bank.IsInternal(other.Account) {
+				line.Counterparty = other.Account
+			}
+		}
+		lines = append(lines, line)
+
+		if filter.Limit > 0 && len(lines) == filter.Limit {
+			break
+		}
+	}
+	return lines, nil
+}
+
+// BalanceBefore returns the balance after the account's last entry before t.
+func (s *MemoryStore) BalanceBefore(a *bank.Account, t time.Time) (bank.Money, error) {
+	defer s.lock()()
+
+	for i := len(s.data.entries) - 1; i >= 0; i-- {
+		e := s.data.entries[i]
+		if e.entry.Account == a.Number && e.tx.CreatedAt.Before(t) {
+			return e.entry.Balance, nil
+		}
+	}
+	return bank.NewMoney(0, a.Balance.Currency), nil
+}
@@ -0,0 +1,262 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrNoSchema is returned when migrating a store that has no SQL schema, such as the in-memory store.
+var ErrNoSchema = errors.New("store has no schema to migrate")
+
+// ErrSchemaOutdated is returned by Check when the database isn't at the latest migration.
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// ErrDirtySchema is returned when a previous migration failed half way.
+// The schema has to be fixed by hand before migrating again.
+var ErrDirtySchema = errors.New("database schema is dirty")
+
+// Migration is a numbered schema change, read from a pair of
+// <version>_<name>.up.sql and <version>_<name>.down.sql files.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus tells whether a migration has been applied.
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// LoadMigrations reads the migrations in the driver's directory of fsys, ordered by version.
+func LoadMigrations(fsys fs.FS, driver string) ([]Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(driver, "*.sql"))
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		base := path.Base(file)
+		name, direction := strings.TrimSuffix(base, ".sql"), ""
+		switch {
+		case strings.HasSuffix(name, ".up"):
+			name, direction = strings.TrimSuffix(name, ".up"), "up"
+		case strings.HasSuffix(name, ".down"):
+			name, direction = strings.TrimSuffix(name, ".down"), "down"
+		default:
+			return nil, fmt.Errorf("migration %s is neither .up.sql nor .down.sql", base)
+		}
+
+		prefix, name, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(prefix)
+		if err != nil || version < 1 {
+			return nil, fmt.Errorf("migration %s has no version number", base)
+		}
+
+		query, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: name}
+			byVersion[version] = m
+		}
+		if direction == "up" {
+			m.Up = string(query)
+		} else {
+			m.Down = string(query)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Migrator applies the migrations of a SQL store and records its version in the "schema_migrations" table.
+// The table has the layout used by the migrate CLI, so databases it migrated keep their version.
+type Migrator struct {
+	store      *SQLStore
+	migrations []Migration
+}
+
+// NewMigrator returns a migrator for the store with the migrations of its dialect in fsys.
+// It returns ErrNoSchema for stores that aren't backed by SQL.
+func NewMigrator(store Store, fsys fs.FS) (*Migrator, error) {
+	s, ok := store.(*SQLStore)
+	if !ok {
+		return nil, ErrNoSchema
+	}
+
+	migrations, err := LoadMigrations(fsys, s.driver)
+	if err != nil {
+		return nil, err
+	}
+	if len(migrations) == 0 {
+		return nil, fmt.Errorf("no %s migrations found", s.driver)
+	}
+
+	if _, err := s.db.Exec("CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)"); err != nil {
+		return nil, fmt.Errorf("createSchemaMigrations: %v", err)
+	}
+	return &Migrator{store: s, migrations: migrations}, nil
+}
+
+// Latest returns the version of the last migration.
+func (m *Migrator) Latest() int {
+	return m.migrations[len(m.migrations)-1].Version
+}
+
+// Version returns the version the database is at, zero if no migration was applied,
+// and whether the last migration failed half way.
+func (m *Migrator) Version() (int, bool, error) {
+	var version int
+	var dirty bool
+	err := m.store.db.QueryRow("SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("schemaVersion: %v", err)
+	}
+	return version, dirty, nil
+}
+
+// Status lists every migration and whether it has been applied.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	version, _, err := m.Version()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		status[i] = MigrationStatus{Migration: migration, Applied: migration.Version <= version}
+	}
+	return status, nil
+}
+
+// Check returns ErrSchemaOutdated unless every migration has been applied,
+// and ErrDirtySchema if the last one failed.
+func (m *Migrator) Check() error {
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirtySchema, version)
+	}
+	if version != m.Latest() {
+		return fmt.Errorf("%w: at version %d, latest is %d", ErrSchemaOutdated, version, m.Latest())
+	}
+	return nil
+}
+
+// Up applies every migration that hasn't been applied yet.
+func (m *Migrator) Up() error {
+	return m.To(m.Latest())
+}
+
+// Down rolls back every applied migration.
+func (m *Migrator) Down() error {
+	return m.To(0)
+}
+
+// To applies or rolls back migrations, one at a time, until the database is at the given version.
+// Version zero is the empty schema.
+func (m *Migrator) To(target int) error {
+	if target != 0 && m.index(target) < 0 {
+		return fmt.Errorf("no migration with version %d", target)
+	}
+
+	version, dirty, err := m.Version()
+	if err != nil {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%w at version %d", ErrDirtySchema, version)
+	}
+	if version != 0 && m.index(version) < 0 {
+		return fmt.Errorf("database is at version %d, which has no migration", version)
+	}
+
+	for version < target {
+		next := m.migrations[m.index(version)+1]
+		if err := m.apply(next.Version, next.Up); err != nil {
+			return fmt.Errorf("migration %d_%s up: %v", next.Version, next.Name, err)
+		}
+		version = next.Version
+	}
+
+	for version > target {
+		i := m.index(version)
+		previous := 0
+		if i > 0 {
+			previous = m.migrations[i-1].Version
+		}
+		if err := m.apply(previous, m.migrations[i].Down); err != nil {
+			return fmt.Errorf("migration %d_%s down: %v", m.migrations[i].Version, m.migrations[i].Name, err)
+		}
+		version = previous
+	}
+	return nil
+}
+
+// index returns the position of the migration with the given version, -1 if there is none.
+// Version zero comes before the first migration.
+func (m *Migrator) index(version int) int {
+	for i, migration := range m.migrations {
+		if migration.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+// apply runs the query and moves the recorded version to the given one.
+// The version is marked dirty while the query runs: MySQL commits schema changes straight away,
+// so a failing query can leave a migration half applied.
+func (m *Migrator) apply(version int, query string) error {
+	return m.store.Atomic(func(tx Store) error {
+		q := tx.(*SQLStore).q
+
+		if err := setVersion(q, version, true); err != nil {
+			return err
+		}
+		if _, err := q.Exec(query); err != nil {
+			return err
+		}
+		return setVersion(q, version, false)
+	})
+}
+
+// setVersion replaces the row of the "schema_migrations" table. Version zero leaves the table empty.
+func setVersion(q dbtx, version int, dirty bool) error {
+	if _, err := q.Exec("DELETE FROM schema_migrations"); err != nil {
+		return fmt.Errorf("setSchemaVersion: %v", err)
+	}
+	if version == 0 && !dirty {
+		return nil
+	}
+	if _, err := q.Exec("INSERT INTO schema_migrations (version, dirty) VALUES (?, ?)", version, dirty); err != nil {
+		return fmt.Errorf("setSchemaVersion: %v", err)
+	}
+	return nil
+}
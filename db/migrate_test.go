@@ -0,0 +1,158 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"testing/fstest"
+)
+
+// newTestMigrator returns a migrator for an empty SQLite database in memory.
+func newTestMigrator(t *testing.T, fsys fstest.MapFS) (*Migrator, *SQLStore) {
+	store, err := Open(Config{Driver: SQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMigrator(store, fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m, store.(*SQLStore)
+}
+
+// tableExists reports whether the SQLite database has the table.
+func tableExists(t *testing.T, s *SQLStore, name string) bool {
+	var n int
+	if err := s.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n > 0
+}
+
+var testMigrations = fstest.MapFS{
+	"sqlite/000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER)")},
+	"sqlite/000001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+	"sqlite/000002_create_b.up.sql":   {Data: []byte("CREATE TABLE b (id INTEGER)")},
+	"sqlite/000002_create_b.down.sql": {Data: []byte("DROP TABLE b")},
+	"sqlite/000005_create_c.up.sql":   {Data: []byte("CREATE TABLE c (id INTEGER)")},
+	"sqlite/000005_create_c.down.sql": {Data: []byte("DROP TABLE c")},
+}
+
+func TestMigrator(t *testing.T) {
+	m, s := newTestMigrator(t, testMigrations)
+
+	if err := m.Check(); !errors.Is(err, ErrSchemaOutdated) {
+		t.Errorf("expected an empty database to be out of date, got %v", err)
+	}
+
+	if err := m.To(2); err != nil {
+		t.Fatal(err)
+	}
+	if !tableExists(t, s, "a") || !tableExists(t, s, "b") || tableExists(t, s, "c") {
+		t.Error("expected only the first two migrations to be applied")
+	}
+
+	status, err := m.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(status) != 3 || !status[1].Applied || status[2].Applied || status[2].Name != "create_c" {
+		t.Errorf("unexpected status: %+v", status)
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Check(); err != nil {
+		t.Errorf("expected the schema to be up to date, got %v", err)
+	}
+
+	if err := m.To(1); err != nil {
+		t.Fatal(err)
+	}
+	if version, _, _ := m.Version(); version != 1 || tableExists(t, s, "b") || tableExists(t, s, "c") {
+		t.Errorf("expected to be back at version 1, got %d", version)
+	}
+
+	if err := m.Down(); err != nil {
+		t.Fatal(err)
+	}
+	if version, _, _ := m.Version(); version != 0 || tableExists(t, s, "a") {
+		t.Errorf("expected an empty schema, got version %d", version)
+	}
+
+	if err := m.To(3); err == nil {
+		t.Error("expected an error migrating to a version with no migration")
+	}
+}
+
+func TestMigratorFailure(t *testing.T) {
+	fsys := fstest.MapFS{
+		"sqlite/000001_create_a.up.sql":   {Data: []byte("CREATE TABLE a (id INTEGER)")},
+		"sqlite/000001_create_a.down.sql": {Data: []byte("DROP TABLE a")},
+		"sqlite/000002_broken.up.sql":     {Data: []byte("CREATE TABLE")},
+		"sqlite/000002_broken.down.sql":   {Data: []byte("SELECT 1")},
+	}
+	m, s := newTestMigrator(t, fsys)
+
+	if err := m.Up(); err == nil {
+		t.Fatal("expected the broken migration to fail")
+	}
+
+	// SQLite rolls the failed migration back, leaving the database at the previous version
+	version, dirty, err := m.Version()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 1 || dirty || !tableExists(t, s, "a") {
+		t.Errorf("expected a clean version 1, got version %d, dirty %v", version, dirty)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	migrations, err := LoadMigrations(os.DirFS("../bankapi/db/migrations"), MySQL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sqlite, err := LoadMigrations(os.DirFS("../bankapi/db/migrations"), SQLite)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every dialect has the same migrations
+	if len(migrations) == 0 || len(migrations) != len(sqlite) {
+		t.Fatalf("expected the same migrations in each dialect, got %d and %d", len(migrations), len(sqlite))
+	}
+	for i := range migrations {
+		if migrations[i].Version != sqlite[i].Version || migrations[i].Name != sqlite[i].Name {
+			t.Errorf("migration %d_%s has no SQLite counterpart", migrations[i].Version, migrations[i].Name)
+		}
+	}
+
+	missing := fstest.MapFS{"sqlite/000001_create_a.up.sql": {Data: []byte("CREATE TABLE a (id INTEGER)")}}
+	if _, err := LoadMigrations(missing, SQLite); err == nil {
+		t.Error("expected an error for a migration without a down file")
+	}
+}
+
+func TestMigrationsRoundTrip(t *testing.T) {
+	store, err := Open(Config{Driver: SQLite, Path: ":memory:"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m, err := NewMigrator(store, os.DirFS("../bankapi/db/migrations"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every down migration undoes its up migration
+	for _, step := range []func() error{m.Up, m.Down, m.Up} {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := m.Check(); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,1030 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/themobileprof/bank"
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// dbtx is the subset of *sql.DB and *sql.Tx used by the queries,
+// so the same query can run on its own or inside a database transaction.
+type dbtx interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// SQLStore is a Store backed by a SQL database with the schema in bankapi/db/migrations.
+// The queries are shared by every dialect; the driver only changes how rows are locked
+// and how constraint violations are reported.
+type SQLStore struct {
+	db     *sql.DB
+	q      dbtx
+	driver string // MySQL or SQLite.
+	depth  int    // How many Atomic calls the store runs in, counting the one that began the transaction.
+}
+
+// NewMySQLStore returns a store that runs its queries on the given MySQL database handle.
+func NewMySQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db, q: db, driver: MySQL}
+}
+
+// NewSQLiteStore returns a store that runs its queries on the given SQLite database handle.
+// SQLite has no row locks, so the handle is limited to a single connection:
+// transactions then run one after the other, which is what LockAccounts promises.
+func NewSQLiteStore(db *sql.DB) *SQLStore {
+	db.SetMaxOpenConns(1)
+	return &SQLStore{db: db, q: db, driver: SQLite}
+}
+
+func (s *SQLStore) Customers() CustomerRepository       { return s }
+func (s *SQLStore) Accounts() AccountRepository         { return s }
+func (s *SQLStore) Transactions() TransactionRepository { return s }
+func (s *SQLStore) Holds() HoldRepository               { return s }
+func (s *SQLStore) Interest() InterestRepository        { return s }
+func (s *SQLStore) Fees() FeeRepository                 { return s }
+func (s *SQLStore) Idempotency() IdempotencyRepository  { return s }
+func (s *SQLStore) Auth() AuthRepository                { return s }
+func (s *SQLStore) Approvals() ApprovalRepository       { return s }
+func (s *SQLStore) Audit() AuditRepository              { return s }
+
+// Atomic runs fn inside a database transaction.
+// The transaction is committed if fn returns nil and rolled back otherwise.
+// Calling Atomic on a store that is already in a transaction runs fn in a savepoint of that transaction.
+func (s *SQLStore) Atomic(fn func(tx Store) error) error {
+	if s.q != s.db {
+		return s.savepoint(fn)
+	}
+	if s.db == nil {
+		return fmt.Errorf("database connection is nil")
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return fmt.Errorf("beginTransaction: %v", err)
+	}
+
+	if err := fn(&SQLStore{db: s.db, q: tx, driver: s.driver, depth: 1}); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commitTransaction: %v", err)
+	}
+	return nil
+}
+
+// savepoint runs fn inside a savepoint of the transaction the store already runs in,
+// so that an error of fn rolls back what fn did and leaves the rest of the transaction as it was.
+func (s *SQLStore) savepoint(fn func(tx Store) error) error {
+	name := fmt.Sprintf("atomic_%d", s.depth)
+	if _, err := s.q.Exec("SAVEPOINT " + name); err != nil {
+		return fmt.Errorf("savepoint: %v", err)
+	}
+
+	if err := fn(&SQLStore{db: s.db, q: s.q, driver: s.driver, depth: s.depth + 1}); err != nil {
+		if _, rollbackErr := s.q.Exec("ROLLBACK TO SAVEPOINT " + name); rollbackErr != nil {
+			return fmt.Errorf("rollbackToSavepoint: %v: %w", rollbackErr, err)
+		}
+		return err
+	}
+
+	if _, err := s.q.Exec("RELEASE SAVEPOINT " + name); err != nil {
+		return fmt.Errorf("releaseSavepoint: %v", err)
+	}
+	return nil
+}
+
+// duplicate wraps a unique constraint violation in ErrDuplicate.
+func duplicate(err error) error {
+	var me *mysql.MySQLError
+	if errors.As(err, &me) && me.Number == 1062 {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+
+	var se *sqlite.Error
+	if errors.As(err, &se) && (se.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE || se.Code() == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY) {
+		return fmt.Errorf("%w: %v", ErrDuplicate, err)
+	}
+	return err
+}
+
+// nullable stores empty optional details as NULL rather than as an empty string,
+// which ENUM, DATE and CHECK constrained columns would reject.
+func nullable(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// InsertCustomer inserts the customer's name, email, phone number, address, gender and date of birth into the "users" table.
+func (s *SQLStore) InsertCustomer(c *bank.Customer) (int64, error) {
+	result, err := s.q.Exec("INSERT INTO users (name, email, phone_number, address, gender, date_of_birth) VALUES (?, ?, ?, ?, ?, ?)", c.Name, c.Email, nullable(c.Phone), nullable(c.Address), nullable(c.Gender), nullable(c.DoB))
+	if err != nil {
+		return 0, fmt.Errorf("AddUser: %w", duplicate(err))
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("addUser: %v", err)
+	}
+	c.ID = id
+	return id, nil
+}
+
+// GetCustomer queries the "users" table for the customer's details.
+func (s *SQLStore) GetCustomer(id int64) (*bank.Customer, error) {
+	c := &bank.Customer{}
+
+	var phone, address, gender, dob sql.NullString
+	row := s.q.QueryRow("SELECT id, name, email, phone_number, address, gender, date_of_birth FROM users WHERE id = ?", id)
+	if err := row.Scan(&c.ID, &c.Name, &c.Email, &phone, &address, &gender, &dob); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrCustomerNotFound
+		}
+		return nil, fmt.Errorf("getCustomer %d: %v", id, err)
+	}
+	c.Phone, c.Address, c.Gender, c.DoB = phone.String, address.String, gender.String, dob.String
+	return c, nil
+}
+
+// UpdateCustomer updates the customer's row in the "users" table.
+func (s *SQLStore) UpdateCustomer(c *bank.Customer) error {
+	_, err := s.q.Exec("UPDATE users SET name = ?, email = ?, phone_number = ?, address = ?, gender = ?, date_of_birth = ? WHERE id = ?", c.Name, c.Email, nullable(c.Phone), nullable(c.Address), nullable(c.Gender), nullable(c.DoB), c.ID)
+	if err != nil {
+		return fmt.Errorf("updateCustomer: %w", duplicate(err))
+	}
+	return nil
+}
+
+// InsertAccount inserts the account number, type, status, balance, currency and overdraft limit into the "accounts" table.
+// An account without a type is stored as a current account, one without a status as active
+// and one whose balance has no currency in bank.DefaultCurrency.
+func (s *SQLStore) InsertAccount(customerID int64, a *bank.Account) (int64, error) {
+	if a.Type == "" {
+		a.Type = bank.CurrentAccount
+	}
+	if a.Status == "" {
+		a.Status = bank.StatusActive
+	}
+
+	result, err := s.q.Exec("INSERT INTO accounts (user_id, account_number, type, status, balance, currency, overdraft_limit) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		customerID, a.Number, a.Type, a.Status, a.Balance, a.Currency(), a.Overdraft)
+	if err != nil {
+		return 0, fmt.Errorf("addAccount: %w", duplicate(err))
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, fmt.Errorf("addAccount: %v", err)
+	}
+	return id, nil
+}
+
+// accountColumns selects an account together with its owner's details.
+const accountColumns = "SELECT u.id, u.name, u.email, u.phone_number, u.address, u.gender, u.date_of_birth, a.account_number, a.type, COALESCE(a.status, 'active'), a.balance, a.currency, a.overdraft_limit, " +
+	"(SELECT COALESCE(SUM(h.amount), 0) FROM account_holds h WHERE h.account_number = a.account_number AND h.released_at IS NULL) " +
+	"FROM users u JOIN accounts a ON u.id = a.user_id"
+
+// accountQuery selects the account with the given number.
+const accountQuery = accountColumns + " WHERE a.account_number = ?"
+
+// scanner is a *sql.Row or *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAccount reads a row selected with accountColumns into a bank.Account.
+func scanAccount(row scanner, number string) (*bank.Account, error) {
+	account := &bank.Account{}
+
+	var phone, address, gender, dob sql.NullString
+	var currency string
+	if err := row.Scan(&account.ID, &account.Name, &account.Email, &phone, &address, &gender, &dob, &account.Number, &account.Type, &account.Status, &account.Balance, &currency, &account.Overdraft, &account.Held); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrAccountNotFound
+		}
+		return nil, fmt.Errorf("getAccountByNumber %v: %v", number, err)
+	}
+	account.Phone, account.Address, account.Gender, account.DoB = phone.String, address.String, gender.String, dob.String
+	account.Balance.Currency, account.Overdraft.Currency, account.Held.Currency = currency, currency, currency
+	return account, nil
+}
+
+// GetAccountByNumber queries the "users" and "accounts" tables to retrieve the account details.
+func (s *SQLStore) GetAccountByNumber(number string) (*bank.Account, error) {
+	return scanAccount(s.q.QueryRow(accountQuery, number), number)
+}
+
+// LastAccountNumber queries the "accounts" table for the highest account number with the prefix.
+func (s *SQLStore) LastAccountNumber(prefix string) (string, error) {
+	var number sql.NullString
+	if err := s.q.QueryRow("SELECT MAX(account_number) FROM accounts WHERE account_number LIKE ?", prefix+"%").Scan(&number); err != nil {
+		return "", fmt.Errorf("lastAccountNumber %v: %v", prefix, err)
+	}
+	return number.String, nil
+}
+
+// AccountsByCustomer queries the customer's accounts in the order they were inserted.
+func (s *SQLStore) AccountsByCustomer(customerID int64) ([]*bank.Account, error) {
+	accounts, err := s.queryAccounts("u.id = ?", customerID)
+	if err != nil {
+		return nil, fmt.Errorf("accountsByCustomer %d: %v", customerID, err)
+	}
+	return accounts, nil
+}
+
+// AccountsByType queries the accounts of the type in the order they were inserted.
+func (s *SQLStore) AccountsByType(accountType bank.AccountType) ([]*bank.Account, error) {
+	accounts, err := s.queryAccounts("a.type = ?", accountType)
+	if err != nil {
+		return nil, fmt.Errorf("accountsByType %s: %v", accountType, err)
+	}
+	return accounts, nil
+}
+
+// queryAccounts selects the accounts that meet the condition, in the order they were inserted.
+func (s *SQLStore) queryAccounts(condition string, arg interface{}) ([]*bank.Account, error) {
+	rows, err := s.q.Query(accountColumns+" WHERE "+condition+" ORDER BY a.id", arg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []*bank.Account{}
+	for rows.Next() {
+		account, err := scanAccount(rows, "")
+		if err != nil {
+			return nil, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// LockAccounts selects the accounts with SELECT ... FOR UPDATE in ascending account number order.
+// SQLite doesn't support FOR UPDATE; its single connection already keeps other transactions out.
+func (s *SQLStore) LockAccounts(numbers ...string) (map[string]*bank.Account, error) {
+	query := accountQuery
+	if s.driver == MySQL {
+		query += " FOR UPDATE"
+	}
+
+	sorted := append([]string(nil), numbers...)
+	sort.Strings(sorted)
+
+	accounts := make(map[string]*bank.Account, len(sorted))
+	for _, number := range sorted {
+		if _, ok := accounts[number]; ok {
+			continue
+		}
+
+		account, err := scanAccount(s.q.QueryRow(query, number), number)
+		if err == ErrAccountNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		accounts[number] = account
+	}
+	return accounts, nil
+}
+
+// UpdateBalance updates the balance of the account in the "accounts" table.
+func (s *SQLStore) UpdateBalance(a *bank.Account) error {
+	_, err := s.q.Exec("UPDATE accounts SET balance = ? WHERE account_number = ?", a.Balance, a.Number)
+	if err != nil {
+		return fmt.Errorf("UpdateBalance: %v", err)
+	}
+	return nil
+}
+
+// UpdateOverdraft updates the overdraft limit of the account in the "accounts" table.
+func (s *SQLStore) UpdateOverdraft(a *bank.Account) error {
+	result, err := s.q.Exec("UPDATE accounts SET overdraft_limit = ? WHERE account_number = ?", a.Overdraft, a.Number)
+	if err != nil {
+		return fmt.Errorf("updateOverdraft: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("updateOverdraft: %w", ErrAccountNotFound)
+	}
+	return nil
+}
+
+// UpdateStatus updates the status of the account in the "accounts" table
+// and inserts the change into the "account_status_changes" table.
+func (s *SQLStore) UpdateStatus(a *bank.Account, change *bank.StatusChange) error {
+	result, err := s.q.Exec("UPDATE accounts SET status = ? WHERE account_number = ?", a.Status, a.Number)
+	if err != nil {
+		return fmt.Errorf("updateStatus: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("updateStatus: %w", ErrAccountNotFound)
+	}
+
+	_, err = s.q.Exec("INSERT INTO account_status_changes (account_number, from_status, to_status, reason) VALUES (?, ?, ?, ?)", a.Number, change.From, change.To, change.Reason)
+	if err != nil {
+		return fmt.Errorf("recordStatusChange: %v", err)
+	}
+	return nil
+}
+
+// StatusChanges returns the rows of the "account_status_changes" table for the account, oldest first.
+func (s *SQLStore) StatusChanges(number string) ([]bank.StatusChange, error) {
+	rows, err := s.q.Query("SELECT from_status, to_status, reason, created_at FROM account_status_changes WHERE account_number = ? ORDER BY id", number)
+	if err != nil {
+		return nil, fmt.Errorf("statusChanges %v: %v", number, err)
+	}
+	defer rows.Close()
+
+	changes := []bank.StatusChange{}
+	for rows.Next() {
+		var change bank.StatusChange
+		var date sqlTime
+		if err := rows.Scan(&change.From, &change.To, &change.Reason, &date); err != nil {
+			return nil, fmt.Errorf("statusChanges %v: %v", number, err)
+		}
+		change.CreatedAt = date.Time
+		changes = append(changes, change)
+	}
+	return changes, rows.Err()
+}
+
+// InsertClosure inserts the closing statement into the "account_closures" table.
+func (s *SQLStore) InsertClosure(c *bank.ClosingStatement) error {
+	var transactionID interface{}
+	if c.SettlementID != 0 {
+		transactionID = c.SettlementID
+	}
+
+	_, err := s.q.Exec("INSERT INTO account_closures (account_number, reason, total_credits, total_debits, final_balance, settlement_account, settlement_transaction_id) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		c.Number, c.Reason, c.TotalCredits, c.TotalDebits, c.FinalBalance, nullable(c.SettlementAccount), transactionID)
+	if err != nil {
+		return fmt.Errorf("insertClosure: %w", duplicate(err))
+	}
+	return nil
+}
+
+// GetClosure queries the "account_closures" table for the account's closing statement, in the account's currency.
+func (s *SQLStore) GetClosure(number string) (*bank.ClosingStatement, error) {
+	c := &bank.ClosingStatement{Number: number}
+
+	var settlementAccount sql.NullString
+	var settlementID sql.NullInt64
+	var closedAt sqlTime
+	var currency string
+	row := s.q.QueryRow("SELECT c.reason, c.total_credits, c.total_debits, c.final_balance, a.currency, c.settlement_account, c.settlement_transaction_id, c.closed_at "+
+		"FROM account_closures c JOIN accounts a ON a.account_number = c.account_number WHERE c.account_number = ?", number)
+	if err := row.Scan(&c.Reason, &c.TotalCredits, &c.TotalDebits, &c.FinalBalance, &currency, &settlementAccount, &settlementID, &closedAt); err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrClosureNotFound
+		}
+		return nil, fmt.Errorf("getClosure %v: %v", number, err)
+	}
+	c.SettlementAccount, c.SettlementID, c.ClosedAt = settlementAccount.String, settlementID.Int64, closedAt.Time
+	c.TotalCredits.Currency, c.TotalDebits.Currency, c.FinalBalance.Currency = currency, currency, currency
+	return c, nil
+}
+
+// InsertHold inserts the hold into the "account_holds" table and sets its ID.
+func (s *SQLStore) InsertHold(h *bank.Hold) error {
+	result, err := s.q.Exec("INSERT INTO account_holds (account_number, amount, reason) VALUES (?, ?, ?)", h.Account, h.Amount, h.Reason)
+	if err != nil {
+		return fmt.Errorf("insertHold: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("insertHold: %v", err)
+	}
+	h.ID = id
+	return nil
+}
+
+// holdColumns selects a hold from the "account_holds" table, in the currency of its account.
+const holdColumns = "SELECT h.id, h.account_number, h.amount, a.currency, h.reason, h.created_at FROM account_holds h JOIN accounts a ON a.account_number = h.account_number"
+
+// scanHold reads a row selected with holdColumns into a bank.Hold.
+func scanHold(row scanner) (*bank.Hold, error) {
+	h := &bank.Hold{}
+
+	var createdAt sqlTime
+	if err := row.Scan(&h.ID, &h.Account, &h.Amount, &h.Amount.Currency, &h.Reason, &createdAt); err != nil {
+		return nil, err
+	}
+	h.CreatedAt = createdAt.Time
+	return h, nil
+}
+
+// PendingHold queries the "account_holds" table for the hold, if it hasn't been released.
+func (s *SQLStore) PendingHold(id int64) (*bank.Hold, error) {
+	h, err := scanHold(s.q.QueryRow(holdColumns+" WHERE h.id = ? AND h.released_at IS NULL", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrHoldNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("pendingHold %d: %v", id, err)
+	}
+	return h, nil
+}
+
+// PendingHolds queries the "account_holds" table for the account's holds that haven't been released.
+func (s *SQLStore) PendingHolds(number string) ([]bank.Hold, error) {
+	rows, err := s.q.Query(holdColumns+" WHERE h.account_number = ? AND h.released_at IS NULL ORDER BY h.id", number)
+	if err != nil {
+		return nil, fmt.Errorf("pendingHolds %v: %v", number, err)
+	}
+	defer rows.Close()
+
+	holds := []bank.Hold{}
+	for rows.Next() {
+		h, err := scanHold(rows)
+		if err != nil {
+			return nil, fmt.Errorf("pendingHolds %v: %v", number, err)
+		}
+		holds = append(holds, *h)
+	}
+	return holds, rows.Err()
+}
+
+// ReleaseHold sets the released_at time of the hold in the "account_holds" table.
+func (s *SQLStore) ReleaseHold(h *bank.Hold) error {
+	result, err := s.q.Exec("UPDATE account_holds SET released_at = CURRENT_TIMESTAMP WHERE id = ? AND released_at IS NULL", h.ID)
+	if err != nil {
+		return fmt.Errorf("releaseHold: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("releaseHold: %w", ErrHoldNotFound)
+	}
+	return nil
+}
+
+// dateLayout is the format of DATE columns.
+const dateLayout = "2006-01-02"
+
+// InsertAccrual inserts the accrual into the "interest_accruals" table,
+// whose unique key on the account and date turns a second accrual for the day into ErrDuplicate.
+func (s *SQLStore) InsertAccrual(a *bank.Accrual) error {
+	_, err := s.q.Exec("INSERT INTO interest_accruals (account_number, accrual_date, balance, amount) VALUES (?, ?, ?, ?)",
+		a.Account, a.Date.Format(dateLayout), a.Balance, a.Amount)
+	if err != nil {
+		return fmt.Errorf("insertAccrual: %w", duplicate(err))
+	}
+	return nil
+}
+
+// PendingAccruals queries the "interest_accruals" table for the account's accruals up to the date
+// that have no capitalization transaction yet, in the currency of the account.
+func (s *SQLStore) PendingAccruals(number string, through time.Time) ([]bank.Accrual, error) {
+	rows, err := s.q.Query("SELECT i.account_number, i.accrual_date, i.balance, a.currency, i.amount FROM interest_accruals i JOIN accounts a ON a.account_number = i.account_number "+
+		"WHERE i.account_number = ? AND i.accrual_date <= ? AND i.transaction_id IS NULL ORDER BY i.accrual_date", number, through.Format(dateLayout))
+	if err != nil {
+		return nil, fmt.Errorf("pendingAccruals %v: %v", number, err)
+	}
+	defer rows.Close()
+
+	accruals := []bank.Accrual{}
+	for rows.Next() {
+		var a bank.Accrual
+		var date sqlTime
+		if err := rows.Scan(&a.Account, &date, &a.Balance, &a.Balance.Currency, &a.Amount); err != nil {
+			return nil, fmt.Errorf("pendingAccruals %v: %v", number, err)
+		}
+		a.Date = date.Time
+		accruals = append(accruals, a)
+	}
+	return accruals, rows.Err()
+}
+
+// MarkCapitalized sets the transaction_id of the accruals in the "interest_accruals" table.
+func (s *SQLStore) MarkCapitalized(accruals []bank.Accrual, transactionID int64) error {
+	for _, a := range accruals {
+		_, err := s.q.Exec("UPDATE interest_accruals SET transaction_id = ? WHERE account_number = ? AND accrual_date = ?", transactionID, a.Account, a.Date.Format(dateLayout))
+		if err != nil {
+			return fmt.Errorf("markCapitalized: %v", err)
+		}
+	}
+	return nil
+}
+
+// monthLayout is the format of the month of a maintenance fee.
+const monthLayout = "2006-01"
+
+// InsertMaintenanceFee inserts the fee into the "maintenance_fees" table,
+// whose unique key on the account and month turns a second fee for the month into ErrDuplicate.
+func (s *SQLStore) InsertMaintenanceFee(number string, month time.Time, transactionID int64) error {
+	_, err := s.q.Exec("INSERT INTO maintenance_fees (account_number, fee_month, transaction_id) VALUES (?, ?, ?)", number, month.Format(monthLayout), transactionID)
+	if err != nil {
+		return fmt.Errorf("insertMaintenanceFee: %w", duplicate(err))
+	}
+	return nil
+}
+
+// InsertRequest inserts the request into the "idempotency_keys" table without a response,
+// whose primary key on the key turns a second request with it into ErrDuplicate.
+func (s *SQLStore) InsertRequest(r *IdempotentRequest) error {
+	_, err := s.q.Exec("INSERT INTO idempotency_keys (idempotency_key, fingerprint, expires_at) VALUES (?, ?, ?)", r.Key, r.Fingerprint, r.ExpiresAt.UTC().Format(timeLayout))
+	if err != nil {
+		return fmt.Errorf("insertRequest: %w", duplicate(err))
+	}
+	return nil
+}
+
+// GetRequest queries the "idempotency_keys" table for the request made with the key.
+func (s *SQLStore) GetRequest(key string) (*IdempotentRequest, error) {
+	r := &IdempotentRequest{Key: key}
+
+	var status sql.NullInt64
+	var contentType, location sql.NullString
+	var createdAt, expiresAt sqlTime
+	err := s.q.QueryRow("SELECT fingerprint, status_code, content_type, location, response_body, created_at, expires_at FROM idempotency_keys WHERE idempotency_key = ?", key).
+		Scan(&r.Fingerprint, &status, &contentType, &location, &r.Body, &createdAt, &expiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRequestNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getRequest %v: %v", key, err)
+	}
+	r.Status, r.ContentType, r.Location = int(status.Int64), contentType.String, location.String
+	r.CreatedAt, r.ExpiresAt = createdAt.Time, expiresAt.Time
+	return r, nil
+}
+
+// SaveResponse sets the response columns of the request in the "idempotency_keys" table.
+func (s *SQLStore) SaveResponse(r *IdempotentRequest) error {
+	result, err := s.q.Exec("UPDATE idempotency_keys SET status_code = ?, content_type = ?, location = ?, response_body = ? WHERE idempotency_key = ?",
+		r.Status, nullable(r.ContentType), nullable(r.Location), r.Body, r.Key)
+	if err != nil {
+		return fmt.Errorf("saveResponse: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("saveResponse: %w", ErrRequestNotFound)
+	}
+	return nil
+}
+
+// DeleteRequest deletes the request made with the key from the "idempotency_keys" table.
+func (s *SQLStore) DeleteRequest(key string) error {
+	if _, err := s.q.Exec("DELETE FROM idempotency_keys WHERE idempotency_key = ?", key); err != nil {
+		return fmt.Errorf("deleteRequest: %v", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes the requests that expired at or before t from the "idempotency_keys" table.
+func (s *SQLStore) DeleteExpired(t time.Time) (int64, error) {
+	result, err := s.q.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", t.UTC().Format(timeLayout))
+	if err != nil {
+		return 0, fmt.Errorf("deleteExpired: %v", err)
+	}
+	return result.RowsAffected()
+}
+
+// InsertAPIKey inserts the API key into the "api_keys" table and sets its ID.
+func (s *SQLStore) InsertAPIKey(k *APIKey) error {
+	result, err := s.q.Exec("INSERT INTO api_keys (name, key_hash, role) VALUES (?, ?, ?)", k.Name, k.Hash, k.Role)
+	if err != nil {
+		return fmt.Errorf("insertAPIKey: %w", duplicate(err))
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("insertAPIKey: %v", err)
+	}
+	k.ID = id
+	return nil
+}
+
+// APIKeyByHash queries the "api_keys" table for the key with the hash.
+func (s *SQLStore) APIKeyByHash(hash string) (*APIKey, error) {
+	k := &APIKey{Hash: hash}
+
+	var createdAt sqlTime
+	err := s.q.QueryRow("SELECT id, name, role, created_at FROM api_keys WHERE key_hash = ?", hash).Scan(&k.ID, &k.Name, &k.Role, &createdAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("apiKeyByHash: %v", err)
+	}
+	k.CreatedAt = createdAt.Time
+	return k, nil
+}
+
+// SaveLogin updates the customer's row of the "customer_logins" table, or inserts it if they have none.
+func (s *SQLStore) SaveLogin(l *Login) error {
+	var n int
+	if err := s.q.QueryRow("SELECT COUNT(*) FROM customer_logins WHERE user_id = ?", l.CustomerID).Scan(&n); err != nil {
+		return fmt.Errorf("saveLogin: %v", err)
+	}
+
+	query := "INSERT INTO customer_logins (username, password_hash, user_id) VALUES (?, ?, ?)"
+	if n > 0 {
+		query = "UPDATE customer_logins SET username = ?, password_hash = ?, updated_at = CURRENT_TIMESTAMP WHERE user_id = ?"
+	}
+	if _, err := s.q.Exec(query, l.Username, l.PasswordHash, l.CustomerID); err != nil {
+		return fmt.Errorf("saveLogin: %w", duplicate(err))
+	}
+	return nil
+}
+
+// LoginByUsername queries the "customer_logins" table for the login with the username.
+func (s *SQLStore) LoginByUsername(username string) (*Login, error) {
+	l := &Login{Username: username}
+
+	err := s.q.QueryRow("SELECT user_id, password_hash FROM customer_logins WHERE username = ?", username).Scan(&l.CustomerID, &l.PasswordHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrLoginNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("loginByUsername: %v", err)
+	}
+	return l, nil
+}
+
+// RolePermissions queries the "role_permissions" table for the role's permissions.
+func (s *SQLStore) RolePermissions(role bank.Role) ([]bank.Permission, error) {
+	rows, err := s.q.Query("SELECT permission FROM role_permissions WHERE role = ? ORDER BY permission", role)
+	if err != nil {
+		return nil, fmt.Errorf("rolePermissions %v: %v", role, err)
+	}
+	defer rows.Close()
+
+	var permissions []bank.Permission
+	for rows.Next() {
+		var p bank.Permission
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("rolePermissions %v: %v", role, err)
+		}
+		permissions = append(permissions, p)
+	}
+	return permissions, rows.Err()
+}
+
+// InsertOperation inserts the operation into the "pending_operations" table and sets its ID.
+func (s *SQLStore) InsertOperation(o *bank.PendingOperation) error {
+	if o.RequestedAt.IsZero() {
+		o.RequestedAt = time.Now().UTC()
+	}
+	result, err := s.q.Exec("INSERT INTO pending_operations (type, account_number, to_account_number, amount, note, currency, status, requested_by, requested_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		o.Type, o.Account, nullable(o.To), o.Amount, nullable(o.Note), o.Amount.Currency, o.Status, o.RequestedBy, o.RequestedAt.UTC().Format(timeLayout))
+	if err != nil {
+		return fmt.Errorf("insertOperation: %v", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("insertOperation: %v", err)
+	}
+	o.ID = id
+	return nil
+}
+
+// operationColumns selects an operation from the "pending_operations" table.
+const operationColumns = "SELECT id, type, account_number, to_account_number, amount, note, currency, status, requested_by, requested_at, decided_by, decided_at, reason, transaction_id FROM pending_operations"
+
+// scanOperation reads a row selected with operationColumns into a bank.PendingOperation.
+func scanOperation(row scanner) (*bank.PendingOperation, error) {
+	o := &bank.PendingOperation{}
+
+	var to, note, decidedBy, reason sql.NullString
+	var transaction sql.NullInt64
+	var requestedAt, decidedAt sqlTime
+	if err := row.Scan(&o.ID, &o.Type, &o.Account, &to, &o.Amount, &note, &o.Amount.Currency, &o.Status, &o.RequestedBy, &requestedAt, &decidedBy, &decidedAt, &reason, &transaction); err != nil {
+		return nil, err
+	}
+	o.To, o.Note, o.DecidedBy, o.Reason, o.Transaction = to.String, note.String, decidedBy.String, reason.String, transaction.Int64
+	o.RequestedAt, o.DecidedAt = requestedAt.Time, decidedAt.Time
+	return o, nil
+}
+
+// GetOperation queries the "pending_operations" table for the operation.
+func (s *SQLStore) GetOperation(id int64) (*bank.PendingOperation, error) {
+	o, err := scanOperation(s.q.QueryRow(operationColumns+" WHERE id = ?", id))
+	if err == sql.ErrNoRows {
+		return nil, ErrOperationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("getOperation %d: %v", id, err)
+	}
+	return o, nil
+}
+
+// Operations queries the "pending_operations" table for the operations with the status.
+func (s *SQLStore) Operations(status bank.OperationStatus) ([]*bank.PendingOperation, error) {
+	query, args := operationColumns, []interface{}{}
+	if status != "" {
+		query, args = query+" WHERE status = ?", append(args, status)
+	}
+	rows, err := s.q.Query(query+" ORDER BY id", args...)
+	if err != nil {
+		return nil, fmt.Errorf("operations: %v", err)
+	}
+	defer rows.Close()
+
+	operations := []*bank.PendingOperation{}
+	for rows.Next() {
+		o, err := scanOperation(rows)
+		if err != nil {
+			return nil, fmt.Errorf("operations: %v", err)
+		}
+		operations = append(operations, o)
+	}
+	return operations, rows.Err()
+}
+
+// DecideOperation sets the decision columns of the operation in the "pending_operations" table,
+// if the row is still pending.
+func (s *SQLStore) DecideOperation(o *bank.PendingOperation) error {
+	var transaction interface{}
+	if o.Transaction != 0 {
+		transaction = o.Transaction
+	}
+	result, err := s.q.Exec("UPDATE pending_operations SET status = ?, decided_by = ?, decided_at = ?, reason = ?, transaction_id = ? WHERE id = ? AND status = ?",
+		o.Status, o.DecidedBy, o.DecidedAt.UTC().Format(timeLayout), nullable(o.Reason), transaction, o.ID, bank.OperationPending)
+	if err != nil {
+		return fmt.Errorf("decideOperation: %v", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return fmt.Errorf("decideOperation: %w: operation %d", bank.ErrNotPending, o.ID)
+	}
+	return nil
+}
+
+// AppendEntry inserts the entry into the "audit_log" table, chained to the last row.
+// The unique index on prev_hash refuses a second entry chained to the same row.
+// On MySQL the last row is read with FOR UPDATE, so that in a transaction it is the last one committed, not the one of the snapshot.
+func (s *SQLStore) AppendEntry(e *AuditEntry) error {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now()
+	}
+	e.CreatedAt = e.CreatedAt.UTC().Truncate(time.Second)
+	query := "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1"
+	if s.driver == MySQL {
+		query += " FOR UPDATE"
+	}
+	e.PrevHash = ""
+	err := s.q.QueryRow(query).Scan(&e.PrevHash)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("appendEntry: %v", err)
+	}
+	e.Hash = e.Sum()
+
+	result, err := s.q.Exec("INSERT INTO audit_log (actor, action, target, account_number, state_before, state_after, request_id, status, created_at, prev_hash, hash) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		e.Actor, e.Action, e.Target, nullable(e.Account), nullable(e.Before), nullable(e.After), e.RequestID, e.Status, e.CreatedAt.Format(timeLayout), e.PrevHash, e.Hash)
+	if err != nil {
+		return fmt.Errorf("appendEntry: %w", duplicate(err))
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("appendEntry: %v", err)
+	}
+	e.ID = id
+	return nil
+}
+
+// AuditEntries queries the "audit_log" table for the entries matching the filter.
+func (s *SQLStore) AuditEntries(filter AuditFilter) ([]*AuditEntry, error) {
+	var where []string
+	var args []interface{}
+
+	if filter.Actor != "" {
+		where = append(where, "actor = ?")
+		args = append(args, filter.Actor)
+	}
+	if filter.Account != "" {
+		where = append(where, "account_number = ?")
+		args = append(args, filter.Account)
+	}
+	if filter.Target != "" {
+		where = append(where, "target = ?")
+		args = append(args, filter.Target)
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.Since.UTC().Format(timeLayout))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.Until.UTC().Format(timeLayout))
+	}
+	if filter.After > 0 {
+		where = append(where, "id > ?")
+		args = append(args, filter.After)
+	}
+
+	query := "SELECT id, actor, action, target, account_number, state_before, state_after, request_id, status, created_at, prev_hash, hash FROM audit_log"
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id"
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("auditEntries: %v", err)
+	}
+	defer rows.Close()
+
+	entries := []*AuditEntry{}
+	for rows.Next() {
+		e := &AuditEntry{}
+		var account, before, after sql.NullString
+		var createdAt sqlTime
+		if err := rows.Scan(&e.ID, &e.Actor, &e.Action, &e.Target, &account, &before, &after, &e.RequestID, &e.Status, &createdAt, &e.PrevHash, &e.Hash); err != nil {
+			return nil, fmt.Errorf("auditEntries: %v", err)
+		}
+		e.Account, e.Before, e.After, e.CreatedAt = account.String, before.String, after.String, createdAt.UTC()
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// Record inserts the transaction and its entries.
+// It sets the ID of the transaction to the ID of the inserted "transactions" row.
+// The converted amount and rate of a transfer between currencies are stored with the transaction.
+func (s *SQLStore) Record(t *bank.Transaction) error {
+	var converted, convertedCurrency, rate interface{}
+	if t.Rate != nil {
+		converted, convertedCurrency, rate = t.Converted, t.Converted.Currency, t.Rate.String()
+	}
+
+	result, err := s.q.Exec("INSERT INTO transactions (type, amount, currency, converted_amount, converted_currency, rate) VALUES (?, ?, ?, ?, ?, ?)",
+		t.Type, t.Amount, currencyOf(t.Amount), converted, convertedCurrency, rate)
+	if err != nil {
+		return fmt.Errorf("recordTransaction: %v", err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("recordTransaction: %v", err)
+	}
+
+	for _, e := range t.Entries {
+		var balance interface{}
+		if !bank.IsInternal(e.Account) {
+			balance = e.Balance
+		}
+
+		_, err := s.q.Exec("INSERT INTO ledger_entries (transaction_id, account_number, direction, amount, currency, balance_after) VALUES (?, ?, ?, ?, ?, ?)", id, e.Account, e.Direction, e.Amount, currencyOf(e.Amount), balance)
+		if err != nil {
+			return fmt.Errorf("recordEntry: %v", err)
+		}
+	}
+
+	t.ID = id
+	return nil
+}
+
+// Entries returns every ledger entry posted to the given account, oldest first.
+func (s *SQLStore) Entries(account string) ([]bank.Entry, error) {
+	rows, err := s.q.Query("SELECT account_number, direction, amount, currency, balance_after FROM ledger_entries WHERE account_number = ? ORDER BY id", account)
+	if err != nil {
+		return nil, fmt.Errorf("ledgerEntries %v: %v", account, err)
+	}
+	defer rows.Close()
+
+	var entries []bank.Entry
+	for rows.Next() {
+		var e bank.Entry
+		if err := rows.Scan(&e.Account, &e.Direction, &e.Amount, &e.Amount.Currency, &e.Balance); err != nil {
+			return nil, fmt.Errorf("ledgerEntries %v: %v", account, err)
+		}
+		e.Balance.Currency = e.Amount.Currency
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// currencyOf returns the currency of the amount, bank.DefaultCurrency if it has none.
+func currencyOf(m bank.Money) string {
+	if m.Currency == "" {
+		return bank.DefaultCurrency
+	}
+	return m.Currency
+}
+
+// timeLayout is the format timestamps are compared in.
+const timeLayout = "2006-01-02 15:04:05"
+
+// History joins the account's ledger entries with their transactions, newest first.
+// The counterparty of each line is the customer account of another entry of the transaction, if any.
+func (s *SQLStore) History(number string, filter TransactionFilter) ([]bank.StatementLine, error) {
+	where := []string{"e.account_number = ?"}
+	args := []interface{}{number}
+
+	if !filter.Since.IsZero() {
+		where = append(where, "t.created_at >= ?")
+		args = append(args, filter.Since.UTC().Format(timeLayout))
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "t.created_at < ?")
+		args = append(args, filter.Until.UTC().Format(timeLayout))
+	}
+	if filter.Type != "" {
+		where = append(where, "t.type = ?")
+		args = append(args, filter.Type)
+	}
+	if filter.MinAmount != nil {
+		where = append(where, "e.amount >= ?")
+		args = append(args, *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		where = append(where, "e.amount <= ?")
+		args = append(args, *filter.MaxAmount)
+	}
+	if filter.Before > 0 {
+		where = append(where, "e.id < ?")
+		args = append(args, filter.Before)
+	}
+
+	query := "SELECT e.id, t.type, e.direction, e.amount, e.currency, e.balance_after, t.created_at, " +
+		"(SELECT o.account_number FROM ledger_entries o WHERE o.transaction_id = e.transaction_id AND o.account_number NOT IN (?, ?, ?, ?, ?, ?) LIMIT 1) " +
+		"FROM ledger_entries e JOIN transactions t ON t.id = e.transaction_id " +
+		"WHERE " + strings.Join(where, " AND ") + " ORDER BY e.id DESC"
+	args = append([]interface{}{number, bank.CashAccount, bank.FXAccount, bank.InterestAccount, bank.FeeAccount, bank.AdjustmentAccount}, args...)
+	if filter.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, filter.Limit)
+	}
+
+	rows, err := s.q.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("getTransactions %v: %v", number, err)
+	}
+	defer rows.Close()
+
+	lines := []bank.StatementLine{}
+	for rows.Next() {
+		var line bank.StatementLine
+		var date sqlTime
+		var counterparty sql.NullString
+		if err := rows.Scan(&line.ID, &line.Type, &line.Direction, &line.Amount, &line.Amount.Currency, &line.Balance, &date, &counterparty); err != nil {
+			return nil, fmt.Errorf("getTransactions %v: %v", number, err)
+		}
+		line.Balance.Currency = line.Amount.Currency
+		line.Counterparty = counterparty.String
+		line.Date = date.Time
+		lines = append(lines, line)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("getTransactions %v: %v", number, err)
+	}
+	return lines, nil
+}
+
+// BalanceBefore returns the balance_after of the account's last ledger entry before t.
+func (s *SQLStore) BalanceBefore(a *bank.Account, t time.Time) (bank.Money, error) {
+	balance := bank.NewMoney(0, a.Balance.Currency)
+
+	row := s.q.QueryRow("SELECT e.balance_after FROM ledger_entries e JOIN transactions t ON t.id = e.transaction_id WHERE e.account_number = ? AND t.created_at < ? ORDER BY e.id DESC LIMIT 1", a.Number, t.UTC().Format(timeLayout))
+	if err := row.Scan(&balance); err != nil && err != sql.ErrNoRows {
+		return bank.Money{}, fmt.Errorf("balanceBefore %v: %v", a.Number, err)
+	}
+	return balance, nil
+}
+
+// sqlTime scans a timestamp column whether the driver returns it as a time.Time or as text.
+type sqlTime struct {
+	time.Time
+}
+
+// Scan implements sql.Scanner.
+func (t *sqlTime) Scan(src interface{}) error {
+	var s string
+	switch v := src.(type) {
+	case time.Time:
+		t.Time = v
+		return nil
+	case []byte:
+		s = string(v)
+	case string:
+		s = v
+	case nil:
+		t.Time = time.Time{}
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into a time", src)
+	}
+
+	for _, layout := range []string{timeLayout, time.RFC3339Nano, dateLayout} {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			t.Time = parsed
+			return nil
+		}
+	}
+	return fmt.Errorf("cannot parse time %q", s)
+}
@@ -0,0 +1,304 @@
+package db
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/themobileprof/bank"
+)
+
+// ErrAccountNotFound is returned when no account has the requested number.
+var ErrAccountNotFound = errors.New("account not found")
+
+// ErrCustomerNotFound is returned when no customer has the requested ID.
+var ErrCustomerNotFound = errors.New("customer not found")
+
+// ErrHoldNotFound is returned when no pending hold has the requested ID.
+var ErrHoldNotFound = errors.New("hold not found")
+
+// ErrClosureNotFound is returned when the requested account hasn't been closed.
+var ErrClosureNotFound = errors.New("account closure not found")
+
+// ErrOperationNotFound is returned when no pending operation has the requested ID.
+var ErrOperationNotFound = errors.New("pending operation not found")
+
+// ErrRequestNotFound is returned when no request was made with the requested idempotency key.
+var ErrRequestNotFound = errors.New("idempotent request not found")
+
+// ErrAPIKeyNotFound is returned when no API key has the requested hash.
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+// ErrLoginNotFound is returned when no customer signs in with the requested username.
+var ErrLoginNotFound = errors.New("login not found")
+
+// ErrDuplicate is returned when a row would break a unique constraint,
+// such as a second customer with the same email or a reused account number.
+var ErrDuplicate = errors.New("duplicate entry")
+
+// CustomerRepository stores bank customers (the "users" table).
+type CustomerRepository interface {
+	// InsertCustomer stores a new customer, sets its ID and returns it.
+	InsertCustomer(c *bank.Customer) (int64, error)
+	// GetCustomer returns the customer with the given ID, or ErrCustomerNotFound.
+	GetCustomer(id int64) (*bank.Customer, error)
+	// UpdateCustomer stores the details of an existing customer, found by its ID.
+	UpdateCustomer(c *bank.Customer) error
+}
+
+// AccountRepository stores bank accounts (the "accounts" table) along with their owner's details
+// and the total of their pending holds.
+type AccountRepository interface {
+	// InsertAccount stores a new account owned by the customer and returns its ID.
+	InsertAccount(customerID int64, a *bank.Account) (int64, error)
+	// GetAccountByNumber returns the account with the given number, or ErrAccountNotFound.
+	GetAccountByNumber(number string) (*bank.Account, error)
+	// LastAccountNumber returns the highest account number that starts with the prefix, or "" if there is none.
+	LastAccountNumber(prefix string) (string, error)
+	// AccountsByCustomer returns the accounts owned by the customer, in the order they were opened.
+	AccountsByCustomer(customerID int64) ([]*bank.Account, error)
+	// AccountsByType returns every account of the type, in the order they were opened.
+	AccountsByType(accountType bank.AccountType) ([]*bank.Account, error)
+	// UpdateStatus stores the status of the account and records the change that led to it.
+	UpdateStatus(a *bank.Account, change *bank.StatusChange) error
+	// StatusChanges returns the status changes of the account, oldest first.
+	StatusChanges(number string) ([]bank.StatusChange, error)
+	// LockAccounts returns the given accounts, locked until the surrounding transaction ends.
+	// The accounts are locked in ascending account number order, whatever order they are passed in,
+	// so two transactions touching the same accounts can't deadlock each other.
+	// Accounts that don't exist are left out of the returned map.
+	LockAccounts(numbers ...string) (map[string]*bank.Account, error)
+	// UpdateBalance stores the balance of the account.
+	UpdateBalance(a *bank.Account) error
+	// UpdateOverdraft stores the overdraft limit of the account.
+	UpdateOverdraft(a *bank.Account) error
+	// InsertClosure stores the closing statement of a closed account.
+	InsertClosure(c *bank.ClosingStatement) error
+	// GetClosure returns the closing statement of the account, or ErrClosureNotFound.
+	GetClosure(number string) (*bank.ClosingStatement, error)
+}
+
+// HoldRepository stores holds on account balances (the "account_holds" table).
+type HoldRepository interface {
+	// InsertHold stores a pending hold and sets its ID.
+	InsertHold(h *bank.Hold) error
+	// PendingHold returns the pending hold with the given ID, or ErrHoldNotFound.
+	PendingHold(id int64) (*bank.Hold, error)
+	// PendingHolds returns the account's pending holds, oldest first.
+	PendingHolds(number string) ([]bank.Hold, error)
+	// ReleaseHold marks the hold released, so it no longer counts towards the account's held total.
+	ReleaseHold(h *bank.Hold) error
+}
+
+// InterestRepository stores the interest accounts accrue day by day until it is capitalized
+// (the "interest_accruals" table).
+type InterestRepository interface {
+	// InsertAccrual stores the accrual. An account accrues once per business date:
+	// a second accrual for the same date is an ErrDuplicate.
+	InsertAccrual(a *bank.Accrual) error
+	// PendingAccruals returns the account's accruals up to and including the date
+	// that haven't been capitalized, oldest first.
+	PendingAccruals(number string, through time.Time) ([]bank.Accrual, error)
+	// MarkCapitalized records the transaction that capitalized the accruals.
+	MarkCapitalized(accruals []bank.Accrual, transactionID int64) error
+}
+
+// FeeRepository records the maintenance fees charged to accounts (the "maintenance_fees" table).
+type FeeRepository interface {
+	// InsertMaintenanceFee records the transaction that charged the account its maintenance fee for the month.
+	// An account is charged once a month: a second fee for the same month is an ErrDuplicate.
+	InsertMaintenanceFee(number string, month time.Time, transactionID int64) error
+}
+
+// IdempotentRequest is a request made with an idempotency key and, once it has been handled, its response.
+type IdempotentRequest struct {
+	Key         string
+	Fingerprint string    // Hash of what was requested, so a key reused for another request can be told apart.
+	Status      int       // HTTP status of the response, zero while the request is being handled.
+	ContentType string    // Content-Type of the response.
+	Location    string    // Location of the response, if any.
+	Body        []byte    // Body of the response.
+	CreatedAt   time.Time // When the request was first made.
+	ExpiresAt   time.Time // When the key can be used again.
+}
+
+// Done reports whether the request has been handled and its response stored.
+func (r *IdempotentRequest) Done() bool {
+	return r.Status != 0
+}
+
+// IdempotencyRepository stores the requests made with idempotency keys (the "idempotency_keys" table).
+type IdempotencyRepository interface {
+	// InsertRequest stores the request before it is handled. A key is used once:
+	// a second request with it is an ErrDuplicate until the first is deleted or expires.
+	InsertRequest(r *IdempotentRequest) error
+	// GetRequest returns the request made with the key, or ErrRequestNotFound.
+	GetRequest(key string) (*IdempotentRequest, error)
+	// SaveResponse stores the response of the request.
+	SaveResponse(r *IdempotentRequest) error
+	// DeleteRequest removes the request made with the key, so the key can be used again.
+	DeleteRequest(key string) error
+	// DeleteExpired removes the requests that expired at or before t and returns how many there were.
+	DeleteExpired(t time.Time) (int64, error)
+}
+
+// ApprovalRepository stores the operations over the approval limits and their decisions
+// (the "pending_operations" table).
+type ApprovalRepository interface {
+	// InsertOperation stores the pending operation and sets its ID.
+	InsertOperation(o *bank.PendingOperation) error
+	// GetOperation returns the operation with the given ID, or ErrOperationNotFound.
+	GetOperation(id int64) (*bank.PendingOperation, error)
+	// Operations returns the operations with the status, or all of them if status is empty, oldest first.
+	Operations(status bank.OperationStatus) ([]*bank.PendingOperation, error)
+	// DecideOperation stores the decision of the operation and the transaction posted on its approval.
+	// An operation that was decided in the meantime is a bank.ErrNotPending.
+	DecideOperation(o *bank.PendingOperation) error
+}
+
+// ErrBrokenChain is returned when the audit log has an entry that was altered, removed or inserted after it was written.
+var ErrBrokenChain = errors.New("audit log chain is broken")
+
+// AuditEntry is a change made to the bank's state, as recorded in the append-only audit log.
+// Each entry's hash covers the hash of the entry before it, so the entries form a chain
+// that no entry can be altered, removed or inserted in without breaking.
+type AuditEntry struct {
+	ID        int64
+	Actor     string    // Who made the change, such as "key:back-office" or "customer:1", empty if unknown.
+	Action    string    // What was done, such as "POST /v1/accounts/{number}/deposits".
+	Target    string    // What was changed, such as "account:0017286378" or "customer:1", empty if nothing in particular.
+	Account   string    // Number of the account changed, if any.
+	Before    string    // JSON state of the target before the change, empty if it didn't exist.
+	After     string    // JSON state of the target after the change, empty if it doesn't exist anymore.
+	RequestID string    // ID of the request that made the change.
+	Status    int       // HTTP status of the response to the request, zero for changes made outside the API.
+	CreatedAt time.Time // When the change was made, to the second.
+	PrevHash  string    // Hash of the entry before, empty for the first entry.
+	Hash      string    // Hex SHA-256 hash of the entry, see Sum.
+}
+
+// Sum returns the hash of the entry's fields and of the entry before it.
+// Fields are length prefixed, so no two entries hash the same fields.
+func (e *AuditEntry) Sum() string {
+	h := sha256.New()
+	for _, field := range []string{e.PrevHash, e.Actor, e.Action, e.Target, e.Account, e.Before, e.After, e.RequestID, strconv.Itoa(e.Status), e.CreatedAt.UTC().Format(time.RFC3339)} {
+		fmt.Fprintf(h, "%d:%s\n", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// VerifyAuditChain checks the entries, the whole audit log oldest first, and returns an ErrBrokenChain
+// naming the first entry whose hash doesn't match its fields or that doesn't follow the entry before it.
+func VerifyAuditChain(entries []*AuditEntry) error {
+	prev := ""
+	for _, e := range entries {
+		if e.PrevHash != prev {
+			return fmt.Errorf("%w: entry %d doesn't follow the entry before it", ErrBrokenChain, e.ID)
+		}
+		if e.Hash != e.Sum() {
+			return fmt.Errorf("%w: entry %d was altered", ErrBrokenChain, e.ID)
+		}
+		prev = e.Hash
+	}
+	return nil
+}
+
+// AuditFilter narrows down the audit log entries returned. Zero values mean "no restriction".
+type AuditFilter struct {
+	Actor   string    // Only changes made by this actor.
+	Account string    // Only changes to this account.
+	Target  string    // Only changes to this target.
+	Since   time.Time // Only changes at or after this time.
+	Until   time.Time // Only changes before this time.
+	After   int64     // Only entries with an ID higher than this one.
+	Limit   int       // Maximum number of entries, zero for no limit.
+}
+
+// AuditRepository is the append-only audit log (the "audit_log" table). Entries are never updated nor deleted.
+type AuditRepository interface {
+	// AppendEntry chains the entry to the last one, setting its PrevHash and Hash, stores it and sets its ID.
+	// A zero CreatedAt is set to now. An entry appended in the meantime by someone else is an ErrDuplicate:
+	// appending the entry again chains it to that one.
+	AppendEntry(e *AuditEntry) error
+	// AuditEntries returns the entries matching the filter, oldest first.
+	AuditEntries(filter AuditFilter) ([]*AuditEntry, error)
+}
+
+// APIKey is a key a back-office integration authenticates with. Only a hash of the key is stored.
+type APIKey struct {
+	ID        int64
+	Name      string    // Who the key was issued to.
+	Hash      string    // Hex SHA-256 hash of the key.
+	Role      bank.Role // What the integration acts as.
+	CreatedAt time.Time
+}
+
+// Login is the username and password hash a customer signs in with.
+type Login struct {
+	CustomerID   int64
+	Username     string
+	PasswordHash string
+}
+
+// AuthRepository stores the credentials callers authenticate with and the permissions of the roles they act as
+// (the "api_keys", "customer_logins" and "role_permissions" tables).
+type AuthRepository interface {
+	// InsertAPIKey stores the API key and sets its ID. Names are unique: a second key with the same name is an ErrDuplicate.
+	InsertAPIKey(k *APIKey) error
+	// APIKeyByHash returns the API key with the given hash, or ErrAPIKeyNotFound.
+	APIKeyByHash(hash string) (*APIKey, error)
+	// SaveLogin stores the customer's login, replacing the one they had.
+	// Usernames are unique: a username another customer signs in with is an ErrDuplicate.
+	SaveLogin(l *Login) error
+	// LoginByUsername returns the login with the given username, or ErrLoginNotFound.
+	LoginByUsername(username string) (*Login, error)
+	// RolePermissions returns the permissions of the role, none for a role without any.
+	RolePermissions(role bank.Role) ([]bank.Permission, error)
+}
+
+// TransactionFilter narrows down the transactions returned for an account.
+// Zero values mean "no restriction".
+type TransactionFilter struct {
+	Since     time.Time            // Only transactions at or after this time.
+	Until     time.Time            // Only transactions before this time.
+	Type      bank.TransactionType // Only this type of transaction.
+	MinAmount *bank.Money          // Smallest amount, inclusive.
+	MaxAmount *bank.Money          // Largest amount, inclusive.
+	Before    int64                // Only lines with an ID lower than this one.
+	Limit     int                  // Maximum number of lines, zero for no limit.
+}
+
+// TransactionRepository is the journal of posted transactions
+// (the "transactions" and "ledger_entries" tables).
+type TransactionRepository interface {
+	bank.Journal
+
+	// History returns the account's transactions matching the filter as statement lines, newest first.
+	History(number string, filter TransactionFilter) ([]bank.StatementLine, error)
+	// BalanceBefore returns the running balance of the account after its last transaction before t.
+	// An account with no transactions before then had a zero balance.
+	BalanceBefore(a *bank.Account, t time.Time) (bank.Money, error)
+}
+
+// Store gives access to the repositories of a storage backend.
+type Store interface {
+	Customers() CustomerRepository
+	Accounts() AccountRepository
+	Transactions() TransactionRepository
+	Holds() HoldRepository
+	Interest() InterestRepository
+	Fees() FeeRepository
+	Idempotency() IdempotencyRepository
+	Auth() AuthRepository
+	Approvals() ApprovalRepository
+	Audit() AuditRepository
+
+	// Atomic runs fn inside a transaction. The store passed to fn reads and writes through
+	// the transaction, and everything fn did is rolled back if it returns an error.
+	// Called on a store that already runs in a transaction, it runs fn in that transaction
+	// and only rolls back what fn did.
+	Atomic(fn func(tx Store) error) error
+}
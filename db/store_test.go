@@ -0,0 +1,915 @@
+package db
+
+import (
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/themobileprof/bank"
+)
+
+// testStores returns an empty store of every backend that needs no server.
+func testStores(t *testing.T) map[string]Store {
+	sqlite, err := Open(Config{Driver: SQLite, Path: ":memory:", Schema: os.DirFS("../bankapi/db/migrations")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return map[string]Store{
+		Memory: NewMemoryStore(),
+		SQLite: sqlite,
+	}
+}
+
+func TestStoreAtomicRollback(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testAtomicRollback(t, s) })
+	}
+}
+
+func testAtomicRollback(t *testing.T, s Store) {
+	id, err := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Accounts().InsertAccount(id, &bank.Account{Number: "0017286376"}); err != nil {
+		t.Fatal(err)
+	}
+
+	failed := errors.New("failed")
+	err = s.Atomic(func(tx Store) error {
+		accounts, err := tx.Accounts().LockAccounts("0017286376")
+		if err != nil {
+			return err
+		}
+		account := accounts["0017286376"]
+		if _, err := bank.NewLedger(tx.Transactions()).Deposit(account, bank.NewMoney(500, bank.DefaultCurrency)); err != nil {
+			return err
+		}
+		if err := tx.Accounts().UpdateBalance(account); err != nil {
+			return err
+		}
+		return failed
+	})
+	if err != failed {
+		t.Fatalf("expected the error from fn, got %v", err)
+	}
+
+	account, err := s.Accounts().GetAccountByNumber("0017286376")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !account.Balance.IsZero() {
+		t.Errorf("expected the balance to be rolled back, got %s", account.Balance)
+	}
+	if entries, _ := s.Transactions().Entries("0017286376"); len(entries) != 0 {
+		t.Errorf("expected no ledger entries, got %d", len(entries))
+	}
+}
+
+func TestStoreNestedAtomic(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testNestedAtomic(t, s) })
+	}
+}
+
+func testNestedAtomic(t *testing.T, s Store) {
+	failed := errors.New("failed")
+	err := s.Atomic(func(tx Store) error {
+		if _, err := tx.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"}); err != nil {
+			return err
+		}
+		err := tx.Atomic(func(inner Store) error {
+			if _, err := inner.Customers().InsertCustomer(&bank.Customer{Name: "Sam Song", Email: "sam@example.com"}); err != nil {
+				return err
+			}
+			return failed
+		})
+		if err != failed {
+			t.Errorf("expected the error from the inner fn, got %v", err)
+		}
+		return tx.Atomic(func(inner Store) error {
+			_, err := inner.Customers().InsertCustomer(&bank.Customer{Name: "Ada Obi", Email: "ada@example.com"})
+			return err
+		})
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the failed inner fn was rolled back
+	for email, kept := range map[string]bool{"jane@example.com": true, "sam@example.com": false, "ada@example.com": true} {
+		if _, err := s.Customers().InsertCustomer(&bank.Customer{Name: "Again", Email: email}); errors.Is(err, ErrDuplicate) != kept {
+			t.Errorf("%s: expected the customer to be kept %v, got %v", email, kept, err)
+		}
+	}
+}
+
+func TestStoreDuplicates(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testDuplicates(t, s) })
+	}
+}
+
+func testDuplicates(t *testing.T, s Store) {
+	id, _ := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	if _, err := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a duplicate email error, got %v", err)
+	}
+
+	s.Accounts().InsertAccount(id, &bank.Account{Number: "0017286376"})
+	if _, err := s.Accounts().InsertAccount(id, &bank.Account{Number: "0017286376"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a duplicate account number error, got %v", err)
+	}
+}
+
+func TestStoreHistory(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testHistory(t, s) })
+	}
+}
+
+func testHistory(t *testing.T, s Store) {
+	for _, number := range []string{"0017286376", "0018989351"} {
+		id, err := s.Customers().InsertCustomer(&bank.Customer{Name: "Tester", Email: number + "@example.com", DoB: "1990-01-01"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := s.Accounts().InsertAccount(id, &bank.Account{Number: number, Balance: bank.NewMoney(0, bank.DefaultCurrency)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err := s.Atomic(func(tx Store) error {
+		accounts, err := tx.Accounts().LockAccounts("0018989351", "0017286376")
+		if err != nil {
+			return err
+		}
+		from, to := accounts["0017286376"], accounts["0018989351"]
+
+		ledger := bank.NewLedger(tx.Transactions())
+		if _, err := ledger.Deposit(from, bank.NewMoney(1050, bank.DefaultCurrency)); err != nil {
+			return err
+		}
+		if _, err := ledger.Transfer(from, to, bank.NewMoney(250, bank.DefaultCurrency)); err != nil {
+			return err
+		}
+		if err := tx.Accounts().UpdateBalance(from); err != nil {
+			return err
+		}
+		return tx.Accounts().UpdateBalance(to)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	account, err := s.Accounts().GetAccountByNumber("0017286376")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Balance.String() != "8.00" || account.DoB != "1990-01-01" {
+		t.Errorf("unexpected account: %+v", account)
+	}
+	if err := bank.NewLedger(s.Transactions()).Verify(account); err != nil {
+		t.Error(err)
+	}
+
+	lines, err := s.Transactions().History("0017286376", TransactionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d", len(lines))
+	}
+	if lines[0].Type != bank.TransferTransaction || lines[0].Counterparty != "0018989351" || lines[0].Balance.String() != "8.00" {
+		t.Errorf("unexpected transfer line: %+v", lines[0])
+	}
+	if lines[1].Type != bank.DepositTransaction || lines[1].Counterparty != "" || lines[1].Date.IsZero() {
+		t.Errorf("unexpected deposit line: %+v", lines[1])
+	}
+
+	min := bank.NewMoney(500, bank.DefaultCurrency)
+	lines, err = s.Transactions().History("0017286376", TransactionFilter{MinAmount: &min, Limit: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Type != bank.DepositTransaction {
+		t.Errorf("expected only the deposit, got %+v", lines)
+	}
+
+	balance, err := s.Transactions().BalanceBefore(account, time.Now().UTC().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.String() != "8.00" {
+		t.Errorf("expected a balance of 8.00 before now, got %s", balance)
+	}
+
+	// Times in other zones compare as the same instants
+	behind, ahead := time.FixedZone("UTC-12", -12*3600), time.FixedZone("UTC+14", 14*3600)
+	if balance, err := s.Transactions().BalanceBefore(account, time.Now().Add(time.Hour).In(behind)); err != nil || balance.String() != "8.00" {
+		t.Errorf("expected a balance of 8.00 before an hour from now in UTC-12, got %s %v", balance, err)
+	}
+	if lines, err := s.Transactions().History("0017286376", TransactionFilter{Since: time.Now().Add(-time.Hour).In(ahead)}); err != nil || len(lines) != 2 {
+		t.Errorf("expected the 2 lines since an hour ago in UTC+14, got %d %v", len(lines), err)
+	}
+}
+
+func TestStoreCustomers(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testCustomers(t, s) })
+	}
+}
+
+func testCustomers(t *testing.T, s Store) {
+	customer := &bank.Customer{Name: "Jane Doe", Email: "jane@example.com", Phone: "(213) 555 0147"}
+	id, err := s.Customers().InsertCustomer(customer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if customer.ID != id {
+		t.Errorf("expected the customer ID to be set to %d, got %d", id, customer.ID)
+	}
+
+	for _, a := range []*bank.Account{{Number: "0017286376"}, {Number: "0018989351", Type: bank.SavingsAccount}} {
+		if _, err := s.Accounts().InsertAccount(id, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	accounts, err := s.Accounts().AccountsByCustomer(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(accounts) != 2 || accounts[0].Type != bank.CurrentAccount || accounts[1].Type != bank.SavingsAccount || accounts[1].ID != id {
+		t.Errorf("unexpected accounts: %+v", accounts)
+	}
+
+	customer.Address = "Los Angeles, California"
+	if err := s.Customers().UpdateCustomer(customer); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Customers().GetCustomer(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *got != *customer {
+		t.Errorf("expected %+v, got %+v", customer, got)
+	}
+
+	other := &bank.Customer{Name: "Sam Song", Email: "sam@example.com"}
+	s.Customers().InsertCustomer(other)
+	other.Email = customer.Email
+	if err := s.Customers().UpdateCustomer(other); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a duplicate email error, got %v", err)
+	}
+
+	if _, err := s.Customers().GetCustomer(99); err != ErrCustomerNotFound {
+		t.Errorf("expected ErrCustomerNotFound, got %v", err)
+	}
+	if accounts, _ := s.Accounts().AccountsByCustomer(99); len(accounts) != 0 {
+		t.Errorf("expected no accounts, got %d", len(accounts))
+	}
+
+	if last, err := s.Accounts().LastAccountNumber("001"); err != nil || last != "0018989351" {
+		t.Errorf("expected 0018989351 to be the last number, got %q: %v", last, err)
+	}
+	if last, err := s.Accounts().LastAccountNumber("002"); err != nil || last != "" {
+		t.Errorf("expected no number in branch 002, got %q: %v", last, err)
+	}
+}
+
+func TestStoreStatus(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testStatus(t, s) })
+	}
+}
+
+func testStatus(t *testing.T, s Store) {
+	id, err := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &bank.Account{Number: "0017286376", Balance: bank.NewMoney(0, bank.DefaultCurrency)}
+	if _, err := s.Accounts().InsertAccount(id, account); err != nil {
+		t.Fatal(err)
+	}
+	if account.Status != bank.StatusActive {
+		t.Errorf("expected a new account to be active, got %q", account.Status)
+	}
+
+	for _, to := range []bank.AccountStatus{bank.StatusInactive, bank.StatusClosed} {
+		change, err := account.ChangeStatus(to, "customer request")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Accounts().UpdateStatus(account, change); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stored, err := s.Accounts().GetAccountByNumber(account.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != bank.StatusClosed {
+		t.Errorf("expected the account to be closed, got %q", stored.Status)
+	}
+
+	changes, err := s.Accounts().StatusChanges(account.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].From != bank.StatusActive || changes[1].To != bank.StatusClosed || changes[1].Reason != "customer request" || changes[1].CreatedAt.IsZero() {
+		t.Errorf("unexpected status changes: %+v", changes)
+	}
+
+	if err := s.Accounts().UpdateStatus(&bank.Account{Number: "0000000000"}, &changes[0]); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestStoreHoldsAndClosures(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testHoldsAndClosures(t, s) })
+	}
+}
+
+func testHoldsAndClosures(t *testing.T, s Store) {
+	id, err := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Accounts().InsertAccount(id, &bank.Account{Number: "0017286376", Balance: bank.NewMoney(10000, bank.DefaultCurrency)}); err != nil {
+		t.Fatal(err)
+	}
+
+	var holds []*bank.Hold
+	for _, amount := range []int64{2500, 1000} {
+		h := &bank.Hold{Account: "0017286376", Amount: bank.NewMoney(amount, bank.DefaultCurrency), Reason: "card payment"}
+		if err := s.Holds().InsertHold(h); err != nil {
+			t.Fatal(err)
+		}
+		holds = append(holds, h)
+	}
+	if err := s.Holds().ReleaseHold(holds[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Holds().ReleaseHold(holds[0]); !errors.Is(err, ErrHoldNotFound) {
+		t.Errorf("expected a released hold to be released once, got %v", err)
+	}
+
+	account, err := s.Accounts().GetAccountByNumber("0017286376")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if account.Held.Amount != 1000 || account.Available().Amount != 9000 {
+		t.Errorf("expected 10.00 held, got %s", account.Held)
+	}
+
+	pending, err := s.Holds().PendingHolds("0017286376")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || pending[0].ID != holds[1].ID || pending[0].Reason != "card payment" {
+		t.Errorf("unexpected pending holds: %+v", pending)
+	}
+	if _, err := s.Holds().PendingHold(holds[0].ID); err != ErrHoldNotFound {
+		t.Errorf("expected ErrHoldNotFound, got %v", err)
+	}
+
+	if _, err := s.Accounts().GetClosure("0017286376"); err != ErrClosureNotFound {
+		t.Errorf("expected ErrClosureNotFound, got %v", err)
+	}
+	closure := &bank.ClosingStatement{
+		Number:            "0017286376",
+		Reason:            "customer request",
+		TotalCredits:      bank.NewMoney(10000, bank.DefaultCurrency),
+		TotalDebits:       bank.NewMoney(10000, bank.DefaultCurrency),
+		FinalBalance:      bank.NewMoney(7500, bank.DefaultCurrency),
+		SettlementAccount: "0018989351",
+		SettlementID:      3,
+	}
+	if err := s.Accounts().InsertClosure(closure); err != nil {
+		t.Fatal(err)
+	}
+	got, err := s.Accounts().GetClosure("0017286376")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FinalBalance != closure.FinalBalance || got.SettlementAccount != closure.SettlementAccount || got.SettlementID != 3 || got.Reason != closure.Reason {
+		t.Errorf("expected %+v, got %+v", closure, got)
+	}
+	if err := s.Accounts().InsertClosure(closure); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected an account to be closed once, got %v", err)
+	}
+}
+
+func TestStoreCurrencies(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testCurrencies(t, s) })
+	}
+}
+
+func testCurrencies(t *testing.T, s Store) {
+	id, err := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, a := range []*bank.Account{
+		{Number: "0017286376", Balance: bank.NewMoney(0, "USD")},
+		{Number: "0018989351", Balance: bank.NewMoney(0, bank.DefaultCurrency)},
+	} {
+		if _, err := s.Accounts().InsertAccount(id, a); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rate, _ := bank.ParseRate("USD", "NGN", "1500")
+	err = s.Atomic(func(tx Store) error {
+		accounts, err := tx.Accounts().LockAccounts("0017286376", "0018989351")
+		if err != nil {
+			return err
+		}
+		usd, ngn := accounts["0017286376"], accounts["0018989351"]
+
+		ledger := bank.NewLedger(tx.Transactions()).WithRates(bank.NewStaticRates(rate))
+		if _, err := ledger.Deposit(usd, bank.NewMoney(10000, "")); err != nil {
+			return err
+		}
+		if _, err := ledger.Transfer(usd, ngn, bank.NewMoney(2000, "")); err != nil {
+			return err
+		}
+		if err := tx.Accounts().UpdateBalance(usd); err != nil {
+			return err
+		}
+		return tx.Accounts().UpdateBalance(ngn)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usd, err := s.Accounts().GetAccountByNumber("0017286376")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if usd.Balance != bank.NewMoney(8000, "USD") || usd.Held.Currency != "USD" {
+		t.Errorf("expected a USD account with 80.00, got %s %s", usd.Balance, usd.Balance.Currency)
+	}
+
+	entries, err := s.Transactions().Entries("0018989351")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Amount != bank.NewMoney(3000000, "NGN") || entries[0].Balance.Currency != "NGN" {
+		t.Errorf("expected the converted amount to be credited in NGN, got %+v", entries)
+	}
+
+	lines, err := s.Transactions().History("0017286376", TransactionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 2 || lines[0].Counterparty != "0018989351" || lines[0].Amount.Currency != "USD" || lines[1].Counterparty != "" {
+		t.Errorf("unexpected history: %+v", lines)
+	}
+	lines, err = s.Transactions().History("0018989351", TransactionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Counterparty != "0017286376" {
+		t.Errorf("unexpected history: %+v", lines)
+	}
+}
+
+func TestStoreOverdraft(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testOverdraft(t, s) })
+	}
+}
+
+func testOverdraft(t *testing.T, s Store) {
+	id, err := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	account := &bank.Account{Number: "0017286376", Balance: bank.NewMoney(0, "EUR")}
+	if _, err := s.Accounts().InsertAccount(id, account); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := account.SetOverdraft(bank.NewMoney(50000, "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Accounts().UpdateOverdraft(account); err != nil {
+		t.Fatal(err)
+	}
+	if err := account.Withdraw(bank.NewMoney(12550, "")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Accounts().UpdateBalance(account); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := s.Accounts().GetAccountByNumber(account.Number)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Overdraft != bank.NewMoney(50000, "EUR") || stored.Balance != bank.NewMoney(-12550, "EUR") {
+		t.Errorf("expected -125.50 EUR with a 500.00 overdraft, got %s with %s", stored.Balance, stored.Overdraft)
+	}
+
+	if err := s.Accounts().UpdateOverdraft(&bank.Account{Number: "0000000000"}); !errors.Is(err, ErrAccountNotFound) {
+		t.Errorf("expected ErrAccountNotFound, got %v", err)
+	}
+}
+
+func TestStoreInterest(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testInterest(t, s) })
+	}
+}
+
+func testInterest(t *testing.T, s Store) {
+	id, _ := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	if _, err := s.Accounts().InsertAccount(id, &bank.Account{Number: "0017286376", Type: bank.SavingsAccount, Balance: bank.NewMoney(100000, "USD")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Accounts().InsertAccount(id, &bank.Account{Number: "0012345678"}); err != nil {
+		t.Fatal(err)
+	}
+
+	savings, err := s.Accounts().AccountsByType(bank.SavingsAccount)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(savings) != 1 || savings[0].Number != "0017286376" {
+		t.Fatalf("expected the savings account alone, got %v", savings)
+	}
+
+	first, second := time.Date(2024, 5, 30, 0, 0, 0, 0, time.UTC), time.Date(2024, 5, 31, 0, 0, 0, 0, time.UTC)
+	for _, date := range []time.Time{first, second} {
+		accrual := &bank.Accrual{Account: "0017286376", Date: date, Balance: bank.NewMoney(100000, "USD"), Amount: 2750000}
+		if err := s.Interest().InsertAccrual(accrual); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := s.Interest().InsertAccrual(&bank.Accrual{Account: "0017286376", Date: second}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a second accrual for the day to be a duplicate, got %v", err)
+	}
+
+	if pending, err := s.Interest().PendingAccruals("0017286376", first); err != nil || len(pending) != 1 {
+		t.Errorf("expected one accrual up to %s, got %v %v", first, pending, err)
+	}
+
+	err = s.Atomic(func(tx Store) error {
+		accounts, err := tx.Accounts().LockAccounts("0017286376")
+		if err != nil {
+			return err
+		}
+		account := accounts["0017286376"]
+
+		pending, err := tx.Interest().PendingAccruals("0017286376", second)
+		if err != nil {
+			return err
+		}
+		if len(pending) != 2 || !pending[0].Date.Equal(first) || pending[1].Balance != bank.NewMoney(100000, "USD") {
+			t.Errorf("unexpected pending accruals %+v", pending)
+		}
+
+		transaction, err := bank.NewLedger(tx.Transactions()).Capitalize(account, pending)
+		if err != nil {
+			return err
+		}
+		if err := tx.Accounts().UpdateBalance(account); err != nil {
+			return err
+		}
+		return tx.Interest().MarkCapitalized(pending, transaction.ID)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending, err := s.Interest().PendingAccruals("0017286376", second); err != nil || len(pending) != 0 {
+		t.Errorf("expected the capitalized accruals to be done with, got %v %v", pending, err)
+	}
+	lines, err := s.Transactions().History("0017286376", TransactionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0].Type != bank.InterestTransaction || lines[0].Amount != bank.NewMoney(6, "USD") || lines[0].Counterparty != "" {
+		t.Errorf("expected 0.06 USD of interest with no counterparty, got %+v", lines)
+	}
+}
+
+func TestStoreFees(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testFees(t, s) })
+	}
+}
+
+func testFees(t *testing.T, s Store) {
+	id, _ := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	if _, err := s.Accounts().InsertAccount(id, &bank.Account{Number: "0017286376", Balance: bank.NewMoney(0, "NGN")}); err != nil {
+		t.Fatal(err)
+	}
+	fees, err := bank.NewFeeSchedule(
+		bank.FeeRule{Operation: bank.WithdrawalOperation, Tiers: []bank.FeeTier{{Flat: bank.NewMoney(100, "")}}},
+		bank.FeeRule{Operation: bank.MaintenanceOperation, Tiers: []bank.FeeTier{{Flat: bank.NewMoney(250, "")}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	month := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	err = s.Atomic(func(tx Store) error {
+		accounts, err := tx.Accounts().LockAccounts("0017286376")
+		if err != nil {
+			return err
+		}
+		account := accounts["0017286376"]
+
+		ledger := bank.NewLedger(tx.Transactions()).WithFees(fees)
+		if _, err := ledger.Deposit(account, bank.NewMoney(10000, "")); err != nil {
+			return err
+		}
+		if _, err := ledger.Withdraw(account, bank.NewMoney(1000, "")); err != nil {
+			return err
+		}
+		charge, err := ledger.ChargeMaintenance(account)
+		if err != nil {
+			return err
+		}
+		if err := tx.Fees().InsertMaintenanceFee(account.Number, month, charge.ID); err != nil {
+			return err
+		}
+		return tx.Accounts().UpdateBalance(account)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Fees().InsertMaintenanceFee("0017286376", month.AddDate(0, 0, 14), 99); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a second fee in the month to be a duplicate, got %v", err)
+	}
+
+	lines, err := s.Transactions().History("0017286376", TransactionFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 4 {
+		t.Fatalf("expected the deposit, the withdrawal, its fee and the maintenance fee, got %+v", lines)
+	}
+	if lines[0].Type != bank.FeeTransaction || lines[0].Amount.Amount != 250 || lines[0].Balance.Amount != 8650 {
+		t.Errorf("unexpected maintenance fee line %+v", lines[0])
+	}
+	if lines[1].Type != bank.WithdrawalTransaction || lines[1].Amount.Amount != 100 || lines[1].Counterparty != "" || lines[1].Balance.Amount != 8900 {
+		t.Errorf("unexpected withdrawal fee line %+v", lines[1])
+	}
+	if balance, err := bank.NewLedger(s.Transactions()).Balance(bank.FeeAccount); err != nil || balance.Amount != 350 {
+		t.Errorf("expected 3.50 of fee income, got %v %v", balance, err)
+	}
+}
+
+func TestStoreIdempotency(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testIdempotency(t, s) })
+	}
+}
+
+func testIdempotency(t *testing.T, s Store) {
+	now := time.Now().UTC().Truncate(time.Second)
+	r := &IdempotentRequest{Key: "4f1c7c62", Fingerprint: "abc123", ExpiresAt: now.Add(time.Hour)}
+	if err := s.Idempotency().InsertRequest(r); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Idempotency().InsertRequest(&IdempotentRequest{Key: r.Key, Fingerprint: "def456", ExpiresAt: now.Add(time.Hour)}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a reused key to be a duplicate, got %v", err)
+	}
+
+	pending, err := s.Idempotency().GetRequest(r.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pending.Done() || pending.Fingerprint != "abc123" || !pending.ExpiresAt.Equal(r.ExpiresAt) {
+		t.Errorf("expected a pending request, got %+v", pending)
+	}
+
+	r.Status, r.ContentType, r.Location, r.Body = 201, "application/json", "/v1/customers/1", []byte(`{"id":1}`)
+	if err := s.Idempotency().SaveResponse(r); err != nil {
+		t.Fatal(err)
+	}
+	done, err := s.Idempotency().GetRequest(r.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !done.Done() || done.Status != 201 || done.ContentType != "application/json" || done.Location != "/v1/customers/1" || string(done.Body) != `{"id":1}` {
+		t.Errorf("expected the stored response, got %+v", done)
+	}
+
+	// Expired keys are removed, the others kept
+	if err := s.Idempotency().InsertRequest(&IdempotentRequest{Key: "expired", Fingerprint: "abc123", ExpiresAt: now.Add(-time.Minute)}); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.Idempotency().DeleteExpired(now); err != nil || n != 1 {
+		t.Errorf("expected one expired request deleted, got %d %v", n, err)
+	}
+	if _, err := s.Idempotency().GetRequest("expired"); !errors.Is(err, ErrRequestNotFound) {
+		t.Errorf("expected the expired request to be gone, got %v", err)
+	}
+
+	if err := s.Idempotency().DeleteRequest(r.Key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Idempotency().GetRequest(r.Key); !errors.Is(err, ErrRequestNotFound) {
+		t.Errorf("expected the deleted request to be gone, got %v", err)
+	}
+	if err := s.Idempotency().SaveResponse(r); !errors.Is(err, ErrRequestNotFound) {
+		t.Errorf("expected no request to save the response of, got %v", err)
+	}
+}
+
+func TestStoreAuth(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testAuth(t, s) })
+	}
+}
+
+func testAuth(t *testing.T, s Store) {
+	k := &APIKey{Name: "back-office", Hash: "5e884898da28047151d0e56f8dc6292773603d0d6aabbdd62a11ef721d1542d8", Role: bank.RoleTeller}
+	if err := s.Auth().InsertAPIKey(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Auth().InsertAPIKey(&APIKey{Name: "back-office", Hash: "other"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected a second key with the same name to be a duplicate, got %v", err)
+	}
+	found, err := s.Auth().APIKeyByHash(k.Hash)
+	if err != nil || found.ID != k.ID || found.Name != "back-office" || found.Role != bank.RoleTeller {
+		t.Errorf("expected the key, got %+v %v", found, err)
+	}
+	if _, err := s.Auth().APIKeyByHash("unknown"); !errors.Is(err, ErrAPIKeyNotFound) {
+		t.Errorf("expected no key, got %v", err)
+	}
+
+	jane, _ := s.Customers().InsertCustomer(&bank.Customer{Name: "Jane Doe", Email: "jane@example.com"})
+	sam, _ := s.Customers().InsertCustomer(&bank.Customer{Name: "Sam Song", Email: "sam@example.com"})
+	if err := s.Auth().SaveLogin(&Login{CustomerID: jane, Username: "jane", PasswordHash: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Auth().SaveLogin(&Login{CustomerID: jane, Username: "janedoe", PasswordHash: "second"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Auth().SaveLogin(&Login{CustomerID: sam, Username: "janedoe", PasswordHash: "third"}); !errors.Is(err, ErrDuplicate) {
+		t.Errorf("expected another customer's username to be a duplicate, got %v", err)
+	}
+
+	login, err := s.Auth().LoginByUsername("janedoe")
+	if err != nil || login.CustomerID != jane || login.PasswordHash != "second" {
+		t.Errorf("expected Jane's new login, got %+v %v", login, err)
+	}
+	if _, err := s.Auth().LoginByUsername("jane"); !errors.Is(err, ErrLoginNotFound) {
+		t.Errorf("expected the old username to be gone, got %v", err)
+	}
+
+	// Roles start with the default permissions
+	for _, role := range bank.Roles {
+		permissions, err := s.Auth().RolePermissions(role)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := map[bank.Permission]bool{}
+		for _, p := range permissions {
+			got[p] = true
+		}
+		want := bank.DefaultPermissions[role]
+		for _, p := range want {
+			if !got[p] {
+				t.Errorf("%s: expected permission %q", role, p)
+			}
+		}
+		if len(permissions) != len(want) {
+			t.Errorf("%s: expected the permissions %v, got %v", role, want, permissions)
+		}
+	}
+	if permissions, err := s.Auth().RolePermissions("superuser"); err != nil || len(permissions) != 0 {
+		t.Errorf("expected an unknown role to have no permissions, got %v %v", permissions, err)
+	}
+}
+
+func TestStoreApprovals(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testApprovals(t, s) })
+	}
+}
+
+func testApprovals(t *testing.T, s Store) {
+	transfer := &bank.PendingOperation{Type: bank.TransferTransaction, Account: "0017286376", To: "0018989350", Amount: bank.NewMoney(5000000, "NGN"), Status: bank.OperationPending, RequestedBy: "customer:1"}
+	deposit := &bank.PendingOperation{Type: bank.DepositTransaction, Account: "0017286376", Amount: bank.NewMoney(900000, "USD"), Note: "Sale of a car", Status: bank.OperationPending, RequestedBy: "key:counter"}
+	for _, o := range []*bank.PendingOperation{transfer, deposit} {
+		if err := s.Approvals().InsertOperation(o); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	found, err := s.Approvals().GetOperation(transfer.ID)
+	if err != nil || found.To != "0018989350" || found.Amount != transfer.Amount || found.Status != bank.OperationPending || found.RequestedAt.IsZero() || !found.DecidedAt.IsZero() {
+		t.Errorf("expected the transfer, got %+v %v", found, err)
+	}
+	if _, err := s.Approvals().GetOperation(99); !errors.Is(err, ErrOperationNotFound) {
+		t.Errorf("expected no operation, got %v", err)
+	}
+
+	decidedAt := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	if err := found.Decide("key:approver", true, "Known customer", decidedAt); err != nil {
+		t.Fatal(err)
+	}
+	found.Transaction = 7
+	if err := s.Approvals().DecideOperation(found); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Approvals().DecideOperation(found); !errors.Is(err, bank.ErrNotPending) {
+		t.Errorf("expected a decided operation not to be decided again, got %v", err)
+	}
+
+	decided, _ := s.Approvals().GetOperation(transfer.ID)
+	if decided.Status != bank.OperationApproved || decided.DecidedBy != "key:approver" || !decided.DecidedAt.Equal(decidedAt) || decided.Reason != "Known customer" || decided.Transaction != 7 {
+		t.Errorf("expected the decision to be stored, got %+v", decided)
+	}
+
+	pending, err := s.Approvals().Operations(bank.OperationPending)
+	if err != nil || len(pending) != 1 || pending[0].ID != deposit.ID || pending[0].To != "" || pending[0].Note != "Sale of a car" {
+		t.Errorf("expected the deposit to be pending, got %v %v", pending, err)
+	}
+	if all, err := s.Approvals().Operations(""); err != nil || len(all) != 2 || all[0].ID != transfer.ID {
+		t.Errorf("expected every operation, oldest first, got %v %v", all, err)
+	}
+}
+
+func TestStoreAudit(t *testing.T) {
+	for driver, s := range testStores(t) {
+		t.Run(driver, func(t *testing.T) { testAudit(t, s) })
+	}
+}
+
+func testAudit(t *testing.T, s Store) {
+	at := time.Date(2024, 3, 1, 12, 0, 0, 500, time.UTC)
+	entries := []*AuditEntry{
+		{Actor: "key:counter", Action: "POST /v1/customers", Target: "customer:1", After: `{"id":1}`, RequestID: "a", Status: 201, CreatedAt: at},
+		{Actor: "key:counter", Action: "POST /v1/accounts/{number}/deposits", Target: "account:0017286376", Account: "0017286376", Before: `{"balance":0}`, After: `{"balance":10}`, RequestID: "b", Status: 201, CreatedAt: at.Add(time.Hour)},
+		{Actor: "customer:1", Action: "PUT /v1/customers/{id}", Target: "customer:1", Before: `{"id":1}`, After: `{"id":1,"address":"Lagos"}`, RequestID: "c", Status: 200},
+	}
+	for _, e := range entries {
+		if err := s.Audit().AppendEntry(e); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if entries[0].PrevHash != "" || entries[1].PrevHash != entries[0].Hash || entries[2].PrevHash != entries[1].Hash || entries[2].CreatedAt.IsZero() {
+		t.Errorf("expected the entries to be chained, got %+v", entries)
+	}
+
+	stored, err := s.Audit().AuditEntries(AuditFilter{})
+	if err != nil || len(stored) != 3 || stored[0].ID != entries[0].ID || !stored[0].CreatedAt.Equal(at.Truncate(time.Second)) || stored[1].Before != `{"balance":0}` {
+		t.Fatalf("expected every entry, oldest first, got %v %v", stored, err)
+	}
+	if err := VerifyAuditChain(stored); err != nil {
+		t.Errorf("expected the chain to hold, got %v", err)
+	}
+
+	tests := []struct {
+		filter AuditFilter
+		ids    []int64
+	}{
+		{AuditFilter{Actor: "key:counter"}, []int64{entries[0].ID, entries[1].ID}},
+		{AuditFilter{Account: "0017286376"}, []int64{entries[1].ID}},
+		{AuditFilter{Target: "customer:1"}, []int64{entries[0].ID, entries[2].ID}},
+		{AuditFilter{Since: at.Add(time.Minute), Until: at.Add(2 * time.Hour)}, []int64{entries[1].ID}},
+		{AuditFilter{Limit: 1}, []int64{entries[0].ID}},
+		{AuditFilter{After: entries[0].ID, Limit: 1}, []int64{entries[1].ID}},
+	}
+	for _, tt := range tests {
+		found, err := s.Audit().AuditEntries(tt.filter)
+		if err != nil || len(found) != len(tt.ids) {
+			t.Errorf("%+v: expected entries %v, got %v %v", tt.filter, tt.ids, found, err)
+			continue
+		}
+		for i, e := range found {
+			if e.ID != tt.ids[i] {
+				t.Errorf("%+v: expected entries %v, got entry %d", tt.filter, tt.ids, e.ID)
+			}
+		}
+	}
+
+	// Altering, removing or inserting an entry breaks the chain
+	altered := *stored[1]
+	altered.After = `{"balance":1000}`
+	if err := VerifyAuditChain([]*AuditEntry{stored[0], &altered, stored[2]}); !errors.Is(err, ErrBrokenChain) {
+		t.Errorf("expected an altered entry to be detected, got %v", err)
+	}
+	if err := VerifyAuditChain([]*AuditEntry{stored[0], stored[2]}); !errors.Is(err, ErrBrokenChain) {
+		t.Errorf("expected a removed entry to be detected, got %v", err)
+	}
+	altered.Hash = altered.Sum()
+	if err := VerifyAuditChain([]*AuditEntry{stored[0], &altered, stored[2]}); !errors.Is(err, ErrBrokenChain) {
+		t.Errorf("expected a rehashed entry to be detected, got %v", err)
+	}
+}